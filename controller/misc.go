@@ -116,6 +116,8 @@ func GetStatus(c *gin.Context) {
 		"user_agreement_enabled":      legalSetting.UserAgreement != "",
 		"privacy_policy_enabled":      legalSetting.PrivacyPolicy != "",
 		"checkin_enabled":             operation_setting.GetCheckinSetting().Enabled,
+		"proxy_detect_user_enabled":   system_setting.GetProxyDetectSetting().UserEnabled,
+		"proxy_detect_max_models":     system_setting.GetProxyDetectSetting().ModelLimit(),
 		"_qn":                         "new-api",
 	}
 
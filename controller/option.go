@@ -232,6 +232,141 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "proxy_detect_setting.probe_prompts":
+		err = system_setting.ValidateProbePrompts(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.scoring_weights":
+		_, err = system_setting.ParseScoringWeights(option.Value.(string), system_setting.DefaultScoringWeights)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.timeouts":
+		_, err = system_setting.ParseDetectTimeouts(option.Value.(string), system_setting.DefaultDetectTimeouts)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.thinking_sig_check":
+		_, err = system_setting.ParseThinkingSigCheck(option.Value.(string), system_setting.DefaultThinkingSigCheck)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.max_models":
+		err = system_setting.ValidateMaxModels(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.max_response_body_kb":
+		err = system_setting.ValidateMaxResponseBodyKB(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.scheduled_detect_interval_hours":
+		err = system_setting.ValidateScheduledDetectIntervalHours(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.scheduled_detect_concurrency":
+		err = system_setting.ValidateScheduledDetectConcurrency(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.min_confidence":
+		err = system_setting.ValidateMinConfidence(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.scan_models":
+		err = system_setting.ValidateScanModels(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.model_aliases":
+		err = system_setting.ValidateModelAliases(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.target_host_allowlist", "proxy_detect_setting.target_host_denylist":
+		err = system_setting.ValidateTargetHostList(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "proxy_detect_setting.metadata_denylist":
+		err = system_setting.ValidateMetadataDenylist(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "subscription_webhook_setting.url":
+		err = operation_setting.ValidateSubscriptionWebhookURL(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "subscription_webhook_setting.max_retries":
+		err = operation_setting.ValidateSubscriptionWebhookMaxRetries(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "console_setting.uptime_kuma_groups":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "UptimeKumaGroups")
 		if err != nil {
@@ -1,9 +1,17 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
@@ -11,16 +19,129 @@ import (
 )
 
 type ProxyDetectRequest struct {
-	BaseURL         string   `json:"base_url"`
-	APIKey          string   `json:"api_key"`
-	Models          []string `json:"models"`
-	Rounds          int      `json:"rounds"`
-	VerifyRatelimit bool     `json:"verify_ratelimit"`
+	BaseURL          string   `json:"base_url"`
+	APIKey           string   `json:"api_key"`
+	Models           []string `json:"models"`
+	Rounds           int      `json:"rounds"`
+	VerifyRatelimit  bool     `json:"verify_ratelimit"`
+	TraceID          string   `json:"trace_id"`
+	Preset           string   `json:"preset"`
+	AnthropicVersion string   `json:"anthropic_version"`
+	CheckVersions    bool     `json:"check_versions"`
+	MessagesPath     string   `json:"messages_path"`
+	// 同时进行的 tool 探测数，默认 1（串行）
+	Concurrency int `json:"concurrency"`
+	// 记录目标的 TLS 证书（签发者、SAN）
+	CaptureTLS bool `json:"capture_tls"`
+	// 忽略缓存的检测结果，重新探测
+	Force bool `json:"force"`
+	// 探测经由的出站代理（http/https/socks5），仅管理员可用
+	OutboundProxy string `json:"outbound_proxy"`
+	// 按探测类型覆盖本次检测的提示词，仅替换用户消息，保留工具、thinking 等请求结构
+	CustomPrompts map[string]string `json:"custom_prompts"`
+	// 在每个探测指纹中附带原始响应（已脱敏、限长），仅管理员可用，用于排查误判
+	IncludeRaw bool `json:"include_raw"`
+	// 仅运行这些探测（tool/thinking/simple/stream/vision/cache），为空时按预设运行
+	Probes []string `json:"probes"`
+	// 附加到每个探测请求的请求头，用于按请求头路由的渠道；默认不能覆盖鉴权与版本头
+	ExtraHeaders map[string]string `json:"extra_headers"`
+	// 允许附加请求头覆盖 x-api-key、authorization 等核心请求头
+	OverrideCoreHeaders bool `json:"override_core_headers"`
+}
+
+type ProxyDetectHealthRequest struct {
+	BaseURL          string `json:"base_url"`
+	APIKey           string `json:"api_key"`
+	Model            string `json:"model"`
+	Rounds           int    `json:"rounds"`
+	AnthropicVersion string `json:"anthropic_version"`
+	IncludeDetect    *bool  `json:"include_detect"`
+	IncludeRatelimit *bool  `json:"include_ratelimit"`
+	IncludeModels    *bool  `json:"include_models"`
+	MessagesPath     string `json:"messages_path"`
+}
+
+type ProxyDetectAnalyzeRequest struct {
+	// 已保存的探测指纹（如检测结果中的 fingerprints）
+	Fingerprints []service.Fingerprint `json:"fingerprints"`
+	Model        string                `json:"model"`
+	// 试算用的计分权重，未出现的字段沿用当前配置，不会保存
+	ScoringWeights json.RawMessage `json:"scoring_weights"`
 }
 
 type ProxyDetectModelsRequest struct {
 	BaseURL string `json:"base_url"`
 	APIKey  string `json:"api_key"`
+	// 模型过滤：空为仅 Claude，"all" 为全部，"re:<正则>" 为正则，其它为子串匹配
+	Filter string `json:"filter"`
+}
+
+// proxyDetectMessagesEn translates the messages of the detection endpoints for ?lang=en
+var proxyDetectMessagesEn = map[string]string{
+	"中转检测功能已被管理员关闭":          "Proxy detection has been disabled by the administrator",
+	"API Key 不能为空":           "API key is required",
+	"请选择要检测的模型":              "Select the models to detect",
+	"不支持的 anthropic-version": "Unsupported anthropic-version",
+	"无效的目标地址":                "Invalid target URL",
+	"目标主机不允许检测":              "The target host is not allowed for detection",
+	"仅管理员可自定义 messages 路径":   "Only administrators may customize the messages path",
+	"无效的 messages 路径: ":      "Invalid messages path: ",
+	"无效的自定义提示词: ":            "Invalid custom prompts: ",
+	"无效的探测类型: ":              "Invalid probe types: ",
+	"无效的附加请求头: ":             "Invalid extra headers: ",
+	"模型过滤条件无效: ":             "Invalid model filter: ",
+	"获取模型列表失败: ":             "Failed to fetch the model list: ",
+	"不支持的导出格式":               "Unsupported export format",
+	"仅管理员可使用出站代理":            "Only administrators may use an outbound proxy",
+	"无效的出站代理: ":              "Invalid outbound proxy: ",
+	"仅管理员可查看原始响应":            "Only administrators may include raw responses",
+	"无效的指纹: ":                "Invalid fingerprints: ",
+	"检测模型数超过上限: ":            "Too many models for one detection: ",
+	"请添加要检测的目标":              "Add the targets to detect",
+	"批量检测目标数超过上限: ":          "Too many targets for one batch detection: ",
+}
+
+// proxyDetectMsg returns msg in the language selected by the lang query parameter (Chinese by default)
+func proxyDetectMsg(c *gin.Context, msg string) string {
+	if service.NormalizeDetectLang(c.Query("lang")) == service.DetectLangEn {
+		if en, ok := proxyDetectMessagesEn[msg]; ok {
+			return en
+		}
+	}
+	return msg
+}
+
+// respondProxyDetectScan writes the scan result: the usual API envelope without a format
+// query parameter, otherwise a json or csv file download
+func respondProxyDetectScan(c *gin.Context, format string, scan service.ScanResult) {
+	switch format {
+	case "":
+		common.ApiSuccess(c, scan)
+	case service.ScanExportJSON:
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="proxy-detect-%s.json"`, scan.TraceID))
+		c.JSON(http.StatusOK, scan)
+	case service.ScanExportCSV:
+		var buf bytes.Buffer
+		if err := service.WriteScanResultCSV(&buf, scan); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="proxy-detect-%s.csv"`, scan.TraceID))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
+
+// checkProxyDetectEnabled rejects non-admin callers when user access is disabled.
+// Returns false (and writes the response) if the caller may not proceed.
+func checkProxyDetectEnabled(c *gin.Context) bool {
+	if c.GetInt("role") >= common.RoleAdminUser || system_setting.GetProxyDetectSetting().UserEnabled {
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": proxyDetectMsg(c, "中转检测功能已被管理员关闭"),
+	})
+	return false
 }
 
 // resolveProxyDetectBaseURL applies admin/non-admin logic and validates the URL.
@@ -36,13 +157,168 @@ func resolveProxyDetectBaseURL(c *gin.Context, baseURL string) (string, bool, st
 		baseURL = system_setting.ServerAddress
 	}
 
-	if err := service.ValidateProxyDetectURL(baseURL); err != nil {
+	if err := service.ValidateProxyDetectURL(baseURL, true); err != nil {
 		return "", isAdmin, "无效的目标地址"
 	}
+	if err := service.ValidateProxyDetectURL(baseURL, isAdmin); err != nil {
+		return "", isAdmin, "目标主机不允许检测"
+	}
 	return baseURL, isAdmin, ""
 }
 
+// recordProxyDetectAudit writes who ran which detection; the API key is never stored
+func recordProxyDetectAudit(c *gin.Context, baseURL string, models []string, result service.ScanResult) {
+	if !system_setting.GetProxyDetectSetting().AuditEnabled {
+		return
+	}
+	audit := &model.ProxyDetectAudit{
+		UserId:      c.GetInt("id"),
+		Username:    c.GetString("username"),
+		Role:        c.GetInt("role"),
+		BaseURLHash: model.HashProxyDetectTarget(baseURL),
+		Models:      strings.Join(models, ","),
+		Verdict:     model.SummarizeProxyDetectVerdicts(result.Summary),
+		Summary:     common.GetJsonString(result.Summary),
+		TraceID:     result.TraceID,
+	}
+	if err := audit.Insert(); err != nil {
+		common.SysLog("failed to record proxy detect audit: " + err.Error())
+	}
+}
+
+// GetProxyDetectHistory pages the persisted detection results, filtered by base_url and model
+func GetProxyDetectHistory(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	baseURLHash := ""
+	if baseURL := strings.TrimSpace(c.Query("base_url")); baseURL != "" {
+		baseURLHash = model.HashProxyDetectTarget(baseURL)
+	}
+	logs, total, err := model.GetProxyDetectLogs(baseURLHash, c.Query("model"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetProxyDetectTimeline returns the verdict/confidence history of one base URL as per-model series.
+// Supports model, start_timestamp, end_timestamp and max_points (default 100, at most 500 per series).
+func GetProxyDetectTimeline(c *gin.Context) {
+	baseURL := strings.TrimSpace(c.Query("base_url"))
+	if baseURL == "" {
+		common.ApiErrorMsg(c, "base_url 不能为空")
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	maxPoints, _ := strconv.Atoi(c.Query("max_points"))
+	if maxPoints <= 0 {
+		maxPoints = 100
+	}
+	maxPoints = min(maxPoints, 500)
+
+	logs, err := model.GetProxyDetectLogsForTimeline(model.HashProxyDetectTarget(baseURL), c.Query("model"), startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"base_url":   baseURL,
+		"total_runs": len(logs),
+		"series":     model.BuildProxyDetectTimeline(logs, maxPoints),
+	})
+}
+
+// GetProxyDetectAudits lists detection audit records, filterable by user_id and time range
+func GetProxyDetectAudits(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	audits, total, err := model.GetProxyDetectAudits(userId, startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(audits)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// checkProxyDetectProbeOptions validates the custom prompts and probe selection shared by
+// ProxyDetect and ProxyDetectEstimate. Returns false (and writes the response) if the request
+// must be rejected.
+func checkProxyDetectProbeOptions(c *gin.Context, req *ProxyDetectRequest) bool {
+	if err := service.ValidateCustomPrompts(req.CustomPrompts); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的自定义提示词: ") + err.Error(),
+		})
+		return false
+	}
+	if err := service.ValidateProbeSelection(req.Probes); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的探测类型: ") + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// checkProxyDetectMessagesPath validates the messages_path override, which only admins may set.
+// Returns false (and writes the response) if the request must be rejected.
+func checkProxyDetectMessagesPath(c *gin.Context, path string, isAdmin bool) bool {
+	if path == "" {
+		return true
+	}
+	if !isAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "仅管理员可自定义 messages 路径"),
+		})
+		return false
+	}
+	if err := service.ValidateMessagesPath(path); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的 messages 路径: ") + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// checkProxyDetectOutboundProxy validates the outbound_proxy option, which only admins may set.
+// Returns false (and writes the response) if the request must be rejected.
+func checkProxyDetectOutboundProxy(c *gin.Context, proxyURL string, isAdmin bool) bool {
+	if proxyURL == "" {
+		return true
+	}
+	if !isAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "仅管理员可使用出站代理"),
+		})
+		return false
+	}
+	if _, err := service.ParseOutboundProxy(proxyURL); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的出站代理: ") + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
 func ProxyDetectListModels(c *gin.Context) {
+	if !checkProxyDetectEnabled(c) {
+		return
+	}
+
 	var req ProxyDetectModelsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		common.ApiError(c, err)
@@ -52,7 +328,16 @@ func ProxyDetectListModels(c *gin.Context) {
 	if req.APIKey == "" {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "API Key 不能为空",
+			"message": proxyDetectMsg(c, "API Key 不能为空"),
+		})
+		return
+	}
+
+	filter, err := service.ParseModelFilter(req.Filter)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "模型过滤条件无效: ") + err.Error(),
 		})
 		return
 	}
@@ -61,16 +346,16 @@ func ProxyDetectListModels(c *gin.Context) {
 	if errMsg != "" {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": errMsg,
+			"message": proxyDetectMsg(c, errMsg),
 		})
 		return
 	}
 
-	models, err := service.FetchRemoteModels(baseURL, req.APIKey, isAdmin)
+	models, err := service.FetchRemoteModels(baseURL, req.APIKey, isAdmin, filter)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "获取模型列表失败: " + err.Error(),
+			"message": proxyDetectMsg(c, "获取模型列表失败: ") + err.Error(),
 		})
 		return
 	}
@@ -78,7 +363,68 @@ func ProxyDetectListModels(c *gin.Context) {
 	common.ApiSuccess(c, models)
 }
 
+// checkProxyDetectModelCount rejects a run over the configured model limit instead of
+// silently dropping models. Returns false (and writes the response) if the request must be rejected.
+func checkProxyDetectModelCount(c *gin.Context, models []string) bool {
+	limit := system_setting.GetProxyDetectSetting().ModelLimit()
+	if len(models) <= limit {
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": proxyDetectMsg(c, "检测模型数超过上限: ") + fmt.Sprintf("%d > %d", len(models), limit),
+	})
+	return false
+}
+
+// clampProxyDetectRequest applies the rounds limits of a detection run
+func clampProxyDetectRequest(req *ProxyDetectRequest) {
+	req.Rounds = service.ClampDetectRounds(req.Rounds)
+}
+
+// ProxyDetectEstimate returns the requests and tokens the same ProxyDetect request would
+// spend, without sending anything upstream
+func ProxyDetectEstimate(c *gin.Context) {
+	if !checkProxyDetectEnabled(c) {
+		return
+	}
+
+	var req ProxyDetectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	if len(req.Models) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "请选择要检测的模型"),
+		})
+		return
+	}
+
+	if !checkProxyDetectModelCount(c, req.Models) {
+		return
+	}
+	if !checkProxyDetectProbeOptions(c, &req) {
+		return
+	}
+	clampProxyDetectRequest(&req)
+	common.ApiSuccess(c, service.EstimateDetection(req.Models, service.DetectOptions{
+		Rounds:          req.Rounds,
+		VerifyRatelimit: req.VerifyRatelimit,
+		Preset:          req.Preset,
+		CheckVersions:   req.CheckVersions,
+		CustomPrompts:   req.CustomPrompts,
+		Probes:          req.Probes,
+	}))
+}
+
 func ProxyDetect(c *gin.Context) {
+	if !checkProxyDetectEnabled(c) {
+		return
+	}
+
 	var req ProxyDetectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		common.ApiError(c, err)
@@ -88,7 +434,7 @@ func ProxyDetect(c *gin.Context) {
 	if req.APIKey == "" {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "API Key 不能为空",
+			"message": proxyDetectMsg(c, "API Key 不能为空"),
 		})
 		return
 	}
@@ -96,46 +442,429 @@ func ProxyDetect(c *gin.Context) {
 	if len(req.Models) == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "请选择要检测的模型",
+			"message": proxyDetectMsg(c, "请选择要检测的模型"),
 		})
 		return
 	}
 
-	if len(req.Models) > 6 {
-		req.Models = req.Models[:6]
+	if !checkProxyDetectModelCount(c, req.Models) {
+		return
 	}
+	clampProxyDetectRequest(&req)
 
-	if req.Rounds <= 0 {
-		req.Rounds = 2
+	format := c.Query("format")
+	if format != "" && format != service.ScanExportJSON && format != service.ScanExportCSV {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "不支持的导出格式"),
+		})
+		return
 	}
-	if req.Rounds > 3 {
-		req.Rounds = 3
+
+	if req.AnthropicVersion != "" && !service.IsKnownAnthropicVersion(req.AnthropicVersion) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "不支持的 anthropic-version"),
+		})
+		return
 	}
 
 	baseURL, isAdmin, errMsg := resolveProxyDetectBaseURL(c, req.BaseURL)
 	if errMsg != "" {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": errMsg,
+			"message": proxyDetectMsg(c, errMsg),
+		})
+		return
+	}
+
+	if !checkProxyDetectMessagesPath(c, req.MessagesPath, isAdmin) {
+		return
+	}
+	if !checkProxyDetectOutboundProxy(c, req.OutboundProxy, isAdmin) {
+		return
+	}
+	if !checkProxyDetectProbeOptions(c, &req) {
+		return
+	}
+	if err := service.ValidateExtraHeaders(req.ExtraHeaders, req.OverrideCoreHeaders); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的附加请求头: ") + err.Error(),
 		})
 		return
 	}
+	if req.IncludeRaw && !isAdmin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "仅管理员可查看原始响应"),
+		})
+		return
+	}
+
+	opts := service.DetectOptions{
+		Rounds:              req.Rounds,
+		SkipSSRFCheck:       isAdmin,
+		VerifyRatelimit:     req.VerifyRatelimit,
+		TraceID:             req.TraceID,
+		Preset:              req.Preset,
+		AnthropicVersion:    req.AnthropicVersion,
+		CheckVersions:       req.CheckVersions,
+		MessagesPath:        req.MessagesPath,
+		Concurrency:         req.Concurrency,
+		PersistResult:       true,
+		Lang:                c.Query("lang"),
+		CaptureTLS:          req.CaptureTLS,
+		Force:               req.Force,
+		OutboundProxy:       req.OutboundProxy,
+		CustomPrompts:       req.CustomPrompts,
+		IncludeRaw:          req.IncludeRaw,
+		Probes:              req.Probes,
+		ExtraHeaders:        req.ExtraHeaders,
+		OverrideCoreHeaders: req.OverrideCoreHeaders,
+	}
 
 	if len(req.Models) == 1 {
 		// Single model: use DetectSingleModel with ratelimit verification support
-		detectResult := service.DetectSingleModel(baseURL, req.APIKey, req.Models[0], req.Rounds, isAdmin, req.VerifyRatelimit)
+		detectResult := service.DetectSingleModel(baseURL, req.APIKey, req.Models[0], opts)
 		// Wrap in ScanResult for uniform response format
 		scanResult := service.ScanResult{
-			BaseURL:       baseURL,
-			ProxyPlatform: detectResult.ProxyPlatform,
-			ModelResults:  []service.DetectResult{detectResult},
-			Summary:       map[string]string{detectResult.Model: detectResult.Verdict},
-			IsMixed:       false,
+			BaseURL:        baseURL,
+			ProxyPlatform:  detectResult.ProxyPlatform,
+			ModelResults:   []service.DetectResult{detectResult},
+			Summary:        map[string]string{detectResult.Model: detectResult.Verdict},
+			IsMixed:        false,
+			ChannelVerdict: service.AggregateChannelVerdict([]service.DetectResult{detectResult}),
+			TraceID:        detectResult.TraceID,
+			TokenUsage:     detectResult.TokenUsage,
 		}
-		common.ApiSuccess(c, scanResult)
+		recordProxyDetectAudit(c, baseURL, req.Models, scanResult)
+		respondProxyDetectScan(c, format, scanResult)
 	} else {
 		// Multiple models: use ScanMultipleModels
-		result := service.ScanMultipleModels(baseURL, req.APIKey, req.Models, req.Rounds, isAdmin)
-		common.ApiSuccess(c, result)
+		result := service.ScanMultipleModels(baseURL, req.APIKey, req.Models, opts)
+		recordProxyDetectAudit(c, baseURL, req.Models, result)
+		respondProxyDetectScan(c, format, result)
+	}
+}
+
+// ProxyDetectAccountHealth returns a combined verdict / ratelimit / models / latency report.
+// Each include_* flag defaults to true.
+func ProxyDetectAccountHealth(c *gin.Context) {
+	if !checkProxyDetectEnabled(c) {
+		return
+	}
+
+	var req ProxyDetectHealthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	if req.APIKey == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "API Key 不能为空"),
+		})
+		return
+	}
+
+	if req.AnthropicVersion != "" && !service.IsKnownAnthropicVersion(req.AnthropicVersion) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "不支持的 anthropic-version"),
+		})
+		return
+	}
+
+	req.Rounds = service.ClampDetectRounds(req.Rounds)
+
+	baseURL, isAdmin, errMsg := resolveProxyDetectBaseURL(c, req.BaseURL)
+	if errMsg != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, errMsg),
+		})
+		return
+	}
+
+	if !checkProxyDetectMessagesPath(c, req.MessagesPath, isAdmin) {
+		return
+	}
+
+	report := service.BuildAccountHealthReport(baseURL, req.APIKey, service.AccountHealthOptions{
+		DetectOptions: service.DetectOptions{
+			Rounds:           req.Rounds,
+			SkipSSRFCheck:    isAdmin,
+			AnthropicVersion: req.AnthropicVersion,
+			MessagesPath:     req.MessagesPath,
+		},
+		Model:            req.Model,
+		IncludeDetect:    req.IncludeDetect == nil || *req.IncludeDetect,
+		IncludeRatelimit: req.IncludeRatelimit == nil || *req.IncludeRatelimit,
+		IncludeModels:    req.IncludeModels == nil || *req.IncludeModels,
+	})
+	common.ApiSuccess(c, report)
+}
+
+// GetProxyDetectAvailabilityCache returns the warmed model availability and freshness per channel
+func GetProxyDetectAvailabilityCache(c *gin.Context) {
+	common.ApiSuccess(c, service.ListCachedChannelAvailability())
+}
+
+// GetProxyDetectMetrics serves the detection metrics for a Prometheus scraper
+func GetProxyDetectMetrics(c *gin.Context) {
+	service.ProxyDetectMetricsHandler().ServeHTTP(c.Writer, c.Request)
+}
+
+type ProxyDetectChannelsRequest struct {
+	// 要检测的渠道 ID，与 tag 均为空时检测全部 Anthropic 渠道
+	ChannelIds []int  `json:"channel_ids"`
+	Tag        string `json:"tag"`
+	Rounds     int    `json:"rounds"`
+	Preset     string `json:"preset"`
+	// 显式开启后才会按 channel_auto_disable_verdicts 自动禁用渠道
+	AutoDisable bool `json:"auto_disable"`
+}
+
+// ProxyDetectChannels detects channels in bulk, stores each verdict on the channel and
+// optionally auto-disables channels with a configured verdict
+func ProxyDetectChannels(c *gin.Context) {
+	var req ProxyDetectChannelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// DetectChannels defaults and caps the rounds
+	summary, err := service.DetectChannels(c.Request.Context(), service.ChannelDetectOptions{
+		ChannelIds:  req.ChannelIds,
+		Tag:         req.Tag,
+		Rounds:      req.Rounds,
+		Preset:      req.Preset,
+		AutoDisable: req.AutoDisable,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, summary)
+}
+
+type ProxyDetectBatchRequest struct {
+	// 待检测的渠道列表，每项为 base_url / api_key / models
+	Targets []service.BatchScanTarget `json:"targets"`
+	Rounds  int                       `json:"rounds"`
+	Preset  string                    `json:"preset"`
+}
+
+// ProxyDetectBatch scans several base URLs in one call; each target succeeds or fails on its own
+func ProxyDetectBatch(c *gin.Context) {
+	var req ProxyDetectBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(req.Targets) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "请添加要检测的目标"),
+		})
+		return
+	}
+	if len(req.Targets) > service.MaxBatchScanTargets {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "批量检测目标数超过上限: ") + fmt.Sprintf("%d > %d", len(req.Targets), service.MaxBatchScanTargets),
+		})
+		return
+	}
+	detectReq := ProxyDetectRequest{Rounds: req.Rounds}
+	clampProxyDetectRequest(&detectReq)
+
+	// Admin only, same trust level as admin detection
+	entries := service.ScanBatch(c.Request.Context(), req.Targets, service.DetectOptions{
+		Rounds:        detectReq.Rounds,
+		SkipSSRFCheck: true,
+		Preset:        req.Preset,
+		PersistResult: true,
+		Lang:          c.Query("lang"),
+	})
+	for i, entry := range entries {
+		if entry.Result != nil {
+			recordProxyDetectAudit(c, entry.BaseURL, req.Targets[i].Models, *entry.Result)
+		}
+	}
+	common.ApiSuccess(c, entries)
+}
+
+type ProxyDetectCompareRequest struct {
+	// 待比较的两个端点，各含 base_url / api_key
+	Left   service.CompareTarget `json:"left"`
+	Right  service.CompareTarget `json:"right"`
+	Model  string                `json:"model"`
+	Rounds int                   `json:"rounds"`
+	Preset string                `json:"preset"`
+}
+
+// ProxyDetectCompare detects two endpoints with the same model and diffs their fingerprints,
+// to tell whether two channels resell the same upstream
+func ProxyDetectCompare(c *gin.Context) {
+	var req ProxyDetectCompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Model == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "请选择要检测的模型"),
+		})
+		return
+	}
+	for _, target := range []service.CompareTarget{req.Left, req.Right} {
+		if target.APIKey == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": proxyDetectMsg(c, "API Key 不能为空"),
+			})
+			return
+		}
+		if err := service.ValidateProxyDetectURL(target.BaseURL, true); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": proxyDetectMsg(c, "无效的目标地址"),
+			})
+			return
+		}
+	}
+	detectReq := ProxyDetectRequest{Rounds: req.Rounds}
+	clampProxyDetectRequest(&detectReq)
+
+	// Admin only, same trust level as admin detection
+	result := service.CompareEndpoints(c.Request.Context(), req.Left, req.Right, req.Model, service.DetectOptions{
+		Rounds:        detectReq.Rounds,
+		SkipSSRFCheck: true,
+		Preset:        req.Preset,
+		PersistResult: true,
+		Lang:          c.Query("lang"),
+	})
+	common.ApiSuccess(c, result)
+}
+
+// GetProxyDetectScoringWeights returns the scoring weights analyze currently uses
+func GetProxyDetectScoringWeights(c *gin.Context) {
+	common.ApiSuccess(c, system_setting.GetProxyDetectSetting().ScoringWeights)
+}
+
+// UpdateProxyDetectScoringWeights updates the scoring weights; fields missing from the body keep
+// their current value
+func UpdateProxyDetectScoringWeights(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	weights, err := system_setting.ParseScoringWeights(string(body), system_setting.GetProxyDetectSetting().ScoringWeights)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.UpdateOption("proxy_detect_setting.scoring_weights", common.GetJsonString(weights)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, weights)
+}
+
+// ProxyDetectAnalyze re-scores saved fingerprints without probing, optionally with trial
+// scoring weights layered over the saved ones
+func ProxyDetectAnalyze(c *gin.Context) {
+	var req ProxyDetectAnalyzeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	weights := system_setting.GetProxyDetectSetting().ScoringWeights
+	if len(req.ScoringWeights) > 0 {
+		var err error
+		weights, err = system_setting.ParseScoringWeights(string(req.ScoringWeights), weights)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	result, err := service.ReplayFingerprints(req.Fingerprints, req.Model, weights, c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": proxyDetectMsg(c, "无效的指纹: ") + err.Error(),
+		})
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
+// GetProxyDetectScanModels returns the models a scan uses when the request names none
+func GetProxyDetectScanModels(c *gin.Context) {
+	common.ApiSuccess(c, system_setting.GetProxyDetectSetting().ScanModelEntries())
+}
+
+// UpdateProxyDetectScanModels replaces the default scan model list; an empty list restores
+// the built-in one
+func UpdateProxyDetectScanModels(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := system_setting.ValidateScanModels(string(body)); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var models []string
+	if err := common.Unmarshal(body, &models); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateOption("proxy_detect_setting.scan_models", common.GetJsonString(models)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, system_setting.GetProxyDetectSetting().ScanModelEntries())
+}
+
+type ProxyDetectClearCachesRequest struct {
+	// 要清理的缓存名称，为空时清理全部
+	Names []string `json:"names"`
+}
+
+// ClearProxyDetectCaches flushes detection-related caches and returns how many entries each dropped
+func ClearProxyDetectCaches(c *gin.Context) {
+	var req ProxyDetectClearCachesRequest
+	// 允许空请求体，表示清理全部
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.ApiError(c, err)
+		return
+	}
+	cleared, err := service.ClearProxyDetectCaches(req.Names)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
 	}
+	common.ApiSuccess(c, gin.H{
+		"cleared":   cleared,
+		"available": service.ProxyDetectCacheNames(),
+	})
 }
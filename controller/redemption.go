@@ -84,7 +84,7 @@ func AddRedemption(c *gin.Context) {
 	if redemption.PlanId > 0 {
 		// Subscription code: validate plan exists and is enabled
 		plan, err := model.GetSubscriptionPlanById(redemption.PlanId)
-		if err != nil || plan == nil {
+		if err != nil || plan == nil || plan.IsDeleted() {
 			common.ApiErrorI18n(c, i18n.MsgRedemptionPlanNotFound)
 			return
 		}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,6 +16,25 @@ import (
 
 type SubscriptionPlanDTO struct {
 	Plan model.SubscriptionPlan `json:"plan"`
+	// 购买后计费所用的分组及其倍率：有升级分组时为升级分组，否则为用户当前分组
+	EffectiveGroup      string  `json:"effective_group"`
+	EffectiveGroupRatio float64 `json:"effective_group_ratio"`
+}
+
+// resolvePlanEffectiveGroupRatio 计算套餐生效后的计费分组与倍率，分组不存在于倍率配置时按 1 计
+func resolvePlanEffectiveGroupRatio(plan model.SubscriptionPlan, userGroup string, groupRatios map[string]float64) (string, float64) {
+	group := strings.TrimSpace(plan.UpgradeGroup)
+	if group == "" {
+		group = strings.TrimSpace(userGroup)
+	}
+	if group == "" {
+		group = "default"
+	}
+	ratio, ok := groupRatios[group]
+	if !ok {
+		ratio = 1
+	}
+	return group, ratio
 }
 
 type BillingPreferenceRequest struct {
@@ -29,15 +49,35 @@ func GetSubscriptionPlans(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	userGroup, err := model.GetUserGroup(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plans = model.FilterSubscriptionPlansByGroup(plans, userGroup)
+	groupRatios := ratio_setting.GetGroupRatioCopy()
 	result := make([]SubscriptionPlanDTO, 0, len(plans))
 	for _, p := range plans {
+		group, ratio := resolvePlanEffectiveGroupRatio(p, userGroup, groupRatios)
 		result = append(result, SubscriptionPlanDTO{
-			Plan: p,
+			Plan:                p,
+			EffectiveGroup:      group,
+			EffectiveGroupRatio: ratio,
 		})
 	}
 	common.ApiSuccess(c, result)
 }
 
+// GetSubscriptionBillingSource previews which funding source the next request would be charged against
+func GetSubscriptionBillingSource(c *gin.Context) {
+	decision, err := service.ResolveBillingSource(c.GetInt("id"), strings.TrimSpace(c.Query("model")))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, decision)
+}
+
 func GetSubscriptionSelf(c *gin.Context) {
 	userId := c.GetInt("id")
 	settingMap, _ := model.GetUserSetting(userId, false)
@@ -62,6 +102,23 @@ func GetSubscriptionSelf(c *gin.Context) {
 	})
 }
 
+// GetSubscriptionOrdersSelf lists the caller's own subscription orders
+func GetSubscriptionOrdersSelf(c *gin.Context) {
+	userId := c.GetInt("id")
+	pageInfo := common.GetPageQuery(c)
+	orders, total, err := model.GetUserSubscriptionOrders(
+		userId, c.Query("status"),
+		pageInfo.GetStartIdx(), pageInfo.GetPageSize(),
+	)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orders)
+	common.ApiSuccess(c, pageInfo)
+}
+
 func UpdateSubscriptionPreference(c *gin.Context) {
 	userId := c.GetInt("id")
 	var req BillingPreferenceRequest
@@ -114,12 +171,30 @@ func validateSubscriptionPlan(plan *model.SubscriptionPlan) string {
 	if plan.TotalAmount < 0 {
 		return "总额度不能为负数"
 	}
+	if plan.RefundableDays < 0 {
+		return "可退款天数不能为负数"
+	}
 	plan.UpgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
 	if plan.UpgradeGroup != "" {
 		if _, ok := ratio_setting.GetGroupRatioCopy()[plan.UpgradeGroup]; !ok {
 			return "升级分组不存在"
 		}
 	}
+	if len(plan.VisibleToGroups) > 0 {
+		groupRatios := ratio_setting.GetGroupRatioCopy()
+		groups := make([]string, 0, len(plan.VisibleToGroups))
+		for _, g := range plan.VisibleToGroups {
+			g = strings.TrimSpace(g)
+			if g == "" {
+				continue
+			}
+			if _, ok := groupRatios[g]; !ok {
+				return "可见分组 " + g + " 不存在"
+			}
+			groups = append(groups, g)
+		}
+		plan.VisibleToGroups = groups
+	}
 	plan.QuotaResetPeriod = model.NormalizeResetPeriod(plan.QuotaResetPeriod)
 	if plan.QuotaResetPeriod == model.SubscriptionResetCustom && plan.QuotaResetCustomSeconds <= 0 {
 		return "自定义重置周期需大于0秒"
@@ -131,7 +206,8 @@ func validateSubscriptionPlan(plan *model.SubscriptionPlan) string {
 
 func AdminListSubscriptionPlans(c *gin.Context) {
 	var plans []model.SubscriptionPlan
-	if err := model.DB.Order("sort_order desc, id desc").Find(&plans).Error; err != nil {
+	// Admins also see soft-deleted plans so they can be restored
+	if err := model.DB.Unscoped().Order("sort_order desc, id desc").Find(&plans).Error; err != nil {
 		common.ApiError(c, err)
 		return
 	}
@@ -155,6 +231,7 @@ func AdminCreateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 	req.Plan.Id = 0
+	req.Plan.DeletedAt = gorm.DeletedAt{}
 	if errMsg := validateSubscriptionPlan(&req.Plan); errMsg != "" {
 		common.ApiErrorMsg(c, errMsg)
 		return
@@ -185,7 +262,13 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 
-	err := model.DB.Transaction(func(tx *gorm.DB) error {
+	visibleToGroups, err := common.Marshal(req.Plan.VisibleToGroups)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
 		// update plan (allow zero values updates with map)
 		updateMap := map[string]interface{}{
 			"title":                      req.Plan.Title,
@@ -203,6 +286,9 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 			"max_purchase_per_user":      req.Plan.MaxPurchasePerUser,
 			"total_amount":               req.Plan.TotalAmount,
 			"upgrade_group":              req.Plan.UpgradeGroup,
+			"visible_to_groups":          string(visibleToGroups),
+			"refundable":                 req.Plan.Refundable,
+			"refundable_days":            req.Plan.RefundableDays,
 			"quota_reset_period":         req.Plan.QuotaResetPeriod,
 			"quota_reset_custom_seconds": req.Plan.QuotaResetCustomSeconds,
 			"updated_at":                 common.GetTimestamp(),
@@ -370,15 +456,30 @@ func AdminListSubscriptionOrders(c *gin.Context) {
 	common.ApiSuccess(c, pageInfo)
 }
 
-// ---- Admin: Delete Subscription Plan ----
+// ---- Admin: Delete / Restore Subscription Plan ----
 
+// AdminDeleteSubscriptionPlan soft-deletes a plan; ?hard=true removes it when nothing references it
 func AdminDeleteSubscriptionPlan(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	if id <= 0 {
 		common.ApiErrorMsg(c, "无效的ID")
 		return
 	}
-	if err := model.AdminDeleteSubscriptionPlan(id); err != nil {
+	hard, _ := strconv.ParseBool(c.Query("hard"))
+	if err := model.AdminDeleteSubscriptionPlan(id, hard); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminRestoreSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	if err := model.AdminRestoreSubscriptionPlan(id); err != nil {
 		common.ApiError(c, err)
 		return
 	}
@@ -40,7 +40,7 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
+	if !plan.Enabled || plan.IsDeleted() {
 		common.ApiErrorMsg(c, "套餐未启用")
 		return
 	}
@@ -67,6 +67,10 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		common.ApiErrorMsg(c, "用户不存在")
 		return
 	}
+	if !plan.IsVisibleToGroup(user.Group) {
+		common.ApiErrorMsg(c, "该套餐不对当前分组开放")
+		return
+	}
 
 	if plan.MaxPurchasePerUser > 0 {
 		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
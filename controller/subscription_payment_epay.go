@@ -34,7 +34,7 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	if !plan.Enabled {
+	if !plan.Enabled || plan.IsDeleted() {
 		common.ApiErrorMsg(c, "套餐未启用")
 		return
 	}
@@ -52,6 +52,15 @@ func SubscriptionRequestEpay(c *gin.Context) {
 	}
 
 	userId := c.GetInt("id")
+	userGroup, err := model.GetUserGroup(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !plan.IsVisibleToGroup(userGroup) {
+		common.ApiErrorMsg(c, "该套餐不对当前分组开放")
+		return
+	}
 	if plan.MaxPurchasePerUser > 0 {
 		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
 		if err != nil {
@@ -114,6 +114,18 @@ func main() {
 	// Quota expiry task (expire redemption-based balance)
 	service.StartQuotaExpiryTask()
 
+	// Proxy detection metrics, served on /api/proxy-detect/metrics
+	service.InitProxyDetectMetrics()
+
+	// Proxy detection result retention task
+	service.StartProxyDetectRetentionTask()
+
+	// Proxy detection model availability cache warmer
+	service.StartProxyDetectAvailabilityWarmTask()
+
+	// Scheduled proxy detection of all Anthropic channels
+	service.StartProxyDetectScheduledTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -231,6 +231,23 @@ func (channel *Channel) SetOtherInfo(otherInfo map[string]interface{}) {
 	channel.OtherInfo = string(otherInfoBytes)
 }
 
+// UpdateChannelOtherInfo merges fields into the channel's other_info and saves only that
+// column; it returns the previous other_info
+func UpdateChannelOtherInfo(channelId int, fields map[string]interface{}) (map[string]interface{}, error) {
+	channel, err := GetChannelById(channelId, false)
+	if err != nil {
+		return nil, err
+	}
+	previous := channel.GetOtherInfo()
+	info := channel.GetOtherInfo()
+	for k, v := range fields {
+		info[k] = v
+	}
+	channel.SetOtherInfo(info)
+	err = DB.Model(&Channel{}).Where("id = ?", channelId).Update("other_info", channel.OtherInfo).Error
+	return previous, err
+}
+
 func (channel *Channel) GetTag() string {
 	if channel.Tag == nil {
 		return ""
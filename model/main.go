@@ -279,6 +279,8 @@ func migrateDB() error {
 		&QuotaRecord{},
 		&Ticket{},
 		&TicketMessage{},
+		&ProxyDetectLog{},
+		&ProxyDetectAudit{},
 	)
 	if err != nil {
 		return err
@@ -330,6 +332,8 @@ func migrateDBFast() error {
 		{&QuotaRecord{}, "QuotaRecord"},
 		{&Ticket{}, "Ticket"},
 		{&TicketMessage{}, "TicketMessage"},
+		{&ProxyDetectLog{}, "ProxyDetectLog"},
+		{&ProxyDetectAudit{}, "ProxyDetectAudit"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -402,14 +406,21 @@ func ensureSubscriptionPlanTableSQLite() error {
 ` + "`creem_product_id`" + ` varchar(128) DEFAULT '',
 ` + "`max_purchase_per_user`" + ` integer DEFAULT 0,
 ` + "`upgrade_group`" + ` varchar(64) DEFAULT '',
+` + "`visible_to_groups`" + ` text,
+` + "`refundable`" + ` numeric DEFAULT 0,
+` + "`refundable_days`" + ` integer DEFAULT 0,
 ` + "`total_amount`" + ` bigint NOT NULL DEFAULT 0,
 ` + "`quota_reset_period`" + ` varchar(16) DEFAULT 'never',
 ` + "`quota_reset_custom_seconds`" + ` bigint DEFAULT 0,
 ` + "`created_at`" + ` bigint,
 ` + "`updated_at`" + ` bigint,
+` + "`deleted_at`" + ` datetime,
 PRIMARY KEY (` + "`id`" + `)
 )`
-		return DB.Exec(createSQL).Error
+		if err := DB.Exec(createSQL).Error; err != nil {
+			return err
+		}
+		return ensureSubscriptionPlanDeletedAtIndexSQLite(tableName)
 	}
 	var cols []struct {
 		Name string `gorm:"column:name"`
@@ -436,11 +447,15 @@ PRIMARY KEY (` + "`id`" + `)
 		{Name: "creem_product_id", DDL: "`creem_product_id` varchar(128) DEFAULT ''"},
 		{Name: "max_purchase_per_user", DDL: "`max_purchase_per_user` integer DEFAULT 0"},
 		{Name: "upgrade_group", DDL: "`upgrade_group` varchar(64) DEFAULT ''"},
+		{Name: "visible_to_groups", DDL: "`visible_to_groups` text"},
+		{Name: "refundable", DDL: "`refundable` numeric DEFAULT 0"},
+		{Name: "refundable_days", DDL: "`refundable_days` integer DEFAULT 0"},
 		{Name: "total_amount", DDL: "`total_amount` bigint NOT NULL DEFAULT 0"},
 		{Name: "quota_reset_period", DDL: "`quota_reset_period` varchar(16) DEFAULT 'never'"},
 		{Name: "quota_reset_custom_seconds", DDL: "`quota_reset_custom_seconds` bigint DEFAULT 0"},
 		{Name: "created_at", DDL: "`created_at` bigint"},
 		{Name: "updated_at", DDL: "`updated_at` bigint"},
+		{Name: "deleted_at", DDL: "`deleted_at` datetime"},
 	}
 	for _, col := range required {
 		if _, ok := existing[col.Name]; ok {
@@ -450,7 +465,11 @@ PRIMARY KEY (` + "`id`" + `)
 			return err
 		}
 	}
-	return nil
+	return ensureSubscriptionPlanDeletedAtIndexSQLite(tableName)
+}
+
+func ensureSubscriptionPlanDeletedAtIndexSQLite(tableName string) error {
+	return DB.Exec("CREATE INDEX IF NOT EXISTS `idx_" + tableName + "_deleted_at` ON `" + tableName + "` (`deleted_at`)").Error
 }
 
 // migrateSubscriptionPlanPriceAmount migrates price_amount column from float/double to decimal(10,6)
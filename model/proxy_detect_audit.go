@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ProxyDetectAudit 中转检测审计记录：记录谁在何时检测了哪个地址，不保存 API Key
+type ProxyDetectAudit struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Username    string `json:"username" gorm:"type:varchar(64);index"`
+	Role        int    `json:"role"`
+	BaseURLHash string `json:"base_url_hash" gorm:"type:varchar(64);index"`
+	Models      string `json:"models" gorm:"type:text"`
+	// 单模型为该模型结论；多模型结论一致时为该结论，否则为 mixed
+	Verdict   string `json:"verdict" gorm:"type:varchar(32)"`
+	Summary   string `json:"summary" gorm:"type:text"`
+	TraceID   string `json:"trace_id" gorm:"type:varchar(64);index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// HashProxyDetectTarget 对检测目标（base URL 等）做带密钥的哈希，避免明文落库
+func HashProxyDetectTarget(value string) string {
+	return common.GenerateHMAC(strings.TrimRight(strings.ToLower(strings.TrimSpace(value)), "/"))
+}
+
+// SummarizeProxyDetectVerdicts 将各模型结论归并为一个审计结论
+func SummarizeProxyDetectVerdicts(summary map[string]string) string {
+	verdict := ""
+	for _, v := range summary {
+		if verdict == "" {
+			verdict = v
+		} else if v != verdict {
+			return "mixed"
+		}
+	}
+	return verdict
+}
+
+func (a *ProxyDetectAudit) Insert() error {
+	if a.CreatedAt == 0 {
+		a.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(a).Error
+}
+
+// GetProxyDetectAudits 分页查询审计记录，userId 为 0 或时间为 0 表示不过滤
+func GetProxyDetectAudits(userId int, startTimestamp int64, endTimestamp int64, startIdx int, num int) (audits []*ProxyDetectAudit, total int64, err error) {
+	tx := DB.Model(&ProxyDetectAudit{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&audits).Error
+	return audits, total, err
+}
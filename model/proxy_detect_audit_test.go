@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeProxyDetectVerdicts(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "", SummarizeProxyDetectVerdicts(nil))
+	require.Equal(t, "anthropic", SummarizeProxyDetectVerdicts(map[string]string{"claude-sonnet-4-5": "anthropic"}))
+	require.Equal(t, "bedrock", SummarizeProxyDetectVerdicts(map[string]string{"a": "bedrock", "b": "bedrock"}))
+	require.Equal(t, "mixed", SummarizeProxyDetectVerdicts(map[string]string{"a": "anthropic", "b": "bedrock"}))
+}
+
+func TestHashProxyDetectTarget(t *testing.T) {
+	t.Parallel()
+
+	hash := HashProxyDetectTarget("https://api.example.com")
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, HashProxyDetectTarget(" HTTPS://api.example.com/ "))
+	require.NotEqual(t, hash, HashProxyDetectTarget("https://api.example.org"))
+	require.NotContains(t, hash, "example")
+}
@@ -0,0 +1,279 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const proxyDetectLogPruneBatchSize = 500
+
+// ProxyDetectLog 中转检测结果记录
+type ProxyDetectLog struct {
+	Id            int     `json:"id"`
+	BaseURLHash   string  `json:"base_url_hash" gorm:"type:varchar(64);index"`
+	KeyHash       string  `json:"key_hash" gorm:"type:varchar(64);index"`
+	Model         string  `json:"model" gorm:"type:varchar(128);index"`
+	Verdict       string  `json:"verdict" gorm:"type:varchar(32)"`
+	Confidence    float64 `json:"confidence"`
+	Scores        string  `json:"scores" gorm:"type:text"`
+	ProxyPlatform string  `json:"proxy_platform" gorm:"type:varchar(64)"`
+	Fingerprints  string  `json:"fingerprints" gorm:"type:text"`
+	CreatedAt     int64   `json:"created_at" gorm:"bigint;index"`
+}
+
+func (l *ProxyDetectLog) Insert() error {
+	if l.CreatedAt == 0 {
+		l.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(l).Error
+}
+
+// latestProxyDetectLogIds 每个 base URL 与模型最新一条结论不在 excludeVerdicts 中的记录 ID 子查询
+// 这些记录是结论变更 webhook 的比较基线（见 GetLatestProxyDetectLog），清理时始终保留；除此之外没有其他数据引用检测记录
+func latestProxyDetectLogIds(excludeVerdicts []string) *gorm.DB {
+	tx := DB.Model(&ProxyDetectLog{}).Select("MAX(id)")
+	if len(excludeVerdicts) > 0 {
+		tx = tx.Where("verdict NOT IN ?", excludeVerdicts)
+	}
+	return tx.Group("base_url_hash, model")
+}
+
+// deleteProxyDetectLogs 分批删除 scope 选中的记录（基线记录除外），返回删除条数
+func deleteProxyDetectLogs(scope func(*gorm.DB) *gorm.DB, baselineExclude []string) (int64, error) {
+	var deleted int64
+	for {
+		var ids []int
+		err := DB.Model(&ProxyDetectLog{}).Scopes(scope).
+			Where("id NOT IN (?)", latestProxyDetectLogIds(baselineExclude)).
+			Order("id").Limit(proxyDetectLogPruneBatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return deleted, err
+		}
+		res := DB.Where("id IN ?", ids).Delete(&ProxyDetectLog{})
+		if res.Error != nil {
+			return deleted, res.Error
+		}
+		deleted += res.RowsAffected
+	}
+}
+
+// PruneProxyDetectLogs 按保留策略清理检测记录，返回删除条数
+// 早于 maxAgeSeconds 的记录清理；keepLatest > 0 时每个 base URL 仅保留最新 keepLatest 条；
+// 每个 base URL 与模型最新一条结论不在 baselineExclude 中的记录始终保留
+func PruneProxyDetectLogs(maxAgeSeconds int64, keepLatest int, baselineExclude []string) (int64, error) {
+	var cutoff int64
+	if maxAgeSeconds > 0 {
+		cutoff = common.GetTimestamp() - maxAgeSeconds
+	}
+	if keepLatest <= 0 {
+		if cutoff == 0 {
+			return 0, nil
+		}
+		return deleteProxyDetectLogs(func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("created_at < ?", cutoff)
+		}, baselineExclude)
+	}
+
+	var hashes []string
+	if err := DB.Model(&ProxyDetectLog{}).Distinct("base_url_hash").Pluck("base_url_hash", &hashes).Error; err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, hash := range hashes {
+		// 第 keepLatest 新的记录，排在它之后的记录超出保留名额
+		var boundary []ProxyDetectLog
+		err := DB.Model(&ProxyDetectLog{}).Select("id", "created_at").Where("base_url_hash = ?", hash).
+			Order("created_at desc, id desc").Offset(keepLatest - 1).Limit(1).Find(&boundary).Error
+		if err != nil {
+			return deleted, err
+		}
+		scope := func(tx *gorm.DB) *gorm.DB {
+			tx = tx.Where("base_url_hash = ?", hash)
+			if len(boundary) == 0 {
+				return tx.Where("created_at < ?", cutoff)
+			}
+			b := boundary[0]
+			return tx.Where("(created_at < ? OR (created_at = ? AND id < ?) OR created_at < ?)", b.CreatedAt, b.CreatedAt, b.Id, cutoff)
+		}
+		n, err := deleteProxyDetectLogs(scope, baselineExclude)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// ProxyDetectTimelinePoint 单次检测在时间线上的一个点
+type ProxyDetectTimelinePoint struct {
+	Id            int     `json:"id"`
+	Model         string  `json:"model"`
+	Verdict       string  `json:"verdict"`
+	Confidence    float64 `json:"confidence"`
+	ProxyPlatform string  `json:"proxy_platform"`
+	CreatedAt     int64   `json:"created_at"`
+	// 与同一模型上一个点的差异，首个点为空
+	PrevVerdict     string   `json:"prev_verdict,omitempty"`
+	VerdictChanged  bool     `json:"verdict_changed"`
+	ConfidenceDelta *float64 `json:"confidence_delta,omitempty"`
+}
+
+// ProxyDetectTimelineSeries 同一模型按时间排序的检测结果
+type ProxyDetectTimelineSeries struct {
+	Model       string                     `json:"model"`
+	TotalRuns   int                        `json:"total_runs"`
+	Downsampled bool                       `json:"downsampled"`
+	Points      []ProxyDetectTimelinePoint `json:"points"`
+}
+
+// GetProxyDetectLogs 分页查询检测记录（新记录在前），baseURLHash、modelName 为空时不过滤
+func GetProxyDetectLogs(baseURLHash string, modelName string, startIdx int, num int) (logs []*ProxyDetectLog, total int64, err error) {
+	tx := DB.Model(&ProxyDetectLog{})
+	if baseURLHash != "" {
+		tx = tx.Where("base_url_hash = ?", baseURLHash)
+	}
+	if modelName != "" {
+		tx = tx.Where("model = ?", modelName)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// GetLatestProxyDetectLog 返回某个 base URL 与模型最近一次结论不在 excludeVerdicts 中的检测记录，没有记录时返回 nil
+func GetLatestProxyDetectLog(baseURLHash string, modelName string, excludeVerdicts []string) (*ProxyDetectLog, error) {
+	var logs []ProxyDetectLog
+	tx := DB.Model(&ProxyDetectLog{}).
+		Select("id", "model", "verdict", "confidence", "created_at").
+		Where("base_url_hash = ? AND model = ?", baseURLHash, modelName)
+	if len(excludeVerdicts) > 0 {
+		tx = tx.Where("verdict NOT IN ?", excludeVerdicts)
+	}
+	err := tx.Order("id desc").Limit(1).Find(&logs).Error
+	if err != nil || len(logs) == 0 {
+		return nil, err
+	}
+	return &logs[0], nil
+}
+
+// GetProxyDetectLogsForTimeline 按时间升序返回某个 base URL 的检测记录，model 为空时返回全部模型
+func GetProxyDetectLogsForTimeline(baseURLHash string, modelName string, startTimestamp int64, endTimestamp int64) ([]ProxyDetectLog, error) {
+	tx := DB.Model(&ProxyDetectLog{}).
+		Select("id", "model", "verdict", "confidence", "proxy_platform", "created_at").
+		Where("base_url_hash = ?", baseURLHash)
+	if modelName != "" {
+		tx = tx.Where("model = ?", modelName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	var logs []ProxyDetectLog
+	err := tx.Order("created_at asc, id asc").Find(&logs).Error
+	return logs, err
+}
+
+// BuildProxyDetectTimeline 将检测记录按模型整理为时间序列，并计算相邻点之间的结论和置信度变化
+// 每个序列最多保留 maxPoints 个点（<= 0 表示不限制），抽样时优先保留首尾和结论发生变化的点
+func BuildProxyDetectTimeline(logs []ProxyDetectLog, maxPoints int) []ProxyDetectTimelineSeries {
+	byModel := make(map[string][]ProxyDetectLog)
+	var models []string
+	for _, l := range logs {
+		if _, ok := byModel[l.Model]; !ok {
+			models = append(models, l.Model)
+		}
+		byModel[l.Model] = append(byModel[l.Model], l)
+	}
+	sort.Strings(models)
+
+	series := make([]ProxyDetectTimelineSeries, 0, len(models))
+	for _, m := range models {
+		runs := byModel[m]
+		sort.SliceStable(runs, func(i, j int) bool {
+			if runs[i].CreatedAt != runs[j].CreatedAt {
+				return runs[i].CreatedAt < runs[j].CreatedAt
+			}
+			return runs[i].Id < runs[j].Id
+		})
+		kept := downsampleProxyDetectRuns(runs, maxPoints)
+		s := ProxyDetectTimelineSeries{
+			Model:       m,
+			TotalRuns:   len(runs),
+			Downsampled: len(kept) < len(runs),
+			Points:      make([]ProxyDetectTimelinePoint, 0, len(kept)),
+		}
+		for i, l := range kept {
+			p := ProxyDetectTimelinePoint{
+				Id:            l.Id,
+				Model:         l.Model,
+				Verdict:       l.Verdict,
+				Confidence:    l.Confidence,
+				ProxyPlatform: l.ProxyPlatform,
+				CreatedAt:     l.CreatedAt,
+			}
+			if i > 0 {
+				prev := kept[i-1]
+				delta := l.Confidence - prev.Confidence
+				p.PrevVerdict = prev.Verdict
+				p.VerdictChanged = prev.Verdict != l.Verdict
+				p.ConfidenceDelta = &delta
+			}
+			s.Points = append(s.Points, p)
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+// downsampleProxyDetectRuns 在时间有序的记录中选出至多 maxPoints 条，先保留首尾和结论变化点，剩余名额均匀分配
+func downsampleProxyDetectRuns(runs []ProxyDetectLog, maxPoints int) []ProxyDetectLog {
+	if maxPoints <= 0 || len(runs) <= maxPoints {
+		return runs
+	}
+	var important, others []int
+	for i := range runs {
+		if i == 0 || i == len(runs)-1 || runs[i].Verdict != runs[i-1].Verdict {
+			important = append(important, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+	var selected []int
+	if len(important) >= maxPoints {
+		selected = evenlySpaced(important, maxPoints)
+	} else {
+		selected = append(important, evenlySpaced(others, maxPoints-len(important))...)
+		sort.Ints(selected)
+	}
+	kept := make([]ProxyDetectLog, 0, len(selected))
+	for _, i := range selected {
+		kept = append(kept, runs[i])
+	}
+	return kept
+}
+
+// evenlySpaced 从有序切片中均匀选出 n 个元素，包含首尾
+func evenlySpaced(items []int, n int) []int {
+	if n <= 0 {
+		return nil
+	}
+	if len(items) <= n {
+		return items
+	}
+	if n == 1 {
+		return []int{items[0]}
+	}
+	result := make([]int, 0, n)
+	step := float64(len(items)-1) / float64(n-1)
+	for i := 0; i < n; i++ {
+		result = append(result, items[int(float64(i)*step+0.5)])
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupProxyDetectLogTestDB points DB at a private in-memory SQLite database for the test
+func setupProxyDetectLogTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	origDB := DB
+	DB = db
+	t.Cleanup(func() { DB = origDB })
+	require.NoError(t, DB.AutoMigrate(&ProxyDetectLog{}))
+}
+
+func TestPruneProxyDetectLogs(t *testing.T) {
+	now := common.GetTimestamp()
+	day := int64(86400)
+	seed := func(t *testing.T) {
+		logs := []ProxyDetectLog{
+			{Id: 1, BaseURLHash: "a", Model: "sonnet", CreatedAt: now - 10*day},
+			{Id: 2, BaseURLHash: "a", Model: "opus", CreatedAt: now - 9*day},
+			{Id: 3, BaseURLHash: "a", Model: "sonnet", CreatedAt: now - 3*day},
+			{Id: 4, BaseURLHash: "a", Model: "sonnet", CreatedAt: now - 2*day},
+			{Id: 5, BaseURLHash: "a", Model: "sonnet", CreatedAt: now - day},
+			{Id: 6, BaseURLHash: "b", Model: "sonnet", CreatedAt: now - 8*day},
+			{Id: 7, BaseURLHash: "b", Model: "sonnet", CreatedAt: now - 2*day},
+			// A failed run is never a baseline
+			{Id: 8, BaseURLHash: "a", Model: "opus", Verdict: "timeout", CreatedAt: now - 3600},
+		}
+		require.NoError(t, DB.Create(&logs).Error)
+	}
+	remaining := func(t *testing.T) []int {
+		var ids []int
+		require.NoError(t, DB.Model(&ProxyDetectLog{}).Order("id").Pluck("id", &ids).Error)
+		return ids
+	}
+
+	testCases := []struct {
+		name       string
+		maxAge     int64
+		keepLatest int
+		expected   []int
+	}{
+		{name: "no policy", expected: []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		// 2 is the latest opus run of base URL a, the baseline of its verdict webhook
+		{name: "age keeps baselines", maxAge: 5 * day, expected: []int{2, 3, 4, 5, 7, 8}},
+		{name: "keep latest per base url", keepLatest: 2, expected: []int{2, 5, 6, 7, 8}},
+		{name: "age and keep latest", maxAge: 5 * day, keepLatest: 2, expected: []int{2, 5, 7, 8}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupProxyDetectLogTestDB(t)
+			seed(t)
+			deleted, err := PruneProxyDetectLogs(tc.maxAge, tc.keepLatest, []string{"timeout"})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, remaining(t))
+			require.EqualValues(t, 8-len(tc.expected), deleted)
+		})
+	}
+}
+
+func TestBuildProxyDetectTimeline(t *testing.T) {
+	t.Parallel()
+
+	logs := []ProxyDetectLog{
+		{Id: 3, Model: "opus", Verdict: "anthropic", Confidence: 0.9, CreatedAt: 300},
+		{Id: 1, Model: "sonnet", Verdict: "anthropic", Confidence: 0.9, CreatedAt: 100},
+		{Id: 2, Model: "sonnet", Verdict: "anthropic", Confidence: 0.8, CreatedAt: 200},
+		{Id: 4, Model: "sonnet", Verdict: "bedrock", Confidence: 0.7, CreatedAt: 400},
+	}
+	series := BuildProxyDetectTimeline(logs, 0)
+	require.Len(t, series, 2)
+
+	// Single recorded run: one point without deltas
+	require.Equal(t, "opus", series[0].Model)
+	require.Equal(t, 1, series[0].TotalRuns)
+	require.Len(t, series[0].Points, 1)
+	require.Nil(t, series[0].Points[0].ConfidenceDelta)
+	require.False(t, series[0].Points[0].VerdictChanged)
+
+	sonnet := series[1].Points
+	require.Equal(t, []int{1, 2, 4}, []int{sonnet[0].Id, sonnet[1].Id, sonnet[2].Id})
+	require.False(t, sonnet[1].VerdictChanged)
+	require.InDelta(t, -0.1, *sonnet[1].ConfidenceDelta, 1e-9)
+	require.True(t, sonnet[2].VerdictChanged)
+	require.Equal(t, "anthropic", sonnet[2].PrevVerdict)
+}
+
+func TestBuildProxyDetectTimelineDownsample(t *testing.T) {
+	t.Parallel()
+
+	var logs []ProxyDetectLog
+	for i := 1; i <= 50; i++ {
+		verdict := "anthropic"
+		if i == 27 {
+			verdict = "suspicious"
+		}
+		logs = append(logs, ProxyDetectLog{Id: i, Model: "sonnet", Verdict: verdict, CreatedAt: int64(i * 10)})
+	}
+	series := BuildProxyDetectTimeline(logs, 6)
+	require.Len(t, series, 1)
+	require.True(t, series[0].Downsampled)
+	require.Equal(t, 50, series[0].TotalRuns)
+
+	points := series[0].Points
+	require.Len(t, points, 6)
+	var ids []int
+	for _, p := range points {
+		ids = append(ids, p.Id)
+	}
+	// First, last and both verdict changes (27 and 28) are always kept
+	require.Equal(t, 1, ids[0])
+	require.Equal(t, 50, ids[len(ids)-1])
+	require.Contains(t, ids, 27)
+	require.Contains(t, ids, 28)
+	require.IsIncreasing(t, ids)
+}
+
+func TestGetProxyDetectLogs(t *testing.T) {
+	setupSubscriptionPlanTestDB(t)
+	require.NoError(t, DB.AutoMigrate(&ProxyDetectLog{}))
+
+	target := HashProxyDetectTarget("https://relay.example.com")
+	other := HashProxyDetectTarget("https://other.example.com")
+	for _, l := range []ProxyDetectLog{
+		{BaseURLHash: target, Model: "claude-sonnet-4-5", Verdict: "anthropic"},
+		{BaseURLHash: target, Model: "claude-opus-4-1", Verdict: "bedrock"},
+		{BaseURLHash: target, Model: "claude-sonnet-4-5", Verdict: "suspicious"},
+		{BaseURLHash: other, Model: "claude-sonnet-4-5", Verdict: "anthropic"},
+	} {
+		require.NoError(t, l.Insert())
+	}
+
+	logs, total, err := GetProxyDetectLogs("", "", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, total)
+	require.Len(t, logs, 4)
+
+	logs, total, err = GetProxyDetectLogs(target, "claude-sonnet-4-5", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, "suspicious", logs[0].Verdict, "newest first")
+	require.Equal(t, "anthropic", logs[1].Verdict)
+
+	logs, total, err = GetProxyDetectLogs(target, "", 1, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, logs, 1)
+	require.Equal(t, "bedrock", logs[0].Verdict)
+
+	latest, err := GetLatestProxyDetectLog(target, "claude-sonnet-4-5", nil)
+	require.NoError(t, err)
+	require.Equal(t, "suspicious", latest.Verdict)
+
+	latest, err = GetLatestProxyDetectLog(other, "claude-opus-4-1", nil)
+	require.NoError(t, err)
+	require.Nil(t, latest)
+}
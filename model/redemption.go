@@ -162,6 +162,9 @@ func Redeem(key string, userId int) (*RedeemResult, error) {
 			if !plan.Enabled {
 				return errors.New("关联的订阅套餐已禁用")
 			}
+			if plan.IsDeleted() {
+				return errors.New("关联的订阅套餐已删除")
+			}
 			_, err = CreateUserSubscriptionFromPlanTx(tx, userId, plan, "redemption")
 			if err != nil {
 				return err
@@ -35,6 +35,12 @@ const (
 var (
 	ErrSubscriptionOrderNotFound      = errors.New("subscription order not found")
 	ErrSubscriptionOrderStatusInvalid = errors.New("subscription order status invalid")
+	ErrSubscriptionNotRefundable      = errors.New("subscription plan is not refundable")
+	ErrSubscriptionRefundWindowPassed = errors.New("subscription refund window has passed")
+	ErrSubscriptionPlanNotFound       = errors.New("subscription plan not found")
+	ErrSubscriptionPlanDeleted        = errors.New("subscription plan has been deleted")
+	ErrSubscriptionPlanNotDeleted     = errors.New("subscription plan not found or not deleted")
+	ErrSubscriptionPlanReferenced     = errors.New("subscription plan is still referenced")
 )
 
 const (
@@ -169,6 +175,13 @@ type SubscriptionPlan struct {
 	// Upgrade user group after purchase (empty = no change)
 	UpgradeGroup string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
 
+	// User groups allowed to see and purchase the plan (empty = visible to all)
+	VisibleToGroups []string `json:"visible_to_groups" gorm:"type:text;serializer:json"`
+
+	// Refund policy: refundable within RefundableDays of purchase (0 = no time limit)
+	Refundable     bool `json:"refundable" gorm:"default:false"`
+	RefundableDays int  `json:"refundable_days" gorm:"type:int;default:0"`
+
 	// Total quota (amount in quota units, 0 = unlimited)
 	TotalAmount int64 `json:"total_amount" gorm:"type:bigint;not null;default:0"`
 
@@ -178,6 +191,9 @@ type SubscriptionPlan struct {
 
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
+
+	// Soft delete: hidden from listings and purchasing, existing subscriptions keep working
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
 func (p *SubscriptionPlan) BeforeCreate(tx *gorm.DB) error {
@@ -192,6 +208,49 @@ func (p *SubscriptionPlan) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsVisibleToGroup reports whether users in the given group may see and purchase the plan.
+func (p *SubscriptionPlan) IsVisibleToGroup(group string) bool {
+	if len(p.VisibleToGroups) == 0 {
+		return true
+	}
+	for _, g := range p.VisibleToGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDeleted reports whether the plan has been soft-deleted
+func (p *SubscriptionPlan) IsDeleted() bool {
+	return p.DeletedAt.Valid
+}
+
+// CheckSubscriptionRefundPolicy reports whether a subscription may be refunded at now under its plan's policy.
+func CheckSubscriptionRefundPolicy(plan *SubscriptionPlan, sub *UserSubscription, now int64) error {
+	if plan == nil || sub == nil {
+		return errors.New("invalid refund args")
+	}
+	if !plan.Refundable {
+		return ErrSubscriptionNotRefundable
+	}
+	if plan.RefundableDays > 0 && now-sub.StartTime > int64(plan.RefundableDays)*24*3600 {
+		return fmt.Errorf("%w: refundable within %d days of purchase", ErrSubscriptionRefundWindowPassed, plan.RefundableDays)
+	}
+	return nil
+}
+
+// FilterSubscriptionPlansByGroup keeps only the plans visible to the given user group.
+func FilterSubscriptionPlansByGroup(plans []SubscriptionPlan, group string) []SubscriptionPlan {
+	result := make([]SubscriptionPlan, 0, len(plans))
+	for _, p := range plans {
+		if p.IsVisibleToGroup(group) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 // Subscription order (payment -> webhook -> create UserSubscription)
 type SubscriptionOrder struct {
 	Id     int     `json:"id"`
@@ -366,7 +425,8 @@ func getSubscriptionPlanByIdTx(tx *gorm.DB, id int) (*SubscriptionPlan, error) {
 	if tx != nil {
 		query = tx
 	}
-	if err := query.Where("id = ?", id).First(&plan).Error; err != nil {
+	// Include soft-deleted plans so existing subscriptions keep resolving their plan
+	if err := query.Unscoped().Where("id = ?", id).First(&plan).Error; err != nil {
 		return nil, err
 	}
 	_ = getSubscriptionPlanCache().SetWithTTL(key, plan, subscriptionPlanCacheTTL())
@@ -505,6 +565,30 @@ func CreateUserSubscriptionFromPlanTx(tx *gorm.DB, userId int, plan *Subscriptio
 	return sub, nil
 }
 
+// SubscriptionPurchaseEvent describes a newly created subscription, for fulfillment integrations
+type SubscriptionPurchaseEvent struct {
+	SubscriptionId int
+	UserId         int
+	PlanId         int
+	PlanTitle      string
+	Money          float64
+	TradeNo        string // empty for admin binds
+	PaymentMethod  string
+	Source         string // "order" or "admin"
+	CreatedAt      int64
+}
+
+// SubscriptionPurchaseHook is called after a subscription has been created and committed.
+// The service layer sets it; model cannot import service.
+var SubscriptionPurchaseHook func(event SubscriptionPurchaseEvent)
+
+func fireSubscriptionPurchaseHook(event SubscriptionPurchaseEvent) {
+	if SubscriptionPurchaseHook == nil {
+		return
+	}
+	SubscriptionPurchaseHook(event)
+}
+
 // Complete a subscription order (idempotent). Creates a UserSubscription snapshot from the plan.
 func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 	if tradeNo == "" {
@@ -519,6 +603,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 	var logMoney float64
 	var logPaymentMethod string
 	var upgradeGroup string
+	var event *SubscriptionPurchaseEvent
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		var order SubscriptionOrder
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(&order).Error; err != nil {
@@ -538,7 +623,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 			// still allow completion for already purchased orders
 		}
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		_, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
 		if err != nil {
 			return err
 		}
@@ -557,6 +642,17 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 		logPlanTitle = plan.Title
 		logMoney = order.Money
 		logPaymentMethod = order.PaymentMethod
+		event = &SubscriptionPurchaseEvent{
+			SubscriptionId: sub.Id,
+			UserId:         order.UserId,
+			PlanId:         plan.Id,
+			PlanTitle:      plan.Title,
+			Money:          order.Money,
+			TradeNo:        order.TradeNo,
+			PaymentMethod:  order.PaymentMethod,
+			Source:         sub.Source,
+			CreatedAt:      sub.CreatedAt,
+		}
 		return nil
 	})
 	if err != nil {
@@ -569,6 +665,9 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 		msg := fmt.Sprintf("订阅购买成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, logMoney, logPaymentMethod)
 		RecordLog(logUserId, LogTypeTopup, msg)
 	}
+	if event != nil {
+		fireSubscriptionPurchaseHook(*event)
+	}
 	return nil
 }
 
@@ -637,13 +736,26 @@ func AdminBindSubscription(userId int, planId int, sourceNote string) (string, e
 	if err != nil {
 		return "", err
 	}
+	if plan.IsDeleted() {
+		return "", ErrSubscriptionPlanDeleted
+	}
+	var sub *UserSubscription
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		_, err := CreateUserSubscriptionFromPlanTx(tx, userId, plan, "admin")
+		var err error
+		sub, err = CreateUserSubscriptionFromPlanTx(tx, userId, plan, "admin")
 		return err
 	})
 	if err != nil {
 		return "", err
 	}
+	fireSubscriptionPurchaseHook(SubscriptionPurchaseEvent{
+		SubscriptionId: sub.Id,
+		UserId:         userId,
+		PlanId:         plan.Id,
+		PlanTitle:      plan.Title,
+		Source:         sub.Source,
+		CreatedAt:      sub.CreatedAt,
+	})
 	if strings.TrimSpace(plan.UpgradeGroup) != "" {
 		_ = UpdateUserGroupCache(userId, plan.UpgradeGroup)
 		return fmt.Sprintf("用户分组将升级到 %s", plan.UpgradeGroup), nil
@@ -727,7 +839,7 @@ func GetSubscriptionPlanTitlesByIds(planIds []int) (map[int]string, error) {
 		return map[int]string{}, nil
 	}
 	var plans []SubscriptionPlan
-	err := DB.Where("id IN ?", planIds).Select("id", "title").Find(&plans).Error
+	err := DB.Unscoped().Where("id IN ?", planIds).Select("id", "title").Find(&plans).Error
 	if err != nil {
 		return nil, err
 	}
@@ -1292,26 +1404,154 @@ func AdminListSubscriptionOrders(offset, limit int, userId int, status string, s
 	return result, total, nil
 }
 
-// ---- Admin: Delete Subscription Plan (safe, check active subscriptions) ----
+// ---- User: Own Subscription Order History ----
 
-func AdminDeleteSubscriptionPlan(planId int) error {
+// SubscriptionOrderSelfItem is the user-facing view of an order; user identity and
+// provider payloads are left out
+type SubscriptionOrderSelfItem struct {
+	Id            int     `json:"id"`
+	PlanId        int     `json:"plan_id"`
+	PlanTitle     string  `json:"plan_title"`
+	Money         float64 `json:"money"`
+	TradeNo       string  `json:"trade_no"`
+	PaymentMethod string  `json:"payment_method"`
+	Status        string  `json:"status"`
+	CreateTime    int64   `json:"create_time"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+// GetUserSubscriptionOrders lists the orders of one user, newest first
+func GetUserSubscriptionOrders(userId int, status string, offset, limit int) ([]SubscriptionOrderSelfItem, int64, error) {
+	if userId <= 0 {
+		return nil, 0, errors.New("invalid userId")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	tx := DB.Model(&SubscriptionOrder{}).Where("user_id = ?", userId)
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var orders []SubscriptionOrder
+	if err := tx.Order("id desc").Offset(offset).Limit(limit).Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+	planIdSet := make(map[int]struct{}, len(orders))
+	for _, o := range orders {
+		planIdSet[o.PlanId] = struct{}{}
+	}
+	planIds := make([]int, 0, len(planIdSet))
+	for pid := range planIdSet {
+		planIds = append(planIds, pid)
+	}
+	titleMap, _ := GetSubscriptionPlanTitlesByIds(planIds)
+	result := make([]SubscriptionOrderSelfItem, 0, len(orders))
+	for _, o := range orders {
+		result = append(result, SubscriptionOrderSelfItem{
+			Id:            o.Id,
+			PlanId:        o.PlanId,
+			PlanTitle:     titleMap[o.PlanId],
+			Money:         o.Money,
+			TradeNo:       o.TradeNo,
+			PaymentMethod: o.PaymentMethod,
+			Status:        o.Status,
+			CreateTime:    o.CreateTime,
+			CompleteTime:  o.CompleteTime,
+		})
+	}
+	return result, total, nil
+}
+
+// ---- Admin: Delete / Restore Subscription Plan ----
+
+// SubscriptionPlanReferences counts the records that still point at a plan
+type SubscriptionPlanReferences struct {
+	Subscriptions int64 `json:"subscriptions"`
+	Orders        int64 `json:"orders"`
+	Redemptions   int64 `json:"redemptions"`
+}
+
+func (r SubscriptionPlanReferences) Total() int64 {
+	return r.Subscriptions + r.Orders + r.Redemptions
+}
+
+// checkHardDelete only allows removing the row when nothing references the plan
+func (r SubscriptionPlanReferences) checkHardDelete() error {
+	if r.Total() == 0 {
+		return nil
+	}
+	return fmt.Errorf("该套餐仍被引用（订阅 %d 个，订单 %d 个，兑换码 %d 个），无法彻底删除: %w",
+		r.Subscriptions, r.Orders, r.Redemptions, ErrSubscriptionPlanReferenced)
+}
+
+func countSubscriptionPlanReferences(planId int) (SubscriptionPlanReferences, error) {
+	var refs SubscriptionPlanReferences
+	if err := DB.Model(&UserSubscription{}).Where("plan_id = ?", planId).Count(&refs.Subscriptions).Error; err != nil {
+		return refs, err
+	}
+	if err := DB.Model(&SubscriptionOrder{}).Where("plan_id = ?", planId).Count(&refs.Orders).Error; err != nil {
+		return refs, err
+	}
+	if err := DB.Unscoped().Model(&Redemption{}).Where("plan_id = ?", planId).Count(&refs.Redemptions).Error; err != nil {
+		return refs, err
+	}
+	return refs, nil
+}
+
+// AdminDeleteSubscriptionPlan soft-deletes a plan by default. Soft-deleted plans are hidden from
+// listings and purchasing but existing subscriptions keep working. hard removes the row and is
+// only allowed when no subscription, order or redemption code references the plan.
+func AdminDeleteSubscriptionPlan(planId int, hard bool) error {
 	if planId <= 0 {
 		return errors.New("invalid planId")
 	}
-	// Check for active subscriptions
-	now := common.GetTimestamp()
-	var activeCount int64
-	if err := DB.Model(&UserSubscription{}).
-		Where("plan_id = ? AND status = ? AND end_time > ?", planId, "active", now).
-		Count(&activeCount).Error; err != nil {
-		return err
+	if !hard {
+		result := DB.Where("id = ?", planId).Delete(&SubscriptionPlan{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSubscriptionPlanNotFound
+		}
+		InvalidateSubscriptionPlanCache(planId)
+		return nil
 	}
-	if activeCount > 0 {
-		return fmt.Errorf("该套餐仍有 %d 个活跃订阅，无法删除", activeCount)
+	refs, err := countSubscriptionPlanReferences(planId)
+	if err != nil {
+		return err
 	}
-	if err := DB.Where("id = ?", planId).Delete(&SubscriptionPlan{}).Error; err != nil {
+	if err := refs.checkHardDelete(); err != nil {
 		return err
 	}
+	result := DB.Unscoped().Where("id = ?", planId).Delete(&SubscriptionPlan{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionPlanNotFound
+	}
+	InvalidateSubscriptionPlanCache(planId)
+	return nil
+}
+
+// AdminRestoreSubscriptionPlan undoes a soft delete
+func AdminRestoreSubscriptionPlan(planId int) error {
+	if planId <= 0 {
+		return errors.New("invalid planId")
+	}
+	result := DB.Unscoped().Model(&SubscriptionPlan{}).
+		Where("id = ? AND deleted_at IS NOT NULL", planId).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionPlanNotDeleted
+	}
 	InvalidateSubscriptionPlanCache(planId)
 	return nil
 }
@@ -1413,7 +1653,8 @@ func GetSubscriptionPlanUsageStats() ([]SubscriptionPlanUsageStat, error) {
 	expiringThreshold := now + 7*24*3600
 
 	var plans []SubscriptionPlan
-	if err := DB.Order("sort_order desc, id desc").Find(&plans).Error; err != nil {
+	// Soft-deleted plans stay in reports
+	if err := DB.Unscoped().Order("sort_order desc, id desc").Find(&plans).Error; err != nil {
 		return nil, err
 	}
 	if len(plans) == 0 {
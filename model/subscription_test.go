@@ -0,0 +1,149 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSubscriptionPlanVisibleToGroups(t *testing.T) {
+	t.Parallel()
+
+	plans := []SubscriptionPlan{
+		{Id: 1, Title: "public"},
+		{Id: 2, Title: "partner", VisibleToGroups: []string{"partner", "vip"}},
+	}
+
+	require.True(t, plans[0].IsVisibleToGroup("default"))
+	require.False(t, plans[1].IsVisibleToGroup("default"))
+	require.True(t, plans[1].IsVisibleToGroup("vip"))
+
+	visible := FilterSubscriptionPlansByGroup(plans, "default")
+	require.Len(t, visible, 1)
+	require.Equal(t, 1, visible[0].Id)
+
+	visible = FilterSubscriptionPlansByGroup(plans, "partner")
+	require.Len(t, visible, 2)
+}
+
+func TestCheckSubscriptionRefundPolicy(t *testing.T) {
+	t.Parallel()
+
+	const day = int64(24 * 3600)
+	start := int64(1_700_000_000)
+	sub := &UserSubscription{StartTime: start}
+
+	nonRefundable := &SubscriptionPlan{Refundable: false}
+	require.ErrorIs(t, CheckSubscriptionRefundPolicy(nonRefundable, sub, start+day), ErrSubscriptionNotRefundable)
+
+	sevenDays := &SubscriptionPlan{Refundable: true, RefundableDays: 7}
+	require.NoError(t, CheckSubscriptionRefundPolicy(sevenDays, sub, start+3*day))
+	require.NoError(t, CheckSubscriptionRefundPolicy(sevenDays, sub, start+7*day))
+	require.ErrorIs(t, CheckSubscriptionRefundPolicy(sevenDays, sub, start+7*day+1), ErrSubscriptionRefundWindowPassed)
+
+	anytime := &SubscriptionPlan{Refundable: true}
+	require.NoError(t, CheckSubscriptionRefundPolicy(anytime, sub, start+365*day))
+
+	require.Error(t, CheckSubscriptionRefundPolicy(nil, sub, start))
+}
+
+// setupSubscriptionPlanTestDB points DB at a private in-memory SQLite database for the test
+func setupSubscriptionPlanTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	origDB, origSQLite := DB, common.UsingSQLite
+	DB, common.UsingSQLite = db, true
+	t.Cleanup(func() { DB, common.UsingSQLite = origDB, origSQLite })
+	require.NoError(t, ensureSubscriptionPlanTableSQLite())
+	require.NoError(t, DB.AutoMigrate(&UserSubscription{}, &SubscriptionOrder{}, &Redemption{}))
+}
+
+func TestSubscriptionPlanSoftDeleteRestore(t *testing.T) {
+	setupSubscriptionPlanTestDB(t)
+
+	plan := &SubscriptionPlan{Title: "monthly", PriceAmount: 10, Enabled: true, Purchasable: true}
+	require.NoError(t, DB.Create(plan).Error)
+	sub := &UserSubscription{UserId: 1, PlanId: plan.Id, Status: "active", EndTime: common.GetTimestamp() + 3600}
+	require.NoError(t, DB.Create(sub).Error)
+
+	require.NoError(t, AdminDeleteSubscriptionPlan(plan.Id, false))
+
+	// Hidden from listings, still resolvable for existing subscriptions
+	var listed []SubscriptionPlan
+	require.NoError(t, DB.Find(&listed).Error)
+	require.Empty(t, listed)
+	got, err := GetSubscriptionPlanById(plan.Id)
+	require.NoError(t, err)
+	require.True(t, got.IsDeleted())
+	_, err = AdminBindSubscription(2, plan.Id, "")
+	require.ErrorIs(t, err, ErrSubscriptionPlanDeleted)
+
+	require.NoError(t, AdminRestoreSubscriptionPlan(plan.Id))
+	require.ErrorIs(t, AdminRestoreSubscriptionPlan(plan.Id), ErrSubscriptionPlanNotDeleted)
+	require.NoError(t, DB.Find(&listed).Error)
+	require.Len(t, listed, 1)
+	got, err = GetSubscriptionPlanById(plan.Id)
+	require.NoError(t, err)
+	require.False(t, got.IsDeleted())
+}
+
+func TestSubscriptionPlanHardDeleteGuard(t *testing.T) {
+	setupSubscriptionPlanTestDB(t)
+
+	referenced := &SubscriptionPlan{Title: "referenced", PriceAmount: 10}
+	unused := &SubscriptionPlan{Title: "unused", PriceAmount: 10}
+	require.NoError(t, DB.Create(referenced).Error)
+	require.NoError(t, DB.Create(unused).Error)
+	require.NoError(t, (&SubscriptionOrder{UserId: 1, PlanId: referenced.Id, TradeNo: "SUB-guard"}).Insert())
+
+	require.ErrorIs(t, AdminDeleteSubscriptionPlan(referenced.Id, true), ErrSubscriptionPlanReferenced)
+	require.NoError(t, AdminDeleteSubscriptionPlan(unused.Id, true))
+
+	var count int64
+	require.NoError(t, DB.Unscoped().Model(&SubscriptionPlan{}).Where("id = ?", unused.Id).Count(&count).Error)
+	require.Zero(t, count)
+	require.ErrorIs(t, AdminDeleteSubscriptionPlan(unused.Id, true), ErrSubscriptionPlanNotFound)
+}
+
+func TestGetUserSubscriptionOrders(t *testing.T) {
+	setupSubscriptionPlanTestDB(t)
+
+	plan := &SubscriptionPlan{Title: "monthly", PriceAmount: 10, Enabled: true, Purchasable: true}
+	require.NoError(t, DB.Create(plan).Error)
+	orders := []*SubscriptionOrder{
+		{UserId: 1, PlanId: plan.Id, Money: 10, TradeNo: "sub-1", PaymentMethod: "stripe", Status: "success", CompleteTime: 100, ProviderPayload: `{"secret":"x"}`},
+		{UserId: 2, PlanId: plan.Id, Money: 10, TradeNo: "sub-2", PaymentMethod: "epay", Status: "success"},
+		{UserId: 1, PlanId: plan.Id, Money: 10, TradeNo: "sub-3", PaymentMethod: "epay", Status: "pending"},
+	}
+	for _, o := range orders {
+		require.NoError(t, o.Insert())
+	}
+
+	items, total, err := GetUserSubscriptionOrders(1, "", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, items, 2)
+	require.Equal(t, "sub-3", items[0].TradeNo)
+	require.Equal(t, "sub-1", items[1].TradeNo)
+	require.Equal(t, "monthly", items[1].PlanTitle)
+	require.EqualValues(t, 100, items[1].CompleteTime)
+
+	items, total, err = GetUserSubscriptionOrders(1, "success", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, "sub-1", items[0].TradeNo)
+
+	items, total, err = GetUserSubscriptionOrders(1, "", 1, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, items, 1)
+	require.Equal(t, "sub-1", items[0].TradeNo)
+
+	_, _, err = GetUserSubscriptionOrders(0, "", 0, 10)
+	require.Error(t, err)
+}
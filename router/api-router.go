@@ -138,6 +138,8 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.GET("/plans", controller.GetSubscriptionPlans)
 			subscriptionRoute.GET("/self", controller.GetSubscriptionSelf)
 			subscriptionRoute.PUT("/self/preference", controller.UpdateSubscriptionPreference)
+			subscriptionRoute.GET("/self/billing-source", controller.GetSubscriptionBillingSource)
+			subscriptionRoute.GET("/self/orders", controller.GetSubscriptionOrdersSelf)
 			subscriptionRoute.POST("/epay/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestEpay)
 			subscriptionRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestStripePay)
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
@@ -150,6 +152,7 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.PUT("/plans/:id", controller.AdminUpdateSubscriptionPlan)
 			subscriptionAdminRoute.PATCH("/plans/:id", controller.AdminUpdateSubscriptionPlanStatus)
 			subscriptionAdminRoute.DELETE("/plans/:id", controller.AdminDeleteSubscriptionPlan)
+			subscriptionAdminRoute.POST("/plans/:id/restore", controller.AdminRestoreSubscriptionPlan)
 			subscriptionAdminRoute.POST("/bind", controller.AdminBindSubscription)
 
 			// Subscription orders (admin)
@@ -391,6 +394,22 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			proxyDetectRoute.POST("/models", controller.ProxyDetectListModels)
 			proxyDetectRoute.POST("/detect", controller.ProxyDetect)
+			proxyDetectRoute.POST("/estimate", controller.ProxyDetectEstimate)
+			proxyDetectRoute.POST("/health", controller.ProxyDetectAccountHealth)
+			proxyDetectRoute.GET("/availability-cache", middleware.AdminAuth(), controller.GetProxyDetectAvailabilityCache)
+			proxyDetectRoute.GET("/metrics", middleware.AdminAuth(), controller.GetProxyDetectMetrics)
+			proxyDetectRoute.POST("/caches/clear", middleware.AdminAuth(), controller.ClearProxyDetectCaches)
+			proxyDetectRoute.GET("/audit", middleware.AdminAuth(), controller.GetProxyDetectAudits)
+			proxyDetectRoute.GET("/timeline", middleware.AdminAuth(), controller.GetProxyDetectTimeline)
+			proxyDetectRoute.GET("/history", middleware.AdminAuth(), controller.GetProxyDetectHistory)
+			proxyDetectRoute.POST("/channels", middleware.AdminAuth(), controller.ProxyDetectChannels)
+			proxyDetectRoute.POST("/batch", middleware.AdminAuth(), controller.ProxyDetectBatch)
+			proxyDetectRoute.POST("/compare", middleware.AdminAuth(), controller.ProxyDetectCompare)
+			proxyDetectRoute.POST("/analyze", middleware.AdminAuth(), controller.ProxyDetectAnalyze)
+			proxyDetectRoute.GET("/weights", middleware.AdminAuth(), controller.GetProxyDetectScoringWeights)
+			proxyDetectRoute.PUT("/weights", middleware.AdminAuth(), controller.UpdateProxyDetectScoringWeights)
+			proxyDetectRoute.GET("/scan-models", middleware.AdminAuth(), controller.GetProxyDetectScanModels)
+			proxyDetectRoute.PUT("/scan-models", middleware.AdminAuth(), controller.UpdateProxyDetectScanModels)
 		}
 
 		ticketRoute := apiRouter.Group("/ticket")
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// BillingSourceNone means neither subscription nor wallet can fund the request
+const BillingSourceNone = "none"
+
+// BillingSourceDecision explains which funding source the next request would be charged against
+type BillingSourceDecision struct {
+	Model             string `json:"model"`
+	BillingPreference string `json:"billing_preference"`
+	Source            string `json:"source"`
+	SubscriptionId    int    `json:"subscription_id,omitempty"`
+	PlanId            int    `json:"plan_id,omitempty"`
+	PlanTitle         string `json:"plan_title,omitempty"`
+	WalletQuota       int    `json:"wallet_quota"`
+	Reason            string `json:"reason"`
+}
+
+// billingSubscriptionCandidate is an active subscription with its effective remaining amount
+type billingSubscriptionCandidate struct {
+	Sub       model.UserSubscription
+	PlanTitle string
+}
+
+// usable mirrors PreConsumeUserSubscription: unlimited, or enough remaining for amount.
+// A subscription whose reset is already due counts as fully available.
+func (c billingSubscriptionCandidate) usable(amount int64, now int64) bool {
+	if c.Sub.AmountTotal <= 0 {
+		return true
+	}
+	used := c.Sub.AmountUsed
+	if c.Sub.NextResetTime > 0 && c.Sub.NextResetTime <= now {
+		used = 0
+	}
+	return c.Sub.AmountTotal-used >= amount
+}
+
+// decideBillingSource applies the same preference and fallback rules as NewBillingSession.
+// amount is the minimum pre-consume (1 for a preview).
+func decideBillingSource(pref string, candidates []billingSubscriptionCandidate, walletQuota int, amount int64, now int64) BillingSourceDecision {
+	decision := BillingSourceDecision{
+		BillingPreference: common.NormalizeBillingPreference(pref),
+		WalletQuota:       walletQuota,
+	}
+
+	// PreConsumeUserSubscription picks the earliest-expiring subscription with enough remaining
+	sorted := make([]billingSubscriptionCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Sub.EndTime != sorted[j].Sub.EndTime {
+			return sorted[i].Sub.EndTime < sorted[j].Sub.EndTime
+		}
+		return sorted[i].Sub.Id < sorted[j].Sub.Id
+	})
+	var picked *billingSubscriptionCandidate
+	for i := range sorted {
+		if sorted[i].usable(amount, now) {
+			picked = &sorted[i]
+			break
+		}
+	}
+	walletOK := walletQuota > 0 && int64(walletQuota) >= amount
+
+	useSubscription := func(reason string) BillingSourceDecision {
+		decision.Source = BillingSourceSubscription
+		decision.SubscriptionId = picked.Sub.Id
+		decision.PlanId = picked.Sub.PlanId
+		decision.PlanTitle = picked.PlanTitle
+		decision.Reason = fmt.Sprintf("%s，使用订阅套餐「%s」(#%d)", reason, picked.PlanTitle, picked.Sub.Id)
+		return decision
+	}
+	useWallet := func(reason string) BillingSourceDecision {
+		decision.Source = BillingSourceWallet
+		decision.Reason = reason
+		return decision
+	}
+	none := func(reason string) BillingSourceDecision {
+		decision.Source = BillingSourceNone
+		decision.Reason = reason
+		return decision
+	}
+
+	switch decision.BillingPreference {
+	case "subscription_only":
+		if picked != nil {
+			return useSubscription("仅使用订阅")
+		}
+		if len(candidates) == 0 {
+			return none("仅使用订阅，但没有生效中的订阅")
+		}
+		return none("仅使用订阅，但所有订阅额度已用尽")
+	case "wallet_only":
+		if walletOK {
+			return useWallet("仅使用钱包")
+		}
+		return none("仅使用钱包，但钱包余额不足")
+	case "wallet_first":
+		if walletOK {
+			return useWallet("钱包优先，钱包余额充足")
+		}
+		if picked != nil {
+			return useSubscription("钱包优先，但钱包余额不足，回退到订阅")
+		}
+		return none("钱包余额不足，且没有可用的订阅")
+	default:
+		if picked != nil {
+			return useSubscription("订阅优先")
+		}
+		if walletOK {
+			if len(candidates) == 0 {
+				return useWallet("订阅优先，但没有生效中的订阅，使用钱包")
+			}
+			return useWallet("订阅优先，但所有订阅额度已用尽，回退到钱包")
+		}
+		return none("没有可用的订阅，且钱包余额不足")
+	}
+}
+
+// ResolveBillingSource reports which source a request for modelName would be charged against
+// under the user's billing preference. It does not reserve any quota.
+func ResolveBillingSource(userId int, modelName string) (BillingSourceDecision, error) {
+	settingMap, _ := model.GetUserSetting(userId, false)
+	subs, err := model.GetAllActiveUserSubscriptions(userId)
+	if err != nil {
+		return BillingSourceDecision{}, err
+	}
+	walletQuota, err := model.GetUserQuota(userId, false)
+	if err != nil {
+		return BillingSourceDecision{}, err
+	}
+
+	candidates := make([]billingSubscriptionCandidate, 0, len(subs))
+	for _, summary := range subs {
+		if summary.Subscription == nil {
+			continue
+		}
+		candidate := billingSubscriptionCandidate{Sub: *summary.Subscription}
+		if plan, err := model.GetSubscriptionPlanById(summary.Subscription.PlanId); err == nil && plan != nil {
+			candidate.PlanTitle = plan.Title
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	decision := decideBillingSource(settingMap.BillingPreference, candidates, walletQuota, 1, common.GetTimestamp())
+	decision.Model = modelName
+	return decision, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecideBillingSource(t *testing.T) {
+	const now = int64(1_700_000_000)
+	later := billingSubscriptionCandidate{Sub: model.UserSubscription{Id: 2, PlanId: 20, AmountTotal: 100, AmountUsed: 10, EndTime: now + 7200}, PlanTitle: "Later"}
+	sooner := billingSubscriptionCandidate{Sub: model.UserSubscription{Id: 1, PlanId: 10, AmountTotal: 0, EndTime: now + 3600}, PlanTitle: "Sooner"}
+	exhausted := billingSubscriptionCandidate{Sub: model.UserSubscription{Id: 3, PlanId: 30, AmountTotal: 100, AmountUsed: 100, EndTime: now + 60}, PlanTitle: "Exhausted"}
+	resetDue := exhausted
+	resetDue.Sub.NextResetTime = now - 1
+
+	cases := []struct {
+		name       string
+		pref       string
+		candidates []billingSubscriptionCandidate
+		wallet     int
+		source     string
+		subId      int
+	}{
+		{"default prefers earliest-expiring usable subscription", "", []billingSubscriptionCandidate{later, exhausted, sooner}, 500, BillingSourceSubscription, 1},
+		{"subscription first falls back to wallet", "subscription_first", []billingSubscriptionCandidate{exhausted}, 500, BillingSourceWallet, 0},
+		{"subscription first without subscriptions", "subscription_first", nil, 500, BillingSourceWallet, 0},
+		{"due reset makes subscription usable", "subscription_first", []billingSubscriptionCandidate{resetDue}, 0, BillingSourceSubscription, 3},
+		{"wallet first uses wallet", "wallet_first", []billingSubscriptionCandidate{later}, 500, BillingSourceWallet, 0},
+		{"wallet first falls back to subscription", "wallet_first", []billingSubscriptionCandidate{later}, 0, BillingSourceSubscription, 2},
+		{"wallet only with empty wallet", "wallet_only", []billingSubscriptionCandidate{later}, 0, BillingSourceNone, 0},
+		{"subscription only exhausted", "subscription_only", []billingSubscriptionCandidate{exhausted}, 500, BillingSourceNone, 0},
+		{"nothing available", "subscription_first", []billingSubscriptionCandidate{exhausted}, 0, BillingSourceNone, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision := decideBillingSource(tc.pref, tc.candidates, tc.wallet, 1, now)
+			require.Equal(t, tc.source, decision.Source)
+			require.Equal(t, tc.subId, decision.SubscriptionId)
+			require.NotEmpty(t, decision.Reason)
+		})
+	}
+
+	decision := decideBillingSource("bogus", []billingSubscriptionCandidate{sooner}, 0, 1, now)
+	require.Equal(t, "subscription_first", decision.BillingPreference)
+	require.Equal(t, "Sooner", decision.PlanTitle)
+	require.Equal(t, 10, decision.PlanId)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -10,11 +11,16 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 )
 
 // Fingerprint constants
@@ -25,18 +31,63 @@ const (
 	kiroModelPrefix     = "kiro-"
 	bedrockModelPrefix  = "anthropic."
 
-	thinkingSigShortThreshold = 100
+	// Max models detected at the same time in a multi-model scan
+	multiScanConcurrency = 3
+	// Max tool probes in flight for one model, see DetectOptions.Concurrency
+	maxProbeConcurrency = 3
+	// Tool probe rounds when none are requested, and the most a detection may ask for
+	defaultDetectRounds = 2
+	maxDetectRounds     = 3
 
-	// Overall timeout for a single detection (all probes for one model)
-	singleDetectTimeout = 120 * time.Second
-	// Overall timeout for multi-model scan
-	multiScanTimeout = 300 * time.Second
-	// Timeout for individual probe requests
-	probeTimeout = 60 * time.Second
-	// Timeout for model availability check
-	availCheckTimeout = 20 * time.Second
+	// Default anthropic-version header sent with probes
+	defaultAnthropicVersion = "2023-06-01"
+
+	// Max length of a caller-provided trace ID
+	maxTraceIDLen = 64
+
+	// Messages API path appended to the base URL unless overridden
+	defaultMessagesPath = "/v1/messages"
+	// Max length of a messages path override
+	maxMessagesPathLen = 256
+
+	// max_tokens requested by the max_tokens probe; a stop well below it means the upstream capped it
+	maxTokensProbeLimit = 1024
+	// A max_tokens stop below this ratio of the requested limit is treated as a silent cap
+	maxTokensCapRatio = 0.9
+
+	// Repeated tool probes faster and steadier than this look like cached responses
+	cachedLatencyMaxMeanMs   = 300
+	cachedLatencyMaxStdDevMs = 15
+
+	// Ratelimit samples taken by VerifyRatelimit, detection probe samples included
+	ratelimitVerifyShots = 4
+)
+
+// Probe failure classes recorded in Fingerprint.ErrorClass
+const (
+	ProbeErrorAuth       = "auth"       // HTTP 401/403
+	ProbeErrorNetwork    = "network"    // connection failed
+	ProbeErrorTimeout    = "timeout"    // request or detection deadline exceeded
+	ProbeErrorHTTP       = "http"       // other non-200 status
+	ProbeErrorParse      = "parse"      // response unreadable or not a Messages body
+	ProbeErrorRequest    = "request"    // request could not be built
+	ProbeErrorBudget     = "budget"     // skipped, the scan output-token budget is used up
+	ProbeErrorOverloaded = "overloaded" // HTTP 529 overloaded_error after the retries
 )
 
+// Detection presets
+const (
+	DetectPresetStandard = "standard"
+	// DetectPresetThorough enables extra probes that cost noticeably more tokens
+	DetectPresetThorough = "thorough"
+	// DetectPresetQuick sends a single tool probe for a provisional verdict, for triaging many
+	// channels before auditing the suspicious ones with a full detection
+	DetectPresetQuick = "quick"
+)
+
+// Upper bound of a quick detection, whatever the configured timeouts
+const quickDetectTimeout = 5 * time.Second
+
 var (
 	msgIDUUIDPattern = regexp.MustCompile(`(?i)^msg_[0-9a-f]{8}-[0-9a-f]{4}-`)
 	toolNPattern     = regexp.MustCompile(`^tool_\d+$`)
@@ -46,61 +97,242 @@ var (
 	anthropicHeaderKeywords = []string{"anthropic-ratelimit", "x-ratelimit", "retry-after"}
 )
 
-// DefaultScanModels are the default models for multi-model scanning
-var DefaultScanModels = []string{
-	"claude-opus-4-6-thinking",
-	"claude-opus-4-6-20250918",
-	"claude-sonnet-4-5-20250929",
-	"claude-haiku-4-5-20251001",
-	"claude-3-5-sonnet-20241022",
-	"claude-3-haiku-20240307",
+// KnownAnthropicVersions are the published anthropic-version header values
+var KnownAnthropicVersions = []string{
+	"2023-06-01",
+	"2023-01-01",
 }
 
 // Fingerprint holds the extracted fingerprint from a single probe
 type Fingerprint struct {
-	ToolID           string `json:"tool_id"`
-	ToolIDSource     string `json:"tool_id_source"`
-	MsgID            string `json:"msg_id"`
-	MsgIDSource      string `json:"msg_id_source"`
-	MsgIDFormat      string `json:"msg_id_format"`
-	Model            string `json:"model"`
-	ModelRequested   string `json:"model_requested"`
-	ModelSource      string `json:"model_source"`
-	UsageStyle       string `json:"usage_style"`
-	HasServiceTier   bool   `json:"has_service_tier"`
-	ServiceTier      string `json:"service_tier"`
-	HasInferenceGeo  bool   `json:"has_inference_geo"`
-	InferenceGeo     string `json:"inference_geo"`
-	HasCacheCreation bool   `json:"has_cache_creation_obj"`
-	HasAWSHeaders    bool   `json:"has_aws_headers"`
-	HasAnthropicHdrs bool   `json:"has_anthropic_headers"`
-	ThinkingSigClass string `json:"thinking_sig_class"`
-	ThinkingSigLen   int    `json:"thinking_sig_len"`
-	ProbeType        string `json:"probe_type"`
-	LatencyMs        int64  `json:"latency_ms"`
-	StopReason       string `json:"stop_reason"`
+	ToolID           string   `json:"tool_id"`
+	ToolIDSource     string   `json:"tool_id_source"`
+	MsgID            string   `json:"msg_id"`
+	MsgIDSource      string   `json:"msg_id_source"`
+	MsgIDFormat      string   `json:"msg_id_format"`
+	Model            string   `json:"model"`
+	ModelRequested   string   `json:"model_requested"`
+	ModelSource      string   `json:"model_source"`
+	UsageStyle       string   `json:"usage_style"`
+	HasServiceTier   bool     `json:"has_service_tier"`
+	ServiceTier      string   `json:"service_tier"`
+	HasInferenceGeo  bool     `json:"has_inference_geo"`
+	InferenceGeo     string   `json:"inference_geo"`
+	HasCacheCreation bool     `json:"has_cache_creation_obj"`
+	HasAWSHeaders    bool     `json:"has_aws_headers"`
+	HasAnthropicHdrs bool     `json:"has_anthropic_headers"`
+	ThinkingSigClass string   `json:"thinking_sig_class"`
+	ThinkingSigLen   int      `json:"thinking_sig_len"`
+	ProbeType        string   `json:"probe_type"`
+	LatencyMs        int64    `json:"latency_ms"`
+	StopReason       string   `json:"stop_reason"`
 	ProxyPlatform    string   `json:"proxy_platform,omitempty"`
 	PlatformClues    []string `json:"platform_clues,omitempty"`
 	Error            string   `json:"error,omitempty"`
+	// Coarse failure class, see ProbeError* (empty when Error is empty)
+	ErrorClass string `json:"error_class,omitempty"`
+	// Source of an HTML error page answered instead of JSON, see ErrorKind*
+	ErrorKind string `json:"error_kind,omitempty"`
 	// Rate limit headers (Anthropic-specific)
 	RatelimitInputLimit     int    `json:"ratelimit_input_limit,omitempty"`
 	RatelimitInputRemaining int    `json:"ratelimit_input_remaining,omitempty"`
 	RatelimitInputReset     string `json:"ratelimit_input_reset,omitempty"`
+	// When the upstream produced the response carrying RatelimitInputReset
+	RatelimitObservedAt time.Time `json:"-"`
+	// Streaming timing (stream probe): time to first SSE event vs whole stream
+	TTFTMs         int64 `json:"ttft_ms,omitempty"`
+	StreamTotalMs  int64 `json:"stream_total_ms,omitempty"`
+	StreamEvents   int   `json:"stream_events,omitempty"`
+	StreamBuffered bool  `json:"stream_buffered,omitempty"`
+	// SSE event types in arrival order with consecutive repeats collapsed, whether a ping
+	// arrived and whether the order matches the official framing (stream probe)
+	StreamEventOrder []string `json:"stream_event_order,omitempty"`
+	HasPingEvent     bool     `json:"has_ping_event,omitempty"`
+	StreamCanonical  bool     `json:"stream_canonical,omitempty"`
+	// All events arrived at once (re-emitted blob), or plain JSON came back for stream:true
+	StreamBlob   bool `json:"stream_blob,omitempty"`
+	StreamNotSSE bool `json:"stream_not_sse,omitempty"`
+	// Output size and inferred upstream max_tokens cap (max_tokens probe)
+	OutputTokens       int `json:"output_tokens,omitempty"`
+	OutputChars        int `json:"output_chars,omitempty"`
+	EffectiveMaxTokens int `json:"effective_max_tokens,omitempty"`
+	// Whether the reply followed the top-level system prompt (system probe)
+	SystemHonored bool `json:"system_honored,omitempty"`
+	// Whether the upstream stopped on the requested stop sequence, the stop_sequence it
+	// reported, and whether the sequence leaked into the output (stop_sequences probe)
+	StopSequencesHonored bool   `json:"stop_sequences_honored,omitempty"`
+	StopSequence         string `json:"stop_sequence,omitempty"`
+	StopSequenceLeaked   bool   `json:"stop_sequence_leaked,omitempty"`
+	// Content block types in response order, e.g. ["thinking", "text"]
+	ContentBlockShape []string `json:"content_block_shape,omitempty"`
+	// Whether usage sub-fields add up; false with UsageIssues listing the impossibilities
+	UsageConsistent bool         `json:"usage_consistent"`
+	UsageIssues     []UsageIssue `json:"usage_issues,omitempty"`
+	// usage keys outside the known Anthropic set (snake_case usage only), sorted
+	ExtraUsageFields []string `json:"extra_usage_fields,omitempty"`
+	// False when stop_reason is present but outside anthropicStopReasons
+	StopReasonStandard bool `json:"stop_reason_standard"`
+	// API family of the stop_reason value set, see StopReasonFamily*
+	StopReasonFamily string `json:"stop_reason_family,omitempty"`
+	// Wire casing of the anthropic-* / request-id header names, see HeaderCase* (header_case probe)
+	HeaderCase string `json:"header_case,omitempty"`
+	// Protocol negotiated over TLS (resp.Proto, e.g. HTTP/2.0), empty for plain http targets
+	HTTPProtocol string `json:"http_protocol,omitempty"`
+	// IP of the connection the response came on (the outbound proxy when one is used)
+	RemoteIP string `json:"remote_ip,omitempty"`
+	// The success body exceeded ResponseBodyLimit and was not parsed (the probe failed)
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+	// Date response header minus local receive time in ms, 0 when Date is missing or unparseable
+	ServerClockSkewMs int64 `json:"server_clock_skew_ms,omitempty"`
+	// Redacted response as received, only with DetectOptions.IncludeRaw; never persisted
+	Raw *RawResponse `json:"raw,omitempty"`
+	// Gemini-native fields left by a translated generateContent reply, see GeminiSignal*
+	GeminiSignals []string `json:"gemini_signals,omitempty"`
+	// Wire Content-Encoding (gzip also when decompressed transparently) and body framing,
+	// see TransferEncoding*; empty framing means no fixed length without chunking
+	ContentEncoding  string `json:"content_encoding,omitempty"`
+	TransferEncoding string `json:"transfer_encoding,omitempty"`
+	// How the upstream answered an invalid anthropic-version, see VersionError* (bad_version probe)
+	VersionErrorShape string `json:"version_error_shape,omitempty"`
+	// service_tier sent in the request and how the upstream answered it, see ServiceTier*
+	// (service_tier probe); the tier it reported is in ServiceTier
+	ServiceTierRequested string `json:"service_tier_requested,omitempty"`
+	ServiceTierResponse  string `json:"service_tier_response,omitempty"`
+	// Whether the upstream read an image, see VisionSupported*, and for a rejection whether it
+	// came in Anthropic's error envelope (vision probe)
+	VisionSupported      string `json:"vision_supported,omitempty"`
+	VisionErrorAnthropic bool   `json:"vision_error_anthropic,omitempty"`
+	// usage.cache_read_input_tokens, and whether the repeated cache probe was billed cache
+	// reads (cache probe)
+	CacheReadTokens   int  `json:"cache_read_input_tokens,omitempty"`
+	CacheReadObserved bool `json:"cache_read_observed,omitempty"`
+	// usage keys in wire order and the platform profile they match, see UsageKeyProfile*
+	// (non-streaming probes)
+	UsageKeys       []string `json:"usage_keys,omitempty"`
+	UsageKeyProfile string   `json:"usage_key_profile,omitempty"`
+	// request-id (or x-request-id) response header, its format (see RequestIDFormat*) and
+	// whether it is Anthropic's own next to a genuine message id
+	RequestIDHeader     string `json:"request_id_header,omitempty"`
+	RequestIDFormat     string `json:"request_id_format,omitempty"`
+	RequestIDConsistent bool   `json:"request_id_consistent,omitempty"`
+	// Status of a failed (non-200) probe
+	HTTPStatus int `json:"http_status,omitempty"`
+	// system_fingerprint and origin of the OpenAI-format reply, see ChatCompletion*
+	// (chat_completions fallback probe)
+	SystemFingerprint    string `json:"system_fingerprint,omitempty"`
+	ChatCompletionSource string `json:"chat_completion_source,omitempty"`
+	// Retries after transient 429/5xx responses, and whether a retry after waiting the
+	// advertised Retry-After succeeded
+	Retries           int  `json:"retries,omitempty"`
+	RetryAfterHonored bool `json:"retry_after_honored,omitempty"`
+	// Whether any attempt got HTTP 529, and whether one carried Anthropic's exact
+	// overloaded_error body
+	Overloaded          bool `json:"overloaded,omitempty"`
+	OverloadedAnthropic bool `json:"overloaded_anthropic,omitempty"`
+	// Which credential header alone the upstream accepts (auth probe)
+	AcceptsXAPIKey bool `json:"accepts_x_api_key,omitempty"`
+	AcceptsBearer  bool `json:"accepts_bearer,omitempty"`
+	// Relay depth and entries from the Via / Forwarded / X-Forwarded-* response headers,
+	// see parseForwardedChain
+	ProxyHops      int      `json:"proxy_hops,omitempty"`
+	ForwardedChain []string `json:"forwarded_chain,omitempty"`
+	// Non-Claude model family named by the reply, model field or error body, the matched
+	// text and where it was found, see BackendLLMSource*
+	BackendLLM       string `json:"backend_llm,omitempty"`
+	BackendLLMMatch  string `json:"backend_llm_match,omitempty"`
+	BackendLLMSource string `json:"backend_llm_source,omitempty"`
 }
 
 // DetectResult holds the analysis result for a single model
 type DetectResult struct {
-	Verdict          string                 `json:"verdict"`
-	VerdictText      string                 `json:"verdict_text"`
-	Confidence       float64                `json:"confidence"`
-	Scores           map[string]int         `json:"scores"`
-	Evidence         []string               `json:"evidence"`
-	Fingerprints     []Fingerprint          `json:"fingerprints"`
-	Model            string                 `json:"model"`
-	AvgLatencyMs     int64                  `json:"avg_latency_ms"`
-	ProxyPlatform    string                 `json:"proxy_platform"`
-	PlatformClues    []string               `json:"platform_clues,omitempty"`
-	RatelimitVerify  map[string]any         `json:"ratelimit_verify,omitempty"`
+	Verdict       string         `json:"verdict"`
+	VerdictText   string         `json:"verdict_text"`
+	Confidence    float64        `json:"confidence"`
+	Scores        map[string]int `json:"scores"`
+	Evidence      []string       `json:"evidence"`
+	EvidenceItems []EvidenceItem `json:"evidence_items"`
+	Fingerprints  []Fingerprint  `json:"fingerprints"`
+	Model         string         `json:"model"`
+	// Model name as requested when an alias was normalized into Model
+	ModelRequested string `json:"model_requested,omitempty"`
+	AvgLatencyMs   int64  `json:"avg_latency_ms"`
+	// Latency distribution of the successful probes, beside the average
+	LatencyStats    *LatencyStats          `json:"latency_stats,omitempty"`
+	ProxyPlatform   string                 `json:"proxy_platform"`
+	PlatformClues   []string               `json:"platform_clues,omitempty"`
+	RatelimitVerify *RatelimitVerification `json:"ratelimit_verify,omitempty"`
+	TraceID         string                 `json:"trace_id"`
+	// Deepest relay chain seen across the probes
+	ProxyHops      int      `json:"proxy_hops,omitempty"`
+	ForwardedChain []string `json:"forwarded_chain,omitempty"`
+	// Non-Claude model family behind the channel (backend_llm verdict)
+	BackendLLM string `json:"backend_llm,omitempty"`
+	// Leaf certificate of the target, only with DetectOptions.CaptureTLS on an https target
+	TLSIssuer       string   `json:"tls_issuer,omitempty"`
+	TLSSANs         []string `json:"tls_sans,omitempty"`
+	TLSCertProvider string   `json:"tls_cert_provider,omitempty"`
+	// Inferred upstream max_tokens cap, 0 if not capped or not probed
+	EffectiveMaxTokens int `json:"effective_max_tokens,omitempty"`
+	// anthropic-version header used by the probes
+	AnthropicVersion string `json:"anthropic_version"`
+	// Messages API path the probes were sent to
+	MessagesPath string `json:"messages_path"`
+	// Which KnownAnthropicVersions the upstream accepts (only with DetectOptions.CheckVersions)
+	VersionSupport map[string]bool `json:"version_support,omitempty"`
+	// Distinct inference_geo values seen across rounds, in first-seen order
+	InferenceGeos []string `json:"inference_geos,omitempty"`
+	// Signature lengths of the thinking probes, see ThinkingSigCheck
+	ThinkingSigLengths []int `json:"thinking_sig_lengths,omitempty"`
+	// Distinct connected IPs across the probes, in first-seen order
+	RemoteIPs []string `json:"remote_ips,omitempty"`
+	// Population variance (ms²) of the repeated tool probe latencies, 0 with fewer than 2 rounds
+	LatencyVariance float64 `json:"latency_variance"`
+	// Constant low latency together with repeated msg ids: responses are likely served from a cache
+	CachedResponse bool `json:"cached_response,omitempty"`
+	// The same tool_use id came back in more than one round: responses are replayed
+	DuplicateToolIDs bool `json:"duplicate_tool_ids,omitempty"`
+	// The echoed model or its ModelSource differed between probes: requests are spread over
+	// different backends
+	InconsistentBackend bool `json:"inconsistent_backend,omitempty"`
+	// Boolean flags for the UI, see computeDetectBadges
+	Badges DetectBadges `json:"badges"`
+	// Output tokens consumed against ScanOutputTokenBudget (standalone detection only;
+	// a multi-model scan reports it once on ScanResult)
+	TokenUsage *ProbeTokenUsage `json:"token_usage,omitempty"`
+	// Served from the result cache instead of probing again, see DetectOptions.Force
+	Cached bool `json:"cached,omitempty"`
+	// Provisional verdict of a DetectPresetQuick run from a single probe; a full detection
+	// is recommended before acting on it
+	Quick bool `json:"quick,omitempty"`
+	// Why the availability check failed for an "unavailable" verdict, see UnavailableReason*
+	UnavailableReason string `json:"unavailable_reason,omitempty"`
+}
+
+// RatelimitSample is one anthropic-ratelimit-input-tokens observation
+type RatelimitSample struct {
+	Remaining int    `json:"remaining"`
+	Reset     string `json:"reset"`
+	// Response time the reset is relative to, zero (omitted) if unknown
+	ObservedAt time.Time `json:"observed_at,omitzero"`
+}
+
+// RatelimitVerification holds the result of verifyRatelimitDynamic. Detail renders it for
+// display; the other fields carry the same findings for programmatic checks.
+type RatelimitVerification struct {
+	// Verdict is dynamic, static or unavailable
+	Verdict string            `json:"verdict"`
+	Detail  string            `json:"detail"`
+	Samples []RatelimitSample `json:"samples"`
+	// Remaining of the first sample minus that of the last (negative if it went up)
+	TotalDrop int `json:"total_drop"`
+	// Remaining never went up from one sample to the next, and dropped overall
+	Monotone bool `json:"monotone"`
+	// The reset timestamps passed checkRatelimitResets (ResetCheck is ok); false without them
+	ResetSane bool `json:"reset_sane"`
+	// How many of Samples were taken from the detection probes instead of extra requests
+	ReusedSamples int `json:"reused_samples"`
+	// Plausibility of the reset timestamps, see RatelimitReset*; empty without reset headers
+	ResetCheck string `json:"reset_check,omitempty"`
 }
 
 // ScanResult holds the result for multi-model scanning
@@ -109,15 +341,84 @@ type ScanResult struct {
 	ProxyPlatform string            `json:"proxy_platform"`
 	ModelResults  []DetectResult    `json:"model_results"`
 	Summary       map[string]string `json:"summary"`
-	IsMixed       bool              `json:"is_mixed"`
+	// UnavailableReason of each model whose Summary verdict is "unavailable"
+	SummaryReasons map[string]string `json:"summary_reasons,omitempty"`
+	IsMixed        bool              `json:"is_mixed"`
+	// Headline verdict of the channel across the scanned models, see AggregateChannelVerdict
+	ChannelVerdict *ChannelVerdict `json:"channel_verdict,omitempty"`
+	TraceID        string          `json:"trace_id"`
+	// Output tokens consumed by all probes of the scan against ScanOutputTokenBudget
+	TokenUsage *ProbeTokenUsage `json:"token_usage,omitempty"`
+	// Set when one verdict covers the whole channel and ended the scan early: invalid_key
+	// once any model saw the key rejected
+	Verdict     string `json:"verdict,omitempty"`
+	VerdictText string `json:"verdict_text,omitempty"`
+	// Set when the scan timeout ended the scan early: the index of the first requested model
+	// that was not scanned, and the models from there on (absent from ModelResults)
+	TruncatedAt     int      `json:"truncated_at,omitempty"`
+	UnscannedModels []string `json:"unscanned_models,omitempty"`
+}
+
+// DetectOptions holds the per-run options for DetectSingleModel and ScanMultipleModels
+type DetectOptions struct {
+	Rounds          int
+	SkipSSRFCheck   bool
+	VerifyRatelimit bool
+	// Preset is DetectPresetStandard (default), DetectPresetThorough or DetectPresetQuick
+	Preset string
+	// AnthropicVersion overrides the anthropic-version header; must be one of KnownAnthropicVersions
+	AnthropicVersion string
+	// CheckVersions probes every KnownAnthropicVersions value and reports which are accepted
+	CheckVersions bool
+	// TraceID correlates the logs of all probes in one run; generated if empty
+	TraceID string
+	// MessagesPath overrides defaultMessagesPath (admin only, see ValidateMessagesPath)
+	MessagesPath string
+	// Concurrency is how many tool probes run at once, 1 (sequential) when unset, capped at
+	// maxProbeConcurrency
+	Concurrency int
+	// PersistResult writes the result to ProxyDetectLog so runs form a history
+	PersistResult bool
+	// Lang selects the language of VerdictText and Evidence, DetectLangZh (default) or DetectLangEn
+	Lang string
+	// CaptureTLS sends the probes through a client that records the target TLS certificate
+	CaptureTLS bool
+	// Force probes again even when a result for the same target is cached
+	Force bool
+	// OutboundProxy routes the probes through an http, https or socks5 proxy. It requires
+	// SkipSSRFCheck, and CaptureTLS and the header_case probe are skipped with it.
+	OutboundProxy string
+	// CustomPrompts overrides the user message of a probe type for this run, see
+	// ValidateCustomPrompts
+	CustomPrompts map[string]string
+	// IncludeRaw attaches each probe's redacted response to its Fingerprint (admin only)
+	IncludeRaw bool
+	// Probes runs only these SelectableProbeTypes instead of the preset's probes, see
+	// ValidateProbeSelection
+	Probes []string
+	// ExtraHeaders are added to every probe for channels that route on a header, see
+	// ValidateExtraHeaders. OverrideCoreHeaders lets them replace the auth and version headers.
+	ExtraHeaders        map[string]string
+	OverrideCoreHeaders bool
 }
 
 var verdictTextMap = map[string]string{
 	"anthropic":   "Anthropic 官方 API",
 	"bedrock":     "AWS Bedrock (Kiro)",
 	"antigravity": "Google Vertex AI (Antigravity)",
+	"gemini":      "Google Gemini (原生 API 转译)",
 	"suspicious":  "疑似伪装 Anthropic",
+	"proxy":       "确认中转平台",
 	"unknown":     "无法确定",
+	"invalid_key": "API Key 无效",
+	"unreachable": "无法连接上游",
+	"timeout":     "检测超时",
+	"unavailable": "不可用",
+
+	"budget_exhausted": "探测预算耗尽",
+
+	"openai_translation": "OpenAI 格式转译",
+	"backend_llm":        "非 Claude 模型冒充",
 }
 
 // safeDialer returns a DialContext that blocks connections to private/internal IPs
@@ -129,6 +430,12 @@ func safeDialer() func(ctx context.Context, network, addr string) (net.Conn, err
 		if err != nil {
 			return nil, fmt.Errorf("invalid address: %v", err)
 		}
+		if err := checkTargetHost(host); err != nil {
+			return nil, err
+		}
+		if isMetadataHost(host) {
+			return nil, fmt.Errorf("connection to metadata endpoint blocked")
+		}
 
 		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
 		if err != nil {
@@ -136,18 +443,167 @@ func safeDialer() func(ctx context.Context, network, addr string) (net.Conn, err
 		}
 
 		for _, ipAddr := range ips {
-			ip := ipAddr.IP
-			if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
-				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
-				return nil, fmt.Errorf("connection to private IP blocked")
+			if err := checkProbeIP(ipAddr.IP); err != nil {
+				return nil, err
+			}
+		}
+
+		// Dial the checked addresses rather than the name, which could resolve differently
+		var dialErr error
+		for _, ipAddr := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ipAddr.IP.String(), port))
+			if err == nil {
+				return conn, nil
 			}
-			// Block cloud metadata endpoints (169.254.169.254)
-			if ip.Equal(net.ParseIP("169.254.169.254")) {
-				return nil, fmt.Errorf("connection to metadata endpoint blocked")
+			dialErr = err
+		}
+		if dialErr == nil {
+			dialErr = fmt.Errorf("no address found for %s", host)
+		}
+		return nil, dialErr
+	}
+}
+
+// checkTargetHost applies the configured target host denylist and allowlist. It only guards
+// probes that keep the SSRF check; admins skipping it may target any host.
+func checkTargetHost(host string) error {
+	setting := system_setting.GetProxyDetectSetting()
+	if system_setting.MatchTargetHost(setting.TargetHostDenylist, host) {
+		return fmt.Errorf("target host %s is denied", host)
+	}
+	if len(setting.TargetHostAllowlist) > 0 && !system_setting.MatchTargetHost(setting.TargetHostAllowlist, host) {
+		return fmt.Errorf("target host %s is not in the allowlist", host)
+	}
+	return nil
+}
+
+// checkProbeIP rejects cloud metadata and private/internal addresses
+func checkProbeIP(ip net.IP) error {
+	// Some metadata endpoints (e.g. Alibaba's 100.100.100.200) are not in a private range
+	if isMetadataIP(ip) {
+		return fmt.Errorf("connection to metadata endpoint blocked")
+	}
+	// IPv6 unique local (fc00::/7) is IsPrivate, fe80::/10 is IsLinkLocalUnicast; IPv4-mapped
+	// addresses are classified by their IPv4 form
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("connection to private IP blocked")
+	}
+	for _, n := range blockedIPv6Nets {
+		if n.Contains(ip) {
+			return fmt.Errorf("connection to private IP blocked")
+		}
+	}
+	if v4 := embeddedIPv4(ip); v4 != nil {
+		return checkProbeIP(v4)
+	}
+	return nil
+}
+
+// metadataDenylist is the parsed form of ProxyDetectSetting.MetadataDenylist
+type metadataDenylist struct {
+	hosts map[string]struct{}
+	nets  []*net.IPNet
+}
+
+// parseMetadataDenylist splits entries into hostnames and IP ranges; single IPs become /32 or /128
+func parseMetadataDenylist(entries []string) metadataDenylist {
+	list := metadataDenylist{hosts: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
 			}
+			list.nets = append(list.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			list.nets = append(list.nets, ipNet)
+			continue
+		}
+		list.hosts[normalizeMetadataHost(entry)] = struct{}{}
+	}
+	return list
+}
+
+func normalizeMetadataHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func (l metadataDenylist) containsIP(ip net.IP) bool {
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l metadataDenylist) containsHost(host string) bool {
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return l.containsIP(ip)
+	}
+	_, ok := l.hosts[normalizeMetadataHost(host)]
+	return ok
+}
+
+func currentMetadataDenylist() metadataDenylist {
+	return parseMetadataDenylist(system_setting.GetProxyDetectSetting().MetadataDenylistEntries())
+}
+
+// isMetadataIP reports whether ip is a configured cloud metadata address
+func isMetadataIP(ip net.IP) bool {
+	return currentMetadataDenylist().containsIP(ip)
+}
+
+// isMetadataHost reports whether host (name or literal IP) is a configured cloud metadata endpoint
+func isMetadataHost(host string) bool {
+	return currentMetadataDenylist().containsHost(host)
+}
+
+// probeRedirectPolicy returns a CheckRedirect that applies the proxy detect redirect settings.
+// Each hop must be http(s), within the redirect cap, and stay on the original host unless the
+// target host is allowlisted. Hops that leave the original host are checked against private IPs
+// even for admin clients; checkIP forces the IP check on every hop.
+func probeRedirectPolicy(checkIP bool) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		setting := system_setting.GetProxyDetectSetting()
+		if !setting.ProbeFollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > setting.ProbeMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", setting.ProbeMaxRedirects)
+		}
+		if err := ValidateProxyDetectURL(req.URL.String(), !checkIP); err != nil {
+			return fmt.Errorf("redirect blocked: %v", err)
 		}
 
-		return dialer.DialContext(ctx, network, net.JoinHostPort(host, port))
+		host := req.URL.Hostname()
+		sameHost := len(via) > 0 && strings.EqualFold(host, via[0].URL.Hostname())
+		if !sameHost && !setting.IsRedirectHostAllowed(host) {
+			return fmt.Errorf("redirect to another host blocked: %s", host)
+		}
+		if checkIP || !sameHost {
+			if isMetadataHost(host) {
+				return fmt.Errorf("redirect blocked: connection to metadata endpoint blocked")
+			}
+			ips, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+			if err != nil {
+				return fmt.Errorf("redirect DNS lookup failed: %v", err)
+			}
+			for _, ipAddr := range ips {
+				if err := checkProbeIP(ipAddr.IP); err != nil {
+					return fmt.Errorf("redirect blocked: %v", err)
+				}
+			}
+		}
+		return nil
 	}
 }
 
@@ -157,13 +613,131 @@ func newSafeHTTPClient(timeout time.Duration) *http.Client {
 		Timeout: timeout,
 		Transport: &http.Transport{
 			DialContext: safeDialer(),
+			// A custom DialContext disables HTTP/2 unless forced; probes record the
+			// negotiated protocol
+			ForceAttemptHTTP2: true,
 		},
+		CheckRedirect: probeRedirectPolicy(true),
 	}
 }
 
 // newUnsafeHTTPClient creates a regular HTTP client (for admin use on internal URLs)
 func newUnsafeHTTPClient(timeout time.Duration) *http.Client {
-	return &http.Client{Timeout: timeout}
+	return &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: probeRedirectPolicy(false),
+	}
+}
+
+// ProbeTarget is the upstream endpoint and credentials probes are sent to
+type ProbeTarget struct {
+	BaseURL          string
+	APIKey           string
+	AnthropicVersion string
+	// MessagesPath defaults to defaultMessagesPath
+	MessagesPath string
+	// AuthScheme limits the credential headers to one AuthScheme*; both are sent when empty
+	AuthScheme string
+	// ExtraHeaders are sent with every request; they replace the core headers only with
+	// OverrideCoreHeaders
+	ExtraHeaders        map[string]string
+	OverrideCoreHeaders bool
+}
+
+// ValidateMessagesPath checks a messages path override: it must be a plain absolute path,
+// never a URL, scheme-relative path, traversal or anything that could change the target host
+func ValidateMessagesPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if len(path) > maxMessagesPathLen {
+		return fmt.Errorf("messages path too long")
+	}
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return fmt.Errorf("messages path must start with a single /")
+	}
+	if strings.ContainsAny(path, "\\?#@%: \t\r\n") {
+		return fmt.Errorf("messages path contains forbidden characters")
+	}
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "." || seg == ".." {
+			return fmt.Errorf("messages path must not contain . or .. segments")
+		}
+	}
+	return nil
+}
+
+// messagesURL joins the base URL and messages path, refusing any result on a different host
+func (t ProbeTarget) messagesURL() (string, error) {
+	path := t.MessagesPath
+	if path == "" {
+		path = defaultMessagesPath
+	}
+	if err := ValidateMessagesPath(path); err != nil {
+		return "", err
+	}
+	base, err := url.Parse(t.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL")
+	}
+	reqURL := strings.TrimRight(t.BaseURL, "/") + path
+	parsed, err := url.Parse(reqURL)
+	if err != nil || parsed.Host != base.Host || parsed.Scheme != base.Scheme {
+		return "", fmt.Errorf("messages path escapes the base host")
+	}
+	return reqURL, nil
+}
+
+// IsKnownAnthropicVersion reports whether v is a published anthropic-version value
+func IsKnownAnthropicVersion(v string) bool {
+	return slices.Contains(KnownAnthropicVersions, v)
+}
+
+// newMessagesRequest builds a POST /v1/messages request carrying the probe headers
+func (t ProbeTarget) newMessagesRequest(ctx context.Context, payload map[string]any) (*http.Request, error) {
+	payloadBytes, err := common.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	reqURL, err := t.messagesURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	version := t.AnthropicVersion
+	if version == "" {
+		version = defaultAnthropicVersion
+	}
+	setExtraHeaders(req, t.ExtraHeaders)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", version)
+	setAuthHeaders(req, t.AuthScheme, t.APIKey)
+	if t.OverrideCoreHeaders {
+		setExtraHeaders(req, t.ExtraHeaders)
+	}
+	return req, nil
+}
+
+// normalizeTraceID returns the caller-provided trace ID if usable, otherwise a new one
+func normalizeTraceID(traceID string) string {
+	traceID = strings.TrimSpace(traceID)
+	if traceID == "" || len(traceID) > maxTraceIDLen {
+		return "pd-" + common.GetTimeString() + common.GetRandomString(8)
+	}
+	for _, r := range traceID {
+		if r < 0x21 || r > 0x7e {
+			return "pd-" + common.GetTimeString() + common.GetRandomString(8)
+		}
+	}
+	return traceID
+}
+
+// withTraceID attaches the trace ID to ctx so logger output carries it
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, common.RequestIdKey, traceID)
 }
 
 // classifyMsgID classifies the message ID format
@@ -191,7 +765,7 @@ func classifyThinkingSig(sig string) string {
 	if sig == "" {
 		return "none"
 	}
-	if len(sig) < thinkingSigShortThreshold {
+	if len(sig) < system_setting.GetProxyDetectSetting().ThinkingSigCheck.Short() {
 		return "short"
 	}
 	if strings.HasPrefix(sig, "claude#") {
@@ -244,6 +818,14 @@ func detectProxyPlatform(headers http.Header) (string, []string) {
 		}
 	}
 
+	// Managed gateways; a branded relay found above stays the platform
+	if gateway, gatewayClues := detectManagedGateways(headers); gateway != "" {
+		if platform == "" {
+			platform = gateway
+		}
+		clues = append(clues, gatewayClues...)
+	}
+
 	// CloudFlare detection
 	if strings.ToLower(headers.Get("Server")) == "cloudflare" {
 		if cfRay := headers.Get("Cf-Ray"); cfRay != "" {
@@ -251,6 +833,11 @@ func detectProxyPlatform(headers http.Header) (string, []string) {
 		}
 	}
 
+	// Nested relays, even when each layer scrubs its branded headers
+	if hops, _ := parseForwardedChain(headers); hops > 1 {
+		clues = append(clues, fmt.Sprintf("Relay chain: %d hops", hops))
+	}
+
 	return platform, clues
 }
 
@@ -261,7 +848,7 @@ func buildToolPayload(model string) map[string]any {
 		"max_tokens": 50,
 		"tools": []map[string]any{
 			{
-				"name":        "probe",
+				"name":        system_setting.ProxyDetectToolName,
 				"description": "Probe function",
 				"input_schema": map[string]any{
 					"type": "object",
@@ -272,9 +859,9 @@ func buildToolPayload(model string) map[string]any {
 				},
 			},
 		},
-		"tool_choice": map[string]any{"type": "tool", "name": "probe"},
+		"tool_choice": map[string]any{"type": "tool", "name": system_setting.ProxyDetectToolName},
 		"messages": []map[string]any{
-			{"role": "user", "content": "call probe with q=test"},
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("tool")},
 		},
 	}
 }
@@ -289,67 +876,155 @@ func buildThinkingPayload(model string) map[string]any {
 			"budget_tokens": 1024,
 		},
 		"messages": []map[string]any{
-			{"role": "user", "content": "What is 2+3?"},
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("thinking")},
 		},
 	}
 }
 
-// probeOnce sends one probe request and extracts fingerprints
-func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model, probeType string) Fingerprint {
-	fp := Fingerprint{
-		ProbeType:      probeType,
-		ModelRequested: model,
+// buildMaxTokensPayload builds the max_tokens probe request body.
+// The prompt naturally produces a completion longer than maxTokensProbeLimit.
+func buildMaxTokensPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": maxTokensProbeLimit,
+		"messages": []map[string]any{
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("max_tokens")},
+		},
+	}
+}
+
+// classifyRequestFailure describes a probe request that got no response
+func classifyRequestFailure(ctx context.Context, err error) (message, class string) {
+	var netErr net.Error
+	if ctx.Err() != nil {
+		return "detection timed out", ProbeErrorTimeout
 	}
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "request timed out", ProbeErrorTimeout
+	}
+	return "request failed", ProbeErrorNetwork
+}
 
-	var payload map[string]any
+// buildProbePayload builds the request body of a probe type; unknown types get the minimal
+// "simple" request
+func buildProbePayload(model, probeType string) map[string]any {
 	switch probeType {
 	case "tool":
-		payload = buildToolPayload(model)
+		return buildToolPayload(model)
 	case "thinking":
-		payload = buildThinkingPayload(model)
+		return buildThinkingPayload(model)
+	case "max_tokens":
+		return buildMaxTokensPayload(model)
+	case "stream":
+		return buildStreamPayload(model)
+	case "system":
+		return buildSystemPayload(model)
+	case "stop_sequences":
+		return buildStopSequencesPayload(model)
+	case "identity":
+		return buildIdentityPayload(model)
+	case "vision":
+		return buildVisionPayload(model)
+	case "cache":
+		return buildPromptCachePayload(model)
+	case "service_tier":
+		return buildServiceTierPayload(model)
 	default:
-		payload = map[string]any{
+		return map[string]any{
 			"model":      model,
 			"max_tokens": 5,
-			"messages":   []map[string]any{{"role": "user", "content": "Say OK"}},
+			"messages":   []map[string]any{{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("simple")}},
 		}
 	}
+}
 
-	payloadBytes, err := common.Marshal(payload)
-	if err != nil {
-		fp.Error = "failed to build request"
+// probeOnce sends one probe request and extracts fingerprints
+func probeOnce(ctx context.Context, client *http.Client, target ProbeTarget, model, probeType string) (fp Fingerprint) {
+	fp = Fingerprint{
+		ProbeType:      probeType,
+		ModelRequested: model,
+	}
+	defer observeProbe(&fp)
+
+	budget := probeBudgetFrom(ctx)
+	if budget.exhausted() {
+		fp.Error = "probe token budget exhausted"
+		fp.ErrorClass = ProbeErrorBudget
 		return fp
 	}
 
-	reqURL := strings.TrimRight(baseURL, "/") + "/v1/messages"
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(payloadBytes))
+	payload := applyCustomPrompt(buildProbePayload(model, probeType), customPromptsFrom(ctx)[probeType])
+	req, err := target.newMessagesRequest(ctx, payload)
 	if err != nil {
 		fp.Error = "failed to create request"
+		fp.ErrorClass = ProbeErrorRequest
 		return fp
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("Authorization", "Bearer "+apiKey)
 
-	t0 := time.Now()
-	resp, err := client.Do(req)
+	resp, t0, err := doProbeRequest(ctx, client, req, &fp)
 	if err != nil {
-		if ctx.Err() != nil {
-			fp.Error = "detection timed out"
-		} else {
-			fp.Error = "request failed"
-		}
+		fp.Error, fp.ErrorClass = classifyRequestFailure(ctx, err)
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect probe %s/%s failed: %v", model, probeType, err))
 		return fp
 	}
 	defer resp.Body.Close()
+	if rawCaptureEnabled(ctx) {
+		rec := recordRawBody(resp)
+		defer func() { fp.Raw = rec.rawResponse(resp, target.APIKey) }()
+	}
 	fp.LatencyMs = time.Since(t0).Milliseconds()
+	recordHTTPProtocol(&fp, resp)
+	recordClockSkew(&fp, resp.Header, time.Now())
+
+	// A 400 is the expected answer to the bad_version probe, not a failure; auth, rate-limit
+	// and server errors fail like any other probe
+	if probeType == "bad_version" && resp.StatusCode == http.StatusBadRequest {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxVersionErrorBodyBytes))
+		fp.VersionErrorShape = classifyVersionError(resp.StatusCode, errBody)
+		return fp
+	}
+
+	// The requested tier is rejected by Anthropic, a 400 is the expected answer; auth,
+	// rate-limit and server errors fail like any other probe
+	if probeType == "service_tier" {
+		fp.ServiceTierRequested = requestedServiceTier
+		if resp.StatusCode == http.StatusBadRequest {
+			errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxVersionErrorBodyBytes))
+			fp.ServiceTierResponse = classifyServiceTierResponse(resp.StatusCode, errBody)
+			return fp
+		}
+	}
+
+	// A rejected image is an answer of the vision probe, not a failure
+	if probeType == "vision" && isVisionRejection(resp.StatusCode) {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxVisionErrorBodyBytes))
+		fp.HTTPStatus = resp.StatusCode
+		fp.VisionSupported = VisionSupportedError
+		fp.VisionErrorAnthropic = isAnthropicErrorEnvelope(errBody)
+		recordBackendLLM(&fp, BackendLLMSourceError, string(errBody))
+		return fp
+	}
 
 	if resp.StatusCode != 200 {
-		bodySnippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
-		fp.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(bodySnippet))
+		errBody, errorKind := readErrorBody(resp)
+		bodySnippet := truncateErrorSnippet(errBody)
+		fp.HTTPStatus = resp.StatusCode
+		fp.ErrorKind = errorKind
+		fp.Error = fmt.Sprintf("%s: %s", describeErrorKind(fmt.Sprintf("HTTP %d", resp.StatusCode), errorKind), string(bodySnippet))
+		recordBackendLLM(&fp, BackendLLMSourceError, string(bodySnippet))
+		recordOverloaded(&fp, resp.StatusCode, errBody)
+		switch {
+		case isAuthFailure(resp.StatusCode, errBody):
+			fp.ErrorClass = ProbeErrorAuth
+		case resp.StatusCode == statusOverloaded:
+			fp.ErrorClass = ProbeErrorOverloaded
+		default:
+			fp.ErrorClass = ProbeErrorHTTP
+		}
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect probe %s/%s got HTTP %d", model, probeType, resp.StatusCode))
 		return fp
 	}
+	logger.LogDebug(ctx, "proxy detect probe %s/%s ok in %dms", model, probeType, fp.LatencyMs)
 
 	// Parse headers
 	for k := range resp.Header {
@@ -370,6 +1045,10 @@ func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model,
 
 	// Detect proxy platform from response headers
 	fp.ProxyPlatform, fp.PlatformClues = detectProxyPlatform(resp.Header)
+	fp.ProxyHops, fp.ForwardedChain = parseForwardedChain(resp.Header)
+
+	// Body compression and framing
+	recordBodyEncoding(&fp, resp)
 
 	// Extract rate limit headers
 	for k, vals := range resp.Header {
@@ -384,22 +1063,90 @@ func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model,
 			}
 		} else if kl == "anthropic-ratelimit-input-tokens-reset" && len(vals) > 0 {
 			fp.RatelimitInputReset = vals[0]
+			fp.RatelimitObservedAt = responseObservedAt(resp.Header)
 		}
 	}
 
 	// Parse body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fp.Error = "failed to read response"
-		return fp
+	var body map[string]any
+	if probeType == "stream" {
+		body, err = readStreamBody(resp.Body, t0, &fp)
+		if err != nil {
+			fp.Error = err.Error()
+			fp.ErrorClass = ProbeErrorParse
+			return fp
+		}
+	} else {
+		bodyBytes, err := readLimitedBody(resp.Body)
+		var tooLarge errBodyTooLarge
+		if errors.As(err, &tooLarge) {
+			fp.BodyTruncated = true
+			fp.Error = err.Error()
+			fp.ErrorClass = ProbeErrorParse
+			return fp
+		}
+		if err != nil {
+			fp.Error = "failed to read response"
+			fp.ErrorClass = ProbeErrorParse
+			return fp
+		}
+		if err := common.Unmarshal(bodyBytes, &body); err != nil {
+			fp.Error = "response body not JSON"
+			if fp.ErrorKind = classifyHTMLError(resp.Header, bodyBytes); fp.ErrorKind != "" {
+				fp.Error = fmt.Sprintf("%s: %s", describeErrorKind(fp.Error, fp.ErrorKind), truncateErrorSnippet(bodyBytes))
+			}
+			fp.ErrorClass = ProbeErrorParse
+			return fp
+		}
+		fp.UsageKeys = usageKeyOrder(bodyBytes)
+		fp.UsageKeyProfile = classifyUsageKeys(fp.UsageKeys)
 	}
 
-	var body map[string]any
-	if err := common.Unmarshal(bodyBytes, &body); err != nil {
-		fp.Error = "response body not JSON"
-		return fp
+	extractBodyFingerprint(&fp, body)
+	checkRequestID(&fp, resp.Header)
+	budget.charge(fp.OutputTokens)
+	recordBackendLLM(&fp, BackendLLMSourceModel, fp.Model)
+
+	// max_tokens cap
+	if probeType == "max_tokens" {
+		fp.EffectiveMaxTokens = inferEffectiveMaxTokens(fp)
 	}
 
+	// system parameter honored
+	if probeType == "system" {
+		fp.SystemHonored = isSystemHonored(extractReplyText(body))
+	}
+
+	// stop_sequences parameter honored
+	if probeType == "stop_sequences" {
+		checkStopSequences(&fp, body)
+	}
+
+	// self-identification of the model behind the channel
+	if probeType == "identity" {
+		recordBackendLLM(&fp, BackendLLMSourceReply, extractReplyText(body))
+	}
+
+	// image content read or ignored
+	if probeType == "vision" {
+		checkVisionReply(&fp, body)
+	}
+
+	// invalid anthropic-version answered normally
+	if probeType == "bad_version" {
+		fp.VersionErrorShape = classifyVersionError(resp.StatusCode, nil)
+	}
+
+	// requested service_tier stripped or echoed
+	if probeType == "service_tier" {
+		fp.ServiceTierResponse = classifyServiceTierResponse(resp.StatusCode, nil)
+	}
+
+	return fp
+}
+
+// extractBodyFingerprint extracts the id/model/usage/content fingerprints from a Messages response body
+func extractBodyFingerprint(fp *Fingerprint, body map[string]any) {
 	// 1) tool_use id and thinking signature from content blocks
 	if content, ok := body["content"].([]any); ok {
 		for _, block := range content {
@@ -407,6 +1154,8 @@ func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model,
 			if !ok {
 				continue
 			}
+			blockType, _ := bm["type"].(string)
+			fp.ContentBlockShape = append(fp.ContentBlockShape, blockType)
 			if bm["type"] == "tool_use" {
 				fp.ToolID, _ = bm["id"].(string)
 				if strings.HasPrefix(fp.ToolID, bedrockToolPrefix) {
@@ -424,6 +1173,10 @@ func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model,
 				fp.ThinkingSigLen = len(sig)
 				fp.ThinkingSigClass = classifyThinkingSig(sig)
 			}
+			if bm["type"] == "text" {
+				text, _ := bm["text"].(string)
+				fp.OutputChars += len(text)
+			}
 		}
 	}
 
@@ -461,150 +1214,773 @@ func probeOnce(ctx context.Context, client *http.Client, baseURL, apiKey, model,
 				fp.HasCacheCreation = true
 			}
 		}
+		if n, ok := usage["output_tokens"].(float64); ok {
+			fp.OutputTokens = int(n)
+		} else if n, ok := usage["outputTokens"].(float64); ok {
+			fp.OutputTokens = int(n)
+		}
+		if n, ok := usage["cache_read_input_tokens"].(float64); ok {
+			fp.CacheReadTokens = int(n)
+		}
+		fp.UsageIssues = checkUsageConsistency(usage, fp.OutputChars)
+		fp.UsageConsistent = len(fp.UsageIssues) == 0
+		if fp.UsageStyle == "snake_case" {
+			fp.ExtraUsageFields = extraUsageFields(usage)
+		}
 	}
 
 	// 5) stop_reason
 	fp.StopReason, _ = body["stop_reason"].(string)
+	fp.StopReasonStandard = fp.StopReason == "" || slices.Contains(anthropicStopReasons, fp.StopReason)
+	fp.StopReasonFamily = classifyStopReason(fp.StopReason)
 
-	return fp
+	// 6) Gemini-native fields
+	fp.GeminiSignals = geminiSignals(body)
+	if fp.OutputTokens == 0 && len(fp.GeminiSignals) > 0 {
+		fp.OutputTokens = geminiOutputTokens(body)
+	}
 }
 
-// analyze performs multi-round three-source analysis
-func analyze(fingerprints []Fingerprint, model string) DetectResult {
-	result := DetectResult{
-		Model:  model,
-		Scores: map[string]int{"anthropic": 0, "bedrock": 0, "antigravity": 0},
+// stop_reason values documented for the Messages API; OpenAI-style "stop"/"length"
+// or anything else points to a translated backend
+var anthropicStopReasons = []string{
+	"end_turn",
+	"max_tokens",
+	"stop_sequence",
+	"tool_use",
+	"pause_turn",
+	"refusal",
+	"model_context_window_exceeded",
+}
+
+// extraUsageFields returns the usage keys not in the configured known-field allowlist.
+// camelCase (Bedrock) usage is scored by style and not checked here.
+func extraUsageFields(usage map[string]any) []string {
+	setting := system_setting.GetProxyDetectSetting()
+	var extra []string
+	for key := range usage {
+		if !setting.IsKnownUsageField(key) {
+			extra = append(extra, key)
+		}
 	}
+	slices.Sort(extra)
+	return extra
+}
 
-	var validFPs []Fingerprint
-	for _, fp := range fingerprints {
-		if fp.Error == "" {
-			validFPs = append(validFPs, fp)
+// Usage token fields checked by checkUsageConsistency
+var usageTokenFields = []string{"input_tokens", "output_tokens", "cache_creation_input_tokens", "cache_read_input_tokens"}
+
+// checkUsageConsistency looks for arithmetic impossibilities in a snake_case usage object.
+// Genuine Anthropic usage is internally consistent, fabricated usage often is not.
+func checkUsageConsistency(usage map[string]any, outputChars int) []UsageIssue {
+	var issues []UsageIssue
+	tokens := make(map[string]float64, len(usageTokenFields))
+	for _, field := range usageTokenFields {
+		v, ok := usage[field]
+		if !ok || v == nil {
+			continue
 		}
+		n, isNum := v.(float64)
+		if !isNum || n < 0 || n != math.Trunc(n) {
+			issues = append(issues, UsageIssue{Code: "not_count", Params: map[string]any{"field": field, "value": v}})
+			continue
+		}
+		tokens[field] = n
 	}
 
-	if len(validFPs) == 0 {
-		result.Verdict = "unknown"
-		result.Evidence = []string{"所有探测均失败"}
-		result.Fingerprints = fingerprints
-		result.VerdictText = verdictTextMap["unknown"]
-		return result
+	// cache_creation breakdown must add up to cache_creation_input_tokens
+	if cc, ok := usage["cache_creation"].(map[string]any); ok {
+		var sum float64
+		for _, v := range cc {
+			if n, isNum := v.(float64); isNum {
+				sum += n
+			}
+		}
+		if total, ok := tokens["cache_creation_input_tokens"]; ok && sum != total {
+			issues = append(issues, UsageIssue{Code: "cache_creation_sum", Params: map[string]any{"sum": int(sum), "total": int(total)}})
+		}
 	}
 
-	// Average latency
-	var totalLatency int64
-	for _, fp := range validFPs {
-		totalLatency += fp.LatencyMs
+	// Every probe sends a prompt, so some input must be billed somewhere
+	input, hasInput := tokens["input_tokens"]
+	if hasInput && input+tokens["cache_creation_input_tokens"]+tokens["cache_read_input_tokens"] == 0 {
+		issues = append(issues, UsageIssue{Code: "input_zero"})
 	}
-	result.AvgLatencyMs = totalLatency / int64(len(validFPs))
 
-	// Proxy platform: use the first non-empty platform found in fingerprints
-	for _, fp := range validFPs {
-		if fp.ProxyPlatform != "" {
-			result.ProxyPlatform = fp.ProxyPlatform
-			result.PlatformClues = fp.PlatformClues
-			break
+	// Text was returned but no output tokens were billed
+	if output, ok := tokens["output_tokens"]; ok && output == 0 && outputChars > 0 {
+		issues = append(issues, UsageIssue{Code: "output_zero", Params: map[string]any{"chars": outputChars}})
+	}
+
+	// OpenAI-style total must match the parts if a translator added one
+	if v, ok := usage["total_tokens"].(float64); ok && hasInput {
+		sum := input + tokens["output_tokens"] + tokens["cache_creation_input_tokens"] + tokens["cache_read_input_tokens"]
+		if v != sum && v != input+tokens["output_tokens"] {
+			issues = append(issues, UsageIssue{Code: "total_mismatch", Params: map[string]any{"total": int(v), "sum": int(sum)}})
 		}
 	}
+	return issues
+}
 
-	scores := result.Scores
-	var evidence []string
+// checkContentBlockShape compares the content block types of a probe response with the
+// shape genuine Anthropic returns for that probe type, returning an evidence code or ""
+func checkContentBlockShape(probeType string, shape []string) string {
+	switch probeType {
+	case "tool":
+		// tool_choice forces the tool, so a tool_use block must be present
+		if !slices.Contains(shape, "tool_use") {
+			return "tool_use_missing"
+		}
+	case "thinking":
+		// thinking blocks always precede the answer
+		idx := slices.Index(shape, "thinking")
+		if idx < 0 && slices.Index(shape, "redacted_thinking") < 0 {
+			return "thinking_block_missing"
+		}
+		if idx > 0 && shape[0] != "redacted_thinking" {
+			return "thinking_block_reordered"
+		}
+	}
+	return ""
+}
 
-	if result.ProxyPlatform != "" {
-		evidence = append(evidence, fmt.Sprintf("中转平台: %s", result.ProxyPlatform))
+// latencyMeanVariance returns the mean and population variance of latencies in ms
+func latencyMeanVariance(latencies []int64) (float64, float64) {
+	if len(latencies) == 0 {
+		return 0, 0
 	}
+	var sum float64
+	for _, l := range latencies {
+		sum += float64(l)
+	}
+	mean := sum / float64(len(latencies))
+	var sq float64
+	for _, l := range latencies {
+		d := float64(l) - mean
+		sq += d * d
+	}
+	return mean, sq / float64(len(latencies))
+}
 
-	for i, fp := range validFPs {
-		tag := fmt.Sprintf("[R%d]", i+1)
+// duplicateMsgIDs returns message ids seen in more than one response, in first-seen order
+func duplicateMsgIDs(fingerprints []Fingerprint) []string {
+	return duplicateValues(fingerprints, func(fp Fingerprint) string { return fp.MsgID })
+}
 
-		// 1. tool_use id (weight 5)
-		switch fp.ToolIDSource {
-		case "bedrock":
-			scores["bedrock"] += 5
-			evidence = append(evidence, fmt.Sprintf("%s tool_use id: %s -> tooluse_ (Bedrock/AG)", tag, truncStr(fp.ToolID, 28)))
-		case "anthropic":
-			scores["anthropic"] += 5
-			evidence = append(evidence, fmt.Sprintf("%s tool_use id: %s -> toolu_ (Anthropic)", tag, truncStr(fp.ToolID, 28)))
-		case "vertex":
-			scores["antigravity"] += 5
-			evidence = append(evidence, fmt.Sprintf("%s tool_use id: %s -> tool_N (Vertex AI)", tag, truncStr(fp.ToolID, 28)))
-		case "rewritten":
-			if fp.ToolID != "" {
-				evidence = append(evidence, fmt.Sprintf("%s tool_use id: %s -> 被改写", tag, truncStr(fp.ToolID, 28)))
-			}
-		}
+// duplicateToolIDs returns tool_use ids seen in more than one response, in first-seen order
+func duplicateToolIDs(fingerprints []Fingerprint) []string {
+	return duplicateValues(fingerprints, func(fp Fingerprint) string { return fp.ToolID })
+}
 
-		// 2. thinking signature
-		switch fp.ThinkingSigClass {
+// duplicateValues returns the non-empty values of field repeated across fingerprints
+func duplicateValues(fingerprints []Fingerprint, field func(Fingerprint) string) []string {
+	seen := make(map[string]int)
+	var dups []string
+	for _, fp := range fingerprints {
+		v := field(fp)
+		if v == "" {
+			continue
+		}
+		seen[v]++
+		if seen[v] == 2 {
+			dups = append(dups, v)
+		}
+	}
+	return dups
+}
+
+// distinctValues returns the non-empty values of field across fingerprints, in first-seen order
+func distinctValues(fingerprints []Fingerprint, field func(Fingerprint) string) []string {
+	var values []string
+	for _, fp := range fingerprints {
+		if v := field(fp); v != "" && !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// classifyAllFailed picks the verdict when no probe succeeded: invalid_key if every
+// probe was rejected as unauthorized, unreachable if every probe hit a network or
+// timeout error, otherwise unknown (naming the HTML error pages seen, if any)
+func classifyAllFailed(fingerprints []Fingerprint) (string, EvidenceItem) {
+	allAuth, allUnreachable := len(fingerprints) > 0, len(fingerprints) > 0
+	var errorKinds []string
+	for _, fp := range fingerprints {
+		if fp.ErrorKind != "" && !slices.Contains(errorKinds, fp.ErrorKind) {
+			errorKinds = append(errorKinds, fp.ErrorKind)
+		}
+		if fp.ErrorClass != ProbeErrorAuth {
+			allAuth = false
+		}
+		if fp.ErrorClass != ProbeErrorNetwork && fp.ErrorClass != ProbeErrorTimeout {
+			allUnreachable = false
+		}
+	}
+	switch {
+	case allAuth:
+		return "invalid_key", EvidenceItem{Code: "all_failed_auth", Params: map[string]any{"count": len(fingerprints)}}
+	case allUnreachable:
+		return "unreachable", EvidenceItem{Code: "all_failed_unreachable", Params: map[string]any{"count": len(fingerprints)}}
+	case len(errorKinds) > 0:
+		return "unknown", EvidenceItem{Code: "all_failed_html", Params: map[string]any{"kinds": errorKinds}}
+	default:
+		return "unknown", EvidenceItem{Code: "all_failed"}
+	}
+}
+
+// inferEffectiveMaxTokens returns the upstream's effective max_tokens cap if the
+// max_tokens probe stopped well short of the requested limit, otherwise 0
+func inferEffectiveMaxTokens(fp Fingerprint) int {
+	if fp.StopReason != "max_tokens" || fp.OutputTokens <= 0 {
+		return 0
+	}
+	if float64(fp.OutputTokens) >= float64(maxTokensProbeLimit)*maxTokensCapRatio {
+		return 0
+	}
+	return fp.OutputTokens
+}
+
+// newDetectScores returns the zeroed score of every verdict bucket
+func newDetectScores() map[string]int {
+	return map[string]int{"anthropic": 0, "bedrock": 0, "antigravity": 0, "gemini": 0, "openai": 0}
+}
+
+// analyze performs multi-round three-source analysis, scoring each signal by w
+func analyze(fingerprints []Fingerprint, model string, w system_setting.ScoringWeights) DetectResult {
+	result := DetectResult{
+		Model:  model,
+		Scores: newDetectScores(),
+	}
+
+	var validFPs []Fingerprint
+	for _, fp := range fingerprints {
+		if fp.Error == "" {
+			validFPs = append(validFPs, fp)
+		}
+	}
+
+	if len(validFPs) == 0 {
+		var item EvidenceItem
+		result.Verdict, item = classifyAllFailed(fingerprints)
+		result.addEvidence(item)
+		applyOverloaded(&result, fingerprints, w)
+		applyBackendLLM(&result, fingerprints)
+		result.Fingerprints = fingerprints
+		result.VerdictText = verdictTextMap[result.Verdict]
+		return result
+	}
+
+	// Average latency
+	var totalLatency int64
+	for _, fp := range validFPs {
+		totalLatency += fp.LatencyMs
+	}
+	result.AvgLatencyMs = totalLatency / int64(len(validFPs))
+	result.LatencyStats = computeLatencyStats(validFPs)
+	if stats := result.LatencyStats; stats != nil && stats.Uniform {
+		result.addEvidence(EvidenceItem{Code: "latency_uniform", Params: map[string]any{"count": stats.Count, "min": stats.MinMs, "max": stats.MaxMs}})
+	}
+
+	// Proxy platform: use the first non-empty platform found in fingerprints
+	for _, fp := range validFPs {
+		if fp.ProxyPlatform != "" {
+			result.ProxyPlatform = fp.ProxyPlatform
+			result.PlatformClues = fp.PlatformClues
+			break
+		}
+	}
+
+	scores := result.Scores
+
+	if result.ProxyPlatform != "" {
+		result.addEvidence(EvidenceItem{Code: "proxy_platform", Params: map[string]any{"platform": result.ProxyPlatform}})
+	}
+
+	// Relay chain: keep the deepest one seen
+	for _, fp := range validFPs {
+		if fp.ProxyHops > result.ProxyHops {
+			result.ProxyHops = fp.ProxyHops
+			result.ForwardedChain = fp.ForwardedChain
+		}
+	}
+	if result.ProxyHops > 1 {
+		result.addEvidence(EvidenceItem{Code: "proxy_chain", Params: map[string]any{"hops": result.ProxyHops, "chain": result.ForwardedChain}})
+	}
+
+	usageInconsistent := false
+	usageInjected := false
+	stopReasonTranslated := false
+	headerRecased := false
+	streamBlob := false
+	openAIFormat := false
+	retryAfterHonored := false
+	usageKeysScored := false
+	visionMismatch := false
+	requestIDScored := false
+	serviceTierUnknown := false
+	for i, fp := range validFPs {
+		round := i + 1
+
+		// 1. tool_use id
+		switch fp.ToolIDSource {
+		case "bedrock":
+			scores["bedrock"] += w.ToolIDBedrock
+			result.addEvidence(EvidenceItem{Code: "tool_id_bedrock", Weight: w.ToolIDBedrock, Round: round, Params: map[string]any{"tool_id": truncStr(fp.ToolID, 28)}})
+		case "anthropic":
+			scores["anthropic"] += w.ToolIDAnthropic
+			result.addEvidence(EvidenceItem{Code: "tool_id_anthropic", Weight: w.ToolIDAnthropic, Round: round, Params: map[string]any{"tool_id": truncStr(fp.ToolID, 28)}})
+		case "vertex":
+			scores["antigravity"] += w.ToolIDVertex
+			result.addEvidence(EvidenceItem{Code: "tool_id_vertex", Weight: w.ToolIDVertex, Round: round, Params: map[string]any{"tool_id": truncStr(fp.ToolID, 28)}})
+		case "rewritten":
+			if fp.ToolID != "" {
+				result.addEvidence(EvidenceItem{Code: "tool_id_rewritten", Round: round, Params: map[string]any{"tool_id": truncStr(fp.ToolID, 28)}})
+			}
+		}
+
+		// 2. thinking signature
+		switch fp.ThinkingSigClass {
 		case "short":
-			evidence = append(evidence, fmt.Sprintf("%s thinking sig: (len=%d) -> 签名截断", tag, fp.ThinkingSigLen))
+			result.addEvidence(EvidenceItem{Code: "thinking_sig_short", Round: round, Params: map[string]any{"length": fp.ThinkingSigLen}})
 		case "vertex":
-			scores["antigravity"] += 5
-			evidence = append(evidence, fmt.Sprintf("%s thinking sig: (len=%d) -> claude# 前缀 (Vertex AI)", tag, fp.ThinkingSigLen))
+			scores["antigravity"] += w.ThinkingSigVertex
+			result.addEvidence(EvidenceItem{Code: "thinking_sig_vertex", Weight: w.ThinkingSigVertex, Round: round, Params: map[string]any{"length": fp.ThinkingSigLen}})
 		case "normal":
-			evidence = append(evidence, fmt.Sprintf("%s thinking sig: (len=%d) -> 正常签名", tag, fp.ThinkingSigLen))
+			result.addEvidence(EvidenceItem{Code: "thinking_sig_normal", Round: round, Params: map[string]any{"length": fp.ThinkingSigLen}})
 		case "none":
 			if fp.ProbeType == "thinking" {
-				evidence = append(evidence, fmt.Sprintf("%s thinking sig: 无签名", tag))
+				result.addEvidence(EvidenceItem{Code: "thinking_sig_none", Round: round})
 			}
 		}
 
 		// 3. message id
 		switch fp.MsgIDSource {
 		case "anthropic":
-			scores["anthropic"] += 2
-			evidence = append(evidence, fmt.Sprintf("%s message id: %s -> msg_<base62> (Anthropic)", tag, truncStr(fp.MsgID, 28)))
+			scores["anthropic"] += w.MsgIDAnthropic
+			result.addEvidence(EvidenceItem{Code: "msg_id_anthropic", Weight: w.MsgIDAnthropic, Round: round, Params: map[string]any{"msg_id": truncStr(fp.MsgID, 28)}})
 		case "antigravity":
-			evidence = append(evidence, fmt.Sprintf("%s message id: %s -> msg_<UUID> (非原生)", tag, truncStr(fp.MsgID, 28)))
+			result.addEvidence(EvidenceItem{Code: "msg_id_uuid", Round: round, Params: map[string]any{"msg_id": truncStr(fp.MsgID, 28)}})
 		case "vertex":
-			scores["antigravity"] += 6
-			evidence = append(evidence, fmt.Sprintf("%s message id: %s -> req_vrtx_ (Vertex AI)", tag, truncStr(fp.MsgID, 28)))
+			scores["antigravity"] += w.MsgIDVertex
+			result.addEvidence(EvidenceItem{Code: "msg_id_vertex", Weight: w.MsgIDVertex, Round: round, Params: map[string]any{"msg_id": truncStr(fp.MsgID, 28)}})
 		case "rewritten":
-			evidence = append(evidence, fmt.Sprintf("%s message id: %s -> 被改写", tag, truncStr(fp.MsgID, 28)))
+			result.addEvidence(EvidenceItem{Code: "msg_id_rewritten", Round: round, Params: map[string]any{"msg_id": truncStr(fp.MsgID, 28)}})
 		}
 
 		// 4. model format
 		switch fp.ModelSource {
 		case "kiro":
-			scores["bedrock"] += 8
-			evidence = append(evidence, fmt.Sprintf("%s model: %s -> kiro-* (Kiro 逆向铁证)", tag, fp.Model))
+			scores["bedrock"] += w.ModelKiro
+			result.addEvidence(EvidenceItem{Code: "model_kiro", Weight: w.ModelKiro, Round: round, Params: map[string]any{"model": fp.Model}})
 		case "bedrock":
-			scores["bedrock"] += 3
-			evidence = append(evidence, fmt.Sprintf("%s model: %s -> anthropic.* (Bedrock)", tag, fp.Model))
+			scores["bedrock"] += w.ModelBedrock
+			result.addEvidence(EvidenceItem{Code: "model_bedrock", Weight: w.ModelBedrock, Round: round, Params: map[string]any{"model": fp.Model}})
 		}
 
-		// 5. service_tier / inference_geo
-		if fp.HasServiceTier {
-			scores["anthropic"] += 3
-			evidence = append(evidence, fmt.Sprintf("%s service_tier: %s -> Anthropic 独有", tag, fp.ServiceTier))
+		// 5. service_tier (only the values Anthropic returns score; others penalized once) / inference_geo
+		switch {
+		case fp.HasServiceTier && isKnownServiceTier(fp.ServiceTier):
+			scores["anthropic"] += w.ServiceTier
+			result.addEvidence(EvidenceItem{Code: "service_tier", Weight: w.ServiceTier, Round: round, Params: map[string]any{"service_tier": fp.ServiceTier}})
+		case fp.HasServiceTier:
+			weight := -w.ServiceTierUnknownPenalty
+			if serviceTierUnknown {
+				weight = 0
+			} else {
+				serviceTierUnknown = true
+				scores["anthropic"] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: "service_tier_unknown", Weight: weight, Round: round, Params: map[string]any{"service_tier": truncStr(fp.ServiceTier, 28)}})
 		}
 		if fp.HasInferenceGeo {
-			scores["anthropic"] += 2
-			evidence = append(evidence, fmt.Sprintf("%s inference_geo: %s -> Anthropic 独有", tag, fp.InferenceGeo))
+			scores["anthropic"] += w.InferenceGeo
+			result.addEvidence(EvidenceItem{Code: "inference_geo", Weight: w.InferenceGeo, Round: round, Params: map[string]any{"inference_geo": fp.InferenceGeo}})
 		}
 		if fp.HasCacheCreation {
-			scores["anthropic"] += 1
-			evidence = append(evidence, fmt.Sprintf("%s cache_creation: 嵌套对象 -> Anthropic 新格式", tag))
+			scores["anthropic"] += w.CacheCreation
+			result.addEvidence(EvidenceItem{Code: "cache_creation", Weight: w.CacheCreation, Round: round})
 		}
 
 		// 6. usage style
 		if fp.UsageStyle == "camelCase" {
-			scores["bedrock"] += 2
-			evidence = append(evidence, fmt.Sprintf("%s usage: camelCase (Bedrock)", tag))
+			scores["bedrock"] += w.UsageCamelCase
+			result.addEvidence(EvidenceItem{Code: "usage_camel_case", Weight: w.UsageCamelCase, Round: round})
 		}
 
 		// 7. AWS headers
 		if fp.HasAWSHeaders {
-			scores["bedrock"] += 3
-			evidence = append(evidence, fmt.Sprintf("%s AWS headers detected", tag))
+			scores["bedrock"] += w.AWSHeaders
+			result.addEvidence(EvidenceItem{Code: "aws_headers", Weight: w.AWSHeaders, Round: round})
 		}
 
 		// 8. Anthropic rate-limit headers
 		if fp.HasAnthropicHdrs {
-			scores["anthropic"] += 2
-			evidence = append(evidence, fmt.Sprintf("%s Anthropic rate-limit headers detected", tag))
+			scores["anthropic"] += w.AnthropicHeaders
+			result.addEvidence(EvidenceItem{Code: "anthropic_headers", Weight: w.AnthropicHeaders, Round: round})
+		}
+
+		// 9. streaming buffering and framing
+		if fp.ProbeType == "stream" {
+			switch {
+			case fp.StreamNotSSE:
+				scores["anthropic"] -= w.StreamNotSSEPenalty
+				result.addEvidence(EvidenceItem{Code: "stream_not_sse", Weight: -w.StreamNotSSEPenalty, Round: round})
+			case fp.StreamCanonical && fp.HasPingEvent:
+				scores["anthropic"] += w.StreamCanonical
+				result.addEvidence(EvidenceItem{Code: "stream_canonical", Weight: w.StreamCanonical, Round: round})
+			case fp.StreamCanonical:
+				result.addEvidence(EvidenceItem{Code: "stream_canonical_no_ping", Round: round})
+			case len(fp.StreamEventOrder) > 0:
+				result.addEvidence(EvidenceItem{Code: "stream_order_abnormal", Round: round, Params: map[string]any{"order": fp.StreamEventOrder}})
+			}
+			if fp.StreamBlob {
+				streamBlob = true
+				result.addEvidence(EvidenceItem{Code: "stream_blob", Round: round, Params: map[string]any{"events": fp.StreamEvents}})
+			}
+			if fp.StreamBuffered {
+				result.addEvidence(EvidenceItem{Code: "stream_buffered", Round: round,
+					Params: map[string]any{"ttft_ms": fp.TTFTMs, "total_ms": fp.StreamTotalMs}})
+			} else if fp.StreamTotalMs > 0 {
+				result.addEvidence(EvidenceItem{Code: "stream_timing", Round: round,
+					Params: map[string]any{"ttft_ms": fp.TTFTMs, "total_ms": fp.StreamTotalMs, "events": fp.StreamEvents}})
+			}
+		}
+
+		// 10. max_tokens cap (behavioral, not scored)
+		if fp.ProbeType == "max_tokens" {
+			if fp.EffectiveMaxTokens > 0 {
+				result.EffectiveMaxTokens = fp.EffectiveMaxTokens
+				result.addEvidence(EvidenceItem{Code: "max_tokens_capped", Round: round,
+					Params: map[string]any{"requested": maxTokensProbeLimit, "output_tokens": fp.EffectiveMaxTokens}})
+			} else {
+				result.addEvidence(EvidenceItem{Code: "max_tokens_ok", Round: round,
+					Params: map[string]any{"output_tokens": fp.OutputTokens, "stop_reason": fp.StopReason}})
+			}
+		}
+
+		// 11. system parameter honored (heuristic, models may disobey, low weight)
+		if fp.ProbeType == "system" {
+			if fp.SystemHonored {
+				result.addEvidence(EvidenceItem{Code: "system_honored", Round: round})
+			} else {
+				scores["anthropic"] -= w.SystemIgnoredPenalty
+				result.addEvidence(EvidenceItem{Code: "system_ignored", Weight: -w.SystemIgnoredPenalty, Round: round})
+			}
+		}
+
+		// 12. content block shape (behavioral, not scored)
+		if code := checkContentBlockShape(fp.ProbeType, fp.ContentBlockShape); code != "" {
+			result.addEvidence(EvidenceItem{Code: code, Round: round, Params: map[string]any{"content": fp.ContentBlockShape}})
+		}
+
+		// 13. usage arithmetic consistency (structural, penalized once)
+		if len(fp.UsageIssues) > 0 {
+			weight := 0
+			if !usageInconsistent {
+				usageInconsistent = true
+				weight = -w.UsageInconsistentPenalty
+				scores["anthropic"] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: "usage_inconsistent", Weight: weight, Round: round, Params: map[string]any{"issues": fp.UsageIssues}})
+		}
+
+		// 14. non-standard usage fields (proxy accounting, penalized once)
+		if len(fp.ExtraUsageFields) > 0 {
+			weight := 0
+			if !usageInjected {
+				usageInjected = true
+				weight = -w.UsageInjectedPenalty
+				scores["anthropic"] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: "usage_injected", Weight: weight, Round: round, Params: map[string]any{"fields": fp.ExtraUsageFields}})
+		}
+
+		// 15. non-standard stop_reason (structural, penalized once)
+		// An OpenAI value set also scores the openai bucket; Gemini values already score
+		// through GeminiSignalFinishReason
+		if fp.StopReason != "" && !fp.StopReasonStandard {
+			// Classified here too so re-scored fingerprints saved before the family existed count
+			family := classifyStopReason(fp.StopReason)
+			weight := 0
+			if !stopReasonTranslated {
+				stopReasonTranslated = true
+				weight = -w.StopReasonPenalty
+				scores["anthropic"] += weight
+				if family == StopReasonFamilyOpenAI {
+					scores["openai"] += w.StopReasonOpenAI
+				}
+			}
+			code := "stop_reason_nonstandard"
+			switch family {
+			case StopReasonFamilyOpenAI:
+				code = "stop_reason_openai"
+			case StopReasonFamilyGemini:
+				code = "stop_reason_gemini"
+			}
+			result.addEvidence(EvidenceItem{Code: code, Weight: weight, Round: round, Params: map[string]any{"stop_reason": fp.StopReason}})
+		}
+
+		// tool_choice forces the tool, so the tool probe must stop with tool_use
+		if fp.ProbeType == "tool" && fp.StopReason != "" && fp.StopReason != "tool_use" {
+			result.addEvidence(EvidenceItem{Code: "tool_stop_reason_mismatch", Round: round, Params: map[string]any{"stop_reason": fp.StopReason}})
+		}
+
+		// 16. stop_sequences honored (parameter fidelity; only a leaked sequence is conclusive)
+		if fp.ProbeType == "stop_sequences" {
+			switch {
+			case fp.StopSequencesHonored:
+				result.addEvidence(EvidenceItem{Code: "stop_sequences_honored", Round: round})
+			case fp.StopSequenceLeaked:
+				scores["anthropic"] -= w.StopSequenceLeakedPenalty
+				result.addEvidence(EvidenceItem{Code: "stop_sequence_leaked", Weight: -w.StopSequenceLeakedPenalty, Round: round, Params: map[string]any{"stop_reason": fp.StopReason}})
+			default:
+				result.addEvidence(EvidenceItem{Code: "stop_sequences_inconclusive", Round: round, Params: map[string]any{"stop_reason": fp.StopReason}})
+			}
+		}
+
+		// 17. raw header name casing (very weak tie-breaker, penalized once)
+		if fp.HeaderCase != "" {
+			if fp.HeaderCase == HeaderCaseLowercase {
+				result.addEvidence(EvidenceItem{Code: "header_case_lowercase", Round: round})
+			} else {
+				weight := 0
+				if !headerRecased {
+					headerRecased = true
+					weight = -w.HeaderRecasedPenalty
+					scores["anthropic"] += weight
+				}
+				result.addEvidence(EvidenceItem{Code: "header_case_recased", Weight: weight, Round: round, Params: map[string]any{"header_case": fp.HeaderCase}})
+			}
+		}
+
+		// 18. Gemini-native fields (translated generateContent reply)
+		if len(fp.GeminiSignals) > 0 {
+			weight := 0
+			for _, signal := range fp.GeminiSignals {
+				weight += geminiSignalWeight(w, signal)
+			}
+			scores["gemini"] += weight
+			result.addEvidence(EvidenceItem{Code: "gemini_fields", Weight: weight, Round: round, Params: map[string]any{"signals": fp.GeminiSignals}})
+		}
+
+		// 19. stream delivered with a fixed Content-Length (behavioral, not scored)
+		if fp.ProbeType == "stream" && fp.TransferEncoding == TransferEncodingIdentity {
+			result.addEvidence(EvidenceItem{Code: "stream_fixed_length", Round: round, Params: map[string]any{"content_encoding": fp.ContentEncoding}})
+		}
+
+		// 20. invalid anthropic-version handling
+		switch fp.VersionErrorShape {
+		case VersionErrorAnthropic:
+			scores["anthropic"] += w.VersionErrorAnthropic
+			result.addEvidence(EvidenceItem{Code: "version_error_anthropic", Weight: w.VersionErrorAnthropic, Round: round, Params: map[string]any{"version": invalidAnthropicVersion}})
+		case VersionErrorRewritten:
+			result.addEvidence(EvidenceItem{Code: "version_error_rewritten", Round: round, Params: map[string]any{"version": invalidAnthropicVersion}})
+		case VersionErrorAccepted:
+			scores["anthropic"] -= w.VersionAcceptedPenalty
+			result.addEvidence(EvidenceItem{Code: "version_accepted", Weight: -w.VersionAcceptedPenalty, Round: round, Params: map[string]any{"version": invalidAnthropicVersion}})
+		}
+
+		// 21. OpenAI-format fallback (/v1/messages missing)
+		if fp.ProbeType == "chat_completions" {
+			openAIFormat = true
+			if fp.ChatCompletionSource == ChatCompletionOpenAI {
+				result.addEvidence(EvidenceItem{Code: "chat_completions_openai", Round: round,
+					Params: map[string]any{"id": truncStr(fp.MsgID, 28), "system_fingerprint": fp.SystemFingerprint, "model": fp.Model}})
+			} else {
+				result.addEvidence(EvidenceItem{Code: "chat_completions_translated", Round: round,
+					Params: map[string]any{"id": truncStr(fp.MsgID, 28), "model": fp.Model}})
+			}
+		}
+
+		// 22. Retry-After honored after a transient error (weak, counted once)
+		if fp.RetryAfterHonored {
+			weight := 0
+			if !retryAfterHonored {
+				retryAfterHonored = true
+				weight = w.RetryAfterHonored
+				scores["anthropic"] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: "retry_after_honored", Weight: weight, Round: round, Params: map[string]any{"retries": fp.Retries}})
+		}
+
+		// 23. accepted auth schemes (official /v1/messages only takes x-api-key)
+		if fp.ProbeType == "auth" {
+			switch {
+			case fp.AcceptsBearer && fp.AcceptsXAPIKey:
+				scores["anthropic"] -= w.BearerAcceptedPenalty
+				result.addEvidence(EvidenceItem{Code: "auth_both", Weight: -w.BearerAcceptedPenalty, Round: round})
+			case fp.AcceptsBearer:
+				scores["anthropic"] -= w.BearerAcceptedPenalty
+				result.addEvidence(EvidenceItem{Code: "auth_bearer_only", Weight: -w.BearerAcceptedPenalty, Round: round})
+			case fp.AcceptsXAPIKey:
+				scores["anthropic"] += w.XAPIKeyOnly
+				result.addEvidence(EvidenceItem{Code: "auth_x_api_key_only", Weight: w.XAPIKeyOnly, Round: round})
+			}
+		}
+
+		// 24. image input (behavioral; a foreign rejection on a vision model is conclusive below)
+		if fp.ProbeType == "vision" {
+			switch fp.VisionSupported {
+			case VisionSupportedYes:
+				result.addEvidence(EvidenceItem{Code: "vision_supported", Round: round})
+			case VisionSupportedNo:
+				result.addEvidence(EvidenceItem{Code: "vision_ignored", Round: round})
+			case VisionSupportedError:
+				if fp.VisionErrorAnthropic {
+					result.addEvidence(EvidenceItem{Code: "vision_rejected_anthropic", Round: round, Params: map[string]any{"status": fp.HTTPStatus}})
+				} else {
+					result.addEvidence(EvidenceItem{Code: "vision_rejected", Round: round, Params: map[string]any{"status": fp.HTTPStatus}})
+					visionMismatch = visionMismatch || modelExpectsVision(model)
+				}
+			default:
+				result.addEvidence(EvidenceItem{Code: "vision_inconclusive", Round: round})
+			}
+		}
+
+		// 25. prompt cache read (only an observed read is conclusive, a miss may be a cold cache)
+		if fp.ProbeType == "cache" {
+			if fp.CacheReadObserved {
+				scores["anthropic"] += w.CacheReadObserved
+				result.addEvidence(EvidenceItem{Code: "cache_read_observed", Weight: w.CacheReadObserved, Round: round, Params: map[string]any{"tokens": fp.CacheReadTokens}})
+			} else {
+				result.addEvidence(EvidenceItem{Code: "cache_read_missing", Round: round})
+			}
+		}
+
+		// 26. usage key order (counted once: every round of one upstream shows the same order)
+		if fp.UsageKeyProfile != "" {
+			bucket, weight := "", 0
+			switch fp.UsageKeyProfile {
+			case UsageKeyProfileAnthropic:
+				bucket, weight = "anthropic", w.UsageKeysAnthropic
+			case UsageKeyProfileVertex:
+				bucket, weight = "antigravity", w.UsageKeysVertex
+			case UsageKeyProfileBedrock, UsageKeyProfileBedrockConverse:
+				bucket, weight = "bedrock", w.UsageKeysBedrock
+			case UsageKeyProfileReconstructed:
+				bucket, weight = "anthropic", -w.UsageKeysReconstructedPenalty
+			}
+			if bucket == "" || usageKeysScored {
+				weight = 0
+			} else {
+				usageKeysScored = true
+				scores[bucket] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: "usage_keys_" + fp.UsageKeyProfile, Weight: weight, Round: round, Params: map[string]any{"keys": fp.UsageKeys}})
+		}
+
+		// 27. request-id header next to a genuine message id (counted once). Fingerprints saved
+		// before the header was recorded have no format and are skipped.
+		if fp.RequestIDFormat != "" && fp.MsgIDSource == "anthropic" {
+			code, weight := "request_id_anthropic", w.RequestIDAnthropic
+			switch {
+			case fp.RequestIDConsistent:
+			case fp.RequestIDFormat == RequestIDFormatNone:
+				code, weight = "request_id_missing", -w.RequestIDRewrittenPenalty
+			default:
+				code, weight = "request_id_rewritten", -w.RequestIDRewrittenPenalty
+			}
+			if requestIDScored {
+				weight = 0
+			} else {
+				requestIDScored = true
+				scores["anthropic"] += weight
+			}
+			result.addEvidence(EvidenceItem{Code: code, Weight: weight, Round: round, Params: map[string]any{"request_id": truncStr(fp.RequestIDHeader, 40)}})
+		}
+
+		// 28. requested service_tier handling
+		switch fp.ServiceTierResponse {
+		case ServiceTierRejectedAnthropic:
+			scores["anthropic"] += w.ServiceTierRejectedAnthropic
+			result.addEvidence(EvidenceItem{Code: "service_tier_rejected_anthropic", Weight: w.ServiceTierRejectedAnthropic, Round: round, Params: map[string]any{"requested": fp.ServiceTierRequested}})
+		case ServiceTierRejectedRewritten:
+			result.addEvidence(EvidenceItem{Code: "service_tier_rejected_rewritten", Round: round, Params: map[string]any{"requested": fp.ServiceTierRequested}})
+		case ServiceTierAccepted:
+			observed := fp.ServiceTier
+			if !fp.HasServiceTier {
+				observed = "-"
+			}
+			scores["anthropic"] -= w.ServiceTierAcceptedPenalty
+			result.addEvidence(EvidenceItem{Code: "service_tier_accepted", Weight: -w.ServiceTierAcceptedPenalty, Round: round,
+				Params: map[string]any{"requested": fp.ServiceTierRequested, "observed": truncStr(observed, 28)}})
+		}
+	}
+
+	// Cross-round body encoding: every non-stream reply uncompressed with a precise length
+	// points to a proxy that decompresses and re-serializes (weak, penalized once)
+	var encodedRounds, reserializedRounds int
+	for _, fp := range validFPs {
+		if fp.ProbeType == "stream" || fp.ContentEncoding == "" {
+			continue
+		}
+		encodedRounds++
+		if isReserializedBody(fp) {
+			reserializedRounds++
+		}
+	}
+	if encodedRounds >= 2 && reserializedRounds == encodedRounds {
+		scores["anthropic"] -= w.ReserializedBodyPenalty
+		result.addEvidence(EvidenceItem{Code: "reserialized_body", Weight: -w.ReserializedBodyPenalty,
+			Params: map[string]any{"reserialized": reserializedRounds, "total": encodedRounds}})
+	}
+
+	// 529 overloaded_error, also from failed and retried probes
+	applyOverloaded(&result, fingerprints, w)
+
+	// Cross-round HTTP protocol: an upstream that never negotiates HTTP/2 over TLS is a very
+	// weak hint of a homemade proxy (penalized once); HTTP/2 is noted without weight
+	var tlsRounds, http1Rounds int
+	for _, fp := range validFPs {
+		if fp.HTTPProtocol == "" || isProtocolPinnedProbe(fp.ProbeType) {
+			continue
+		}
+		tlsRounds++
+		if fp.HTTPProtocol == HTTPProtocol11 {
+			http1Rounds++
+		}
+	}
+	switch {
+	case tlsRounds > 0 && http1Rounds == tlsRounds:
+		scores["anthropic"] -= w.HTTP1OnlyPenalty
+		result.addEvidence(EvidenceItem{Code: "http1_only", Weight: -w.HTTP1OnlyPenalty, Params: map[string]any{"total": tlsRounds}})
+	case tlsRounds > 0 && http1Rounds == 0:
+		result.addEvidence(EvidenceItem{Code: "http2_negotiated", Params: map[string]any{"total": tlsRounds}})
+	}
+
+	// Upstream clock skew: a relay with a drifting clock is a weak non-Anthropic hint (penalized once)
+	if skew, ok := medianClockSkew(validFPs); ok && skew.Abs() > clockSkewThreshold {
+		scores["anthropic"] -= w.ClockSkewPenalty
+		result.addEvidence(EvidenceItem{Code: "clock_skew", Weight: -w.ClockSkewPenalty, Params: map[string]any{"skew_s": int64(skew.Round(time.Second) / time.Second)}})
+	}
+
+	// Thinking signature length distribution across the thinking probes (each penalized once)
+	result.ThinkingSigLengths = thinkingSigLengths(validFPs)
+	sigCheck := system_setting.GetProxyDetectSetting().ThinkingSigCheck
+	if bound := truncatedSigBound(result.ThinkingSigLengths); bound > 0 {
+		scores["anthropic"] -= w.ThinkingSigTruncatedPenalty
+		result.addEvidence(EvidenceItem{Code: "thinking_sig_truncated", Weight: -w.ThinkingSigTruncatedPenalty, Params: map[string]any{"bound": bound, "lengths": result.ThinkingSigLengths}})
+	} else if constantSigLength(result.ThinkingSigLengths) {
+		scores["anthropic"] -= w.ThinkingSigConstantPenalty
+		result.addEvidence(EvidenceItem{Code: "thinking_sig_constant_len", Weight: -w.ThinkingSigConstantPenalty, Params: map[string]any{"length": result.ThinkingSigLengths[0], "count": len(result.ThinkingSigLengths)}})
+	}
+	if length := sigLengthOutOfRange(result.ThinkingSigLengths, sigCheck); length > 0 {
+		lo, hi := sigCheck.ExpectedRange()
+		scores["anthropic"] -= w.ThinkingSigOutOfRangePenalty
+		result.addEvidence(EvidenceItem{Code: "thinking_sig_out_of_range", Weight: -w.ThinkingSigOutOfRangePenalty, Params: map[string]any{"length": length, "min": lo, "max": hi}})
+	}
+
+	// Cross-round inference_geo consistency: genuine Anthropic keeps one region per key
+	for _, fp := range validFPs {
+		if fp.HasInferenceGeo && !slices.Contains(result.InferenceGeos, fp.InferenceGeo) {
+			result.InferenceGeos = append(result.InferenceGeos, fp.InferenceGeo)
 		}
 	}
+	if len(result.InferenceGeos) > 1 {
+		result.addEvidence(EvidenceItem{Code: "inference_geo_mixed", Params: map[string]any{"geos": result.InferenceGeos}})
+	}
+	result.RemoteIPs = distinctRemoteIPs(fingerprints)
 
 	// Second pass: tooluse_ attribution correction
 	hasKiroModel := false
@@ -619,13 +1995,13 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 		toolusePoints := 0
 		for _, fp := range validFPs {
 			if fp.ToolIDSource == "bedrock" {
-				toolusePoints += 5
+				toolusePoints += w.ToolIDBedrock
 			}
 		}
 		if scores["antigravity"] >= 4 {
 			scores["antigravity"] += toolusePoints
 			scores["bedrock"] -= toolusePoints
-			evidence = append(evidence, fmt.Sprintf("[修正] tooluse_ 分数 %d 从 Bedrock 转移到 Antigravity", toolusePoints))
+			result.addEvidence(EvidenceItem{Code: "tooluse_reattributed", Weight: toolusePoints, Params: map[string]any{"points": toolusePoints}})
 		}
 	}
 
@@ -637,7 +2013,7 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 			}
 		}
 		if msgUUIDCount > 0 {
-			evidence = append(evidence, fmt.Sprintf("[修正] msg_<UUID> x%d 归属 Kiro 中转改写 (非 Antigravity)", msgUUIDCount))
+			result.addEvidence(EvidenceItem{Code: "msg_uuid_kiro", Params: map[string]any{"count": msgUUIDCount}})
 		}
 	}
 
@@ -651,7 +2027,7 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 		}
 	}
 
-	if scores["anthropic"] > 0 && scores["bedrock"] == 0 && scores["antigravity"] == 0 {
+	if scores["anthropic"] > 0 && scores["bedrock"] == 0 && scores["antigravity"] == 0 && scores["gemini"] == 0 && scores["openai"] == 0 {
 		anyInferenceGeo := false
 		anyCacheObj := false
 		for _, fp := range validFPs {
@@ -665,13 +2041,13 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 
 		if !anyInferenceGeo {
 			missingFlags = append(missingFlags, "inference_geo")
-			scores["anthropic"] -= 3
-			evidence = append(evidence, "[缺失] inference_geo 未出现 (Anthropic 官方必有字段)")
+			scores["anthropic"] -= w.MissingInferenceGeoPenalty
+			result.addEvidence(EvidenceItem{Code: "missing_inference_geo", Weight: -w.MissingInferenceGeoPenalty})
 		}
 		if !anyCacheObj {
 			missingFlags = append(missingFlags, "cache_creation_obj")
-			scores["anthropic"] -= 2
-			evidence = append(evidence, "[缺失] cache_creation 嵌套对象未出现")
+			scores["anthropic"] -= w.MissingCacheCreationPenalty
+			result.addEvidence(EvidenceItem{Code: "missing_cache_creation", Weight: -w.MissingCacheCreationPenalty})
 		}
 
 		if hasThinkingProbe {
@@ -684,12 +2060,46 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 			}
 			if !anyThinkingSig {
 				missingFlags = append(missingFlags, "thinking_signature")
-				scores["anthropic"] -= 3
-				evidence = append(evidence, "[缺失] thinking signature 为空 (真 Anthropic thinking 轮应有 len 200+ 签名)")
+				scores["anthropic"] -= w.MissingThinkingSigPenalty
+				result.addEvidence(EvidenceItem{Code: "missing_thinking_sig", Weight: -w.MissingThinkingSigPenalty})
 			}
 		}
 	}
 
+	// Fourth pass: response caching across the repeated tool probes
+	var toolLatencies []int64
+	for _, fp := range validFPs {
+		if fp.ProbeType == "tool" {
+			toolLatencies = append(toolLatencies, fp.LatencyMs)
+		}
+	}
+	mean, variance := latencyMeanVariance(toolLatencies)
+	result.LatencyVariance = math.Round(variance*100) / 100
+	lowVariance := len(toolLatencies) >= 2 && mean < cachedLatencyMaxMeanMs &&
+		variance < cachedLatencyMaxStdDevMs*cachedLatencyMaxStdDevMs
+	if lowVariance {
+		result.addEvidence(EvidenceItem{Code: "constant_latency", Params: map[string]any{"mean_ms": mean, "variance": variance}})
+	}
+	dupIDs := duplicateMsgIDs(validFPs)
+	if len(dupIDs) > 0 {
+		scores["anthropic"] -= w.DuplicateMsgIDPenalty
+		result.addEvidence(EvidenceItem{Code: "duplicate_msg_id", Weight: -w.DuplicateMsgIDPenalty, Params: map[string]any{"msg_ids": dupIDs}})
+	}
+	result.CachedResponse = lowVariance && len(dupIDs) > 0
+	if dupToolIDs := duplicateToolIDs(validFPs); len(dupToolIDs) > 0 {
+		result.DuplicateToolIDs = true
+		scores["anthropic"] -= w.DuplicateToolIDPenalty
+		result.addEvidence(EvidenceItem{Code: "duplicate_tool_id", Weight: -w.DuplicateToolIDPenalty, Params: map[string]any{"tool_ids": dupToolIDs}})
+	}
+	// Round-robin across backends: the echoed model or its classification changes between probes
+	echoedModels := distinctValues(validFPs, func(fp Fingerprint) string { return fp.Model })
+	modelSources := distinctValues(validFPs, func(fp Fingerprint) string { return fp.ModelSource })
+	if len(echoedModels) > 1 || len(modelSources) > 1 {
+		result.InconsistentBackend = true
+		scores["anthropic"] -= w.InconsistentBackendPenalty
+		result.addEvidence(EvidenceItem{Code: "inconsistent_backend", Weight: -w.InconsistentBackendPenalty, Params: map[string]any{"models": echoedModels, "sources": modelSources}})
+	}
+
 	// Ensure non-negative scores
 	for k := range scores {
 		if scores[k] < 0 {
@@ -697,8 +2107,19 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 		}
 	}
 
+	// Disqualifying platform: the platform itself is dispositive, skip score-based verdict
+	if system_setting.GetProxyDetectSetting().IsDisqualifyingPlatform(result.ProxyPlatform) {
+		result.Verdict = "proxy"
+		result.Confidence = 1
+		result.addEvidence(EvidenceItem{Code: "disqualifying_platform", Params: map[string]any{"platform": result.ProxyPlatform}})
+		result.Fingerprints = fingerprints
+		result.Scores = scores
+		result.VerdictText = verdictTextMap[result.Verdict]
+		return result
+	}
+
 	// Verdict
-	total := scores["anthropic"] + scores["bedrock"] + scores["antigravity"]
+	total := scores["anthropic"] + scores["bedrock"] + scores["antigravity"] + scores["gemini"] + scores["openai"]
 	suspicious := false
 
 	if total == 0 {
@@ -706,38 +2127,66 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 			result.Verdict = "anthropic"
 			result.Confidence = 0.0
 			suspicious = true
-			evidence = append(evidence, "[!] 正面分数被缺失扣分抵消，高度可疑伪装 Anthropic")
+			result.addEvidence(EvidenceItem{Code: "missing_fields_offset"})
 		} else {
 			result.Verdict = "unknown"
 			result.Confidence = 0.0
-			evidence = append(evidence, "未获取到有效指纹信号")
+			result.addEvidence(EvidenceItem{Code: "no_signal"})
 		}
 	} else {
 		winner := "anthropic"
 		maxScore := scores["anthropic"]
-		for _, k := range []string{"bedrock", "antigravity"} {
+		for _, k := range []string{"bedrock", "antigravity", "gemini", "openai"} {
 			if scores[k] > maxScore {
 				maxScore = scores[k]
 				winner = k
 			}
 		}
 		result.Verdict = winner
+		if winner == "openai" {
+			result.Verdict = "openai_translation"
+		}
 		result.Confidence = math.Round(float64(maxScore)/float64(total)*100) / 100
 		if winner == "anthropic" && len(missingFlags) >= 2 {
 			suspicious = true
+		} else if minConfidence := system_setting.GetProxyDetectSetting().MinConfidence; result.Confidence < minConfidence {
+			// Conflicting signals: keep scores and evidence but do not name a weak winner
+			result.Verdict = "unknown"
+			result.addEvidence(EvidenceItem{Code: "low_confidence",
+				Params: map[string]any{"winner": winner, "confidence": result.Confidence, "min": minConfidence}})
 		}
 	}
 
 	if suspicious {
 		result.Verdict = "suspicious"
-		evidence = append(evidence, fmt.Sprintf(
-			"[!!] 疑似伪装 Anthropic: %d 个必有字段缺失 (%s)",
-			len(missingFlags), strings.Join(missingFlags, ", ")))
-		evidence = append(evidence,
-			"[!!] 中转站可能重写了 tool_id 前缀并注入 service_tier，但无法伪造 inference_geo 和 cache_creation 嵌套对象")
+		result.addEvidence(EvidenceItem{Code: "missing_fields_suspicious",
+			Params: map[string]any{"count": len(missingFlags), "fields": missingFlags}})
+		result.addEvidence(EvidenceItem{Code: "missing_fields_hint"})
+	}
+
+	if result.CachedResponse && result.Verdict == "anthropic" {
+		result.Verdict = "suspicious"
+		result.addEvidence(EvidenceItem{Code: "cached_response"})
 	}
 
-	result.Evidence = evidence
+	if openAIFormat {
+		// None of the Anthropic fingerprints could be collected; the endpoint itself decides
+		result.Verdict = "openai_translation"
+		result.Confidence = 1
+	}
+
+	if streamBlob && result.Verdict == "anthropic" {
+		result.Verdict = "suspicious"
+		result.addEvidence(EvidenceItem{Code: "stream_faked"})
+	}
+
+	if visionMismatch && result.Verdict == "anthropic" {
+		result.Verdict = "suspicious"
+		result.addEvidence(EvidenceItem{Code: "vision_mismatch", Params: map[string]any{"model": model}})
+	}
+
+	applyBackendLLM(&result, fingerprints)
+
 	result.Fingerprints = fingerprints
 	result.Scores = scores
 	result.VerdictText = verdictTextMap[result.Verdict]
@@ -748,44 +2197,76 @@ func analyze(fingerprints []Fingerprint, model string) DetectResult {
 	return result
 }
 
-// verifyRatelimitDynamic sends multiple simple requests and checks if
-// ratelimit-input-remaining actually decrements (dynamic) or stays fixed (static).
-// Returns a map with keys: "verdict" (dynamic/static/unavailable), "samples", "detail"
-func verifyRatelimitDynamic(ctx context.Context, client *http.Client, baseURL, apiKey, model string, shots int) map[string]any {
-	if shots <= 0 {
-		shots = 4
+// ClampDetectRounds defaults unset tool probe rounds and caps them at maxDetectRounds
+func ClampDetectRounds(rounds int) int {
+	if rounds <= 0 {
+		return defaultDetectRounds
 	}
+	return min(rounds, maxDetectRounds)
+}
 
-	type sample struct {
-		Remaining int    `json:"remaining"`
-		Reset     string `json:"reset"`
+// ratelimitSamplesFromFingerprints collects the remaining-token values already observed by the
+// detection probes, in probe order. Concurrent tool probes finish in any order, and the Date
+// header is too coarse to sort them, so nothing is reused when concurrency > 1.
+func ratelimitSamplesFromFingerprints(fingerprints []Fingerprint, concurrency int) []RatelimitSample {
+	if concurrency > 1 {
+		return nil
 	}
+	var samples []RatelimitSample
+	for _, fp := range fingerprints {
+		if fp.Error == "" && fp.RatelimitInputRemaining > 0 {
+			samples = append(samples, RatelimitSample{
+				Remaining:  fp.RatelimitInputRemaining,
+				Reset:      fp.RatelimitInputReset,
+				ObservedAt: fp.RatelimitObservedAt,
+			})
+		}
+	}
+	return samples
+}
 
-	var samples []sample
+// verifyRatelimitDynamic checks whether ratelimit-input-remaining actually decrements (dynamic)
+// or stays fixed (static). Samples captured earlier (e.g. by the detection probes) are reused
+// first; simple requests are only sent, one at a time, until shots samples are collected.
+func verifyRatelimitDynamic(ctx context.Context, client *http.Client, target ProbeTarget, model string, shots int, reused []RatelimitSample) *RatelimitVerification {
+	if shots <= 0 {
+		shots = 4
+	}
+
+	samples := append([]RatelimitSample(nil), reused...)
+	extra := shots - len(samples)
 
-	for i := 0; i < shots; i++ {
+	for i := 0; i < extra; i++ {
 		if ctx.Err() != nil {
 			break
 		}
-		fp := probeOnce(ctx, client, baseURL, apiKey, model, "simple")
+		if i > 0 || len(reused) > 0 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fp := probeOnce(ctx, client, target, model, "simple")
 		if fp.Error == "" && fp.RatelimitInputRemaining > 0 {
-			samples = append(samples, sample{
-				Remaining: fp.RatelimitInputRemaining,
-				Reset:     fp.RatelimitInputReset,
+			samples = append(samples, RatelimitSample{
+				Remaining:  fp.RatelimitInputRemaining,
+				Reset:      fp.RatelimitInputReset,
+				ObservedAt: fp.RatelimitObservedAt,
 			})
 		}
-		if i < shots-1 {
-			time.Sleep(300 * time.Millisecond)
-		}
 	}
 
-	result := map[string]any{
-		"samples": samples,
+	result := classifyRatelimitSamples(samples)
+	result.ReusedSamples = len(reused)
+	return result
+}
+
+// classifyRatelimitSamples decides whether the sampled remaining values are dynamic or static
+func classifyRatelimitSamples(samples []RatelimitSample) *RatelimitVerification {
+	result := &RatelimitVerification{
+		Samples: samples,
 	}
 
 	if len(samples) < 2 {
-		result["verdict"] = "unavailable"
-		result["detail"] = "ratelimit header 不可用（样本不足）"
+		result.Verdict = "unavailable"
+		result.Detail = "ratelimit header 不可用（样本不足）"
 		return result
 	}
 
@@ -808,51 +2289,85 @@ func verifyRatelimitDynamic(ctx context.Context, client *http.Client, baseURL, a
 	}
 
 	totalDrop := samples[0].Remaining - samples[len(samples)-1].Remaining
+	result.TotalDrop = totalDrop
+	result.Monotone = monotoneDec && totalDrop > 0
 
 	if allSame {
-		result["verdict"] = "static"
-		result["detail"] = fmt.Sprintf("remaining 固定为 %d，疑似伪造", samples[0].Remaining)
-	} else if monotoneDec && totalDrop > 0 {
-		result["verdict"] = "dynamic"
-		result["detail"] = fmt.Sprintf("remaining 单调递减 %d → %d (drop=%d)，真实 ratelimit",
+		result.Verdict = "static"
+		result.Detail = fmt.Sprintf("remaining 固定为 %d，疑似伪造", samples[0].Remaining)
+	} else if result.Monotone {
+		result.Verdict = "dynamic"
+		result.Detail = fmt.Sprintf("remaining 单调递减 %d → %d (drop=%d)，真实 ratelimit",
 			samples[0].Remaining, samples[len(samples)-1].Remaining, totalDrop)
 	} else {
-		result["verdict"] = "dynamic"
-		result["detail"] = fmt.Sprintf("remaining 有变化但非单调 (%d → %d)，可能真实",
+		result.Verdict = "dynamic"
+		result.Detail = fmt.Sprintf("remaining 有变化但非单调 (%d → %d)，可能真实",
 			samples[0].Remaining, samples[len(samples)-1].Remaining)
 	}
 
+	if check, detail := checkRatelimitResets(samples); check != "" {
+		result.ResetCheck = check
+		result.Detail += "；" + detail
+	}
+	result.ResetSane = result.ResetCheck == RatelimitResetOK
+
 	return result
 }
 
-// FindWorkingModel tries multiple models to find one that works with the given API key.
-// Excludes Opus to save quota. Returns the first working model or a default.
-func FindWorkingModel(ctx context.Context, client *http.Client, baseURL, apiKey string) string {
-	probeModels := []string{
-		"claude-sonnet-4-5-20250929",
-		"claude-haiku-4-5-20251001",
-		"claude-3-5-sonnet-20241022",
-		"claude-3-haiku-20240307",
-	}
+// Default model ID substring kept by FetchRemoteModels
+const defaultModelFilterSubstring = "claude"
 
-	for _, model := range probeModels {
-		if ctx.Err() != nil {
-			break
-		}
-		checkCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
-		if CheckModelAvailable(checkCtx, client, baseURL, apiKey, model) {
-			cancel()
-			return model
+// ModelFilter selects model IDs returned by FetchRemoteModels.
+// The zero value keeps Claude models only.
+type ModelFilter struct {
+	all       bool
+	substring string
+	pattern   *regexp.Regexp
+}
+
+// ParseModelFilter parses a filter expression:
+// "" = Claude models only, "all" = every model, "re:<expr>" = regular expression,
+// anything else = case-insensitive substring
+func ParseModelFilter(expr string) (ModelFilter, error) {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case expr == "":
+		return ModelFilter{}, nil
+	case strings.EqualFold(expr, "all"):
+		return ModelFilter{all: true}, nil
+	case strings.HasPrefix(expr, "re:"):
+		pattern, err := regexp.Compile(strings.TrimPrefix(expr, "re:"))
+		if err != nil {
+			return ModelFilter{}, fmt.Errorf("invalid model filter regex: %w", err)
 		}
-		cancel()
+		return ModelFilter{pattern: pattern}, nil
+	default:
+		return ModelFilter{substring: strings.ToLower(expr)}, nil
+	}
+}
+
+// Match reports whether a model ID passes the filter
+func (f ModelFilter) Match(id string) bool {
+	switch {
+	case f.all:
+		return true
+	case f.pattern != nil:
+		return f.pattern.MatchString(id)
+	case f.substring != "":
+		return strings.Contains(strings.ToLower(id), f.substring)
+	default:
+		return strings.Contains(strings.ToLower(id), defaultModelFilterSubstring)
 	}
+}
 
-	return probeModels[0]
+// FetchRemoteModels fetches models matching filter from a remote OpenAI-compatible /v1/models endpoint.
+func FetchRemoteModels(baseURL, apiKey string, skipSSRFCheck bool, filter ModelFilter) ([]string, error) {
+	return fetchRemoteModels(context.Background(), baseURL, apiKey, skipSSRFCheck, filter)
 }
 
-// FetchRemoteModels fetches available Claude models from a remote OpenAI-compatible /v1/models endpoint.
-func FetchRemoteModels(baseURL, apiKey string, skipSSRFCheck bool) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// fetchRemoteModels is FetchRemoteModels bounded by the parent context
+func fetchRemoteModels(parent context.Context, baseURL, apiKey string, skipSSRFCheck bool, filter ModelFilter) ([]string, error) {
+	ctx, cancel := context.WithTimeout(parent, 15*time.Second)
 	defer cancel()
 
 	var client *http.Client
@@ -879,7 +2394,7 @@ func FetchRemoteModels(baseURL, apiKey string, skipSSRFCheck bool) ([]string, er
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := readLimitedBody(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
@@ -893,172 +2408,557 @@ func FetchRemoteModels(baseURL, apiKey string, skipSSRFCheck bool) ([]string, er
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	var claudeModels []string
+	var models []string
 	for _, m := range result.Data {
-		if strings.Contains(strings.ToLower(m.ID), "claude") {
-			claudeModels = append(claudeModels, m.ID)
+		if filter.Match(m.ID) {
+			models = append(models, m.ID)
 		}
 	}
 
-	return claudeModels, nil
+	return models, nil
 }
 
 // DetectSingleModel runs detection for a single model with SSRF-safe HTTP client
-func DetectSingleModel(baseURL, apiKey, model string, rounds int, skipSSRFCheck bool, verifyRatelimit bool) DetectResult {
-	ctx, cancel := context.WithTimeout(context.Background(), singleDetectTimeout)
+func DetectSingleModel(baseURL, apiKey, model string, opts DetectOptions) DetectResult {
+	result := detectSingleModel(context.Background(), baseURL, apiKey, model, opts)
+	result.localize(opts.Lang)
+	return result
+}
+
+// detectSingleModel is DetectSingleModel bounded by the parent context
+func detectSingleModel(parent context.Context, baseURL, apiKey, model string, opts DetectOptions) DetectResult {
+	requested := model
+	model = system_setting.GetProxyDetectSetting().ResolveModelAlias(model)
+	opts.TraceID = normalizeTraceID(opts.TraceID)
+	timeouts := system_setting.GetProxyDetectSetting().Timeouts
+	detectTimeout, probeTimeout := timeouts.SingleDetect(), timeouts.Probe()
+	quick := opts.Preset == DetectPresetQuick
+	if quick {
+		// One tool probe and nothing else, so the result comes back within quickDetectTimeout
+		opts.Rounds = 1
+		opts.CheckVersions = false
+		opts.VerifyRatelimit = false
+		opts.Probes = nil
+		detectTimeout = min(detectTimeout, quickDetectTimeout)
+		probeTimeout = min(probeTimeout, quickDetectTimeout)
+	}
+	ctx, cancel := context.WithTimeout(withTraceID(parent, opts.TraceID), detectTimeout)
 	defer cancel()
+	ctx, ownBudget := withProbeBudget(ctx)
+	ctx = withCustomPrompts(ctx, opts.CustomPrompts)
+	ctx = withRawCapture(ctx, opts.IncludeRaw)
+
+	cacheKey := detectResultCacheKey(baseURL, apiKey, model, opts)
+	if !opts.Force {
+		if cached, ok := cachedDetectResult(cacheKey); ok {
+			cached.TraceID = opts.TraceID
+			cached.ModelRequested = modelRequested(requested, model)
+			logger.LogInfo(ctx, fmt.Sprintf("proxy detect served from cache: model=%s verdict=%s", model, cached.Verdict))
+			return cached
+		}
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect started: model=%s rounds=%d", model, opts.Rounds))
+	started := time.Now()
 
+	if opts.AnthropicVersion == "" {
+		opts.AnthropicVersion = defaultAnthropicVersion
+	}
+	target := ProbeTarget{BaseURL: baseURL, APIKey: apiKey, AnthropicVersion: opts.AnthropicVersion, MessagesPath: opts.MessagesPath,
+		ExtraHeaders: opts.ExtraHeaders, OverrideCoreHeaders: opts.OverrideCoreHeaders}
+
+	rounds := opts.Rounds
 	var client *http.Client
-	if skipSSRFCheck {
+	var tlsRec *tlsCertRecorder
+	switch {
+	case opts.OutboundProxy != "":
+		client = newOutboundProxyClient(probeTimeout, opts.OutboundProxy, !opts.SkipSSRFCheck)
+	case opts.CaptureTLS:
+		client, tlsRec = newTLSCaptureClient(probeTimeout, !opts.SkipSSRFCheck)
+	case opts.SkipSSRFCheck:
 		client = newUnsafeHTTPClient(probeTimeout)
-	} else {
+	default:
 		client = newSafeHTTPClient(probeTimeout)
 	}
 
 	var fingerprints []Fingerprint
 
 	// Tool probes
-	for i := 0; i < rounds; i++ {
-		if ctx.Err() != nil {
-			break
+	if probeSelected(opts, "tool", true) {
+		fingerprints = append(fingerprints, runToolProbes(ctx, client, target, model, rounds, opts.Concurrency)...)
+	}
+
+	switch {
+	case quick:
+	case messagesEndpointMissing(fingerprints):
+		// OpenAI-only channel: the other /v1/messages probes would fail the same way
+		if ctx.Err() == nil {
+			fingerprints = append(fingerprints, probeChatCompletions(ctx, client, target, model))
 		}
-		fp := probeOnce(ctx, client, baseURL, apiKey, model, "tool")
-		fingerprints = append(fingerprints, fp)
-		if i < rounds-1 {
-			time.Sleep(300 * time.Millisecond)
+	default:
+		fingerprints = append(fingerprints, runFollowUpProbes(ctx, client, target, model, opts)...)
+	}
+
+	// Probes skipped for budget carry no signal
+	var skipped int
+	fingerprints = slices.DeleteFunc(fingerprints, func(fp Fingerprint) bool {
+		if fp.ErrorClass == ProbeErrorBudget {
+			skipped++
+			return true
+		}
+		return false
+	})
+
+	result := analyze(fingerprints, model, system_setting.GetProxyDetectSetting().ScoringWeights)
+	if quick {
+		result.Quick = true
+		result.addEvidence(EvidenceItem{Code: "quick_scan"})
+	}
+	if tlsRec != nil {
+		applyTLSCertificate(&result, tlsRec.certificate())
+	}
+	result.TraceID = opts.TraceID
+	result.AnthropicVersion = opts.AnthropicVersion
+	result.MessagesPath = opts.MessagesPath
+	if result.MessagesPath == "" {
+		result.MessagesPath = defaultMessagesPath
+	}
+
+	budget := probeBudgetFrom(ctx)
+	if skipped > 0 {
+		// Partial probes are not a reliable verdict; keep the evidence for diagnostics
+		usage := budget.usage()
+		result.Verdict = "budget_exhausted"
+		result.VerdictText = verdictTextMap["budget_exhausted"]
+		result.Confidence = 0
+		result.addEvidence(EvidenceItem{Code: "budget_exhausted",
+			Params: map[string]any{"used": usage.OutputTokens, "budget": usage.Budget, "skipped": skipped}})
+	}
+
+	// Optional: which anthropic-version values the upstream accepts
+	anthropicFormat := result.Verdict != "openai_translation"
+	if opts.CheckVersions && anthropicFormat && ctx.Err() == nil && !budget.exhausted() {
+		result.VersionSupport = checkVersionSupport(ctx, client, target, model)
+		var rejected []string
+		for _, v := range KnownAnthropicVersions {
+			if !result.VersionSupport[v] {
+				rejected = append(rejected, v)
+			}
+		}
+		if len(rejected) > 0 {
+			result.addEvidence(EvidenceItem{Code: "versions_rejected", Params: map[string]any{"versions": rejected}})
+		}
+	}
+
+	// Optional: verify ratelimit dynamic behavior
+	if opts.VerifyRatelimit && anthropicFormat && ctx.Err() == nil && !budget.exhausted() {
+		result.RatelimitVerify = verifyRatelimitDynamic(ctx, client, target, model, ratelimitVerifyShots, ratelimitSamplesFromFingerprints(fingerprints, opts.Concurrency))
+		switch result.RatelimitVerify.Verdict {
+		case "static":
+			result.addEvidence(EvidenceItem{Code: "ratelimit_static", Params: map[string]any{"remaining": result.RatelimitVerify.Samples[0].Remaining}})
+		case "dynamic":
+			result.addEvidence(EvidenceItem{Code: "ratelimit_dynamic", Params: map[string]any{"total_drop": result.RatelimitVerify.TotalDrop, "monotone": result.RatelimitVerify.Monotone}})
+		case "unavailable":
+			result.addEvidence(EvidenceItem{Code: "ratelimit_unavailable"})
+		}
+		if check := result.RatelimitVerify.ResetCheck; check != "" && check != RatelimitResetOK {
+			result.addEvidence(EvidenceItem{Code: "ratelimit_reset_" + check})
 		}
 	}
 
-	// Thinking probe
+	if ownBudget {
+		result.TokenUsage = budget.usage()
+	}
+	if ctx.Err() != nil {
+		// Partial probes are not a reliable verdict; keep the fingerprints for diagnostics
+		result.Verdict = "timeout"
+		if keyRejected(ctx) {
+			result.Verdict = "invalid_key"
+		}
+		result.VerdictText = verdictTextMap[result.Verdict]
+		result.Confidence = 0
+	}
+	result.ModelRequested = modelRequested(requested, model)
+	result.Badges = computeDetectBadges(result)
+	// A provisional quick verdict must not enter the history or trigger verdict-change webhooks
+	if opts.PersistResult && !quick {
+		previous := verdictWebhookBaseline(ctx, baseURL, result.Model)
+		persistDetectResult(ctx, baseURL, apiKey, result)
+		notifyVerdictChange(baseURL, previous, result)
+	}
 	if ctx.Err() == nil {
-		fp := probeOnce(ctx, client, baseURL, apiKey, model, "thinking")
+		storeDetectResult(cacheKey, result)
+	}
+	detectMetrics().ObserveDetection(result.Verdict, result.ProxyPlatform, time.Since(started))
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect finished: model=%s verdict=%s", model, result.Verdict))
+	return result
+}
+
+// persistDetectResult records one result in ProxyDetectLog. Only salted hashes of the
+// base URL and API key are stored, so runs can be correlated without leaking credentials.
+func persistDetectResult(ctx context.Context, baseURL, apiKey string, result DetectResult) {
+	entry := &model.ProxyDetectLog{
+		BaseURLHash:   model.HashProxyDetectTarget(baseURL),
+		KeyHash:       common.GenerateHMAC(apiKey),
+		Model:         result.Model,
+		Verdict:       result.Verdict,
+		Confidence:    result.Confidence,
+		Scores:        common.GetJsonString(result.Scores),
+		ProxyPlatform: result.ProxyPlatform,
+		Fingerprints:  common.GetJsonString(withoutRawResponses(result.Fingerprints)),
+	}
+	if err := entry.Insert(); err != nil {
+		logger.LogError(ctx, "failed to record proxy detect log: "+err.Error())
+	}
+}
+
+// runFollowUpProbes runs the probes after the tool rounds; the thorough preset adds the
+// parameter-fidelity and header probes
+func runFollowUpProbes(ctx context.Context, client *http.Client, target ProbeTarget, model string, opts DetectOptions) []Fingerprint {
+	var fingerprints []Fingerprint
+	thorough := opts.Preset == DetectPresetThorough
+
+	// Thinking probes; the thorough preset repeats them to compare signature lengths
+	for i := 0; probeSelected(opts, "thinking", true) && i < thinkingProbeRounds(opts) && ctx.Err() == nil; i++ {
+		fp := probeOnce(ctx, client, target, model, "thinking")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Streaming probe measuring time-to-first-token (thorough preset, or selected)
+	if probeSelected(opts, "stream", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "stream")
 		fingerprints = append(fingerprints, fp)
 	}
 
-	result := analyze(fingerprints, model)
+	// Minimal request (only when selected in DetectOptions.Probes)
+	if probeSelected(opts, "simple", false) && ctx.Err() == nil {
+		fingerprints = append(fingerprints, probeOnce(ctx, client, target, model, "simple"))
+	}
 
-	// Optional: verify ratelimit dynamic behavior
-	if verifyRatelimit && ctx.Err() == nil {
-		result.RatelimitVerify = verifyRatelimitDynamic(ctx, client, baseURL, apiKey, model, 4)
-		if v, ok := result.RatelimitVerify["verdict"].(string); ok {
-			switch v {
-			case "static":
-				result.Evidence = append(result.Evidence,
-					"[!!] ratelimit remaining 值固定不变，疑似伪造的 ratelimit header")
-			case "dynamic":
-				result.Evidence = append(result.Evidence,
-					"[✓] ratelimit remaining 正常递减，真实 Anthropic ratelimit header")
-			case "unavailable":
-				result.Evidence = append(result.Evidence,
-					"[i] ratelimit header 不可用，无法进行动态验证")
+	// max_tokens cap probe (thorough preset only, costs ~1k output tokens)
+	if probeSelected(opts, "max_tokens", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "max_tokens")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// system parameter probe (thorough preset only)
+	if probeSelected(opts, "system", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "system")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// stop_sequences parameter probe (thorough preset only)
+	if probeSelected(opts, "stop_sequences", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "stop_sequences")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Self-identification probe (thorough preset only)
+	if probeSelected(opts, "identity", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "identity")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Image input probe (thorough preset, or selected in DetectOptions.Probes)
+	if probeSelected(opts, "vision", thorough) && ctx.Err() == nil {
+		fp := probeOnce(ctx, client, target, model, "vision")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Prompt caching probe (thorough preset, or selected): the same cached prefix sent twice
+	if probeSelected(opts, "cache", thorough) && ctx.Err() == nil {
+		fingerprints = append(fingerprints, probePromptCache(ctx, client, target, model))
+	}
+
+	// Raw header casing probe (thorough preset only, needs its own HTTP/1.1 client, which
+	// would bypass an outbound proxy)
+	if probeSelected(opts, "header_case", thorough) && opts.OutboundProxy == "" && ctx.Err() == nil {
+		headerClient, rec := newHeaderCaseClient(system_setting.GetProxyDetectSetting().Timeouts.Probe(), !opts.SkipSSRFCheck)
+		fp := probeOnce(ctx, headerClient, target, model, "header_case")
+		if fp.Error == "" {
+			fp.HeaderCase = classifyHeaderCase(rec.headerNames())
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Invalid anthropic-version probe (thorough preset only, the expected 400 costs nothing)
+	if probeSelected(opts, "bad_version", thorough) && ctx.Err() == nil {
+		versionTarget := target
+		versionTarget.AnthropicVersion = invalidAnthropicVersion
+		fp := probeOnce(ctx, client, versionTarget, model, "bad_version")
+		fingerprints = append(fingerprints, fp)
+	}
+
+	// Requested service_tier probe (thorough preset only, the expected 400 costs nothing)
+	if probeSelected(opts, "service_tier", thorough) && ctx.Err() == nil {
+		fingerprints = append(fingerprints, probeOnce(ctx, client, target, model, "service_tier"))
+	}
+
+	// Auth scheme probe (thorough preset only): one request per credential header
+	if probeSelected(opts, "auth", thorough) && ctx.Err() == nil {
+		fingerprints = append(fingerprints, probeAuthSchemes(ctx, client, target, model))
+	}
+	return fingerprints
+}
+
+// runToolProbes sends rounds tool probes, up to concurrency at a time. Results keep round
+// order so the [R1]/[R2] evidence tags stay stable; rounds skipped after ctx ends are dropped.
+func runToolProbes(ctx context.Context, client *http.Client, target ProbeTarget, model string, rounds, concurrency int) []Fingerprint {
+	concurrency = min(max(concurrency, 1), maxProbeConcurrency)
+	if concurrency == 1 {
+		var fingerprints []Fingerprint
+		for i := 0; i < rounds; i++ {
+			if ctx.Err() != nil {
+				break
+			}
+			fingerprints = append(fingerprints, probeOnce(ctx, client, target, model, "tool"))
+			if i < rounds-1 {
+				time.Sleep(300 * time.Millisecond)
 			}
 		}
+		return fingerprints
 	}
 
-	return result
+	results := make([]*Fingerprint, rounds)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			fp := probeOnce(ctx, client, target, model, "tool")
+			results[i] = &fp
+		}(i)
+	}
+	wg.Wait()
+
+	fingerprints := make([]Fingerprint, 0, rounds)
+	for _, fp := range results {
+		if fp != nil {
+			fingerprints = append(fingerprints, *fp)
+		}
+	}
+	return fingerprints
+}
+
+// checkVersionSupport sends one minimal request per known anthropic-version
+func checkVersionSupport(ctx context.Context, client *http.Client, target ProbeTarget, model string) map[string]bool {
+	support := make(map[string]bool, len(KnownAnthropicVersions))
+	for _, v := range KnownAnthropicVersions {
+		if ctx.Err() != nil {
+			break
+		}
+		versionTarget := target
+		versionTarget.AnthropicVersion = v
+		support[v] = CheckModelAvailable(ctx, client, versionTarget, model) == nil
+	}
+	return support
 }
 
-// CheckModelAvailable quickly checks if a model is available
-func CheckModelAvailable(ctx context.Context, client *http.Client, baseURL, apiKey, model string) bool {
-	payload := map[string]any{
+// buildAvailabilityPayload builds the minimal request used by CheckModelAvailable
+func buildAvailabilityPayload(model string) map[string]any {
+	return map[string]any{
 		"model":      model,
 		"max_tokens": 5,
 		"messages":   []map[string]any{{"role": "user", "content": "hi"}},
 	}
-	payloadBytes, err := common.Marshal(payload)
-	if err != nil {
-		return false
-	}
+}
 
-	reqURL := strings.TrimRight(baseURL, "/") + "/v1/messages"
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(payloadBytes))
+// CheckModelAvailable quickly checks if a model is available. It returns nil when it is,
+// else a *ModelUnavailableError telling why.
+func CheckModelAvailable(ctx context.Context, client *http.Client, target ProbeTarget, model string) error {
+	req, err := target.newMessagesRequest(ctx, buildAvailabilityPayload(model))
 	if err != nil {
-		return false
+		return &ModelUnavailableError{Reason: UnavailableReasonNetwork}
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false
+		return &ModelUnavailableError{Reason: requestFailureReason(ctx, err)}
 	}
 	defer resp.Body.Close()
-	return resp.StatusCode == 200
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAuthErrorBodyBytes))
+	return &ModelUnavailableError{Reason: classifyUnavailableResponse(resp.StatusCode, body), StatusCode: resp.StatusCode}
+}
+
+// ScanMultipleModels detects several models concurrently under the configured scan timeout,
+// each model bounded by the configured per-model budget
+func ScanMultipleModels(baseURL, apiKey string, models []string, opts DetectOptions) ScanResult {
+	budget := system_setting.GetProxyDetectSetting().Timeouts.MultiScanModel()
+	scan := scanMultipleModels(context.Background(), baseURL, apiKey, models, opts, budget)
+	scan.localize(opts.Lang)
+	return scan
 }
 
-// ScanMultipleModels scans multiple models to detect mixed channels
-func ScanMultipleModels(baseURL, apiKey string, models []string, rounds int, skipSSRFCheck bool) ScanResult {
+// scanMultipleModels scans the models in sequential batches of multiScanConcurrency. Each model gets
+// its own context derived from the global deadline and capped at budget, so a slow model cannot
+// starve the others; models that run out of time get the "timeout" verdict. Once the global deadline
+// passes no further batch starts, and the scan reports where it was truncated.
+func scanMultipleModels(parent context.Context, baseURL, apiKey string, models []string, opts DetectOptions, budget time.Duration) ScanResult {
 	if len(models) == 0 {
-		models = DefaultScanModels
+		models = system_setting.GetProxyDetectSetting().ScanModelEntries()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), multiScanTimeout)
+	opts.TraceID = normalizeTraceID(opts.TraceID)
+	ctx, cancel := context.WithTimeout(withTraceID(parent, opts.TraceID), system_setting.GetProxyDetectSetting().Timeouts.MultiScan())
 	defer cancel()
-
-	var client *http.Client
-	if skipSSRFCheck {
-		client = newUnsafeHTTPClient(probeTimeout)
-	} else {
-		client = newSafeHTTPClient(probeTimeout)
-	}
-
-	scan := ScanResult{
-		BaseURL: baseURL,
-		Summary: make(map[string]string),
-	}
-
-	for _, model := range models {
+	ctx, _ = withProbeBudget(ctx)
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect scan started: %d models", len(models)))
+
+	results := make([]DetectResult, len(models))
+	scanned := len(models)
+	for start := 0; start < len(models); start += multiScanConcurrency {
 		if ctx.Err() != nil {
+			scanned = start
 			break
 		}
-
-		availClient := client
-		if skipSSRFCheck {
-			availClient = newUnsafeHTTPClient(availCheckTimeout)
-		} else {
-			availClient = newSafeHTTPClient(availCheckTimeout)
+		var wg sync.WaitGroup
+		for i := start; i < min(start+multiScanConcurrency, len(models)); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = scanOneModel(ctx, baseURL, apiKey, models[i], opts, budget)
+				// A rejected key fails every other model the same way
+				if results[i].Verdict == "invalid_key" {
+					abort(errKeyRejected)
+				}
+			}(i)
 		}
+		wg.Wait()
+	}
+	results = results[:scanned]
 
-		if !CheckModelAvailable(ctx, availClient, baseURL, apiKey, model) {
-			r := DetectResult{
-				Model:       model,
-				Verdict:     "unavailable",
-				VerdictText: "不可用",
-				Scores:      map[string]int{"anthropic": 0, "bedrock": 0, "antigravity": 0},
+	scan := ScanResult{
+		BaseURL:      baseURL,
+		ModelResults: results,
+		Summary:      make(map[string]string, len(results)),
+		TraceID:      opts.TraceID,
+		TokenUsage:   probeBudgetFrom(ctx).usage(),
+	}
+	if keyRejected(ctx) {
+		scan.Verdict = "invalid_key"
+		scan.VerdictText = verdictTextMap["invalid_key"]
+	}
+	if scanned < len(models) {
+		scan.TruncatedAt = scanned
+		scan.UnscannedModels = models[scanned:]
+		reason := "timeout"
+		if scan.Verdict == "invalid_key" {
+			reason = "rejected API key"
+		}
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect scan truncated by %s: %d of %d models scanned", reason, scanned, len(models)))
+	}
+	verdictSet := make(map[string]bool)
+	for _, result := range results {
+		scan.Summary[result.Model] = result.Verdict
+		if result.UnavailableReason != "" {
+			if scan.SummaryReasons == nil {
+				scan.SummaryReasons = make(map[string]string)
 			}
-			scan.ModelResults = append(scan.ModelResults, r)
-			scan.Summary[model] = "unavailable"
-			continue
+			scan.SummaryReasons[result.Model] = result.UnavailableReason
 		}
-
-		// Use DetectSingleModel which creates its own context/client
-		result := DetectSingleModel(baseURL, apiKey, model, rounds, skipSSRFCheck, false)
-		scan.ModelResults = append(scan.ModelResults, result)
-		scan.Summary[model] = result.Verdict
-
 		if result.ProxyPlatform != "" && scan.ProxyPlatform == "" {
 			scan.ProxyPlatform = result.ProxyPlatform
 		}
+		// Check if mixed channel
+		if isConclusiveVerdict(result.Verdict) {
+			verdictSet[result.Verdict] = true
+		}
+	}
+	scan.IsMixed = len(verdictSet) > 1
+	scan.ChannelVerdict = AggregateChannelVerdict(results)
+
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect scan finished: mixed=%t", scan.IsMixed))
+	return scan
+}
+
+// scanOneModel checks availability and detects one model within its own budget
+func scanOneModel(parent context.Context, baseURL, apiKey, model string, opts DetectOptions, budget time.Duration) DetectResult {
+	requested := model
+	model = system_setting.GetProxyDetectSetting().ResolveModelAlias(model)
+	result := scanResolvedModel(parent, baseURL, apiKey, model, opts, budget)
+	result.ModelRequested = modelRequested(requested, model)
+	return result
+}
+
+// modelRequested returns the requested model name when an alias was normalized, else ""
+func modelRequested(requested, model string) string {
+	if requested == model {
+		return ""
+	}
+	return requested
+}
 
-		time.Sleep(500 * time.Millisecond)
+// scanResolvedModel is scanOneModel for a model name with aliases already normalized
+func scanResolvedModel(parent context.Context, baseURL, apiKey, model string, opts DetectOptions, budget time.Duration) DetectResult {
+	if probeBudgetFrom(parent).exhausted() {
+		return budgetExhaustedDetectResult(model, opts.TraceID)
 	}
 
-	// Check if mixed channel
-	verdictSet := make(map[string]bool)
-	for _, v := range scan.Summary {
-		if v != "unavailable" {
-			verdictSet[v] = true
+	ctx, cancel := context.WithTimeout(parent, budget)
+	defer cancel()
+
+	availTimeout := system_setting.GetProxyDetectSetting().Timeouts.AvailCheck()
+	var availClient *http.Client
+	if opts.OutboundProxy != "" {
+		availClient = newOutboundProxyClient(availTimeout, opts.OutboundProxy, !opts.SkipSSRFCheck)
+	} else if opts.SkipSSRFCheck {
+		availClient = newUnsafeHTTPClient(availTimeout)
+	} else {
+		availClient = newSafeHTTPClient(availTimeout)
+	}
+	availTarget := ProbeTarget{BaseURL: baseURL, APIKey: apiKey, AnthropicVersion: opts.AnthropicVersion, MessagesPath: opts.MessagesPath,
+		ExtraHeaders: opts.ExtraHeaders, OverrideCoreHeaders: opts.OverrideCoreHeaders}
+	if err := CheckModelAvailable(ctx, availClient, availTarget, model); err != nil {
+		reason := unavailableReason(err)
+		if reason == UnavailableReasonAuth {
+			return invalidKeyDetectResult(model, opts.TraceID)
+		}
+		if ctx.Err() != nil {
+			return interruptedDetectResult(ctx, model, opts.TraceID)
+		}
+		return DetectResult{
+			Model:             model,
+			Verdict:           "unavailable",
+			VerdictText:       verdictTextMap["unavailable"],
+			UnavailableReason: reason,
+			Scores:            newDetectScores(),
+			TraceID:           opts.TraceID,
 		}
 	}
-	scan.IsMixed = len(verdictSet) > 1
 
-	return scan
+	modelOpts := opts
+	modelOpts.VerifyRatelimit = false
+	// detectSingleModel turns a run cut short by ctx into timeout or invalid_key
+	return detectSingleModel(ctx, baseURL, apiKey, model, modelOpts)
+}
+
+func timeoutDetectResult(model, traceID string) DetectResult {
+	return DetectResult{
+		Model:       model,
+		Verdict:     "timeout",
+		VerdictText: verdictTextMap["timeout"],
+		Scores:      newDetectScores(),
+		TraceID:     traceID,
+	}
 }
 
-// ValidateProxyDetectURL validates the URL for proxy detection
-func ValidateProxyDetectURL(rawURL string) error {
+// ValidateProxyDetectURL validates the URL for proxy detection. Unless skipSSRFCheck is set
+// the host must also pass the target host denylist and allowlist.
+func ValidateProxyDetectURL(rawURL string, skipSSRFCheck bool) error {
 	parsed, err := url.Parse(rawURL)
 	if err != nil {
 		return fmt.Errorf("invalid URL format")
@@ -1069,6 +2969,9 @@ func ValidateProxyDetectURL(rawURL string) error {
 	if parsed.Hostname() == "" {
 		return fmt.Errorf("URL must have a hostname")
 	}
+	if !skipSSRFCheck {
+		return checkTargetHost(parsed.Hostname())
+	}
 	return nil
 }
 
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"net/http"
+)
+
+// Probes normally send the key both as x-api-key and as Authorization: Bearer so any
+// upstream accepts them. The auth probe sends the same request once per scheme: the
+// official /v1/messages only authenticates API keys through x-api-key, so an upstream that
+// accepts Bearer is an OpenAI-style translation layer.
+
+// Schemes for ProbeTarget.AuthScheme; empty sends both headers
+const (
+	AuthSchemeXAPIKey = "x-api-key"
+	AuthSchemeBearer  = "bearer"
+)
+
+// setAuthHeaders sets the credential headers of scheme on req
+func setAuthHeaders(req *http.Request, scheme, apiKey string) {
+	if scheme != AuthSchemeBearer {
+		req.Header.Set("x-api-key", apiKey)
+	}
+	if scheme != AuthSchemeXAPIKey {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// probeAuthSchemes sends the auth probe with each scheme alone. The fingerprint of the
+// accepted request is kept for the usual body analysis (x-api-key first); when neither
+// scheme is accepted it carries the x-api-key failure.
+func probeAuthSchemes(ctx context.Context, client *http.Client, target ProbeTarget, model string) Fingerprint {
+	xTarget := target
+	xTarget.AuthScheme = AuthSchemeXAPIKey
+	fp := probeOnce(ctx, client, xTarget, model, "auth")
+	if fp.ErrorClass == ProbeErrorBudget || ctx.Err() != nil {
+		return fp
+	}
+
+	bearerTarget := target
+	bearerTarget.AuthScheme = AuthSchemeBearer
+	bearer := probeOnce(ctx, client, bearerTarget, model, "auth")
+
+	acceptsXAPIKey, acceptsBearer := fp.Error == "", bearer.Error == ""
+	if !acceptsXAPIKey && acceptsBearer {
+		fp = bearer
+	}
+	fp.AcceptsXAPIKey = acceptsXAPIKey
+	fp.AcceptsBearer = acceptsBearer
+	return fp
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAuthHeaders(t *testing.T) {
+	for scheme, want := range map[string][2]string{
+		"":                {"sk-test", "Bearer sk-test"},
+		AuthSchemeXAPIKey: {"sk-test", ""},
+		AuthSchemeBearer:  {"", "Bearer sk-test"},
+	} {
+		req, err := http.NewRequest(http.MethodPost, "http://example.com", nil)
+		require.NoError(t, err)
+		setAuthHeaders(req, scheme, "sk-test")
+		require.Equal(t, want[0], req.Header.Get("x-api-key"), scheme)
+		require.Equal(t, want[1], req.Header.Get("Authorization"), scheme)
+	}
+}
+
+func TestProbeAuthSchemes(t *testing.T) {
+	var acceptXAPIKey, acceptBearer bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (acceptXAPIKey && r.Header.Get("x-api-key") != "") || (acceptBearer && r.Header.Get("Authorization") != "") {
+			_, _ = w.Write([]byte(toolProbeGenuineBody))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	w := system_setting.DefaultScoringWeights
+	probe := func(xAPIKey, bearer bool) (Fingerprint, DetectResult) {
+		acceptXAPIKey, acceptBearer = xAPIKey, bearer
+		fp := probeAuthSchemes(context.Background(), client, target, "claude-sonnet-4-5-20250929")
+		return fp, analyze([]Fingerprint{anthropicFingerprint("tool"), fp}, "claude-test", w)
+	}
+
+	fp, result := probe(true, false)
+	require.Empty(t, fp.Error)
+	require.True(t, fp.AcceptsXAPIKey)
+	require.False(t, fp.AcceptsBearer)
+	require.Contains(t, result.Evidence, "[R2] 仅接受 x-api-key 认证、拒绝 Bearer，与官方一致")
+
+	fp, result = probe(true, true)
+	require.True(t, fp.AcceptsXAPIKey)
+	require.True(t, fp.AcceptsBearer)
+	require.Contains(t, result.Evidence, "[R2] [!!] 同时接受 x-api-key 与 Authorization: Bearer 认证，官方 /v1/messages 不支持 Bearer，疑似转译层")
+
+	// Bearer-only upstream: the bearer response is kept for analysis
+	fp, result = probe(false, true)
+	require.Empty(t, fp.Error)
+	require.False(t, fp.AcceptsXAPIKey)
+	require.True(t, fp.AcceptsBearer)
+	require.Equal(t, "msg_01ABC", fp.MsgID)
+	require.Contains(t, result.Evidence, "[R2] [!!] 仅接受 Authorization: Bearer 认证、拒绝 x-api-key，为 OpenAI 风格转译层")
+
+	fp, _ = probe(false, false)
+	require.Equal(t, ProbeErrorAuth, fp.ErrorClass)
+	require.False(t, fp.AcceptsXAPIKey)
+	require.False(t, fp.AcceptsBearer)
+}
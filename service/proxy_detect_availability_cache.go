@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	// The warmer checks every tick whether the configured warm interval has elapsed
+	availabilityWarmTickInterval = 1 * time.Minute
+	// Upper bound for warming one channel
+	availabilityWarmChannelTimeout = 10 * time.Minute
+)
+
+// ChannelAvailability is the cached model availability of one channel
+type ChannelAvailability struct {
+	ChannelId int             `json:"channel_id"`
+	Name      string          `json:"name"`
+	BaseURL   string          `json:"base_url"`
+	Models    map[string]bool `json:"models"`
+	WarmedAt  int64           `json:"warmed_at"`
+	// Derived on read from WarmedAt and the configured TTL
+	Fresh bool `json:"fresh"`
+}
+
+type availabilityCache struct {
+	mu      sync.RWMutex
+	entries map[int]ChannelAvailability
+}
+
+var (
+	proxyDetectAvailabilityCache = &availabilityCache{entries: make(map[int]ChannelAvailability)}
+
+	availabilityWarmOnce    sync.Once
+	availabilityWarmRunning atomic.Bool
+	availabilityLastWarm    atomic.Int64
+)
+
+func init() {
+	RegisterProxyDetectCache("availability", proxyDetectAvailabilityCache)
+}
+
+func (c *availabilityCache) set(entry ChannelAvailability) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[entry.ChannelId] = entry
+}
+
+// retain drops entries of channels that are no longer warmed
+func (c *availabilityCache) retain(channelIds map[int]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.entries {
+		if !channelIds[id] {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// Clear drops all warmed entries; the next warm run refills them
+func (c *availabilityCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[int]ChannelAvailability)
+	availabilityLastWarm.Store(0)
+	return n
+}
+
+func (c *availabilityCache) get(channelId int, now int64, ttlSeconds int64) (ChannelAvailability, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[channelId]
+	c.mu.RUnlock()
+	if !ok {
+		return entry, false
+	}
+	entry.Fresh = now-entry.WarmedAt < ttlSeconds
+	return entry, true
+}
+
+func (c *availabilityCache) list(now int64, ttlSeconds int64) []ChannelAvailability {
+	c.mu.RLock()
+	list := make([]ChannelAvailability, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entry.Fresh = now-entry.WarmedAt < ttlSeconds
+		list = append(list, entry)
+	}
+	c.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ChannelId < list[j].ChannelId })
+	return list
+}
+
+func availabilityCacheTTLSeconds() int64 {
+	return int64(system_setting.GetProxyDetectSetting().AvailabilityCacheTTLMinutes) * 60
+}
+
+// GetCachedChannelAvailability returns the warmed availability of a channel.
+// Callers should fall back to CheckModelAvailable when the entry is missing or not fresh.
+func GetCachedChannelAvailability(channelId int) (ChannelAvailability, bool) {
+	return proxyDetectAvailabilityCache.get(channelId, common.GetTimestamp(), availabilityCacheTTLSeconds())
+}
+
+// ListCachedChannelAvailability returns all warmed channels with their freshness
+func ListCachedChannelAvailability() []ChannelAvailability {
+	return proxyDetectAvailabilityCache.list(common.GetTimestamp(), availabilityCacheTTLSeconds())
+}
+
+func StartProxyDetectAvailabilityWarmTask() {
+	availabilityWarmOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("proxy detect availability warm task started: tick=%s", availabilityWarmTickInterval))
+			ticker := time.NewTicker(availabilityWarmTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				runAvailabilityWarmOnce()
+			}
+		})
+	})
+}
+
+func runAvailabilityWarmOnce() {
+	setting := system_setting.GetProxyDetectSetting()
+	if !setting.AvailabilityWarmEnabled || setting.AvailabilityWarmIntervalMinutes <= 0 {
+		return
+	}
+	interval := int64(setting.AvailabilityWarmIntervalMinutes) * 60
+	if common.GetTimestamp()-availabilityLastWarm.Load() < interval {
+		return
+	}
+	if !availabilityWarmRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer availabilityWarmRunning.Store(false)
+
+	ctx := context.Background()
+	var channels []*model.Channel
+	err := model.DB.Where("type = ? AND status = ?", constant.ChannelTypeAnthropic, common.ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect availability warm: failed to load channels: %v", err))
+		return
+	}
+
+	warmed := make(map[int]bool, len(channels))
+	for _, channel := range channels {
+		warmed[channel.Id] = true
+		warmChannelAvailability(ctx, channel)
+	}
+	proxyDetectAvailabilityCache.retain(warmed)
+	availabilityLastWarm.Store(common.GetTimestamp())
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect availability warm: %d channels", len(channels)))
+}
+
+func warmChannelAvailability(parent context.Context, channel *model.Channel) {
+	keys := channel.GetKeys()
+	models := channel.GetModels()
+	if len(keys) == 0 || len(models) == 0 {
+		return
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+
+	ctx, cancel := context.WithTimeout(parent, availabilityWarmChannelTimeout)
+	defer cancel()
+
+	// Channels are admin-configured, same trust level as admin detection
+	client := newUnsafeHTTPClient(system_setting.GetProxyDetectSetting().Timeouts.AvailCheck())
+	target := ProbeTarget{BaseURL: baseURL, APIKey: keys[0]}
+	host := limiterHostKey(baseURL)
+
+	result := make(map[string]bool, len(models))
+	for _, m := range models {
+		if err := proxyDetectHostLimiter.Wait(ctx, host); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("proxy detect availability warm: channel #%d timed out", channel.Id))
+			return
+		}
+		result[m] = CheckModelAvailable(ctx, client, target, m) == nil
+	}
+	proxyDetectAvailabilityCache.set(ChannelAvailability{
+		ChannelId: channel.Id,
+		Name:      channel.Name,
+		BaseURL:   baseURL,
+		Models:    result,
+		WarmedAt:  common.GetTimestamp(),
+	})
+}
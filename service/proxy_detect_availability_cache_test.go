@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailabilityCacheFreshness(t *testing.T) {
+	cache := &availabilityCache{entries: make(map[int]ChannelAvailability)}
+	cache.set(ChannelAvailability{ChannelId: 2, Models: map[string]bool{"claude-sonnet-4-5-20250929": true}, WarmedAt: 1000})
+	cache.set(ChannelAvailability{ChannelId: 1, Models: map[string]bool{"claude-opus-4-1-20250805": false}, WarmedAt: 400})
+
+	entry, ok := cache.get(2, 1500, 600)
+	require.True(t, ok)
+	require.True(t, entry.Fresh)
+	require.True(t, entry.Models["claude-sonnet-4-5-20250929"])
+
+	entry, ok = cache.get(1, 1500, 600)
+	require.True(t, ok)
+	require.False(t, entry.Fresh)
+
+	_, ok = cache.get(3, 1500, 600)
+	require.False(t, ok)
+
+	list := cache.list(1500, 600)
+	require.Len(t, list, 2)
+	require.Equal(t, 1, list[0].ChannelId)
+	require.Equal(t, 2, list[1].ChannelId)
+
+	cache.retain(map[int]bool{2: true})
+	require.Len(t, cache.list(1500, 600), 1)
+}
+
+func TestHostLimiterSpacing(t *testing.T) {
+	l := newHostLimiter(50 * time.Millisecond)
+	ctx := context.Background()
+	host := limiterHostKey("https://API.example.com/v1")
+	require.Equal(t, "api.example.com", host)
+
+	start := time.Now()
+	require.NoError(t, l.Wait(ctx, host))
+	require.NoError(t, l.Wait(ctx, "other.example.com"))
+	require.Less(t, time.Since(start), 40*time.Millisecond)
+
+	require.NoError(t, l.Wait(ctx, host))
+	require.NoError(t, l.Wait(ctx, host))
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(t, l.Wait(cancelled, host))
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// The cheapest impersonations do not run Claude at all: the channel sends "claude" requests
+// to another model and rewrites the envelope. Those models tend to name themselves when asked
+// (identity probe), and the real name also leaks through the model field or upstream errors.
+
+// Where the backend model name was found, see Fingerprint.BackendLLMSource
+const (
+	BackendLLMSourceModel = "model"
+	BackendLLMSourceReply = "reply"
+	BackendLLMSourceError = "error"
+)
+
+// backendLLMFamilies maps each lowercase name to the model family it identifies
+var backendLLMFamilies = map[string]string{
+	"deepseek": "deepseek",
+	"深度求索":     "deepseek",
+	"qwen":     "qwen",
+	"tongyi":   "qwen",
+	"通义":       "qwen",
+	"千问":       "qwen",
+	"chatglm":  "glm",
+	"glm":      "glm",
+	"zhipu":    "glm",
+	"智谱":       "glm",
+	"moonshot": "kimi",
+	"kimi":     "kimi",
+	"doubao":   "doubao",
+	"豆包":       "doubao",
+	"ernie":    "ernie",
+	"文心":       "ernie",
+	"baichuan": "baichuan",
+	"百川":       "baichuan",
+	"minimax":  "minimax",
+	"hunyuan":  "hunyuan",
+	"混元":       "hunyuan",
+}
+
+// Latin names must start a word ("glm-4", "Qwen2.5") so "Bernie" does not match ernie;
+// Chinese names match anywhere
+var backendLLMPattern = regexp.MustCompile(`(?i)\b(?:deepseek|qwen|tongyi|chatglm|glm|zhipu|moonshot|kimi|doubao|ernie|baichuan|minimax|hunyuan)|深度求索|通义|千问|智谱|豆包|文心|百川|混元`)
+
+// matchBackendLLM returns the family and matched substring of the first non-Claude model
+// name in text
+func matchBackendLLM(text string) (string, string) {
+	match := backendLLMPattern.FindString(text)
+	if match == "" {
+		return "", ""
+	}
+	return backendLLMFamilies[strings.ToLower(match)], match
+}
+
+// recordBackendLLM notes the first non-Claude model name found on the probe
+func recordBackendLLM(fp *Fingerprint, source, text string) {
+	if fp.BackendLLM != "" {
+		return
+	}
+	if family, match := matchBackendLLM(text); family != "" {
+		fp.BackendLLM = family
+		fp.BackendLLMMatch = match
+		fp.BackendLLMSource = source
+	}
+}
+
+// buildIdentityPayload builds the identity probe request body, a question Claude answers
+// with its own name
+func buildIdentityPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 64,
+		"messages": []map[string]any{
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("identity")},
+		},
+	}
+}
+
+// applyBackendLLM switches the verdict to backend_llm when any probe, failed ones included,
+// revealed a non-Claude model. A named backend outweighs every envelope signal.
+func applyBackendLLM(result *DetectResult, fingerprints []Fingerprint) {
+	for _, fp := range fingerprints {
+		if fp.BackendLLM == "" {
+			continue
+		}
+		result.Verdict = "backend_llm"
+		result.Confidence = 1
+		result.BackendLLM = fp.BackendLLM
+		result.addEvidence(EvidenceItem{Code: "backend_llm",
+			Params: map[string]any{"family": fp.BackendLLM, "match": fp.BackendLLMMatch, "source": fp.BackendLLMSource, "probe": fp.ProbeType}})
+		return
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchBackendLLM(t *testing.T) {
+	cases := []struct {
+		text   string
+		family string
+		match  string
+	}{
+		{"I am DeepSeek-V3, developed by DeepSeek.", "deepseek", "DeepSeek"},
+		{"我是通义千问，由阿里云开发的大模型。", "qwen", "通义"},
+		{"qwen2.5-72b-instruct", "qwen", "qwen"},
+		{"I'm ChatGLM, trained by Zhipu AI.", "glm", "ChatGLM"},
+		{"glm-4-plus", "glm", "glm"},
+		{"I am Kimi, an AI assistant made by Moonshot AI.", "kimi", "Kimi"},
+		{"I'm Claude, an AI assistant made by Anthropic.", "", ""},
+		{"Bernie asked a question.", "", ""},
+		{"claude-sonnet-4-5-20250929", "", ""},
+	}
+	for _, c := range cases {
+		family, match := matchBackendLLM(c.text)
+		require.Equal(t, c.family, family, c.text)
+		require.Equal(t, c.match, match, c.text)
+	}
+}
+
+func TestIdentityProbeBackendLLM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"I am DeepSeek-V3, a model trained by DeepSeek."}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":12}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	fp := probeOnce(context.Background(), client, ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "identity")
+	require.Empty(t, fp.Error)
+	require.Equal(t, "deepseek", fp.BackendLLM)
+	require.Equal(t, "DeepSeek", fp.BackendLLMMatch)
+	require.Equal(t, BackendLLMSourceReply, fp.BackendLLMSource)
+
+	result := analyze([]Fingerprint{anthropicFingerprint("tool"), fp}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "backend_llm", result.Verdict)
+	require.Equal(t, "deepseek", result.BackendLLM)
+	require.Contains(t, result.Evidence, `[!!] 渠道后端为 deepseek 而非 Claude: identity 探测的 reply 含 "DeepSeek"`)
+}
+
+func TestBackendLLMFromError(t *testing.T) {
+	failed := Fingerprint{ProbeType: "tool", Error: "HTTP 400: qwen-max: invalid tool_choice", ErrorClass: ProbeErrorHTTP}
+	recordBackendLLM(&failed, BackendLLMSourceError, "qwen-max: invalid tool_choice")
+
+	result := analyze([]Fingerprint{failed}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "backend_llm", result.Verdict)
+	require.Equal(t, "qwen", result.BackendLLM)
+}
@@ -0,0 +1,57 @@
+package service
+
+import "strings"
+
+// DetectBadges are compact boolean flags for rendering a detection result,
+// derived from the verdict, ratelimit verification and fingerprint flags
+type DetectBadges struct {
+	IsGenuine        bool `json:"is_genuine"`
+	IsProxied        bool `json:"is_proxied"`
+	HasAWSHeaders    bool `json:"has_aws_headers"`
+	RatelimitDynamic bool `json:"ratelimit_dynamic"`
+	ModelSubstituted bool `json:"model_substituted"`
+	Suspicious       bool `json:"suspicious"`
+}
+
+// computeDetectBadges derives the badges of a finished result; it does not re-score anything
+func computeDetectBadges(result DetectResult) DetectBadges {
+	badges := DetectBadges{
+		IsGenuine:        result.Verdict == "anthropic",
+		Suspicious:       result.Verdict == "suspicious",
+		RatelimitDynamic: result.RatelimitVerify != nil && result.RatelimitVerify.Verdict == "dynamic",
+	}
+	switch result.Verdict {
+	case "proxy", "bedrock", "antigravity", "gemini", "openai_translation", "suspicious":
+		badges.IsProxied = true
+	}
+	if result.ProxyPlatform != "" {
+		badges.IsProxied = true
+	}
+	for _, fp := range result.Fingerprints {
+		if fp.Error != "" {
+			continue
+		}
+		if fp.HasAWSHeaders {
+			badges.HasAWSHeaders = true
+		}
+		if isModelSubstituted(fp.ModelRequested, fp.Model) {
+			badges.ModelSubstituted = true
+		}
+	}
+	return badges
+}
+
+// isModelSubstituted reports whether the responding model is a different model from the requested one.
+// Platform prefixes (kiro-, anthropic.) and dated/versioned suffixes of the same model are not substitutions.
+func isModelSubstituted(requested, responded string) bool {
+	if requested == "" || responded == "" {
+		return false
+	}
+	normalize := func(m string) string {
+		m = strings.ToLower(strings.TrimSpace(m))
+		m = strings.TrimPrefix(m, kiroModelPrefix)
+		return strings.TrimPrefix(m, bedrockModelPrefix)
+	}
+	req, resp := normalize(requested), normalize(responded)
+	return !strings.HasPrefix(resp, req) && !strings.HasPrefix(req, resp)
+}
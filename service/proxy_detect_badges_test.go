@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeDetectBadges(t *testing.T) {
+	genuine := anthropicFingerprint("tool")
+	genuine.ModelRequested = "claude-sonnet-4-5"
+	second := genuine
+	second.MsgID = "msg_01ZYXWVUTSRQPONMLKJIHGFEDC"
+
+	bedrock := Fingerprint{
+		ProbeType:      "tool",
+		ToolID:         "tooluse_abcdefghijklmnopqrstuv",
+		ToolIDSource:   "bedrock",
+		Model:          "kiro-claude-sonnet-4-5",
+		ModelRequested: "claude-sonnet-4-5-20250929",
+		ModelSource:    "kiro",
+		UsageStyle:     "camelCase",
+		HasAWSHeaders:  true,
+	}
+	substituted := genuine
+	substituted.Model = "claude-3-5-haiku-20241022"
+
+	cases := []struct {
+		name   string
+		result DetectResult
+		want   DetectBadges
+	}{
+		{
+			name: "genuine with dynamic ratelimit",
+			result: func() DetectResult {
+				r := analyze([]Fingerprint{genuine, second}, "claude-sonnet-4-5", system_setting.DefaultScoringWeights)
+				r.RatelimitVerify = &RatelimitVerification{Verdict: "dynamic"}
+				return r
+			}(),
+			want: DetectBadges{IsGenuine: true, RatelimitDynamic: true},
+		},
+		{
+			name:   "bedrock via kiro",
+			result: analyze([]Fingerprint{bedrock, bedrock}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights),
+			want:   DetectBadges{IsProxied: true, HasAWSHeaders: true},
+		},
+		{
+			name:   "suspicious with substituted model",
+			result: DetectResult{Verdict: "suspicious", Fingerprints: []Fingerprint{substituted}},
+			want:   DetectBadges{IsProxied: true, Suspicious: true, ModelSubstituted: true},
+		},
+		{
+			name:   "anthropic behind a known platform",
+			result: DetectResult{Verdict: "anthropic", ProxyPlatform: "OpenRouter", RatelimitVerify: &RatelimitVerification{Verdict: "static"}},
+			want:   DetectBadges{IsGenuine: true, IsProxied: true},
+		},
+		{
+			name:   "all probes failed",
+			result: DetectResult{Verdict: "invalid_key", Fingerprints: []Fingerprint{{Error: "HTTP 401", HasAWSHeaders: true}}},
+			want:   DetectBadges{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, computeDetectBadges(tc.result))
+		})
+	}
+}
+
+func TestIsModelSubstituted(t *testing.T) {
+	require.False(t, isModelSubstituted("claude-sonnet-4-5", "claude-sonnet-4-5-20250929"))
+	require.False(t, isModelSubstituted("claude-3-5-sonnet-20241022", "anthropic.claude-3-5-sonnet-20241022-v2:0"))
+	require.False(t, isModelSubstituted("claude-sonnet-4-5", ""))
+	require.True(t, isModelSubstituted("claude-opus-4-1", "claude-sonnet-4-5-20250929"))
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Channels scanned at the same time by ScanBatch
+const batchScanConcurrency = 3
+
+// Upper bound for one batch scan; each target is further bounded by the multi-scan timeout
+const batchScanTimeout = 30 * time.Minute
+
+// Max targets accepted by one batch scan
+const MaxBatchScanTargets = 100
+
+// BatchScanTarget is one channel of a batch scan; without Models the configured scan models are used
+type BatchScanTarget struct {
+	BaseURL string   `json:"base_url"`
+	APIKey  string   `json:"api_key"`
+	Models  []string `json:"models"`
+	// Mount point of the Messages API, defaults to /v1/messages
+	MessagesPath string `json:"messages_path"`
+}
+
+// BatchScanEntry is the outcome of one target, in request order. Exactly one of Result and
+// Error is set, so a failing target never hides the others.
+type BatchScanEntry struct {
+	BaseURL string      `json:"base_url"`
+	Result  *ScanResult `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ScanBatch scans the targets with at most batchScanConcurrency channels in flight. A slot
+// is released as soon as its channel finishes, so a slow channel holds up only its own slot;
+// targets still waiting when the batch deadline passes are reported as timed out.
+func ScanBatch(parent context.Context, targets []BatchScanTarget, opts DetectOptions) []BatchScanEntry {
+	ctx, cancel := context.WithTimeout(parent, batchScanTimeout)
+	defer cancel()
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect batch started: %d targets", len(targets)))
+
+	budget := system_setting.GetProxyDetectSetting().Timeouts.MultiScanModel()
+	entries := make([]BatchScanEntry, len(targets))
+	sem := make(chan struct{}, batchScanConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		entries[i].BaseURL = target.BaseURL
+		if err := validateBatchScanTarget(target, opts.SkipSSRFCheck); err != nil {
+			entries[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, target BatchScanTarget) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				entries[i].Error = "detection timed out"
+				return
+			}
+			// Every target gets its own trace id
+			targetOpts := opts
+			targetOpts.TraceID = ""
+			targetOpts.MessagesPath = target.MessagesPath
+			scan := scanMultipleModels(ctx, target.BaseURL, target.APIKey, target.Models, targetOpts, budget)
+			scan.localize(opts.Lang)
+			entries[i].Result = &scan
+		}(i, target)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, e := range entries {
+		if e.Error != "" {
+			failed++
+		}
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect batch finished: %d targets, %d failed", len(targets), failed))
+	return entries
+}
+
+// validateBatchScanTarget rejects a target that cannot be scanned before any request is sent
+func validateBatchScanTarget(target BatchScanTarget, skipSSRFCheck bool) error {
+	if err := ValidateProxyDetectURL(target.BaseURL, skipSSRFCheck); err != nil {
+		return err
+	}
+	if err := ValidateMessagesPath(target.MessagesPath); err != nil {
+		return err
+	}
+	if target.APIKey == "" {
+		return fmt.Errorf("api key is required")
+	}
+	if limit := system_setting.GetProxyDetectSetting().ModelLimit(); len(target.Models) > limit {
+		return fmt.Errorf("too many models: %d > %d", len(target.Models), limit)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanBatch(t *testing.T) {
+	// Every model is unavailable, which settles each scan after one request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	targets := []BatchScanTarget{
+		{BaseURL: srv.URL, APIKey: "sk-a", Models: []string{"claude-sonnet-4-5-20250929", "claude-3-haiku-20240307"}},
+		{BaseURL: "ftp://example.com", APIKey: "sk-b"},
+		{BaseURL: srv.URL + "/v2", Models: []string{"claude-sonnet-4-5-20250929"}},
+		{BaseURL: srv.URL + "/v3", APIKey: "sk-c", Models: []string{"claude-3-haiku-20240307"}},
+	}
+	entries := ScanBatch(context.Background(), targets, DetectOptions{Rounds: 1, SkipSSRFCheck: true})
+	require.Len(t, entries, len(targets))
+	for i, entry := range entries {
+		require.Equal(t, targets[i].BaseURL, entry.BaseURL)
+	}
+
+	require.Empty(t, entries[0].Error)
+	require.Equal(t, map[string]string{"claude-sonnet-4-5-20250929": "unavailable", "claude-3-haiku-20240307": "unavailable"}, entries[0].Result.Summary)
+	require.Nil(t, entries[1].Result)
+	require.NotEmpty(t, entries[1].Error)
+	require.Nil(t, entries[2].Result)
+	require.Equal(t, "api key is required", entries[2].Error)
+	require.Empty(t, entries[3].Error)
+	require.Equal(t, srv.URL+"/v3", entries[3].Result.BaseURL)
+	require.NotEqual(t, entries[0].Result.TraceID, entries[3].Result.TraceID)
+}
+
+func TestScanBatchDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries := ScanBatch(ctx, []BatchScanTarget{{BaseURL: "http://127.0.0.1:1", APIKey: "sk-a", Models: []string{"claude-sonnet-4-5-20250929"}}}, DetectOptions{Rounds: 1})
+	require.Len(t, entries, 1)
+	// Either the slot was never taken or the scan found its deadline already passed
+	if entries[0].Error == "" {
+		require.Empty(t, entries[0].Result.ModelResults)
+	} else {
+		require.Equal(t, "detection timed out", entries[0].Error)
+	}
+}
+
+func TestScanBatchMessagesPath(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	targets := []BatchScanTarget{
+		{BaseURL: srv.URL, APIKey: "sk-a", Models: []string{"claude-3-haiku-20240307"}, MessagesPath: "/anthropic/v1/messages"},
+		{BaseURL: srv.URL, APIKey: "sk-b", Models: []string{"claude-3-haiku-20240307"}, MessagesPath: "v1/messages"},
+	}
+	entries := ScanBatch(context.Background(), targets, DetectOptions{Rounds: 1, SkipSSRFCheck: true})
+	require.Empty(t, entries[0].Error)
+	require.Equal(t, []string{"/anthropic/v1/messages"}, paths)
+	require.Nil(t, entries[1].Result)
+	require.NotEmpty(t, entries[1].Error)
+}
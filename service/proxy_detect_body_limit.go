@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// A hostile or broken upstream can answer with a multi-gigabyte body, or a small gzip body
+// that inflates to one (the transport decompresses transparently). Success bodies are read
+// through readLimitedBody, capped at ProxyDetectSetting.ResponseBodyLimit. Error bodies
+// keep their own small caps.
+
+// errBodyTooLarge is returned by readLimitedBody when the body exceeds the limit
+type errBodyTooLarge struct{ limit int64 }
+
+func (e errBodyTooLarge) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", e.limit)
+}
+
+// readLimitedBody reads r up to the configured response body limit. A longer body yields
+// the bytes read so far and errBodyTooLarge.
+func readLimitedBody(r io.Reader) ([]byte, error) {
+	limit := system_setting.GetProxyDetectSetting().ResponseBodyLimit()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return data, err
+	}
+	if int64(len(data)) > limit {
+		return data[:limit], errBodyTooLarge{limit: limit}
+	}
+	return data, nil
+}
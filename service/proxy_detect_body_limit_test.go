@@ -0,0 +1,59 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLimitedBody(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.MaxResponseBodyKB = 64
+	limit := int(setting.ResponseBodyLimit())
+
+	data, err := readLimitedBody(strings.NewReader(strings.Repeat("a", limit)))
+	require.NoError(t, err)
+	require.Len(t, data, limit)
+
+	data, err = readLimitedBody(strings.NewReader(strings.Repeat("a", limit+1)))
+	require.EqualError(t, err, "response body exceeds 65536 bytes")
+	require.Len(t, data, limit)
+}
+
+func TestProbeOnceOversizedBody(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.MaxResponseBodyKB = 64
+
+	// A small gzip body that inflates far beyond the limit
+	var bomb bytes.Buffer
+	gz := gzip.NewWriter(&bomb)
+	_, _ = gz.Write([]byte(`{"id":"msg_01ABC","content":[{"type":"text","text":"`))
+	_, _ = gz.Write(bytes.Repeat([]byte("A"), 4<<20))
+	_, _ = gz.Write([]byte(`"}]}`))
+	_ = gz.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(bomb.Bytes())
+	}))
+	defer srv.Close()
+
+	fp := probeOnce(context.Background(), srv.Client(), ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "simple")
+	require.True(t, fp.BodyTruncated)
+	require.Equal(t, ProbeErrorParse, fp.ErrorClass)
+	require.Contains(t, fp.Error, "response body exceeds")
+	require.Empty(t, fp.MsgID)
+}
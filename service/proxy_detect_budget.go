@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// ProbeTokenUsage reports the output tokens consumed by probes against the per-scan budget
+type ProbeTokenUsage struct {
+	OutputTokens int64 `json:"output_tokens"`
+	// Budget is the configured cap, 0 when unlimited
+	Budget    int64 `json:"budget"`
+	Exhausted bool  `json:"exhausted"`
+}
+
+// probeTokenBudget tracks output tokens across all probes of one scan. It is checked
+// before each probe, so probes already in flight may overshoot the limit slightly.
+type probeTokenBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+type probeBudgetKey struct{}
+
+func newProbeTokenBudget(limit int) *probeTokenBudget {
+	return &probeTokenBudget{limit: int64(max(limit, 0))}
+}
+
+// withProbeBudget attaches a budget from ProxyDetectSetting unless ctx already carries one,
+// so a multi-model scan shares one budget across its models. The bool is true when a new
+// budget was attached.
+func withProbeBudget(ctx context.Context) (context.Context, bool) {
+	if probeBudgetFrom(ctx) != nil {
+		return ctx, false
+	}
+	budget := newProbeTokenBudget(system_setting.GetProxyDetectSetting().ScanOutputTokenBudget)
+	return context.WithValue(ctx, probeBudgetKey{}, budget), true
+}
+
+// probeBudgetFrom returns the budget attached to ctx, or nil
+func probeBudgetFrom(ctx context.Context) *probeTokenBudget {
+	budget, _ := ctx.Value(probeBudgetKey{}).(*probeTokenBudget)
+	return budget
+}
+
+func (b *probeTokenBudget) charge(tokens int) {
+	if b != nil && tokens > 0 {
+		b.used.Add(int64(tokens))
+	}
+}
+
+func (b *probeTokenBudget) exhausted() bool {
+	return b != nil && b.limit > 0 && b.used.Load() >= b.limit
+}
+
+func (b *probeTokenBudget) usage() *ProbeTokenUsage {
+	if b == nil {
+		return nil
+	}
+	return &ProbeTokenUsage{OutputTokens: b.used.Load(), Budget: b.limit, Exhausted: b.exhausted()}
+}
+
+func budgetExhaustedDetectResult(model, traceID string) DetectResult {
+	return DetectResult{
+		Model:       model,
+		Verdict:     "budget_exhausted",
+		VerdictText: verdictTextMap["budget_exhausted"],
+		Scores:      newDetectScores(),
+		TraceID:     traceID,
+	}
+}
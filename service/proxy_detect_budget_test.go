@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// budgetUpstream answers every probe with 100 output tokens and counts probe requests
+func budgetUpstream(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":100}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func setScanOutputTokenBudget(t *testing.T, limit int) {
+	setting := system_setting.GetProxyDetectSetting()
+	orig := setting.ScanOutputTokenBudget
+	t.Cleanup(func() { setting.ScanOutputTokenBudget = orig })
+	setting.ScanOutputTokenBudget = limit
+}
+
+func TestDetectStopsAtOutputTokenBudget(t *testing.T) {
+	srv, requests := budgetUpstream(t)
+	setScanOutputTokenBudget(t, 150)
+
+	// 3 tool rounds + thinking; the budget is used up after the second tool probe
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", DetectOptions{Rounds: 3, SkipSSRFCheck: true})
+	require.Equal(t, int32(2), requests.Load())
+	require.Equal(t, "budget_exhausted", result.Verdict)
+	require.Equal(t, verdictTextMap["budget_exhausted"], result.VerdictText)
+	require.Len(t, result.Fingerprints, 2)
+	require.Equal(t, &ProbeTokenUsage{OutputTokens: 200, Budget: 150, Exhausted: true}, result.TokenUsage)
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "2 项探测未执行")
+
+	// Unlimited by default
+	setScanOutputTokenBudget(t, 0)
+	result = detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", DetectOptions{Rounds: 3, SkipSSRFCheck: true})
+	require.NotEqual(t, "budget_exhausted", result.Verdict)
+	require.Equal(t, &ProbeTokenUsage{OutputTokens: 400}, result.TokenUsage)
+}
+
+func TestScanSharesOutputTokenBudget(t *testing.T) {
+	srv, _ := budgetUpstream(t)
+	setScanOutputTokenBudget(t, 150)
+
+	// Each model needs two tool rounds + thinking; any two probes already exceed the budget,
+	// so every model ends with skipped probes
+	models := []string{"claude-a", "claude-b", "claude-c"}
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-test", models, DetectOptions{Rounds: 2, SkipSSRFCheck: true}, system_setting.DefaultDetectTimeouts.MultiScanModel())
+	for _, model := range models {
+		require.Equal(t, "budget_exhausted", scan.Summary[model], model)
+	}
+	for _, result := range scan.ModelResults {
+		require.Nil(t, result.TokenUsage)
+	}
+	require.NotNil(t, scan.TokenUsage)
+	require.True(t, scan.TokenUsage.Exhausted)
+	require.Equal(t, int64(150), scan.TokenUsage.Budget)
+	require.GreaterOrEqual(t, scan.TokenUsage.OutputTokens, int64(200))
+	require.False(t, scan.IsMixed)
+
+	// A later scan gets a fresh budget
+	scan = scanMultipleModels(context.Background(), srv.URL, "sk-test", models[:1], DetectOptions{Rounds: 2, SkipSSRFCheck: true}, system_setting.DefaultDetectTimeouts.MultiScanModel())
+	require.Equal(t, "budget_exhausted", scan.Summary["claude-a"])
+	require.Equal(t, int64(200), scan.TokenUsage.OutputTokens)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProxyDetectCache is implemented by every detection-related cache so admins can flush it
+type ProxyDetectCache interface {
+	// Clear drops all entries and returns how many were removed
+	Clear() int
+}
+
+var (
+	proxyDetectCachesMu sync.RWMutex
+	proxyDetectCaches   = make(map[string]ProxyDetectCache)
+)
+
+// RegisterProxyDetectCache makes a cache flushable through ClearProxyDetectCaches
+func RegisterProxyDetectCache(name string, cache ProxyDetectCache) {
+	proxyDetectCachesMu.Lock()
+	defer proxyDetectCachesMu.Unlock()
+	proxyDetectCaches[name] = cache
+}
+
+// ProxyDetectCacheNames lists the registered cache names
+func ProxyDetectCacheNames() []string {
+	proxyDetectCachesMu.RLock()
+	defer proxyDetectCachesMu.RUnlock()
+	names := make([]string, 0, len(proxyDetectCaches))
+	for name := range proxyDetectCaches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClearProxyDetectCaches clears the named caches (all when names is empty) and
+// returns the number of entries removed per cache
+func ClearProxyDetectCaches(names []string) (map[string]int, error) {
+	proxyDetectCachesMu.RLock()
+	defer proxyDetectCachesMu.RUnlock()
+	if len(names) == 0 {
+		for name := range proxyDetectCaches {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if _, ok := proxyDetectCaches[name]; !ok {
+			return nil, fmt.Errorf("unknown cache: %s", name)
+		}
+	}
+	cleared := make(map[string]int, len(names))
+	for _, name := range names {
+		cleared[name] = proxyDetectCaches[name].Clear()
+	}
+	return cleared, nil
+}
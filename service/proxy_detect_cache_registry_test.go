@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingCache struct{ n int }
+
+func (c *countingCache) Clear() int {
+	n := c.n
+	c.n = 0
+	return n
+}
+
+func TestClearProxyDetectCaches(t *testing.T) {
+	a := &countingCache{n: 3}
+	b := &countingCache{n: 5}
+	RegisterProxyDetectCache("test_a", a)
+	RegisterProxyDetectCache("test_b", b)
+	t.Cleanup(func() {
+		proxyDetectCachesMu.Lock()
+		delete(proxyDetectCaches, "test_a")
+		delete(proxyDetectCaches, "test_b")
+		proxyDetectCachesMu.Unlock()
+	})
+
+	require.Contains(t, ProxyDetectCacheNames(), "availability")
+
+	cleared, err := ClearProxyDetectCaches([]string{"test_a"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"test_a": 3}, cleared)
+	require.Equal(t, 5, b.n)
+
+	_, err = ClearProxyDetectCaches([]string{"test_b", "missing"})
+	require.Error(t, err)
+	require.Equal(t, 5, b.n)
+
+	cleared, err = ClearProxyDetectCaches(nil)
+	require.NoError(t, err)
+	require.Equal(t, 5, cleared["test_b"])
+	require.Equal(t, 0, cleared["test_a"])
+	require.Contains(t, cleared, "availability")
+}
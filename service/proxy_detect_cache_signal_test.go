@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// toolRounds builds tool probe fingerprints with the given latencies; uniqueIDs gives each its own msg and tool_use id
+func toolRounds(latencies []int64, uniqueIDs bool) []Fingerprint {
+	fps := make([]Fingerprint, 0, len(latencies))
+	for i, l := range latencies {
+		fp := anthropicFingerprint("tool")
+		fp.LatencyMs = l
+		if uniqueIDs {
+			fp.MsgID = fmt.Sprintf("msg_01ABCDEFGHIJKLMNOPQRST%02d", i)
+			fp.ToolID = fmt.Sprintf("toolu_01ABCDEFGHIJKLMNOPQRST%02d", i)
+		}
+		fps = append(fps, fp)
+	}
+	return fps
+}
+
+func hasEvidence(result DetectResult, substr string) bool {
+	for _, e := range result.Evidence {
+		if strings.Contains(e, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLatencyMeanVariance(t *testing.T) {
+	mean, variance := latencyMeanVariance(nil)
+	require.Zero(t, mean)
+	require.Zero(t, variance)
+
+	mean, variance = latencyMeanVariance([]int64{100, 100, 100})
+	require.Equal(t, 100.0, mean)
+	require.Zero(t, variance)
+
+	mean, variance = latencyMeanVariance([]int64{600, 1000, 1400})
+	require.Equal(t, 1000.0, mean)
+	require.InDelta(t, 106666.67, variance, 0.01)
+}
+
+func TestAnalyzeCachedResponse(t *testing.T) {
+	const model = "claude-sonnet-4-5-20250929"
+
+	// Genuine generation: natural latency spread, unique ids
+	genuine := analyze(toolRounds([]int64{900, 1300, 1100}, true), model, system_setting.DefaultScoringWeights)
+	require.Equal(t, "anthropic", genuine.Verdict)
+	require.False(t, genuine.CachedResponse)
+	require.Greater(t, genuine.LatencyVariance, 1000.0)
+	require.False(t, hasEvidence(genuine, "疑似响应缓存"))
+
+	// Constant low latency alone is only a hint
+	fast := analyze(toolRounds([]int64{42, 42, 43}, true), model, system_setting.DefaultScoringWeights)
+	require.True(t, hasEvidence(fast, "疑似响应缓存"))
+	require.Less(t, fast.LatencyVariance, 1.0)
+	require.False(t, fast.CachedResponse)
+	require.Equal(t, "anthropic", fast.Verdict)
+
+	// Constant low latency plus repeated msg ids: cached responses
+	cached := analyze(toolRounds([]int64{42, 42, 42}, false), model, system_setting.DefaultScoringWeights)
+	require.True(t, cached.CachedResponse)
+	require.Zero(t, cached.LatencyVariance)
+	require.Equal(t, "suspicious", cached.Verdict)
+	require.True(t, hasEvidence(cached, "msg id 重复"))
+	require.True(t, hasEvidence(cached, "缓存/预制响应"))
+}
+
+func TestAnalyzeDuplicateToolIDs(t *testing.T) {
+	const model = "claude-sonnet-4-5-20250929"
+
+	genuine := analyze(toolRounds([]int64{900, 1300, 1100}, true), model, system_setting.DefaultScoringWeights)
+	require.False(t, genuine.DuplicateToolIDs)
+	require.False(t, hasEvidence(genuine, "tool_use id 跨轮重复"))
+
+	// Unique msg ids but a replayed tool_use block
+	fps := toolRounds([]int64{900, 1300, 1100}, true)
+	fps[2].ToolID = fps[0].ToolID
+	replayed := analyze(fps, model, system_setting.DefaultScoringWeights)
+	require.True(t, replayed.DuplicateToolIDs)
+	require.True(t, hasEvidence(replayed, "tool_use id 跨轮重复"))
+	require.Equal(t, genuine.Scores["anthropic"]-system_setting.DefaultScoringWeights.DuplicateToolIDPenalty, replayed.Scores["anthropic"])
+}
+
+func TestAnalyzeInconsistentBackend(t *testing.T) {
+	const model = "claude-sonnet-4-5-20250929"
+	w := system_setting.DefaultScoringWeights
+
+	genuine := analyze(toolRounds([]int64{900, 1300, 1100}, true), model, w)
+	require.False(t, genuine.InconsistentBackend)
+
+	// One round served by a Bedrock backend behind the same channel
+	fps := toolRounds([]int64{900, 1300, 1100}, true)
+	fps[1].Model = "anthropic.claude-sonnet-4-5-20250929-v1:0"
+	fps[1].ModelSource = "bedrock"
+	mixed := analyze(fps, model, w)
+	require.True(t, mixed.InconsistentBackend)
+	require.True(t, hasEvidence(mixed, "model: claude-sonnet-4-5-20250929, anthropic.claude-sonnet-4-5-20250929-v1:0; 来源: anthropic, bedrock"))
+
+	// Same classification but a different model echoed
+	fps = toolRounds([]int64{900, 1300, 1100}, true)
+	fps[2].Model = "claude-3-5-sonnet-20241022"
+	substituted := analyze(fps, model, w)
+	require.True(t, substituted.InconsistentBackend)
+	require.Equal(t, genuine.Scores["anthropic"]-w.InconsistentBackendPenalty, substituted.Scores["anthropic"])
+}
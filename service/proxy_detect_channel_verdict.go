@@ -0,0 +1,87 @@
+package service
+
+import (
+	"math"
+	"sort"
+)
+
+// Floor of a conclusive model's weight, so a zero-confidence verdict still counts
+const channelVerdictMinWeight = 0.1
+
+// ChannelVerdict is the headline verdict of a multi-model scan, aggregated from the model
+// verdicts weighted by their confidence
+type ChannelVerdict struct {
+	// The verdict carrying the most weight, prefixed "mixed-" when other conclusive verdicts
+	// were seen too. Without any conclusive model, the most frequent verdict (e.g. unavailable).
+	Verdict string `json:"verdict"`
+	// Share of the total weight carried by the dominant verdict, 0..1
+	Share float64 `json:"share"`
+	// Number of models per verdict, conclusive or not
+	Distribution map[string]int `json:"distribution"`
+	// Summed confidence weight per conclusive verdict
+	Weights map[string]float64 `json:"weights,omitempty"`
+}
+
+// isConclusiveVerdict reports whether a model verdict says something about the backend,
+// as opposed to the model not being detected at all
+func isConclusiveVerdict(verdict string) bool {
+	switch verdict {
+	case "unavailable", "timeout", "budget_exhausted", "invalid_key":
+		return false
+	}
+	return true
+}
+
+// AggregateChannelVerdict combines the model results of one channel into a ChannelVerdict.
+// Ties go to the verdict that sorts first, so the result does not depend on model order.
+func AggregateChannelVerdict(results []DetectResult) *ChannelVerdict {
+	if len(results) == 0 {
+		return nil
+	}
+	cv := &ChannelVerdict{Distribution: make(map[string]int)}
+	var total float64
+	for _, result := range results {
+		cv.Distribution[result.Verdict]++
+		if !isConclusiveVerdict(result.Verdict) {
+			continue
+		}
+		if cv.Weights == nil {
+			cv.Weights = make(map[string]float64)
+		}
+		weight := math.Max(result.Confidence, channelVerdictMinWeight)
+		cv.Weights[result.Verdict] += weight
+		total += weight
+	}
+
+	if len(cv.Weights) == 0 {
+		cv.Verdict = dominantVerdict(cv.Distribution, func(v string) float64 { return float64(cv.Distribution[v]) })
+		cv.Share = math.Round(float64(cv.Distribution[cv.Verdict])/float64(len(results))*100) / 100
+		return cv
+	}
+	for verdict, weight := range cv.Weights {
+		cv.Weights[verdict] = math.Round(weight*100) / 100
+	}
+	dominant := dominantVerdict(cv.Distribution, func(v string) float64 { return cv.Weights[v] })
+	cv.Share = math.Round(cv.Weights[dominant]/total*100) / 100
+	cv.Verdict = dominant
+	if len(cv.Weights) > 1 {
+		cv.Verdict = "mixed-" + dominant
+	}
+	return cv
+}
+
+// dominantVerdict returns the verdict of distribution with the highest weight
+func dominantVerdict(distribution map[string]int, weight func(string) float64) string {
+	verdicts := make([]string, 0, len(distribution))
+	for verdict := range distribution {
+		verdicts = append(verdicts, verdict)
+	}
+	sort.Strings(verdicts)
+	best := ""
+	for _, verdict := range verdicts {
+		if best == "" || weight(verdict) > weight(best) {
+			best = verdict
+		}
+	}
+	return best
+}
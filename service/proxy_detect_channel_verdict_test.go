@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateChannelVerdict(t *testing.T) {
+	require.Nil(t, AggregateChannelVerdict(nil))
+
+	var results []DetectResult
+	for i := 0; i < 5; i++ {
+		results = append(results, DetectResult{Verdict: "bedrock", Confidence: 0.8})
+	}
+	results = append(results, DetectResult{Verdict: "anthropic", Confidence: 1}, DetectResult{Verdict: "unavailable"})
+	cv := AggregateChannelVerdict(results)
+	require.Equal(t, "mixed-bedrock", cv.Verdict)
+	require.Equal(t, map[string]int{"bedrock": 5, "anthropic": 1, "unavailable": 1}, cv.Distribution)
+	require.Equal(t, map[string]float64{"bedrock": 4, "anthropic": 1}, cv.Weights)
+	require.Equal(t, 0.8, cv.Share)
+
+	// One conclusive verdict is the channel verdict, whatever the unavailable models
+	cv = AggregateChannelVerdict([]DetectResult{{Verdict: "anthropic", Confidence: 0.9}, {Verdict: "timeout"}})
+	require.Equal(t, "anthropic", cv.Verdict)
+	require.Equal(t, 1.0, cv.Share)
+
+	// Zero confidence still counts, and ties go to the verdict sorting first
+	cv = AggregateChannelVerdict([]DetectResult{{Verdict: "unknown"}, {Verdict: "proxy"}})
+	require.Equal(t, "mixed-proxy", cv.Verdict)
+	require.Equal(t, 0.5, cv.Share)
+
+	// Nothing conclusive: the most frequent verdict
+	cv = AggregateChannelVerdict([]DetectResult{{Verdict: "unavailable"}, {Verdict: "unavailable"}, {Verdict: "timeout"}})
+	require.Equal(t, "unavailable", cv.Verdict)
+	require.Nil(t, cv.Weights)
+	require.Equal(t, 0.67, cv.Share)
+}
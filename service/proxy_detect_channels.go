@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Keys the bulk channel detection writes into the channel's other_info
+const (
+	ChannelOtherInfoProxyDetectVerdict    = "proxy_detect_verdict"
+	ChannelOtherInfoProxyDetectConfidence = "proxy_detect_confidence"
+	ChannelOtherInfoProxyDetectTime       = "proxy_detect_time"
+)
+
+// Upper bound for one bulk channel detection run
+const channelDetectTimeout = 30 * time.Minute
+
+// ChannelDetectOptions selects the channels to detect; with neither ChannelIds nor Tag
+// every Anthropic channel is detected
+type ChannelDetectOptions struct {
+	ChannelIds []int
+	Tag        string
+	// Rounds of tool probes per channel, see ClampDetectRounds
+	Rounds int
+	Preset string
+	// AutoDisable must be set explicitly; the verdicts that disable a channel come from
+	// ProxyDetectSetting.ChannelAutoDisableVerdicts
+	AutoDisable bool
+	// Concurrency is how many channels are detected at once, multiScanConcurrency when unset
+	Concurrency int
+}
+
+// ChannelDetectOutcome is the bulk detection result of one channel
+type ChannelDetectOutcome struct {
+	ChannelId       int     `json:"channel_id"`
+	Name            string  `json:"name"`
+	Model           string  `json:"model,omitempty"`
+	Verdict         string  `json:"verdict,omitempty"`
+	VerdictText     string  `json:"verdict_text,omitempty"`
+	Confidence      float64 `json:"confidence"`
+	PreviousVerdict string  `json:"previous_verdict,omitempty"`
+	// Changed is true when the verdict differs from the one stored by the previous run
+	Changed  bool `json:"changed"`
+	Disabled bool `json:"disabled"`
+	// Why an auto-disable candidate was left enabled
+	DisableSkipped string `json:"disable_skipped,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ChannelDetectSummary is what a bulk channel detection run changed
+type ChannelDetectSummary struct {
+	AutoDisable bool                   `json:"auto_disable"`
+	Total       int                    `json:"total"`
+	Detected    int                    `json:"detected"`
+	Changed     int                    `json:"changed"`
+	Disabled    int                    `json:"disabled"`
+	Failed      int                    `json:"failed"`
+	Channels    []ChannelDetectOutcome `json:"channels"`
+}
+
+// DetectChannels detects the selected Anthropic channels with bounded concurrency, stores
+// each verdict on the channel and, only when opts.AutoDisable is set, disables the channels
+// whose verdict is configured in ChannelAutoDisableVerdicts
+func DetectChannels(parent context.Context, opts ChannelDetectOptions) (*ChannelDetectSummary, error) {
+	tx := model.DB.Where("type = ?", constant.ChannelTypeAnthropic)
+	if len(opts.ChannelIds) > 0 {
+		tx = tx.Where("id IN ?", opts.ChannelIds)
+	}
+	if opts.Tag != "" {
+		tx = tx.Where("tag = ?", opts.Tag)
+	}
+	var channels []*model.Channel
+	if err := tx.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+
+	opts.Rounds = ClampDetectRounds(opts.Rounds)
+
+	ctx, cancel := context.WithTimeout(parent, channelDetectTimeout)
+	defer cancel()
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect channels started: %d channels, auto_disable=%t", len(channels), opts.AutoDisable))
+
+	outcomes := make([]ChannelDetectOutcome, len(channels))
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = multiScanConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, channel := range channels {
+		wg.Add(1)
+		go func(i int, channel *model.Channel) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				outcomes[i] = ChannelDetectOutcome{ChannelId: channel.Id, Name: channel.Name, Error: "detection timed out"}
+				return
+			}
+			outcomes[i] = detectChannel(ctx, channel, opts)
+		}(i, channel)
+	}
+	wg.Wait()
+
+	summary := &ChannelDetectSummary{AutoDisable: opts.AutoDisable, Total: len(channels), Channels: outcomes}
+	for _, o := range outcomes {
+		if o.Error != "" {
+			summary.Failed++
+			continue
+		}
+		summary.Detected++
+		if o.Changed {
+			summary.Changed++
+		}
+		if o.Disabled {
+			summary.Disabled++
+		}
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect channels finished: detected=%d changed=%d disabled=%d failed=%d",
+		summary.Detected, summary.Changed, summary.Disabled, summary.Failed))
+	return summary, nil
+}
+
+func detectChannel(ctx context.Context, channel *model.Channel, opts ChannelDetectOptions) ChannelDetectOutcome {
+	outcome := ChannelDetectOutcome{ChannelId: channel.Id, Name: channel.Name}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		outcome.Error = "channel has no key"
+		return outcome
+	}
+	outcome.Model = pickChannelDetectModel(channel.GetModels())
+	if outcome.Model == "" {
+		outcome.Error = "channel has no model"
+		return outcome
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+
+	// Channels are admin-configured, same trust level as admin detection
+	result := detectSingleModel(ctx, baseURL, keys[0], outcome.Model, DetectOptions{
+		Rounds:        opts.Rounds,
+		SkipSSRFCheck: true,
+		Preset:        opts.Preset,
+		PersistResult: true,
+	})
+	outcome.Verdict = result.Verdict
+	outcome.VerdictText = result.VerdictText
+	outcome.Confidence = result.Confidence
+	// A failed run says nothing about the channel, keep the last real verdict
+	if runFailureVerdicts[result.Verdict] {
+		outcome.Error = "detection failed: " + result.Verdict
+		return outcome
+	}
+
+	previous, err := model.UpdateChannelOtherInfo(channel.Id, map[string]interface{}{
+		ChannelOtherInfoProxyDetectVerdict:    result.Verdict,
+		ChannelOtherInfoProxyDetectConfidence: result.Confidence,
+		ChannelOtherInfoProxyDetectTime:       common.GetTimestamp(),
+	})
+	if err != nil {
+		outcome.Error = fmt.Sprintf("failed to save verdict: %v", err)
+		return outcome
+	}
+	outcome.PreviousVerdict, _ = previous[ChannelOtherInfoProxyDetectVerdict].(string)
+	outcome.Changed = outcome.PreviousVerdict != result.Verdict
+
+	disable, skipped := shouldAutoDisableChannel(opts.AutoDisable, channel, result.Verdict)
+	outcome.DisableSkipped = skipped
+	if disable {
+		reason := fmt.Sprintf("中转检测判定为 %s（模型 %s）", result.VerdictText, outcome.Model)
+		if model.UpdateChannelStatus(channel.Id, "", common.ChannelStatusAutoDisabled, reason) {
+			outcome.Disabled = true
+			subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channel.Name, channel.Id)
+			content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channel.Name, channel.Id, reason)
+			NotifyRootUser(formatNotifyType(channel.Id, common.ChannelStatusAutoDisabled), subject, content)
+		}
+	}
+	return outcome
+}
+
+// pickChannelDetectModel prefers the channel's first Claude model
+func pickChannelDetectModel(models []string) string {
+	for _, m := range models {
+		if strings.Contains(strings.ToLower(m), "claude") {
+			return m
+		}
+	}
+	if len(models) > 0 {
+		return models[0]
+	}
+	return ""
+}
+
+// shouldAutoDisableChannel decides whether a verdict disables the channel. Nothing is
+// disabled without the explicit flag; otherwise only enabled single-key channels with a
+// configured verdict are. The string explains why a matching channel was left alone.
+func shouldAutoDisableChannel(autoDisable bool, channel *model.Channel, verdict string) (bool, string) {
+	if !system_setting.GetProxyDetectSetting().IsChannelAutoDisableVerdict(verdict) {
+		return false, ""
+	}
+	switch {
+	case !autoDisable:
+		return false, "auto-disable not requested"
+	case channel.Status != common.ChannelStatusEnabled:
+		return false, "channel not enabled"
+	case channel.ChannelInfo.IsMultiKey:
+		// Detection only used the first key; disable multi-key channels by hand
+		return false, "multi-key channel"
+	}
+	return true, ""
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestShouldAutoDisableChannel(t *testing.T) {
+	enabled := &model.Channel{Status: common.ChannelStatusEnabled}
+	disabled := &model.Channel{Status: common.ChannelStatusManuallyDisabled}
+	multiKey := &model.Channel{Status: common.ChannelStatusEnabled}
+	multiKey.ChannelInfo.IsMultiKey = true
+
+	cases := []struct {
+		name        string
+		autoDisable bool
+		channel     *model.Channel
+		verdict     string
+		disable     bool
+		skipped     string
+	}{
+		{"suspicious with flag", true, enabled, "suspicious", true, ""},
+		{"bedrock with flag", true, enabled, "bedrock", true, ""},
+		{"genuine with flag", true, enabled, "anthropic", false, ""},
+		{"unreachable with flag", true, enabled, "unreachable", false, ""},
+		{"suspicious without flag", false, enabled, "suspicious", false, "auto-disable not requested"},
+		{"already disabled", true, disabled, "suspicious", false, "channel not enabled"},
+		{"multi-key", true, multiKey, "bedrock", false, "multi-key channel"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			disable, skipped := shouldAutoDisableChannel(tc.autoDisable, tc.channel, tc.verdict)
+			require.Equal(t, tc.disable, disable)
+			require.Equal(t, tc.skipped, skipped)
+		})
+	}
+}
+
+func TestShouldAutoDisableChannelConfiguredVerdicts(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	orig := setting.ChannelAutoDisableVerdicts
+	t.Cleanup(func() { setting.ChannelAutoDisableVerdicts = orig })
+	enabled := &model.Channel{Status: common.ChannelStatusEnabled}
+
+	setting.ChannelAutoDisableVerdicts = []string{" proxy "}
+	disable, _ := shouldAutoDisableChannel(true, enabled, "proxy")
+	require.True(t, disable)
+	disable, _ = shouldAutoDisableChannel(true, enabled, "suspicious")
+	require.False(t, disable)
+
+	// An empty list never disables anything
+	setting.ChannelAutoDisableVerdicts = nil
+	disable, skipped := shouldAutoDisableChannel(true, enabled, "suspicious")
+	require.False(t, disable)
+	require.Empty(t, skipped)
+}
+
+func TestPickChannelDetectModel(t *testing.T) {
+	require.Equal(t, "claude-sonnet-4-5", pickChannelDetectModel([]string{"gpt-4o", "claude-sonnet-4-5", "claude-opus-4-1"}))
+	require.Equal(t, "gpt-4o", pickChannelDetectModel([]string{"gpt-4o"}))
+	require.Empty(t, pickChannelDetectModel(nil))
+}
+
+// setupChannelDetectTestDB points model.DB at a private in-memory SQLite database for the test
+func setupChannelDetectTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	origDB, origSQLite := model.DB, common.UsingSQLite
+	model.DB, common.UsingSQLite = db, true
+	t.Cleanup(func() { model.DB, common.UsingSQLite = origDB, origSQLite })
+	require.NoError(t, model.DB.AutoMigrate(&model.Channel{}, &model.ProxyDetectLog{}))
+}
+
+func TestScheduledDetectSendsToolProbes(t *testing.T) {
+	setupChannelDetectTestDB(t)
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 0
+
+	var toolProbes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"tools"`) {
+			toolProbes.Add(1)
+		}
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	baseURL := srv.URL
+	channel := &model.Channel{Type: constant.ChannelTypeAnthropic, Name: "relay", Key: "sk-test", BaseURL: &baseURL,
+		Models: "claude-sonnet-4-5-20250929", Status: common.ChannelStatusEnabled}
+	require.NoError(t, model.DB.Create(channel).Error)
+
+	summary, err := DetectChannels(context.Background(), scheduledDetectOptions(setting))
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Detected)
+	require.EqualValues(t, defaultDetectRounds, toolProbes.Load())
+	require.NotEqual(t, "unknown", summary.Channels[0].Verdict)
+}
+
+func TestDetectChannelsKeepsVerdictOnFailedRun(t *testing.T) {
+	setupChannelDetectTestDB(t)
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(authErrorBody))
+	}))
+	defer srv.Close()
+
+	baseURL := srv.URL
+	channel := &model.Channel{Type: constant.ChannelTypeAnthropic, Name: "relay", Key: "sk-revoked", BaseURL: &baseURL,
+		Models: "claude-sonnet-4-5-20250929", Status: common.ChannelStatusEnabled}
+	require.NoError(t, model.DB.Create(channel).Error)
+	_, err := model.UpdateChannelOtherInfo(channel.Id, map[string]interface{}{ChannelOtherInfoProxyDetectVerdict: "anthropic"})
+	require.NoError(t, err)
+
+	summary, err := DetectChannels(context.Background(), ChannelDetectOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Failed)
+	require.Zero(t, summary.Detected)
+	require.Zero(t, summary.Changed)
+	require.Equal(t, "invalid_key", summary.Channels[0].Verdict)
+	require.NotEmpty(t, summary.Channels[0].Error)
+
+	stored, err := model.GetChannelById(channel.Id, false)
+	require.NoError(t, err)
+	require.Equal(t, "anthropic", stored.GetOtherInfo()[ChannelOtherInfoProxyDetectVerdict])
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// The Date response header carries the upstream server's clock. Anthropic's edge keeps it
+// NTP-synchronized, so a skew of many seconds points at a self-hosted relay with a drifting
+// clock. Our own clock may be off too, so this is only a weak hint.
+
+// Skew beyond which the upstream clock is flagged
+const clockSkewThreshold = 30 * time.Second
+
+// recordClockSkew stores how far the Date header is ahead (+) or behind (-) of received, the
+// local time the response arrived. A missing or unparseable Date leaves the skew at 0. Date has
+// one-second resolution, so small skews are noise.
+func recordClockSkew(fp *Fingerprint, header http.Header, received time.Time) {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return
+	}
+	fp.ServerClockSkewMs = date.Sub(received).Milliseconds()
+}
+
+// medianClockSkew returns the median skew of the fingerprints that recorded one
+func medianClockSkew(fingerprints []Fingerprint) (time.Duration, bool) {
+	var skews []int64
+	for _, fp := range fingerprints {
+		if fp.ServerClockSkewMs != 0 {
+			skews = append(skews, fp.ServerClockSkewMs)
+		}
+	}
+	if len(skews) == 0 {
+		return 0, false
+	}
+	slices.Sort(skews)
+	return time.Duration(skews[len(skews)/2]) * time.Millisecond, true
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordClockSkew(t *testing.T) {
+	received := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var fp Fingerprint
+	recordClockSkew(&fp, http.Header{"Date": {received.Add(-45 * time.Second).Format(http.TimeFormat)}}, received)
+	require.Equal(t, int64(-45000), fp.ServerClockSkewMs)
+
+	fp = Fingerprint{}
+	recordClockSkew(&fp, http.Header{}, received)
+	require.Zero(t, fp.ServerClockSkewMs)
+	recordClockSkew(&fp, http.Header{"Date": {"yesterday"}}, received)
+	require.Zero(t, fp.ServerClockSkewMs)
+}
+
+func TestAnalyzeClockSkew(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	withSkews := func(skews ...int64) DetectResult {
+		var fps []Fingerprint
+		for _, skew := range skews {
+			fp := anthropicFingerprint("tool")
+			fp.ServerClockSkewMs = skew
+			fps = append(fps, fp)
+		}
+		return analyze(fps, model, w)
+	}
+	base := withSkews(0, 0, 0)
+
+	synced := withSkews(-400, 300, -800)
+	require.Equal(t, base.Scores, synced.Scores)
+	require.False(t, hasEvidence(synced, "Date 响应头"))
+
+	drifting := withSkews(92300, 91800, 92100)
+	require.Equal(t, base.Scores["anthropic"]-w.ClockSkewPenalty, drifting.Scores["anthropic"])
+	require.True(t, hasEvidence(drifting, "相差 92 秒"))
+
+	// One outlier round does not move the median
+	require.Equal(t, base.Scores, withSkews(-400, 300, 120000).Scores)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Comparing two endpoints detected with the same model shows whether two "different"
+// channels resell the same upstream: a reseller passes the upstream's id formats, usage
+// layout and headers through unchanged, so an identical rewritten tool_id prefix or message
+// id format on both sides is far more telling than a shared genuine Anthropic shape.
+
+// CompareTarget is one endpoint of a comparison
+type CompareTarget struct {
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key"`
+}
+
+// FieldComparison is one fingerprint field on both endpoints
+type FieldComparison struct {
+	Field string `json:"field"`
+	Left  string `json:"left"`
+	Right string `json:"right"`
+	Match bool   `json:"match"`
+}
+
+// Codes recorded in CompareResult.Highlights
+const (
+	// Both returned the very same tool_use or message id: one upstream, or a shared cache
+	CompareHighlightSameToolID = "same_tool_id"
+	CompareHighlightSameMsgID  = "same_msg_id"
+	// Both rewrite ids the same non-Anthropic way
+	CompareHighlightSameRewrittenToolID = "same_rewritten_tool_id_prefix"
+	CompareHighlightSameRewrittenMsgID  = "same_rewritten_msg_id_format"
+	// Both sit behind the same detected proxy platform
+	CompareHighlightSamePlatform = "same_proxy_platform"
+)
+
+// CompareResult is the detection of both endpoints and the field-by-field diff of their
+// representative fingerprints
+type CompareResult struct {
+	Model  string            `json:"model"`
+	Left   DetectResult      `json:"left"`
+	Right  DetectResult      `json:"right"`
+	Fields []FieldComparison `json:"fields"`
+	// Share of the fields present on either side that match, 0-1
+	Similarity float64  `json:"similarity"`
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+// CompareEndpoints detects both endpoints concurrently with the same model and options and
+// compares the results
+func CompareEndpoints(ctx context.Context, left, right CompareTarget, model string, opts DetectOptions) CompareResult {
+	var results [2]DetectResult
+	var wg sync.WaitGroup
+	for i, target := range []CompareTarget{left, right} {
+		wg.Add(1)
+		go func(i int, target CompareTarget) {
+			defer wg.Done()
+			results[i] = detectSingleModel(ctx, target.BaseURL, target.APIKey, model, opts)
+			results[i].localize(opts.Lang)
+		}(i, target)
+	}
+	wg.Wait()
+	result := compareDetectResults(results[0], results[1])
+	result.Model = model
+	return result
+}
+
+// compareDetectResults diffs the representative fingerprints of two detections. Fields
+// empty on both sides are skipped; the similarity is the share of the rest that match.
+func compareDetectResults(left, right DetectResult) CompareResult {
+	result := CompareResult{Left: left, Right: right}
+	lfp, rfp := representativeFingerprint(left), representativeFingerprint(right)
+
+	add := func(field, l, r string) {
+		if l == "" && r == "" {
+			return
+		}
+		result.Fields = append(result.Fields, FieldComparison{Field: field, Left: l, Right: r, Match: l == r})
+	}
+	add("verdict", left.Verdict, right.Verdict)
+	add("proxy_platform", left.ProxyPlatform, right.ProxyPlatform)
+	add("tool_id_source", lfp.ToolIDSource, rfp.ToolIDSource)
+	add("tool_id_shape", idShape(lfp.ToolID), idShape(rfp.ToolID))
+	add("msg_id_source", lfp.MsgIDSource, rfp.MsgIDSource)
+	add("msg_id_format", lfp.MsgIDFormat, rfp.MsgIDFormat)
+	add("msg_id_shape", idShape(lfp.MsgID), idShape(rfp.MsgID))
+	add("model", lfp.Model, rfp.Model)
+	add("usage_style", lfp.UsageStyle, rfp.UsageStyle)
+	add("usage_keys", strings.Join(lfp.UsageKeys, ","), strings.Join(rfp.UsageKeys, ","))
+	add("service_tier", lfp.ServiceTier, rfp.ServiceTier)
+	add("inference_geo", lfp.InferenceGeo, rfp.InferenceGeo)
+	add("stop_reason", lfp.StopReason, rfp.StopReason)
+	add("request_id_format", lfp.RequestIDFormat, rfp.RequestIDFormat)
+	add("http_protocol", lfp.HTTPProtocol, rfp.HTTPProtocol)
+	add("content_encoding", lfp.ContentEncoding, rfp.ContentEncoding)
+	add("transfer_encoding", lfp.TransferEncoding, rfp.TransferEncoding)
+
+	matched := 0
+	for _, f := range result.Fields {
+		if f.Match {
+			matched++
+		}
+	}
+	if len(result.Fields) > 0 {
+		result.Similarity = math.Round(float64(matched)/float64(len(result.Fields))*100) / 100
+	}
+
+	if lfp.ToolID != "" && lfp.ToolID == rfp.ToolID {
+		result.Highlights = append(result.Highlights, CompareHighlightSameToolID)
+	}
+	if lfp.MsgID != "" && lfp.MsgID == rfp.MsgID {
+		result.Highlights = append(result.Highlights, CompareHighlightSameMsgID)
+	}
+	if lfp.ToolIDSource == "rewritten" && rfp.ToolIDSource == "rewritten" && idShape(lfp.ToolID) == idShape(rfp.ToolID) {
+		result.Highlights = append(result.Highlights, CompareHighlightSameRewrittenToolID)
+	}
+	if lfp.MsgID != "" && lfp.MsgIDSource != "anthropic" && lfp.MsgIDSource == rfp.MsgIDSource &&
+		lfp.MsgIDFormat == rfp.MsgIDFormat && idShape(lfp.MsgID) == idShape(rfp.MsgID) {
+		result.Highlights = append(result.Highlights, CompareHighlightSameRewrittenMsgID)
+	}
+	if left.ProxyPlatform != "" && strings.EqualFold(left.ProxyPlatform, right.ProxyPlatform) {
+		result.Highlights = append(result.Highlights, CompareHighlightSamePlatform)
+	}
+	return result
+}
+
+// representativeFingerprint is the first successful tool probe of a detection, else its
+// first successful probe
+func representativeFingerprint(result DetectResult) Fingerprint {
+	var fallback *Fingerprint
+	for i, fp := range result.Fingerprints {
+		if fp.Error != "" {
+			continue
+		}
+		if fp.ProbeType == "tool" {
+			return fp
+		}
+		if fallback == nil {
+			fallback = &result.Fingerprints[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return Fingerprint{}
+}
+
+// idShape reduces an id to its fixed prefix and length (msg_01ABC... -> "msg_* (28)"), which
+// an upstream keeps while the random part differs on every call
+func idShape(id string) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s* (%d)", id[:strings.LastIndex(id, "_")+1], len(id))
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDShape(t *testing.T) {
+	require.Equal(t, "msg_* (28)", idShape("msg_01ABCDEFGHIJKLMNOPQRSTUV"))
+	require.Equal(t, "msg_bdrk_* (30)", idShape("msg_bdrk_01ABCDEFGHIJKLMNOPQRS"))
+	require.Equal(t, "* (6)", idShape("abc123"))
+	require.Empty(t, idShape(""))
+}
+
+func TestCompareDetectResults(t *testing.T) {
+	genuine := func(toolID, msgID string) DetectResult {
+		fp := anthropicFingerprint("tool")
+		fp.ToolID, fp.MsgID = toolID, msgID
+		return DetectResult{Verdict: "anthropic", Fingerprints: []Fingerprint{{ProbeType: "tool", Error: "HTTP 500"}, fp}}
+	}
+
+	// Two genuine upstreams share every shape but no id
+	diff := compareDetectResults(genuine("toolu_01AAAAAAAAAAAAAAAAAAAAAA", "msg_01AAAAAAAAAAAAAAAAAAAAAA"), genuine("toolu_01BBBBBBBBBBBBBBBBBBBBBB", "msg_01BBBBBBBBBBBBBBBBBBBBBB"))
+	require.Equal(t, 1.0, diff.Similarity)
+	require.Empty(t, diff.Highlights)
+
+	// The same rewritten prefix behind one proxy platform
+	rewritten := func(toolID, geo string) DetectResult {
+		fp := anthropicFingerprint("tool")
+		fp.ToolID, fp.ToolIDSource, fp.InferenceGeo = toolID, "rewritten", geo
+		fp.MsgID = "msg_01" + toolID[5:]
+		return DetectResult{Verdict: "suspicious", ProxyPlatform: "new-api", Fingerprints: []Fingerprint{fp}}
+	}
+	diff = compareDetectResults(rewritten("call_AAAAAAAAAAAA", "us"), rewritten("call_BBBBBBBBBBBB", "eu"))
+	require.Equal(t, []string{CompareHighlightSameRewrittenToolID, CompareHighlightSamePlatform}, diff.Highlights)
+	require.Less(t, diff.Similarity, 1.0)
+	for _, f := range diff.Fields {
+		if f.Field == "inference_geo" {
+			require.False(t, f.Match)
+			require.Equal(t, "us", f.Left)
+		}
+	}
+
+	// Fields empty on both sides are not compared
+	empty := compareDetectResults(DetectResult{}, DetectResult{})
+	require.Empty(t, empty.Fields)
+	require.Zero(t, empty.Similarity)
+}
+
+func TestCompareEndpoints(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	})
+	left := httptest.NewServer(handler)
+	defer left.Close()
+	right := httptest.NewServer(handler)
+	defer right.Close()
+
+	result := CompareEndpoints(context.Background(), CompareTarget{BaseURL: left.URL, APIKey: "sk-a"}, CompareTarget{BaseURL: right.URL, APIKey: "sk-b"},
+		"claude-sonnet-4-5-20250929", DetectOptions{Rounds: 1, Preset: DetectPresetQuick, SkipSSRFCheck: true, Force: true})
+	require.Equal(t, "claude-sonnet-4-5-20250929", result.Model)
+	require.Equal(t, result.Left.Verdict, result.Right.Verdict)
+	require.Equal(t, 1.0, result.Similarity)
+	// A canned reply served on both sides
+	require.Equal(t, []string{CompareHighlightSameToolID, CompareHighlightSameMsgID}, result.Highlights)
+}
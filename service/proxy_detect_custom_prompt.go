@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// DetectOptions.CustomPrompts replaces the user message of individual probes for one run,
+// e.g. with a prompt known to trigger a backend-specific refusal. Only the message text
+// changes; tools, thinking config, system prompt and max_tokens stay as built, so the
+// structural checks on the reply still apply.
+
+// Longest custom prompt accepted, in characters
+const maxCustomPromptLen = 2000
+
+type customPromptsKey struct{}
+
+// ValidateCustomPrompts checks per-run probe prompts: only the probe types with a
+// configurable prompt, non-empty and bounded, and the tool prompt must still ask for the
+// probe tool
+func ValidateCustomPrompts(prompts map[string]string) error {
+	for probeType, prompt := range prompts {
+		if _, ok := system_setting.DefaultProbePrompts[probeType]; !ok {
+			return fmt.Errorf("unknown probe type %s", probeType)
+		}
+		if strings.TrimSpace(prompt) == "" {
+			return fmt.Errorf("prompt of probe type %s is empty", probeType)
+		}
+		if utf8.RuneCountInString(prompt) > maxCustomPromptLen {
+			return fmt.Errorf("prompt of probe type %s is longer than %d characters", probeType, maxCustomPromptLen)
+		}
+		if probeType == "tool" && !strings.Contains(strings.ToLower(prompt), system_setting.ProxyDetectToolName) {
+			return fmt.Errorf("tool prompt must ask for the %s tool", system_setting.ProxyDetectToolName)
+		}
+	}
+	return nil
+}
+
+// withCustomPrompts attaches the run's custom prompts to ctx
+func withCustomPrompts(ctx context.Context, prompts map[string]string) context.Context {
+	if len(prompts) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, customPromptsKey{}, prompts)
+}
+
+// customPromptsFrom returns the custom prompts attached to ctx, or nil
+func customPromptsFrom(ctx context.Context) map[string]string {
+	prompts, _ := ctx.Value(customPromptsKey{}).(map[string]string)
+	return prompts
+}
+
+// applyCustomPrompt replaces the text of the first user message in payload; payloads whose
+// user message is not plain text are left unchanged
+func applyCustomPrompt(payload map[string]any, prompt string) map[string]any {
+	if prompt == "" {
+		return payload
+	}
+	messages, _ := payload["messages"].([]map[string]any)
+	for i, msg := range messages {
+		if msg["role"] != "user" {
+			continue
+		}
+		if _, ok := msg["content"].(string); ok {
+			messages[i] = map[string]any{"role": "user", "content": prompt}
+		}
+		break
+	}
+	return payload
+}
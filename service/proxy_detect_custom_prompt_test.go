@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCustomPrompts(t *testing.T) {
+	require.NoError(t, ValidateCustomPrompts(nil))
+	require.NoError(t, ValidateCustomPrompts(map[string]string{"simple": "Reply with REFUSAL-CHECK", "tool": "Use the probe tool with q=x"}))
+	require.Error(t, ValidateCustomPrompts(map[string]string{"vision": "What color?"}))
+	require.Error(t, ValidateCustomPrompts(map[string]string{"simple": "  "}))
+	require.Error(t, ValidateCustomPrompts(map[string]string{"simple": strings.Repeat("a", maxCustomPromptLen+1)}))
+	require.Error(t, ValidateCustomPrompts(map[string]string{"tool": "say hello"}))
+}
+
+func TestApplyCustomPrompt(t *testing.T) {
+	payload := applyCustomPrompt(buildProbePayload("claude-sonnet-4-5-20250929", "thinking"), "Explain quicksort")
+	require.Equal(t, "Explain quicksort", payload["messages"].([]map[string]any)[0]["content"])
+	require.NotNil(t, payload["thinking"])
+
+	// The default builders are not mutated
+	require.NotEqual(t, "Explain quicksort", buildProbePayload("claude-sonnet-4-5-20250929", "thinking")["messages"].([]map[string]any)[0]["content"])
+
+	// Block content is left alone
+	vision := applyCustomPrompt(buildProbePayload("claude-sonnet-4-5-20250929", "vision"), "hi")
+	require.IsType(t, []map[string]any{}, vision["messages"].([]map[string]any)[0]["content"])
+}
+
+func TestProbeOnceCustomPrompt(t *testing.T) {
+	var mu sync.Mutex
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		_ = common.Unmarshal(raw, &body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx := withCustomPrompts(context.Background(), map[string]string{"tool": "call probe with q=refusal"})
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test", AnthropicVersion: defaultAnthropicVersion}
+	probeOnce(ctx, newUnsafeHTTPClient(5*time.Second), target, "claude-sonnet-4-5-20250929", "tool")
+
+	mu.Lock()
+	defer mu.Unlock()
+	messages := body["messages"].([]any)
+	require.Equal(t, "call probe with q=refusal", messages[0].(map[string]any)["content"])
+	require.NotEmpty(t, body["tools"])
+	require.NotEmpty(t, body["tool_choice"])
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The probe clients let net/http negotiate gzip, which decompresses transparently: the
+// Content-Encoding and Content-Length headers are dropped and resp.Uncompressed is set, so
+// the original encoding has to be read from there. Anthropic compresses when asked and
+// frames bodies without a fixed length (chunked or HTTP/2 data frames). A proxy that
+// buffers, decompresses and re-serializes the reply tends to answer with an uncompressed
+// body of a precise Content-Length instead. Both are weak signals: plenty of legitimate
+// gateways disable compression.
+
+// Body framing classes recorded in Fingerprint.TransferEncoding
+const (
+	TransferEncodingChunked  = "chunked"
+	TransferEncodingIdentity = "identity" // fixed Content-Length
+)
+
+// recordBodyEncoding records how the response body was encoded and framed on the wire
+func recordBodyEncoding(fp *Fingerprint, resp *http.Response) {
+	switch {
+	case resp.Uncompressed:
+		fp.ContentEncoding = "gzip"
+	case resp.Header.Get("Content-Encoding") != "":
+		fp.ContentEncoding = strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	default:
+		fp.ContentEncoding = "identity"
+	}
+
+	switch {
+	case len(resp.TransferEncoding) > 0:
+		fp.TransferEncoding = strings.Join(resp.TransferEncoding, ",")
+	case resp.ContentLength >= 0:
+		fp.TransferEncoding = TransferEncodingIdentity
+	}
+	// Otherwise the length is unknown without chunking (HTTP/2 data frames, or transparently
+	// decompressed), which is how Anthropic frames bodies; leave it empty
+}
+
+// isReserializedBody reports an uncompressed body with a fixed Content-Length
+func isReserializedBody(fp Fingerprint) bool {
+	return fp.ContentEncoding == "identity" && fp.TransferEncoding == TransferEncodingIdentity
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const encodingProbeBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`
+
+func TestProbeBodyEncoding(t *testing.T) {
+	var mode string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode {
+		case "gzip":
+			require.Contains(t, r.Header.Get("Accept-Encoding"), "gzip")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte(encodingProbeBody))
+			_ = gz.Close()
+		case "chunked":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(encodingProbeBody))
+		default:
+			// Small bodies written in one go get a fixed Content-Length
+			_, _ = w.Write([]byte(encodingProbeBody))
+		}
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	probe := func(m string) Fingerprint {
+		mode = m
+		fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+		require.Empty(t, fp.Error)
+		require.Equal(t, "msg_01ABC", fp.MsgID, "body still parsed")
+		return fp
+	}
+
+	fp := probe("gzip")
+	require.Equal(t, "gzip", fp.ContentEncoding)
+	require.Empty(t, fp.TransferEncoding)
+	require.False(t, isReserializedBody(fp))
+
+	fp = probe("chunked")
+	require.Equal(t, "identity", fp.ContentEncoding)
+	require.Equal(t, TransferEncodingChunked, fp.TransferEncoding)
+	require.False(t, isReserializedBody(fp))
+
+	fp = probe("fixed")
+	require.Equal(t, "identity", fp.ContentEncoding)
+	require.Equal(t, TransferEncodingIdentity, fp.TransferEncoding)
+	require.True(t, isReserializedBody(fp))
+}
+
+func TestAnalyzeReserializedBody(t *testing.T) {
+	withEncoding := func(probeType, contentEncoding, transferEncoding string) Fingerprint {
+		fp := anthropicFingerprint(probeType)
+		fp.ContentEncoding, fp.TransferEncoding = contentEncoding, transferEncoding
+		return fp
+	}
+	model := "claude-sonnet-4-5-20250929"
+	w := system_setting.DefaultScoringWeights
+
+	genuine := analyze([]Fingerprint{withEncoding("tool", "gzip", ""), withEncoding("tool", "gzip", "")}, model, w)
+	reserialized := analyze([]Fingerprint{withEncoding("tool", "identity", "identity"), withEncoding("tool", "identity", "identity")}, model, w)
+	require.Equal(t, genuine.Scores["anthropic"]-w.ReserializedBodyPenalty, reserialized.Scores["anthropic"])
+	require.Equal(t, "anthropic", reserialized.Verdict, "weak signal only")
+	require.Contains(t, strings.Join(reserialized.Evidence, "\n"), "[!] 非流式响应均未压缩且带固定 Content-Length (2/2)")
+
+	// One compressed round or a single round is not enough
+	mixed := analyze([]Fingerprint{withEncoding("tool", "identity", "identity"), withEncoding("tool", "gzip", "")}, model, w)
+	require.Equal(t, genuine.Scores["anthropic"], mixed.Scores["anthropic"])
+	single := analyze([]Fingerprint{withEncoding("tool", "identity", "identity")}, model, w)
+	require.NotContains(t, strings.Join(single.Evidence, "\n"), "重新序列化")
+
+	stream := analyze([]Fingerprint{withEncoding("stream", "identity", "identity")}, model, w)
+	require.Contains(t, strings.Join(stream.Evidence, "\n"), "[R1] [!] 流式响应带固定 Content-Length")
+}
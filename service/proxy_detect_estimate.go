@@ -0,0 +1,134 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const (
+	// Rough request-body characters per input token
+	estimateCharsPerToken = 4
+	// Tool-use system prompt Anthropic adds when tool_choice forces a tool
+	toolUseSystemPromptTokens = 313
+)
+
+// ProbeEstimate is the expected cost of one probe type for one model
+type ProbeEstimate struct {
+	ProbeType string `json:"probe_type"`
+	Requests  int    `json:"requests"`
+	// Approximate input tokens of all requests of this probe type
+	InputTokens int `json:"input_tokens"`
+	// Upper bound on output tokens: max_tokens times requests
+	MaxOutputTokens int `json:"max_output_tokens"`
+}
+
+// ModelEstimate is the expected cost of detecting one model
+type ModelEstimate struct {
+	Model           string          `json:"model"`
+	Requests        int             `json:"requests"`
+	InputTokens     int             `json:"input_tokens"`
+	MaxOutputTokens int             `json:"max_output_tokens"`
+	Probes          []ProbeEstimate `json:"probes"`
+}
+
+// DetectEstimate is the expected cost of a detection run; nothing is sent to the upstream
+type DetectEstimate struct {
+	Requests        int             `json:"requests"`
+	InputTokens     int             `json:"input_tokens"`
+	MaxOutputTokens int             `json:"max_output_tokens"`
+	Models          []ModelEstimate `json:"models"`
+	// ScanOutputTokenBudget in effect, 0 when unlimited; the run stops probing once it is spent
+	OutputTokenBudget int `json:"output_token_budget"`
+}
+
+// EstimateDetection returns the requests and tokens a detection of models with opts would
+// spend, following the same probe plan as DetectSingleModel / ScanMultipleModels. Output
+// tokens are an upper bound (every probe using its full max_tokens) and ratelimit
+// verification assumes none of the probe responses could be reused as a sample.
+func EstimateDetection(models []string, opts DetectOptions) DetectEstimate {
+	estimate := DetectEstimate{
+		OutputTokenBudget: system_setting.GetProxyDetectSetting().ScanOutputTokenBudget,
+	}
+	for _, model := range models {
+		m := estimateModel(model, opts, len(models) > 1)
+		estimate.Requests += m.Requests
+		estimate.InputTokens += m.InputTokens
+		estimate.MaxOutputTokens += m.MaxOutputTokens
+		estimate.Models = append(estimate.Models, m)
+	}
+	return estimate
+}
+
+// estimateModel mirrors detectSingleModel; scanned models also pay the availability check
+// and never verify ratelimit
+func estimateModel(model string, opts DetectOptions, scanned bool) ModelEstimate {
+	m := ModelEstimate{Model: model}
+	add := func(probeType string, payload map[string]any, requests int) {
+		if requests <= 0 {
+			return
+		}
+		payload = applyCustomPrompt(payload, opts.CustomPrompts[probeType])
+		maxTokens, _ := payload["max_tokens"].(int)
+		p := ProbeEstimate{
+			ProbeType:       probeType,
+			Requests:        requests,
+			InputTokens:     estimatePayloadInputTokens(payload) * requests,
+			MaxOutputTokens: maxTokens * requests,
+		}
+		m.Probes = append(m.Probes, p)
+		m.Requests += p.Requests
+		m.InputTokens += p.InputTokens
+		m.MaxOutputTokens += p.MaxOutputTokens
+	}
+
+	if scanned {
+		add("availability", buildAvailabilityPayload(model), 1)
+	}
+	if opts.Preset == DetectPresetQuick {
+		add("tool", buildProbePayload(model, "tool"), 1)
+		return m
+	}
+	if probeSelected(opts, "tool", true) {
+		add("tool", buildProbePayload(model, "tool"), opts.Rounds)
+	}
+	if probeSelected(opts, "thinking", true) {
+		add("thinking", buildProbePayload(model, "thinking"), thinkingProbeRounds(opts))
+	}
+	thorough := opts.Preset == DetectPresetThorough
+	if probeSelected(opts, "stream", thorough) {
+		add("stream", buildProbePayload(model, "stream"), 1)
+	}
+	if probeSelected(opts, "simple", false) {
+		add("simple", buildProbePayload(model, "simple"), 1)
+	}
+	for _, probeType := range []string{"max_tokens", "system", "stop_sequences", "identity", "vision", "header_case", "bad_version", "service_tier"} {
+		if !probeSelected(opts, probeType, thorough) || (probeType == "header_case" && opts.OutboundProxy != "") {
+			continue
+		}
+		add(probeType, buildProbePayload(model, probeType), 1)
+	}
+	// The cached prefix is sent twice
+	if probeSelected(opts, "cache", thorough) {
+		add("cache", buildProbePayload(model, "cache"), 2)
+	}
+	// One request per credential header
+	if probeSelected(opts, "auth", thorough) {
+		add("auth", buildProbePayload(model, "auth"), 2)
+	}
+	if opts.CheckVersions {
+		add("versions", buildAvailabilityPayload(model), len(KnownAnthropicVersions))
+	}
+	if opts.VerifyRatelimit && !scanned {
+		add("ratelimit", buildProbePayload(model, "simple"), ratelimitVerifyShots)
+	}
+	return m
+}
+
+// estimatePayloadInputTokens approximates the input tokens of a request body from its JSON size
+func estimatePayloadInputTokens(payload map[string]any) int {
+	tokens := (len(common.GetJsonString(payload)) + estimateCharsPerToken - 1) / estimateCharsPerToken
+	if _, ok := payload["tools"]; ok {
+		tokens += toolUseSystemPromptTokens
+	}
+	return tokens
+}
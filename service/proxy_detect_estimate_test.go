@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateDetection(t *testing.T) {
+	single := EstimateDetection([]string{"claude-sonnet-4-5-20250929"}, DetectOptions{Rounds: 3, VerifyRatelimit: true})
+	require.Len(t, single.Models, 1)
+	m := single.Models[0]
+	// 3 tool + thinking + 4 ratelimit shots
+	require.Equal(t, 8, m.Requests)
+	require.Equal(t, 3*50+2048+4*5, m.MaxOutputTokens)
+	require.Equal(t, m.Requests, single.Requests)
+	require.Positive(t, m.InputTokens)
+
+	probes := map[string]ProbeEstimate{}
+	for _, p := range m.Probes {
+		probes[p.ProbeType] = p
+	}
+	require.Equal(t, 3, probes["tool"].Requests)
+	require.Greater(t, probes["tool"].InputTokens, 3*toolUseSystemPromptTokens)
+	require.Equal(t, 2048, probes["thinking"].MaxOutputTokens)
+	require.Equal(t, 4, probes["ratelimit"].Requests)
+
+	// Quick: a single tool probe whatever the other options ask for
+	quick := EstimateDetection([]string{"claude-sonnet-4-5-20250929"}, DetectOptions{Rounds: 3, VerifyRatelimit: true, CheckVersions: true, Preset: DetectPresetQuick})
+	require.Equal(t, 1, quick.Requests)
+	require.Equal(t, 50, quick.MaxOutputTokens)
+
+	// A scan adds the availability check and skips ratelimit verification
+	scan := EstimateDetection([]string{"claude-sonnet-4-5-20250929", "claude-opus-4-1-20250805"},
+		DetectOptions{Rounds: 2, VerifyRatelimit: true, Preset: DetectPresetThorough, CheckVersions: true})
+	require.Len(t, scan.Models, 2)
+	for _, m := range scan.Models {
+		// availability + 2 tool + 3 thinking + stream + 8 thorough + 2 cache + 2 auth + versions
+		require.Equal(t, 1+2+3+1+8+2+2+len(KnownAnthropicVersions), m.Requests)
+		require.Equal(t, 5+2*50+3*2048+128+maxTokensProbeLimit+32+64+64+32+5+5+5+2*5+2*5+5*len(KnownAnthropicVersions), m.MaxOutputTokens)
+	}
+	require.Equal(t, scan.Models[0].Requests+scan.Models[1].Requests, scan.Requests)
+	require.Equal(t, scan.Models[0].MaxOutputTokens+scan.Models[1].MaxOutputTokens, scan.MaxOutputTokens)
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EvidenceItem is one finding behind a verdict. Code names the signal, Weight is the signed
+// score it applied (0 for informational findings), Round is the 1-based probe round it came
+// from (0 for findings across rounds) and Params holds the values shown in its text.
+type EvidenceItem struct {
+	Code   string         `json:"code"`
+	Weight int            `json:"weight"`
+	Round  int            `json:"round,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// evidenceTemplates renders each code. {name} prints a param, {name:%.1f} formats it with
+// the given verb and {name:sep} joins a []string param with sep (", " by default).
+var evidenceTemplates = map[string]string{
+	// per-round findings
+	"tool_id_bedrock":                 "tool_use id: {tool_id} -> tooluse_ (Bedrock/AG)",
+	"tool_id_anthropic":               "tool_use id: {tool_id} -> toolu_ (Anthropic)",
+	"tool_id_vertex":                  "tool_use id: {tool_id} -> tool_N (Vertex AI)",
+	"tool_id_rewritten":               "tool_use id: {tool_id} -> 被改写",
+	"thinking_sig_short":              "thinking sig: (len={length}) -> 签名截断",
+	"thinking_sig_vertex":             "thinking sig: (len={length}) -> claude# 前缀 (Vertex AI)",
+	"thinking_sig_normal":             "thinking sig: (len={length}) -> 正常签名",
+	"thinking_sig_none":               "thinking sig: 无签名",
+	"msg_id_anthropic":                "message id: {msg_id} -> msg_<base62> (Anthropic)",
+	"msg_id_uuid":                     "message id: {msg_id} -> msg_<UUID> (非原生)",
+	"msg_id_vertex":                   "message id: {msg_id} -> req_vrtx_ (Vertex AI)",
+	"msg_id_rewritten":                "message id: {msg_id} -> 被改写",
+	"model_kiro":                      "model: {model} -> kiro-* (Kiro 逆向铁证)",
+	"model_bedrock":                   "model: {model} -> anthropic.* (Bedrock)",
+	"service_tier":                    "service_tier: {service_tier} -> Anthropic 独有",
+	"inference_geo":                   "inference_geo: {inference_geo} -> Anthropic 独有",
+	"cache_creation":                  "cache_creation: 嵌套对象 -> Anthropic 新格式",
+	"usage_camel_case":                "usage: camelCase (Bedrock)",
+	"aws_headers":                     "AWS headers detected",
+	"anthropic_headers":               "Anthropic rate-limit headers detected",
+	"stream_not_sse":                  "[!!] 请求 stream:true 但返回非流式 JSON，中转未透传流式参数",
+	"stream_canonical":                "SSE 事件序列符合官方格式 (含 ping)",
+	"stream_canonical_no_ping":        "SSE 事件序列符合官方格式，但缺少 ping 事件",
+	"stream_order_abnormal":           "[!] SSE 事件序列异常: {order: → }",
+	"stream_blob":                     "[!!] 流式事件一次性到达 ({events} events)，疑似中转收完整响应后伪造流",
+	"stream_buffered":                 "[!] 流式疑似被缓冲: TTFT {ttft_ms}ms / 总耗时 {total_ms}ms，中转可能先收完整响应再转发",
+	"stream_timing":                   "stream: TTFT {ttft_ms}ms / 总耗时 {total_ms}ms ({events} events)",
+	"max_tokens_capped":               "[!!] max_tokens 被截断: 请求 {requested}，实际输出 {output_tokens} tokens 即以 max_tokens 停止",
+	"max_tokens_ok":                   "max_tokens: 输出 {output_tokens} tokens (stop_reason={stop_reason})，未发现截断",
+	"system_honored":                  "system 参数生效",
+	"system_ignored":                  "[!] system 参数未生效: 回复未遵循 system 指令，疑似中转丢弃了 system 字段",
+	"tool_use_missing":                "[!!] tool_choice 强制调用工具但未返回 tool_use 块，疑似中转合并或改写了内容块 (content=[{content}])",
+	"thinking_block_missing":          "[!] 开启 thinking 但未返回 thinking 块，疑似中转丢弃了 thinking 内容 (content=[{content}])",
+	"thinking_block_reordered":        "[!] thinking 块不在首位，内容块顺序被重排 (content=[{content}])",
+	"usage_inconsistent":              "[!!] usage 数值自相矛盾: {issues:; }",
+	"usage_injected":                  "[!] usage 含非官方字段: {fields}",
+	"stop_reason_openai":              "[!!] stop_reason 为 OpenAI 取值: {stop_reason}，后端为 OpenAI 兼容接口经格式转换",
+	"stop_reason_gemini":              "[!!] stop_reason 为 Gemini finishReason 取值: {stop_reason}，后端为 Gemini 经格式转换",
+	"tool_stop_reason_mismatch":       "[!] 工具探测强制调用工具，stop_reason 却为 {stop_reason} 而非 tool_use",
+	"stop_reason_nonstandard":         "[!!] stop_reason 非 Anthropic 取值: {stop_reason}，疑似 OpenAI 格式转换或自定义后端",
+	"stop_sequences_honored":          "stop_sequences 生效 (stop_reason=stop_sequence)",
+	"stop_sequence_leaked":            "[!!] stop_sequences 未生效: 停止序列出现在输出中 (stop_reason={stop_reason})，中转未透传请求参数",
+	"stop_sequences_inconclusive":     "stop_sequences: 模型未输出停止序列 (stop_reason={stop_reason})，无法判断",
+	"header_case_lowercase":           "响应头名称为小写，与官方一致",
+	"header_case_recased":             "[!] 响应头名称大小写为 {header_case}，官方为全小写，疑似中转重新输出了响应头",
+	"gemini_fields":                   "[!!] 响应含 Gemini 原生字段: {signals} (Gemini generateContent 转译)",
+	"stream_fixed_length":             "[!] 流式响应带固定 Content-Length (Content-Encoding: {content_encoding})，疑似中转缓冲完整响应后再转发",
+	"version_error_anthropic":         "无效 anthropic-version ({version}) 返回官方 invalid_request_error",
+	"version_error_rewritten":         "[!] 无效 anthropic-version ({version}) 的错误响应非官方格式，疑似中转改写了错误",
+	"version_accepted":                "[!!] 上游接受了无效 anthropic-version ({version})，中转未透传或覆盖了该请求头",
+	"service_tier_unknown":            "[!] service_tier: {service_tier} 不是官方取值 (standard/priority/batch)，疑似中转注入",
+	"service_tier_rejected_anthropic": "请求 service_tier={requested} 返回官方 invalid_request_error",
+	"service_tier_rejected_rewritten": "[!] 请求 service_tier={requested} 的错误响应非官方格式，疑似中转改写了错误",
+	"service_tier_accepted":           "[!!] 上游接受了官方不支持的 service_tier={requested}（返回 {observed}），中转丢弃或伪造了该字段",
+	"chat_completions_openai":         "[!!] /v1/messages 不存在，chat/completions 返回 OpenAI 原生响应 (id={id}, system_fingerprint={system_fingerprint}, model={model})，上游并非 Claude",
+	"chat_completions_translated":     "[!!] /v1/messages 不存在，chat/completions 响应由转译层生成 (id={id}, model={model})，渠道以 OpenAI 格式转接",
+	"retry_after_honored":             "按 Retry-After 等待后重试成功 ({retries} 次重试)，限流响应与官方一致",
+	"auth_x_api_key_only":             "仅接受 x-api-key 认证、拒绝 Bearer，与官方一致",
+	"auth_both":                       "[!!] 同时接受 x-api-key 与 Authorization: Bearer 认证，官方 /v1/messages 不支持 Bearer，疑似转译层",
+	"auth_bearer_only":                "[!!] 仅接受 Authorization: Bearer 认证、拒绝 x-api-key，为 OpenAI 风格转译层",
+
+	// findings across rounds
+	"proxy_platform":                "中转平台: {platform}",
+	"backend_llm":                   "[!!] 渠道后端为 {family} 而非 Claude: {probe} 探测的 {source} 含 \"{match}\"",
+	"proxy_chain":                   "[!] 响应经过 {hops} 层转发 ({chain:; })，疑似多级中转转售",
+	"http1_only":                    "[!] TLS 探测均只协商到 HTTP/1.1 ({total} 次)，官方 API 为 HTTP/2，疑似自建中转（CDN 各异，仅供参考）",
+	"clock_skew":                    "[!] 上游 Date 响应头与本地时间相差 {skew_s} 秒，时钟未同步，疑似自建中转（本地时钟偏差也会导致，仅供参考）",
+	"thinking_sig_truncated":        "[!] 多次 thinking 签名长度 ({lengths}) 均略低于 {bound}，疑似被截断为固定长度",
+	"thinking_sig_constant_len":     "[!] {count} 次 thinking 签名长度均为 {length}，官方签名长度随内容变化，疑似固定签名",
+	"thinking_sig_out_of_range":     "[!] thinking 签名长度 {length} 超出预期范围 {min}-{max}",
+	"http2_negotiated":              "TLS 探测均协商到 HTTP/2 ({total} 次)",
+	"overloaded_anthropic":          "HTTP 529 overloaded_error 与官方格式完全一致 ({count} 次)，伪装者极少复刻",
+	"overloaded_rewritten":          "[!] 收到 HTTP 529 ({count} 次)，但错误体与官方 overloaded_error 格式不符",
+	"latency_uniform":               "[!] {count} 次探测延迟几乎相同 ({min}-{max}ms)，疑似缓存或回放响应",
+	"reserialized_body":             "[!] 非流式响应均未压缩且带固定 Content-Length ({reserialized}/{total})，疑似中转解压后重新序列化",
+	"inference_geo_mixed":           "[!] inference_geo 跨轮不一致 ({geos})，疑似跨区号池或注入的随机值",
+	"tooluse_reattributed":          "[修正] tooluse_ 分数 {points} 从 Bedrock 转移到 Antigravity",
+	"msg_uuid_kiro":                 "[修正] msg_<UUID> x{count} 归属 Kiro 中转改写 (非 Antigravity)",
+	"missing_inference_geo":         "[缺失] inference_geo 未出现 (Anthropic 官方必有字段)",
+	"missing_cache_creation":        "[缺失] cache_creation 嵌套对象未出现",
+	"missing_thinking_sig":          "[缺失] thinking signature 为空 (真 Anthropic thinking 轮应有 len 200+ 签名)",
+	"constant_latency":              "[!] 重复探测延迟几乎恒定且极低 (均值 {mean_ms:%.0f}ms, 方差 {variance:%.1f})，疑似响应缓存",
+	"duplicate_msg_id":              "[!!] msg id 重复 ({msg_ids})，真 Anthropic 每次请求都会生成新 id",
+	"duplicate_tool_id":             "[!!] tool_use id 跨轮重复 ({tool_ids})，真实后端每次调用都会生成新 id，疑似缓存或回放响应",
+	"inconsistent_backend":          "[!!] 各轮回显的模型不一致 (model: {models}; 来源: {sources})，疑似轮询多个后端转售",
+	"disqualifying_platform":        "[!!] 检测到禁用中转平台 {platform}，直接判定为中转",
+	"missing_fields_offset":         "[!] 正面分数被缺失扣分抵消，高度可疑伪装 Anthropic",
+	"no_signal":                     "未获取到有效指纹信号",
+	"quick_scan":                    "[快速] 仅基于单次工具探测的初步结论，置信度有限，建议进行完整检测",
+	"low_confidence":                "[!] 信号相互矛盾，得分最高的 {winner} 置信度 {confidence:%.2f} 低于阈值 {min:%.2f}，结论改为无法确定",
+	"missing_fields_suspicious":     "[!!] 疑似伪装 Anthropic: {count} 个必有字段缺失 ({fields})",
+	"missing_fields_hint":           "[!!] 中转站可能重写了 tool_id 前缀并注入 service_tier，但无法伪造 inference_geo 和 cache_creation 嵌套对象",
+	"cached_response":               "[!!] 延迟恒定且 msg id 重复，疑似中转返回缓存/预制响应",
+	"stream_faked":                  "[!!] 声明流式但事件一次性到达，疑似中转伪造流式响应",
+	"request_id_anthropic":          "响应头 request-id 为 Anthropic 格式: {request_id}",
+	"request_id_missing":            "[!] 消息 ID 为 Anthropic 格式，但响应缺少 request-id 头，疑似经中转重新封装",
+	"request_id_rewritten":          "[!] 消息 ID 为 Anthropic 格式，但 request-id 被改写: {request_id}",
+	"usage_keys_anthropic":          "usage 键顺序与 Anthropic 官方一致 ({keys:, })",
+	"usage_keys_vertex":             "usage 键顺序与 Vertex AI 一致 ({keys:, })",
+	"usage_keys_bedrock":            "usage 键顺序与 Bedrock InvokeModel 一致 ({keys:, })",
+	"usage_keys_bedrock_converse":   "usage 键顺序与 Bedrock Converse 一致 ({keys:, })",
+	"usage_keys_reconstructed":      "[!] usage 键按字母排序或缺少缓存计数 ({keys:, })，疑似中转重建",
+	"usage_keys_unknown":            "usage 键顺序不匹配已知平台 ({keys:, })",
+	"cache_read_observed":           "重复请求命中 prompt cache (cache_read_input_tokens={tokens})，伪造的响应无法产生缓存读取",
+	"cache_read_missing":            "重复请求未观察到 prompt cache 读取，可能是缓存未命中，不作判定",
+	"vision_supported":              "图片输入被正确识别",
+	"vision_ignored":                "[!] 图片输入被接受但回复未识别图片内容，疑似被忽略",
+	"vision_inconclusive":           "图片探测回复被截断或未给出答案，无法判断图片支持",
+	"vision_rejected_anthropic":     "图片输入被拒绝 (HTTP {status})，错误为官方格式",
+	"vision_rejected":               "[!] 图片输入被拒绝 (HTTP {status})，错误格式非 Anthropic",
+	"vision_mismatch":               "[!!] {model} 应支持图片输入，却以非官方错误拒绝图片，疑似纯文本模型冒充",
+	"all_failed_auth":               "所有探测均被拒绝 (HTTP 401/403, {count} 次)，API Key 无效或无权限",
+	"all_failed_unreachable":        "所有探测均无法连接或超时 ({count} 次)，请检查 Base URL 与网络",
+	"all_failed_html":               "所有探测均失败，上游返回 HTML 错误页 ({kinds:, })，多为中转服务过载或配置错误",
+	"all_failed":                    "所有探测均失败",
+	"budget_exhausted":              "[!] 探测输出 tokens 预算已用尽 ({used}/{budget})，{skipped} 项探测未执行",
+	"versions_rejected":             "[!] 上游不接受 anthropic-version: {versions} (官方 API 支持全部已发布版本)",
+	"ratelimit_static":              "[!!] ratelimit remaining 值固定为 {remaining}，疑似伪造的 ratelimit header",
+	"ratelimit_dynamic":             "[✓] ratelimit remaining 正常递减，真实 Anthropic ratelimit header",
+	"ratelimit_unavailable":         "[i] ratelimit header 不可用，无法进行动态验证",
+	"ratelimit_reset_unparsable":    "[!!] ratelimit reset 不是 RFC3339 时间，疑似伪造的 ratelimit header",
+	"ratelimit_reset_out_of_window": "[!!] ratelimit reset 不在 1 分钟内，疑似伪造的 ratelimit header",
+	"ratelimit_reset_backwards":     "[!!] ratelimit reset 随请求倒退，疑似伪造的 ratelimit header",
+	"ratelimit_reset_static":        "[!!] ratelimit reset 固定不变，疑似伪造的 ratelimit header",
+	"tls_certificate":               "TLS 证书: 签发者 {issuer}，SAN {sans}",
+	"tls_cert_provider":             "TLS 证书由 {provider} 签发",
+	"tls_san_mismatch":              "[!] 判定为 Anthropic 但 TLS 证书 SAN 不含 anthropic.com ({sans})，目标并非官方端点，可能为反向代理",
+}
+
+// UsageIssue is one impossibility in a response's usage object. Code selects the template in
+// usageIssueTemplates and Params holds the token counts shown in it.
+type UsageIssue struct {
+	Code   string         `json:"code"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// usageIssueTemplates renders the usage issues listed by the usage_inconsistent evidence
+var usageIssueTemplates = map[string]string{
+	"not_count":          "{field} 不是非负整数 ({value})",
+	"cache_creation_sum": "cache_creation 明细之和 {sum} ≠ cache_creation_input_tokens {total}",
+	"input_zero":         "输入 tokens 总计为 0",
+	"output_zero":        "返回了 {chars} 字符文本但 output_tokens 为 0",
+	"total_mismatch":     "total_tokens {total} 与各项之和 {sum} 不符",
+}
+
+var evidencePlaceholder = regexp.MustCompile(`\{(\w+)(?::([^}]*))?\}`)
+
+// String renders the item as the legacy (Chinese) evidence line
+func (e EvidenceItem) String() string {
+	return e.Render(DetectLangZh)
+}
+
+// Render renders the item in lang, prefixed with [R<round>] for per-round findings; unknown
+// codes render as the code itself
+func (e EvidenceItem) Render(lang string) string {
+	templates := evidenceTemplates
+	if NormalizeDetectLang(lang) == DetectLangEn {
+		templates = evidenceTemplatesEn
+	}
+	tmpl, ok := templates[e.Code]
+	if !ok {
+		tmpl = e.Code
+	}
+	text := renderTemplate(tmpl, e.Params, lang)
+	if e.Round > 0 {
+		return fmt.Sprintf("[R%d] %s", e.Round, text)
+	}
+	return text
+}
+
+// Render renders the issue in lang; unknown codes render as the code itself
+func (u UsageIssue) Render(lang string) string {
+	templates := usageIssueTemplates
+	if NormalizeDetectLang(lang) == DetectLangEn {
+		templates = usageIssueTemplatesEn
+	}
+	tmpl, ok := templates[u.Code]
+	if !ok {
+		tmpl = u.Code
+	}
+	return renderTemplate(tmpl, u.Params, lang)
+}
+
+// renderTemplate fills the {name} placeholders of tmpl from params
+func renderTemplate(tmpl string, params map[string]any, lang string) string {
+	return evidencePlaceholder.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		m := evidencePlaceholder.FindStringSubmatch(placeholder)
+		return formatEvidenceParam(params[m[1]], m[2], lang)
+	})
+}
+
+// formatEvidenceParam formats one param: spec is a fmt verb when it starts with %, otherwise
+// the separator for []string, []int and []UsageIssue params
+func formatEvidenceParam(v any, spec string, lang string) string {
+	if strings.HasPrefix(spec, "%") {
+		return fmt.Sprintf(spec, v)
+	}
+	if issues, ok := v.([]UsageIssue); ok {
+		list := make([]string, len(issues))
+		for i, issue := range issues {
+			list[i] = issue.Render(lang)
+		}
+		v = list
+	}
+	if ints, ok := v.([]int); ok {
+		list := make([]string, len(ints))
+		for i, n := range ints {
+			list[i] = strconv.Itoa(n)
+		}
+		v = list
+	}
+	if list, ok := v.([]string); ok {
+		if spec == "" {
+			spec = ", "
+		}
+		return strings.Join(list, spec)
+	}
+	return fmt.Sprint(v)
+}
+
+// renderEvidence renders items as evidence lines in lang
+func renderEvidence(items []EvidenceItem, lang string) []string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, item.Render(lang))
+	}
+	return lines
+}
+
+// addEvidence records item together with its rendered line
+func (r *DetectResult) addEvidence(item EvidenceItem) {
+	r.EvidenceItems = append(r.EvidenceItems, item)
+	r.Evidence = append(r.Evidence, item.String())
+}
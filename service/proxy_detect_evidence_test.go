@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvidenceItemString(t *testing.T) {
+	require.Equal(t, "[R2] tool_use id: toolu_01 -> toolu_ (Anthropic)",
+		EvidenceItem{Code: "tool_id_anthropic", Round: 2, Params: map[string]any{"tool_id": "toolu_01"}}.String())
+	require.Equal(t, "[R1] [!] SSE 事件序列异常: message_start → message_stop",
+		EvidenceItem{Code: "stream_order_abnormal", Round: 1, Params: map[string]any{"order": []string{"message_start", "message_stop"}}}.String())
+	require.Equal(t, "[!] 重复探测延迟几乎恒定且极低 (均值 13ms, 方差 0.3)，疑似响应缓存",
+		EvidenceItem{Code: "constant_latency", Params: map[string]any{"mean_ms": 12.6, "variance": 0.26}}.String())
+	require.Equal(t, "[!!] msg id 重复 (msg_a, msg_b)，真 Anthropic 每次请求都会生成新 id",
+		EvidenceItem{Code: "duplicate_msg_id", Params: map[string]any{"msg_ids": []string{"msg_a", "msg_b"}}}.String())
+	require.Equal(t, "some_new_code", EvidenceItem{Code: "some_new_code"}.String())
+}
+
+func TestAnalyzeEvidenceItems(t *testing.T) {
+	result := analyze([]Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}, "claude-test", system_setting.DefaultScoringWeights)
+
+	require.NotEmpty(t, result.EvidenceItems)
+	require.Equal(t, renderEvidence(result.EvidenceItems, DetectLangZh), result.Evidence)
+	require.Equal(t, "tool_id_anthropic", result.EvidenceItems[0].Code)
+	require.Equal(t, system_setting.DefaultScoringWeights.ToolIDAnthropic, result.EvidenceItems[0].Weight)
+	require.Equal(t, 1, result.EvidenceItems[0].Round)
+
+	// evidence stays a list of strings for existing clients
+	var decoded map[string]any
+	require.NoError(t, common.Unmarshal([]byte(common.GetJsonString(result)), &decoded))
+	lines, ok := decoded["evidence"].([]any)
+	require.True(t, ok)
+	require.Equal(t, result.Evidence[0], lines[0])
+	items, ok := decoded["evidence_items"].([]any)
+	require.True(t, ok)
+	require.Len(t, items, len(lines))
+}
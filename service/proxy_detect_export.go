@@ -0,0 +1,60 @@
+package service
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Export formats of a ScanResult
+const (
+	ScanExportJSON = "json"
+	ScanExportCSV  = "csv"
+)
+
+// scanCSVHeader lists the columns of WriteScanResultCSV, one row per model
+var scanCSVHeader = []string{
+	"model", "verdict", "confidence",
+	"anthropic_score", "bedrock_score", "antigravity_score", "gemini_score", "openai_score",
+	"avg_latency_ms", "proxy_platform", "evidence",
+}
+
+// WriteScanResultCSV flattens each model result of scan into a CSV row; the evidence lines
+// are joined with "; " in the language they were rendered in
+func WriteScanResultCSV(w io.Writer, scan ScanResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(scanCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range scan.ModelResults {
+		row := []string{
+			csvText(r.Model),
+			csvText(r.Verdict),
+			strconv.FormatFloat(r.Confidence, 'f', -1, 64),
+			strconv.Itoa(r.Scores["anthropic"]),
+			strconv.Itoa(r.Scores["bedrock"]),
+			strconv.Itoa(r.Scores["antigravity"]),
+			strconv.Itoa(r.Scores["gemini"]),
+			strconv.Itoa(r.Scores["openai"]),
+			strconv.FormatInt(r.AvgLatencyMs, 10),
+			csvText(r.ProxyPlatform),
+			csvText(strings.Join(r.Evidence, "; ")),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText escapes a text cell that a spreadsheet would run as a formula. The model name,
+// platform and evidence echo upstream responses, so a relay could plant "=HYPERLINK(...)".
+// Numeric cells are written as-is since a negative score must stay a number.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
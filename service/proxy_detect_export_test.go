@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteScanResultCSV(t *testing.T) {
+	scan := ScanResult{ModelResults: []DetectResult{
+		{
+			Model:         "claude-sonnet-4-5-20250929",
+			Verdict:       "anthropic",
+			Confidence:    0.92,
+			Scores:        map[string]int{"anthropic": 12, "bedrock": 1},
+			AvgLatencyMs:  830,
+			ProxyPlatform: "OneAPI/NewAPI",
+			Evidence:      []string{"[R1] tool_use id: toolu_01ABC -> toolu_ (Anthropic)", `中转平台: "OneAPI/NewAPI", x`},
+		},
+		{Model: "claude-3-haiku-20240307", Verdict: "unavailable"},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteScanResultCSV(&buf, scan))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, scanCSVHeader, rows[0])
+	require.Equal(t, []string{
+		"claude-sonnet-4-5-20250929", "anthropic", "0.92", "12", "1", "0", "0", "0", "830", "OneAPI/NewAPI",
+		`[R1] tool_use id: toolu_01ABC -> toolu_ (Anthropic); 中转平台: "OneAPI/NewAPI", x`,
+	}, rows[1])
+	require.Equal(t, []string{"claude-3-haiku-20240307", "unavailable", "0", "0", "0", "0", "0", "0", "0", "", ""}, rows[2])
+}
+
+func TestWriteScanResultCSVEscapesFormulas(t *testing.T) {
+	scan := ScanResult{ModelResults: []DetectResult{{
+		Model:         "=HYPERLINK(\"http://evil.example\")",
+		Verdict:       "suspicious",
+		Scores:        map[string]int{"anthropic": -3},
+		ProxyPlatform: "@SUM(A1:A2)",
+		Evidence:      []string{"+1+1", "x"},
+	}, {
+		Model:    "-claude",
+		Evidence: []string{"[R1] ok"},
+	}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteScanResultCSV(&buf, scan))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, `'=HYPERLINK("http://evil.example")`, rows[1][0])
+	require.Equal(t, "suspicious", rows[1][1])
+	require.Equal(t, "-3", rows[1][3])
+	require.Equal(t, "'@SUM(A1:A2)", rows[1][9])
+	require.Equal(t, "'+1+1; x", rows[1][10])
+	require.Equal(t, "'-claude", rows[2][0])
+	require.Equal(t, "[R1] ok", rows[2][10])
+}
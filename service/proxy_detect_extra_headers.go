@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// DetectOptions.ExtraHeaders adds headers (a tenant id, an anthropic-beta flag) that a channel
+// routes on to every probe. They cannot replace the credential and version headers unless
+// DetectOptions.OverrideCoreHeaders says so.
+
+// Limits of DetectOptions.ExtraHeaders
+const (
+	maxExtraHeaders        = 20
+	maxExtraHeaderValueLen = 1024
+)
+
+// coreProbeHeaders are set by newMessagesRequest; extra headers only replace them with
+// OverrideCoreHeaders
+var coreProbeHeaders = []string{"x-api-key", "authorization", "anthropic-version", "content-type"}
+
+// forbiddenProbeHeaders describe the connection or framing and are never taken from the options
+var forbiddenProbeHeaders = []string{
+	"host", "content-length", "transfer-encoding", "connection", "keep-alive", "te", "trailer",
+	"upgrade", "proxy-connection", "proxy-authorization",
+}
+
+// ValidateExtraHeaders checks the names and values of extra probe headers, and that the core
+// headers are only listed when overrideCore is set
+func ValidateExtraHeaders(headers map[string]string, overrideCore bool) error {
+	if len(headers) > maxExtraHeaders {
+		return fmt.Errorf("at most %d extra headers", maxExtraHeaders)
+	}
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		lower := strings.ToLower(name)
+		for _, forbidden := range forbiddenProbeHeaders {
+			if lower == forbidden {
+				return fmt.Errorf("header %s cannot be set", name)
+			}
+		}
+		if !overrideCore {
+			for _, core := range coreProbeHeaders {
+				if lower == core {
+					return fmt.Errorf("header %s overrides a core header, set override_core_headers to allow it", name)
+				}
+			}
+		}
+		if len(value) > maxExtraHeaderValueLen || !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+	}
+	return nil
+}
+
+// setExtraHeaders sets headers on req, replacing any value already there
+func setExtraHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+}
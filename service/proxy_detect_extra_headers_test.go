@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateExtraHeaders(t *testing.T) {
+	require.NoError(t, ValidateExtraHeaders(nil, false))
+	require.NoError(t, ValidateExtraHeaders(map[string]string{"X-Tenant": "acme", "anthropic-beta": "prompt-caching-2024-07-31"}, false))
+	require.Error(t, ValidateExtraHeaders(map[string]string{"X-Bad Name": "v"}, false))
+	require.Error(t, ValidateExtraHeaders(map[string]string{"X-Tenant": "a\r\nb"}, false))
+	require.Error(t, ValidateExtraHeaders(map[string]string{"Host": "example.com"}, true))
+	require.Error(t, ValidateExtraHeaders(map[string]string{"Authorization": "Bearer x"}, false))
+	require.NoError(t, ValidateExtraHeaders(map[string]string{"Authorization": "Bearer x"}, true))
+}
+
+func TestExtraHeadersOnProbes(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	client := newUnsafeHTTPClient(5 * time.Second)
+
+	// Without the override the core headers keep their values
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-real", ExtraHeaders: map[string]string{"X-Tenant": "acme", "x-api-key": "sk-extra"}}
+	require.NoError(t, CheckModelAvailable(context.Background(), client, target, "claude-x"))
+	require.Equal(t, "acme", got.Get("X-Tenant"))
+	require.Equal(t, "sk-real", got.Get("x-api-key"))
+
+	target.OverrideCoreHeaders = true
+	require.NoError(t, CheckModelAvailable(context.Background(), client, target, "claude-x"))
+	require.Equal(t, "sk-extra", got.Get("x-api-key"))
+}
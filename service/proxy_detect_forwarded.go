@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Each relay in front of the upstream may append itself to Via, Forwarded or the
+// X-Forwarded-* headers, and relays that copy upstream response headers pass those entries
+// through. A nested resale chain therefore shows several entries even when every layer
+// scrubs its branded headers.
+
+// Headers that accumulate one entry per relay, in the order they are reported
+var forwardedChainHeaders = []string{"Via", "Forwarded", "X-Forwarded-For", "X-Forwarded-Host"}
+
+// parseForwardedChain returns the relay depth and the entries behind it as
+// "<header>: <entry>". A relay usually appends to several of these headers at once, so the
+// depth is the longest single header rather than the total.
+func parseForwardedChain(headers http.Header) (int, []string) {
+	hops := 0
+	var chain []string
+	for _, name := range forwardedChainHeaders {
+		var entries []string
+		for _, value := range headers.Values(name) {
+			for _, entry := range strings.Split(value, ",") {
+				if entry = forwardedEntry(name, entry); entry != "" {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		hops = max(hops, len(entries))
+		for _, entry := range entries {
+			chain = append(chain, strings.ToLower(name)+": "+entry)
+		}
+	}
+	return hops, chain
+}
+
+// forwardedEntry trims one list element: the comment of a Via entry is dropped and a
+// Forwarded element keeps only its for/by/host pairs
+func forwardedEntry(header, entry string) string {
+	entry = strings.TrimSpace(entry)
+	switch header {
+	case "Via":
+		if i := strings.Index(entry, "("); i >= 0 {
+			entry = strings.TrimSpace(entry[:i])
+		}
+	case "Forwarded":
+		var pairs []string
+		for _, pair := range strings.Split(entry, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "for", "by", "host":
+				pairs = append(pairs, strings.ToLower(key)+"="+strings.Trim(value, `"`))
+			}
+		}
+		entry = strings.Join(pairs, ";")
+	}
+	return entry
+}
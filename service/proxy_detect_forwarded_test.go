@@ -0,0 +1,54 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForwardedChain(t *testing.T) {
+	h := http.Header{}
+	h.Add("Via", "1.1 edge-a (nginx), 1.1 relay-b")
+	h.Add("Via", "2 relay-c")
+	h.Set("Forwarded", `for=10.0.0.1;proto=https;by="relay-a", for=10.0.0.2`)
+	h.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	hops, chain := parseForwardedChain(h)
+	require.Equal(t, 3, hops)
+	require.Equal(t, []string{
+		"via: 1.1 edge-a",
+		"via: 1.1 relay-b",
+		"via: 2 relay-c",
+		"forwarded: for=10.0.0.1;by=relay-a",
+		"forwarded: for=10.0.0.2",
+		"x-forwarded-for: 203.0.113.7",
+		"x-forwarded-for: 10.0.0.1",
+	}, chain)
+
+	hops, chain = parseForwardedChain(http.Header{})
+	require.Zero(t, hops)
+	require.Empty(t, chain)
+
+	_, clues := detectProxyPlatform(h)
+	require.Contains(t, clues, "Relay chain: 3 hops")
+}
+
+func TestAnalyzeProxyChain(t *testing.T) {
+	fp := anthropicFingerprint("tool")
+	fp.ProxyHops = 2
+	fp.ForwardedChain = []string{"via: 1.1 relay-a", "via: 1.1 relay-b"}
+	single := anthropicFingerprint("tool")
+	single.ProxyHops = 1
+
+	result := analyze([]Fingerprint{single, fp}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, 2, result.ProxyHops)
+	require.Equal(t, fp.ForwardedChain, result.ForwardedChain)
+	require.Contains(t, result.Evidence, "[!] 响应经过 2 层转发 (via: 1.1 relay-a; via: 1.1 relay-b)，疑似多级中转转售")
+
+	result = analyze([]Fingerprint{single}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	for _, item := range result.EvidenceItems {
+		require.NotEqual(t, "proxy_chain", item.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// managedGateway is a hosted API management layer recognized by the headers it adds. A
+// header matches by name prefix or by a substring of the named header's value.
+type managedGateway struct {
+	Platform string
+	// Lowercase header name prefixes
+	HeaderPrefixes []string
+	// Lowercase header name -> lowercase substring of its value
+	HeaderValues map[string]string
+}
+
+// managedGateways are matched in order; the first match becomes the ProxyPlatform
+var managedGateways = []managedGateway{
+	{Platform: "Cloudflare AI Gateway", HeaderPrefixes: []string{"cf-aig-"}},
+	{Platform: "Portkey", HeaderPrefixes: []string{"x-portkey-"}},
+	{Platform: "Helicone", HeaderPrefixes: []string{"helicone-"}},
+	{Platform: "LiteLLM", HeaderPrefixes: []string{"x-litellm-"}},
+	{Platform: "Kong", HeaderPrefixes: []string{"x-kong-"}, HeaderValues: map[string]string{"via": "kong"}},
+}
+
+// matchedHeader returns the first (sorted) header of h carrying the gateway's signature
+func (g managedGateway) matchedHeader(h http.Header) string {
+	var matched []string
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		for _, prefix := range g.HeaderPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				matched = append(matched, name)
+			}
+		}
+		if want, ok := g.HeaderValues[lower]; ok && strings.Contains(strings.ToLower(strings.Join(values, ",")), want) {
+			matched = append(matched, name)
+		}
+	}
+	if len(matched) == 0 {
+		return ""
+	}
+	sort.Strings(matched)
+	return matched[0]
+}
+
+// detectManagedGateways returns the first managedGateways entry found in h and one clue per
+// gateway found
+func detectManagedGateways(h http.Header) (string, []string) {
+	platform := ""
+	var clues []string
+	for _, g := range managedGateways {
+		name := g.matchedHeader(h)
+		if name == "" {
+			continue
+		}
+		if platform == "" {
+			platform = g.Platform
+		}
+		clues = append(clues, fmt.Sprintf("%s header: %s", g.Platform, name))
+	}
+	return platform, clues
+}
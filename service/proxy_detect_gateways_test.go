@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectManagedGateways(t *testing.T) {
+	cases := []struct {
+		header, value, platform string
+	}{
+		{"Cf-Aig-Log-Id", "01J", "Cloudflare AI Gateway"},
+		{"X-Portkey-Trace-Id", "t1", "Portkey"},
+		{"Helicone-Id", "h1", "Helicone"},
+		{"X-Litellm-Model-Id", "m1", "LiteLLM"},
+		{"Via", "1.1 kong/3.4.2", "Kong"},
+		{"X-Kong-Upstream-Latency", "12", "Kong"},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		h.Set(c.header, c.value)
+		platform, clues := detectProxyPlatform(h)
+		require.Equal(t, c.platform, platform, c.header)
+		require.Contains(t, clues, c.platform+" header: "+c.header)
+	}
+
+	// A plain via chain is not Kong
+	h := http.Header{}
+	h.Set("Via", "1.1 varnish")
+	platform, _ := detectProxyPlatform(h)
+	require.Empty(t, platform)
+
+	// Stacked layers: the table order decides the platform, every layer leaves a clue
+	h = http.Header{}
+	h.Set("X-Litellm-Model-Id", "m1")
+	h.Set("Cf-Aig-Cache-Status", "MISS")
+	platform, clues := detectProxyPlatform(h)
+	require.Equal(t, "Cloudflare AI Gateway", platform)
+	require.Contains(t, clues, "LiteLLM header: X-Litellm-Model-Id")
+
+	// A branded relay stays the platform
+	h.Set("X-Aidistri-Request-Id", "a1")
+	platform, _ = detectProxyPlatform(h)
+	require.Equal(t, "Aidistri", platform)
+}
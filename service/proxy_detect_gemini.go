@@ -0,0 +1,95 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Proxies that front Gemini's native generateContent endpoint and translate the reply into
+// the Messages shape tend to leak Gemini fields: a usageMetadata object, camelCase
+// promptTokenCount/candidatesTokenCount counters, upper-case finishReason values copied into
+// stop_reason, or no stop_reason at all. These are distinct from Bedrock's camelCase
+// inputTokens/outputTokens usage, so they score their own "gemini" bucket.
+
+// Gemini tells recorded in Fingerprint.GeminiSignals
+const (
+	GeminiSignalUsageMetadata  = "usageMetadata"
+	GeminiSignalTokenCountKeys = "token_count_keys"
+	GeminiSignalFinishReason   = "finish_reason"
+	GeminiSignalNoStopReason   = "no_stop_reason"
+)
+
+// Gemini usage counter keys
+const (
+	geminiPromptTokenCountKey     = "promptTokenCount"
+	geminiCandidatesTokenCountKey = "candidatesTokenCount"
+)
+
+// geminiSignalWeight returns the score a Gemini tell adds to the gemini bucket
+func geminiSignalWeight(w system_setting.ScoringWeights, signal string) int {
+	switch signal {
+	case GeminiSignalUsageMetadata:
+		return w.GeminiUsageMetadata
+	case GeminiSignalTokenCountKeys:
+		return w.GeminiTokenCountKeys
+	case GeminiSignalFinishReason:
+		return w.GeminiFinishReason
+	case GeminiSignalNoStopReason:
+		return w.GeminiNoStopReason
+	}
+	return 0
+}
+
+// Gemini candidate finishReason values
+var geminiFinishReasons = []string{
+	"STOP",
+	"MAX_TOKENS",
+	"SAFETY",
+	"RECITATION",
+	"LANGUAGE",
+	"BLOCKLIST",
+	"PROHIBITED_CONTENT",
+	"SPII",
+	"MALFORMED_FUNCTION_CALL",
+	"OTHER",
+}
+
+// geminiSignals returns the Gemini tells found in a Messages response body. A missing
+// stop_reason only counts next to another tell, since many rewriters drop it on their own.
+func geminiSignals(body map[string]any) []string {
+	var signals []string
+	usageMetadata, hasUsageMetadata := body["usageMetadata"].(map[string]any)
+	if hasUsageMetadata {
+		signals = append(signals, GeminiSignalUsageMetadata)
+	}
+	usage, _ := body["usage"].(map[string]any)
+	for _, counters := range []map[string]any{usageMetadata, usage} {
+		_, hasPrompt := counters[geminiPromptTokenCountKey]
+		_, hasCandidates := counters[geminiCandidatesTokenCountKey]
+		if hasPrompt || hasCandidates {
+			signals = append(signals, GeminiSignalTokenCountKeys)
+			break
+		}
+	}
+	stopReason, _ := body["stop_reason"].(string)
+	finishReason, _ := body["finishReason"].(string)
+	if slices.Contains(geminiFinishReasons, stopReason) || slices.Contains(geminiFinishReasons, finishReason) {
+		signals = append(signals, GeminiSignalFinishReason)
+	}
+	if len(signals) > 0 && stopReason == "" {
+		signals = append(signals, GeminiSignalNoStopReason)
+	}
+	return signals
+}
+
+// geminiOutputTokens reads candidatesTokenCount so budget accounting works on Gemini-shaped usage
+func geminiOutputTokens(body map[string]any) int {
+	for _, key := range []string{"usageMetadata", "usage"} {
+		counters, _ := body[key].(map[string]any)
+		if n, ok := counters[geminiCandidatesTokenCountKey].(float64); ok {
+			return int(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// Gemini generateContent reply translated into the Messages shape: tool_use id rewritten,
+// usageMetadata passed through and finishReason copied instead of stop_reason
+const geminiTranslatedBody = `{
+  "id": "msg_7c1f6a0e9b2d4c3a8e5f1b0d",
+  "type": "message",
+  "role": "assistant",
+  "model": "claude-sonnet-4-5-20250929",
+  "content": [{"type": "tool_use", "id": "call_0", "name": "get_weather", "input": {"city": "Paris"}}],
+  "finishReason": "STOP",
+  "usageMetadata": {"promptTokenCount": 412, "candidatesTokenCount": 18, "totalTokenCount": 430}
+}`
+
+// Bedrock camelCase usage must not read as Gemini
+const bedrockCamelCaseBody = `{
+  "id": "msg_bdrk_01",
+  "type": "message",
+  "role": "assistant",
+  "model": "anthropic.claude-sonnet-4-5-20250929-v1:0",
+  "content": [{"type": "tool_use", "id": "tooluse_AbCdEf0123456789", "name": "get_weather", "input": {"city": "Paris"}}],
+  "stop_reason": "tool_use",
+  "usage": {"inputTokens": 412, "outputTokens": 18}
+}`
+
+func TestGeminiSignals(t *testing.T) {
+	fp := fingerprintFromBody(t, "tool", geminiTranslatedBody)
+	require.Equal(t, []string{
+		GeminiSignalUsageMetadata,
+		GeminiSignalTokenCountKeys,
+		GeminiSignalFinishReason,
+		GeminiSignalNoStopReason,
+	}, fp.GeminiSignals)
+	require.Equal(t, 18, fp.OutputTokens)
+
+	fp = fingerprintFromBody(t, "tool", `{"id": "msg_x", "stop_reason": "MAX_TOKENS", "usage": {"promptTokenCount": 3, "candidatesTokenCount": 5}}`)
+	require.Equal(t, []string{GeminiSignalTokenCountKeys, GeminiSignalFinishReason}, fp.GeminiSignals)
+	require.Equal(t, 5, fp.OutputTokens)
+
+	require.Empty(t, fingerprintFromBody(t, "tool", bedrockCamelCaseBody).GeminiSignals)
+	require.Empty(t, fingerprintFromBody(t, "tool", usageConsistentBody).GeminiSignals)
+	// A missing stop_reason alone is not a Gemini tell
+	require.Empty(t, fingerprintFromBody(t, "tool", `{"id": "msg_x", "usage": {"input_tokens": 3, "output_tokens": 5}}`).GeminiSignals)
+}
+
+func TestAnalyzeGeminiVerdict(t *testing.T) {
+	gemini := fingerprintFromBody(t, "tool", geminiTranslatedBody)
+	result := analyze([]Fingerprint{gemini, gemini}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "gemini", result.Verdict)
+	require.Equal(t, verdictTextMap["gemini"], result.VerdictText)
+	require.Equal(t, 22, result.Scores["gemini"])
+	require.Zero(t, result.Scores["bedrock"])
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "[R1] [!!] 响应含 Gemini 原生字段: usageMetadata")
+	require.True(t, computeDetectBadges(result).IsProxied)
+
+	bedrock := fingerprintFromBody(t, "tool", bedrockCamelCaseBody)
+	result = analyze([]Fingerprint{bedrock, bedrock}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "bedrock", result.Verdict)
+	require.Zero(t, result.Scores["gemini"])
+
+	result = analyze([]Fingerprint{anthropicFingerprint("tool")}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "anthropic", result.Verdict)
+	require.Contains(t, result.Scores, "gemini")
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The header_case probe compares the wire casing of Anthropic's response header names.
+// net/http canonicalizes names while parsing (anthropic-ratelimit-... becomes
+// Anthropic-Ratelimit-...), so the casing is only visible below the http.Client: the probe
+// client records the raw response head straight off the connection. HTTP/2 always sends
+// lowercase names, so the probe forces HTTP/1.1. Genuine Anthropic emits lowercase names,
+// while proxies that re-emit headers through a canonicalizing stack send Title-Case.
+
+// Header casing classes recorded in Fingerprint.HeaderCase
+const (
+	HeaderCaseLowercase = "lowercase"
+	HeaderCaseCanonical = "canonical"
+	HeaderCaseMixed     = "mixed"
+)
+
+// Raw response head bytes kept per connection
+const maxRawHeaderBytes = 64 << 10
+
+// rawHeaderRecorder keeps the response head of the most recent connection
+type rawHeaderRecorder struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done bool
+}
+
+func (r *rawHeaderRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf.Reset()
+	r.done = false
+}
+
+func (r *rawHeaderRecorder) record(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.buf.Write(p[:min(len(p), maxRawHeaderBytes-r.buf.Len())])
+	if r.buf.Len() >= maxRawHeaderBytes || bytes.Contains(r.buf.Bytes(), []byte("\r\n\r\n")) {
+		r.done = true
+	}
+}
+
+// headerNames returns the header names of the recorded response head in wire casing
+func (r *rawHeaderRecorder) headerNames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	head, _, _ := bytes.Cut(r.buf.Bytes(), []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "HTTP/1.") {
+		return nil
+	}
+	var names []string
+	for _, line := range lines[1:] {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if name, _, ok := strings.Cut(line, ":"); ok {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	return names
+}
+
+// headerCaseConn copies everything read from the connection into the recorder
+type headerCaseConn struct {
+	net.Conn
+	rec *rawHeaderRecorder
+}
+
+func (c *headerCaseConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.rec.record(p[:n])
+	}
+	return n, err
+}
+
+// newHeaderCaseClient creates an HTTP/1.1-only client without keep-alive whose recorder
+// holds the raw response head of the last request. checkIP applies the SSRF-safe dialer.
+func newHeaderCaseClient(timeout time.Duration, checkIP bool) (*http.Client, *rawHeaderRecorder) {
+	rec := &rawHeaderRecorder{}
+	dial := (&net.Dialer{Timeout: 10 * time.Second}).DialContext
+	if checkIP {
+		dial = safeDialer()
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			rec.reset()
+			return &headerCaseConn{Conn: conn, rec: rec}, nil
+		},
+		// TLS is done here so the recorder sees plaintext; ALPN pins HTTP/1.1
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: host, NextProtos: []string{"http/1.1"}})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			rec.reset()
+			return &headerCaseConn{Conn: tlsConn, rec: rec}, nil
+		},
+		DisableKeepAlives: true,
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: probeRedirectPolicy(checkIP),
+	}, rec
+}
+
+// classifyHeaderCase classifies the casing of the anthropic-* and request-id header names;
+// empty when none of them were captured (e.g. the upstream answered over HTTP/2)
+func classifyHeaderCase(names []string) string {
+	lower, canonical, total := 0, 0, 0
+	for _, name := range names {
+		lowered := strings.ToLower(name)
+		if !strings.HasPrefix(lowered, "anthropic-") && lowered != "request-id" {
+			continue
+		}
+		total++
+		if name == lowered {
+			lower++
+		} else if name == http.CanonicalHeaderKey(name) {
+			canonical++
+		}
+	}
+	switch {
+	case total == 0:
+		return ""
+	case lower == total:
+		return HeaderCaseLowercase
+	case canonical == total:
+		return HeaderCaseCanonical
+	default:
+		return HeaderCaseMixed
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// headerCaseUpstream sends the Anthropic headers with exactly the given wire names
+func headerCaseUpstream(t *testing.T, names ...string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range names {
+			// Direct map assignment bypasses canonicalization, so the name goes out as written
+			w.Header()[name] = []string{"1"}
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHeaderCaseProbe(t *testing.T) {
+	cases := []struct {
+		name  string
+		names []string
+		want  string
+	}{
+		{"genuine lowercase", []string{"anthropic-ratelimit-requests-limit", "request-id"}, HeaderCaseLowercase},
+		{"re-emitted title case", []string{"Anthropic-Ratelimit-Requests-Limit", "Request-Id"}, HeaderCaseCanonical},
+		{"mixed", []string{"anthropic-ratelimit-requests-limit", "Request-Id"}, HeaderCaseMixed},
+		{"no anthropic headers", []string{"X-Other"}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := headerCaseUpstream(t, tc.names...)
+			client, rec := newHeaderCaseClient(5*time.Second, false)
+			target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+
+			fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "header_case")
+			require.Empty(t, fp.Error)
+			names := rec.headerNames()
+			for _, name := range tc.names {
+				require.Contains(t, names, name)
+			}
+			require.Equal(t, tc.want, classifyHeaderCase(names))
+		})
+	}
+}
+
+func TestRawHeaderRecorder(t *testing.T) {
+	rec := &rawHeaderRecorder{}
+	rec.record([]byte("HTTP/1.1 200 OK\r\nanthropic-organization-id: org\r\n"))
+	rec.record([]byte(" folded\r\nContent-Type: application/json\r\n\r\n{\"x-fake\": 1}"))
+	rec.record([]byte("HTTP/1.1 200 OK\r\nIgnored: yes\r\n\r\n"))
+	require.Equal(t, []string{"anthropic-organization-id", "Content-Type"}, rec.headerNames())
+
+	rec.reset()
+	rec.record([]byte("not a response"))
+	require.Nil(t, rec.headerNames())
+}
+
+func TestAnalyzeHeaderCase(t *testing.T) {
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("thinking")}
+	lower := anthropicFingerprint("header_case")
+	lower.HeaderCase = HeaderCaseLowercase
+	recased := anthropicFingerprint("header_case")
+	recased.HeaderCase = HeaderCaseCanonical
+
+	base := analyze(append(fps, lower), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	result := analyze(append(fps, recased), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, base.Scores["anthropic"]-1, result.Scores["anthropic"])
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "响应头名称大小写为 canonical")
+}
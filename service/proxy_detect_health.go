@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Overall timeout for an account health report (model list + detection + ratelimit check)
+const accountHealthTimeout = 180 * time.Second
+
+// AccountHealthOptions selects which sub-steps an account health report runs
+type AccountHealthOptions struct {
+	DetectOptions
+	// Model to probe; empty = first working model from FindWorkingModel
+	Model            string
+	IncludeDetect    bool
+	IncludeRatelimit bool
+	IncludeModels    bool
+}
+
+// AccountHealthReport is a holistic view of one base URL + key
+type AccountHealthReport struct {
+	BaseURL     string  `json:"base_url"`
+	TraceID     string  `json:"trace_id"`
+	Model       string  `json:"model"`
+	Verdict     string  `json:"verdict,omitempty"`
+	VerdictText string  `json:"verdict_text,omitempty"`
+	Confidence  float64 `json:"confidence,omitempty"`
+	// anthropic-ratelimit-input-tokens-limit, the account's rate-limit tier indicator
+	RatelimitInputLimit int                    `json:"ratelimit_input_limit,omitempty"`
+	Ratelimit           *RatelimitVerification `json:"ratelimit,omitempty"`
+	Models              []string               `json:"models,omitempty"`
+	ModelsError         string                 `json:"models_error,omitempty"`
+	Latency             *LatencyStats          `json:"latency,omitempty"`
+	Detect              *DetectResult          `json:"detect,omitempty"`
+}
+
+// BuildAccountHealthReport composes model listing, detection and ratelimit verification
+// into one report, all bounded by accountHealthTimeout
+func BuildAccountHealthReport(baseURL, apiKey string, opts AccountHealthOptions) AccountHealthReport {
+	opts.TraceID = normalizeTraceID(opts.TraceID)
+	if opts.AnthropicVersion == "" {
+		opts.AnthropicVersion = defaultAnthropicVersion
+	}
+	ctx, cancel := context.WithTimeout(withTraceID(context.Background(), opts.TraceID), accountHealthTimeout)
+	defer cancel()
+
+	report := AccountHealthReport{
+		BaseURL: baseURL,
+		TraceID: opts.TraceID,
+		Model:   opts.Model,
+	}
+
+	probeTimeout := system_setting.GetProxyDetectSetting().Timeouts.Probe()
+	var client *http.Client
+	if opts.SkipSSRFCheck {
+		client = newUnsafeHTTPClient(probeTimeout)
+	} else {
+		client = newSafeHTTPClient(probeTimeout)
+	}
+	target := ProbeTarget{BaseURL: baseURL, APIKey: apiKey, AnthropicVersion: opts.AnthropicVersion, MessagesPath: opts.MessagesPath,
+		ExtraHeaders: opts.ExtraHeaders, OverrideCoreHeaders: opts.OverrideCoreHeaders}
+
+	if opts.IncludeModels {
+		models, err := fetchRemoteModels(ctx, baseURL, apiKey, opts.SkipSSRFCheck, ModelFilter{})
+		if err != nil {
+			report.ModelsError = err.Error()
+		} else {
+			report.Models = models
+		}
+	}
+
+	if !opts.IncludeDetect && !opts.IncludeRatelimit {
+		return report
+	}
+	if report.Model == "" && ctx.Err() == nil {
+		report.Model = FindWorkingModel(ctx, client, target)
+	}
+
+	if opts.IncludeDetect && ctx.Err() == nil {
+		detectOpts := opts.DetectOptions
+		detectOpts.VerifyRatelimit = opts.IncludeRatelimit
+		result := detectSingleModel(ctx, baseURL, apiKey, report.Model, detectOpts)
+		report.Detect = &result
+		report.Verdict = result.Verdict
+		report.VerdictText = result.VerdictText
+		report.Confidence = result.Confidence
+		report.Ratelimit = result.RatelimitVerify
+		report.Latency = computeLatencyStats(result.Fingerprints)
+		for _, fp := range result.Fingerprints {
+			if fp.RatelimitInputLimit > 0 {
+				report.RatelimitInputLimit = fp.RatelimitInputLimit
+				break
+			}
+		}
+	} else if opts.IncludeRatelimit && ctx.Err() == nil {
+		report.Ratelimit = verifyRatelimitDynamic(ctx, client, target, report.Model, 4, nil)
+	}
+
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect health report finished: model=%s verdict=%s", report.Model, report.Verdict))
+	return report
+}
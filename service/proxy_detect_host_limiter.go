@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum spacing between background probe requests to the same upstream host
+const proxyDetectHostMinInterval = 1 * time.Second
+
+// hostLimiter spaces out requests per host. It is shared by background probe
+// jobs so they never burst against one upstream.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+var proxyDetectHostLimiter = newHostLimiter(proxyDetectHostMinInterval)
+
+// Wait blocks until the host's next slot or ctx is done
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limiterHostKey returns the lowercase host of baseURL, or baseURL itself if unparsable
+func limiterHostKey(baseURL string) string {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(baseURL)
+	}
+	return strings.ToLower(parsed.Host)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// A misconfigured or overloaded proxy answers with the HTML error page of whatever sits in
+// front of it instead of a JSON body. Naming that layer tells a proxy that is merely down
+// (nginx 504, Cloudflare 502) apart from one that fakes the API.
+
+// Max body bytes read to classify an HTML error page
+const maxHTMLErrorBodyBytes = 4 << 10
+
+// Bytes of an error body kept in Fingerprint.Error
+const errorSnippetBytes = 200
+
+// Kinds recorded in Fingerprint.ErrorKind
+const (
+	ErrorKindCloudflareChallenge = "cloudflare_challenge"
+	ErrorKindCloudflare          = "cloudflare"
+	ErrorKindNginx               = "nginx"
+	ErrorKindApache              = "apache"
+	ErrorKindGateway             = "gateway"
+)
+
+// Short labels appended to Fingerprint.Error, by ErrorKind
+var errorKindLabels = map[string]string{
+	ErrorKindCloudflareChallenge: "Cloudflare challenge page",
+	ErrorKindCloudflare:          "Cloudflare error page",
+	ErrorKindNginx:               "nginx error page",
+	ErrorKindApache:              "Apache error page",
+	ErrorKindGateway:             "HTML gateway error page",
+}
+
+// Body markers of a Cloudflare browser challenge
+var cloudflareChallengeMarkers = []string{"just a moment...", "cf-chl", "challenge-platform", "cf_chl_opt"}
+
+// classifyHTMLError returns the ErrorKind of an HTML error page, or "" when the response is
+// not HTML (judged by Content-Type or a leading '<')
+func classifyHTMLError(header http.Header, body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	isHTML := strings.Contains(strings.ToLower(header.Get("Content-Type")), "text/html") ||
+		(len(trimmed) > 0 && trimmed[0] == '<')
+	if !isHTML {
+		return ""
+	}
+
+	lower := strings.ToLower(string(body))
+	server := strings.ToLower(header.Get("Server"))
+	cloudflare := server == "cloudflare" || header.Get("Cf-Ray") != "" || strings.Contains(lower, "cloudflare")
+	if header.Get("Cf-Mitigated") == "challenge" {
+		return ErrorKindCloudflareChallenge
+	}
+	if cloudflare {
+		for _, marker := range cloudflareChallengeMarkers {
+			if strings.Contains(lower, marker) {
+				return ErrorKindCloudflareChallenge
+			}
+		}
+		return ErrorKindCloudflare
+	}
+	switch {
+	case strings.HasPrefix(server, "nginx") || strings.HasPrefix(server, "openresty") ||
+		strings.Contains(lower, "<center>nginx") || strings.Contains(lower, "<center>openresty"):
+		return ErrorKindNginx
+	case strings.HasPrefix(server, "apache") || strings.Contains(lower, "<address>apache"):
+		return ErrorKindApache
+	}
+	return ErrorKindGateway
+}
+
+// readErrorBody reads a failed response for classification and returns its head along with
+// the HTML ErrorKind ("" when not HTML); Fingerprint.Error keeps truncateErrorSnippet of it
+func readErrorBody(resp *http.Response) (body []byte, kind string) {
+	body, _ = io.ReadAll(io.LimitReader(resp.Body, maxHTMLErrorBodyBytes))
+	return body, classifyHTMLError(resp.Header, body)
+}
+
+// truncateErrorSnippet keeps the first errorSnippetBytes bytes of body
+func truncateErrorSnippet(body []byte) []byte {
+	if len(body) > errorSnippetBytes {
+		return body[:errorSnippetBytes]
+	}
+	return body
+}
+
+// describeErrorKind appends the label of kind to msg, e.g. "HTTP 502 (nginx error page)"
+func describeErrorKind(msg, kind string) string {
+	if label := errorKindLabels[kind]; label != "" {
+		return msg + " (" + label + ")"
+	}
+	return msg
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	nginx504Page      = "<html>\r\n<head><title>504 Gateway Time-out</title></head>\r\n<body>\r\n<center><h1>504 Gateway Time-out</h1></center>\r\n<hr><center>nginx/1.24.0</center>\r\n</body>\r\n</html>\r\n"
+	apache502Page     = `<!DOCTYPE HTML PUBLIC "-//IETF//DTD HTML 2.0//EN"><html><head><title>502 Proxy Error</title></head><body><h1>Proxy Error</h1><hr><address>Apache/2.4.57 (Debian) Server at example.com Port 443</address></body></html>`
+	cloudflare502Page = `<!DOCTYPE html><html><head><title>example.com | 502: Bad gateway</title></head><body><div id="cf-error-details">Bad gateway <span>Cloudflare</span></div></body></html>`
+	challengePage     = `<!DOCTYPE html><html lang="en-US"><head><title>Just a moment...</title></head><body><script src="/cdn-cgi/challenge-platform/h/b/orchestrate/chl_page/v1"></script></body></html>`
+)
+
+func TestClassifyHTMLError(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	cases := []struct {
+		header http.Header
+		body   string
+		kind   string
+	}{
+		{http.Header{}, nginx504Page, ErrorKindNginx},
+		{http.Header{"Server": {"openresty"}}, "<html><body>502</body></html>", ErrorKindNginx},
+		{http.Header{}, apache502Page, ErrorKindApache},
+		{http.Header{"Server": {"cloudflare"}, "Cf-Ray": {"8a1b2c3d4e5f-LAX"}}, cloudflare502Page, ErrorKindCloudflare},
+		{http.Header{"Server": {"cloudflare"}}, challengePage, ErrorKindCloudflareChallenge},
+		{http.Header{"Cf-Mitigated": {"challenge"}, "Content-Type": {"text/html"}}, "", ErrorKindCloudflareChallenge},
+		{html, "Service Unavailable", ErrorKindGateway},
+		{http.Header{}, `{"type":"error","error":{"type":"overloaded_error"}}`, ""},
+		{http.Header{"Content-Type": {"text/plain"}}, "upstream connect error", ""},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.kind, classifyHTMLError(tc.header, []byte(tc.body)), tc.body)
+	}
+}
+
+func TestProbeHTMLErrorPage(t *testing.T) {
+	status := http.StatusGatewayTimeout
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Server", "nginx/1.24.0")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(nginx504Page + strings.Repeat("<!-- padding -->", 20)))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, ErrorKindNginx, fp.ErrorKind)
+	require.Equal(t, ProbeErrorHTTP, fp.ErrorClass)
+	require.True(t, strings.HasPrefix(fp.Error, "HTTP 504 (nginx error page): <html>"), fp.Error)
+	require.Len(t, strings.TrimPrefix(fp.Error, "HTTP 504 (nginx error page): "), errorSnippetBytes)
+
+	// An HTML page served with 200 is not a JSON body either
+	status = http.StatusOK
+	fp = probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, ErrorKindNginx, fp.ErrorKind)
+	require.Equal(t, ProbeErrorParse, fp.ErrorClass)
+	require.True(t, strings.HasPrefix(fp.Error, "response body not JSON (nginx error page): <html>"), fp.Error)
+
+	result := analyze([]Fingerprint{fp, fp}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "unknown", result.Verdict)
+	require.True(t, hasEvidence(result, "上游返回 HTML 错误页 (nginx)"))
+}
@@ -0,0 +1,211 @@
+package service
+
+import "strings"
+
+// Languages of the verdict text and evidence lines; the structured fields are language-neutral
+const (
+	DetectLangZh = "zh"
+	DetectLangEn = "en"
+)
+
+// NormalizeDetectLang maps lang to DetectLangZh or DetectLangEn; anything other than an
+// English tag (en, en-US, ...) falls back to Chinese
+func NormalizeDetectLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == DetectLangEn || strings.HasPrefix(lang, DetectLangEn+"-") || strings.HasPrefix(lang, DetectLangEn+"_") {
+		return DetectLangEn
+	}
+	return DetectLangZh
+}
+
+var verdictTextMapEn = map[string]string{
+	"anthropic":   "Anthropic official API",
+	"bedrock":     "AWS Bedrock (Kiro)",
+	"antigravity": "Google Vertex AI (Antigravity)",
+	"gemini":      "Google Gemini (native API translated)",
+	"suspicious":  "Suspected fake Anthropic",
+	"proxy":       "Confirmed proxy platform",
+	"unknown":     "Undetermined",
+	"invalid_key": "Invalid API key",
+	"unreachable": "Upstream unreachable",
+	"timeout":     "Detection timed out",
+	"unavailable": "Unavailable",
+
+	"budget_exhausted": "Probe budget exhausted",
+
+	"openai_translation": "OpenAI format translation",
+	"backend_llm":        "Non-Claude model impersonating Claude",
+}
+
+// verdictText returns the display text of verdict in lang, the verdict itself if unmapped
+func verdictText(verdict, lang string) string {
+	texts := verdictTextMap
+	if NormalizeDetectLang(lang) == DetectLangEn {
+		texts = verdictTextMapEn
+	}
+	if text, ok := texts[verdict]; ok {
+		return text
+	}
+	return verdict
+}
+
+// localize re-renders the verdict text and evidence lines in lang; results are built in
+// Chinese, so this is a no-op for DetectLangZh
+func (r *DetectResult) localize(lang string) {
+	if NormalizeDetectLang(lang) == DetectLangZh {
+		return
+	}
+	r.VerdictText = verdictText(r.Verdict, lang)
+	if len(r.EvidenceItems) > 0 {
+		r.Evidence = renderEvidence(r.EvidenceItems, lang)
+	}
+}
+
+// localize renders every model result and the scan-wide verdict in lang
+func (s *ScanResult) localize(lang string) {
+	for i := range s.ModelResults {
+		s.ModelResults[i].localize(lang)
+	}
+	if s.Verdict != "" {
+		s.VerdictText = verdictText(s.Verdict, lang)
+	}
+}
+
+var usageIssueTemplatesEn = map[string]string{
+	"not_count":          "{field} is not a non-negative integer ({value})",
+	"cache_creation_sum": "cache_creation breakdown sums to {sum} ≠ cache_creation_input_tokens {total}",
+	"input_zero":         "total input tokens are 0",
+	"output_zero":        "{chars} chars of text returned but output_tokens is 0",
+	"total_mismatch":     "total_tokens {total} does not match the sum of the parts {sum}",
+}
+
+var evidenceTemplatesEn = map[string]string{
+	// per-round findings
+	"tool_id_bedrock":                 "tool_use id: {tool_id} -> tooluse_ (Bedrock/AG)",
+	"tool_id_anthropic":               "tool_use id: {tool_id} -> toolu_ (Anthropic)",
+	"tool_id_vertex":                  "tool_use id: {tool_id} -> tool_N (Vertex AI)",
+	"tool_id_rewritten":               "tool_use id: {tool_id} -> rewritten",
+	"thinking_sig_short":              "thinking sig: (len={length}) -> truncated signature",
+	"thinking_sig_vertex":             "thinking sig: (len={length}) -> claude# prefix (Vertex AI)",
+	"thinking_sig_normal":             "thinking sig: (len={length}) -> normal signature",
+	"thinking_sig_none":               "thinking sig: no signature",
+	"msg_id_anthropic":                "message id: {msg_id} -> msg_<base62> (Anthropic)",
+	"msg_id_uuid":                     "message id: {msg_id} -> msg_<UUID> (not native)",
+	"msg_id_vertex":                   "message id: {msg_id} -> req_vrtx_ (Vertex AI)",
+	"msg_id_rewritten":                "message id: {msg_id} -> rewritten",
+	"model_kiro":                      "model: {model} -> kiro-* (conclusive Kiro reverse proxy)",
+	"model_bedrock":                   "model: {model} -> anthropic.* (Bedrock)",
+	"service_tier":                    "service_tier: {service_tier} -> Anthropic only",
+	"inference_geo":                   "inference_geo: {inference_geo} -> Anthropic only",
+	"cache_creation":                  "cache_creation: nested object -> new Anthropic format",
+	"usage_camel_case":                "usage: camelCase (Bedrock)",
+	"aws_headers":                     "AWS headers detected",
+	"anthropic_headers":               "Anthropic rate-limit headers detected",
+	"stream_not_sse":                  "[!!] stream:true requested but a non-streaming JSON body was returned; the proxy dropped the stream parameter",
+	"stream_canonical":                "SSE event sequence matches the official format (with ping)",
+	"stream_canonical_no_ping":        "SSE event sequence matches the official format, but the ping event is missing",
+	"stream_order_abnormal":           "[!] Abnormal SSE event sequence: {order: → }",
+	"stream_blob":                     "[!!] All stream events arrived at once ({events} events); the proxy likely faked the stream from a complete response",
+	"stream_buffered":                 "[!] Stream looks buffered: TTFT {ttft_ms}ms / total {total_ms}ms; the proxy may wait for the full response before forwarding",
+	"stream_timing":                   "stream: TTFT {ttft_ms}ms / total {total_ms}ms ({events} events)",
+	"max_tokens_capped":               "[!!] max_tokens capped: requested {requested}, stopped with max_tokens after {output_tokens} tokens",
+	"max_tokens_ok":                   "max_tokens: {output_tokens} tokens output (stop_reason={stop_reason}), no cap found",
+	"system_honored":                  "system parameter honored",
+	"system_ignored":                  "[!] system parameter ignored: the reply did not follow the system instruction; the proxy likely dropped the system field",
+	"tool_use_missing":                "[!!] tool_choice forces a tool but no tool_use block was returned; the proxy likely merged or rewrote content blocks (content=[{content}])",
+	"thinking_block_missing":          "[!] thinking enabled but no thinking block was returned; the proxy likely dropped the thinking content (content=[{content}])",
+	"thinking_block_reordered":        "[!] thinking block is not first; content blocks were reordered (content=[{content}])",
+	"usage_inconsistent":              "[!!] usage numbers are inconsistent: {issues:; }",
+	"usage_injected":                  "[!] usage contains unofficial fields: {fields}",
+	"stop_reason_openai":              "[!!] stop_reason is an OpenAI value: {stop_reason}; the backend is an OpenAI-compatible API behind format conversion",
+	"stop_reason_gemini":              "[!!] stop_reason is a Gemini finishReason value: {stop_reason}; the backend is Gemini behind format conversion",
+	"tool_stop_reason_mismatch":       "[!] The tool probe forces a tool call, yet stop_reason is {stop_reason} instead of tool_use",
+	"stop_reason_nonstandard":         "[!!] stop_reason is not an Anthropic value: {stop_reason}; likely OpenAI format conversion or a custom backend",
+	"stop_sequences_honored":          "stop_sequences honored (stop_reason=stop_sequence)",
+	"stop_sequence_leaked":            "[!!] stop_sequences ignored: the stop sequence appears in the output (stop_reason={stop_reason}); the proxy dropped the request parameter",
+	"stop_sequences_inconclusive":     "stop_sequences: the model did not output the stop sequence (stop_reason={stop_reason}), inconclusive",
+	"header_case_lowercase":           "Response header names are lowercase, same as official",
+	"header_case_recased":             "[!] Response header names are {header_case}, official ones are all lowercase; the proxy likely rewrote the headers",
+	"gemini_fields":                   "[!!] Response contains Gemini native fields: {signals} (translated Gemini generateContent)",
+	"stream_fixed_length":             "[!] Stream response has a fixed Content-Length (Content-Encoding: {content_encoding}); the proxy likely buffered the full response before forwarding",
+	"version_error_anthropic":         "Invalid anthropic-version ({version}) returned the official invalid_request_error",
+	"version_error_rewritten":         "[!] Error for invalid anthropic-version ({version}) is not in the official format; the proxy likely rewrote the error",
+	"version_accepted":                "[!!] Upstream accepted an invalid anthropic-version ({version}); the proxy dropped or overwrote the header",
+	"service_tier_unknown":            "[!] service_tier: {service_tier} is not an official value (standard/priority/batch); likely injected by the proxy",
+	"service_tier_rejected_anthropic": "Requesting service_tier={requested} returned the official invalid_request_error",
+	"service_tier_rejected_rewritten": "[!] Error for service_tier={requested} is not in the official format; the proxy likely rewrote the error",
+	"service_tier_accepted":           "[!!] Upstream accepted service_tier={requested}, which the official API rejects (reported {observed}); the proxy dropped or faked the field",
+	"chat_completions_openai":         "[!!] /v1/messages does not exist and chat/completions returned a native OpenAI response (id={id}, system_fingerprint={system_fingerprint}, model={model}); the upstream is not Claude",
+	"chat_completions_translated":     "[!!] /v1/messages does not exist and the chat/completions response came from a translation layer (id={id}, model={model}); the channel is relayed in OpenAI format",
+	"retry_after_honored":             "Retry succeeded after waiting the advertised Retry-After ({retries} retries), rate limiting matches the official API",
+	"auth_x_api_key_only":             "Only x-api-key auth is accepted and Bearer is rejected, same as official",
+	"auth_both":                       "[!!] Both x-api-key and Authorization: Bearer auth are accepted; the official /v1/messages does not take Bearer, likely a translation layer",
+	"auth_bearer_only":                "[!!] Only Authorization: Bearer auth is accepted and x-api-key is rejected; an OpenAI-style translation layer",
+
+	// findings across rounds
+	"proxy_platform":                "Proxy platform: {platform}",
+	"backend_llm":                   "[!!] The channel is backed by {family}, not Claude: {source} of the {probe} probe contains \"{match}\"",
+	"proxy_chain":                   "[!] Response passed through {hops} relays ({chain:; }); likely a nested resale chain",
+	"http1_only":                    "[!] TLS probes only negotiated HTTP/1.1 ({total} times) while the official API serves HTTP/2; possibly a homemade proxy (CDNs vary, for reference only)",
+	"clock_skew":                    "[!] The upstream Date header is {skew_s}s off the local clock; an unsynchronized clock suggests a self-hosted relay (a skewed local clock causes this too, for reference only)",
+	"thinking_sig_truncated":        "[!] The thinking signature lengths ({lengths}) all sit just under {bound}: likely cut to a fixed size",
+	"thinking_sig_constant_len":     "[!] All {count} thinking signatures are {length} chars long; genuine signatures vary with the content, likely a constant signature",
+	"thinking_sig_out_of_range":     "[!] Thinking signature length {length} is outside the expected {min}-{max}",
+	"http2_negotiated":              "TLS probes negotiated HTTP/2 ({total} times)",
+	"overloaded_anthropic":          "HTTP 529 overloaded_error matches the official format exactly ({count} times); fakes rarely replicate it",
+	"overloaded_rewritten":          "[!] Got HTTP 529 ({count} times) but the error body does not match the official overloaded_error format",
+	"latency_uniform":               "[!] {count} probes took almost the same time ({min}-{max}ms); responses may be cached or replayed",
+	"reserialized_body":             "[!] Non-streaming responses are all uncompressed with a fixed Content-Length ({reserialized}/{total}); the proxy likely decompressed and re-serialized them",
+	"inference_geo_mixed":           "[!] inference_geo differs across rounds ({geos}); likely a cross-region key pool or injected random values",
+	"tooluse_reattributed":          "[fix] tooluse_ score {points} moved from Bedrock to Antigravity",
+	"msg_uuid_kiro":                 "[fix] msg_<UUID> x{count} attributed to Kiro proxy rewriting (not Antigravity)",
+	"missing_inference_geo":         "[missing] inference_geo absent (always present on official Anthropic)",
+	"missing_cache_creation":        "[missing] cache_creation nested object absent",
+	"missing_thinking_sig":          "[missing] thinking signature empty (real Anthropic thinking rounds carry a 200+ char signature)",
+	"constant_latency":              "[!] Repeated probe latency is nearly constant and very low (mean {mean_ms:%.0f}ms, variance {variance:%.1f}); responses are likely cached",
+	"duplicate_msg_id":              "[!!] Duplicate msg id ({msg_ids}); real Anthropic generates a new id for every request",
+	"duplicate_tool_id":             "[!!] Duplicate tool_use id across rounds ({tool_ids}); a real backend generates a new id for every call, so responses are likely cached or replayed",
+	"inconsistent_backend":          "[!!] The echoed model differs between rounds (model: {models}; source: {sources}); requests are likely spread over several resold backends",
+	"disqualifying_platform":        "[!!] Disqualifying proxy platform {platform} detected, judged as proxy",
+	"missing_fields_offset":         "[!] Positive score cancelled out by missing-field penalties; highly suspected fake Anthropic",
+	"no_signal":                     "No usable fingerprint signal collected",
+	"quick_scan":                    "[Quick] Provisional verdict from a single tool probe with limited confidence, run a full detection to confirm",
+	"low_confidence":                "[!] Conflicting signals: top bucket {winner} has confidence {confidence:%.2f}, below the {min:%.2f} threshold, verdict set to undetermined",
+	"missing_fields_suspicious":     "[!!] Suspected fake Anthropic: {count} required fields missing ({fields})",
+	"missing_fields_hint":           "[!!] The proxy may rewrite the tool_id prefix and inject service_tier, but cannot forge inference_geo or the cache_creation nested object",
+	"cached_response":               "[!!] Constant latency and duplicate msg ids; the proxy likely returns cached or canned responses",
+	"request_id_anthropic":          "request-id response header has Anthropic format: {request_id}",
+	"request_id_missing":            "[!] Message id has Anthropic format but the reply lacks a request-id header; likely re-wrapped by a proxy",
+	"request_id_rewritten":          "[!] Message id has Anthropic format but request-id was rewritten: {request_id}",
+	"usage_keys_anthropic":          "usage key order matches official Anthropic ({keys:, })",
+	"usage_keys_vertex":             "usage key order matches Vertex AI ({keys:, })",
+	"usage_keys_bedrock":            "usage key order matches Bedrock InvokeModel ({keys:, })",
+	"usage_keys_bedrock_converse":   "usage key order matches Bedrock Converse ({keys:, })",
+	"usage_keys_reconstructed":      "[!] usage keys alphabetized or missing the cache counters ({keys:, }), likely rebuilt by a proxy",
+	"usage_keys_unknown":            "usage key order matches no known platform ({keys:, })",
+	"cache_read_observed":           "Repeated request hit the prompt cache (cache_read_input_tokens={tokens}), which a forged reply cannot produce",
+	"cache_read_missing":            "No prompt cache read on the repeated request, possibly a cache miss, not scored",
+	"vision_supported":              "Image input recognized correctly",
+	"vision_ignored":                "[!] Image input accepted but the reply did not recognize it, likely ignored",
+	"vision_inconclusive":           "Vision probe reply truncated or unanswered, image support undetermined",
+	"vision_rejected_anthropic":     "Image input rejected (HTTP {status}) with the official error format",
+	"vision_rejected":               "[!] Image input rejected (HTTP {status}) with a non-Anthropic error format",
+	"vision_mismatch":               "[!!] {model} should accept images but rejected them with a non-official error, likely a text-only model impersonating Claude",
+	"stream_faked":                  "[!!] Streaming declared but events arrived at once; the proxy likely faked the streaming response",
+	"all_failed_auth":               "All probes were rejected (HTTP 401/403, {count} times); the API key is invalid or lacks permission",
+	"all_failed_unreachable":        "All probes failed to connect or timed out ({count} times); check the base URL and network",
+	"all_failed_html":               "All probes failed and the upstream answered with HTML error pages ({kinds:, }); the proxy is most likely overloaded or misconfigured",
+	"all_failed":                    "All probes failed",
+	"budget_exhausted":              "[!] Probe output token budget exhausted ({used}/{budget}), {skipped} probes skipped",
+	"versions_rejected":             "[!] Upstream rejects anthropic-version: {versions} (the official API supports every released version)",
+	"ratelimit_static":              "[!!] ratelimit remaining never changes ({remaining}); the ratelimit headers are likely forged",
+	"ratelimit_dynamic":             "[✓] ratelimit remaining decrements normally; genuine Anthropic ratelimit headers",
+	"ratelimit_unavailable":         "[i] ratelimit headers unavailable, dynamic verification skipped",
+	"ratelimit_reset_unparsable":    "[!!] ratelimit reset is not an RFC 3339 time; the ratelimit headers are likely forged",
+	"ratelimit_reset_out_of_window": "[!!] ratelimit reset is not within a minute of the response; the ratelimit headers are likely forged",
+	"ratelimit_reset_backwards":     "[!!] ratelimit reset moves backwards across requests; the ratelimit headers are likely forged",
+	"ratelimit_reset_static":        "[!!] ratelimit reset never changes; the ratelimit headers are likely forged",
+	"tls_certificate":               "TLS certificate: issuer {issuer}, SAN {sans}",
+	"tls_cert_provider":             "TLS certificate issued by {provider}",
+	"tls_san_mismatch":              "[!] Judged as Anthropic but the TLS certificate SANs do not include anthropic.com ({sans}); the target is not the official endpoint and may be a reverse proxy",
+}
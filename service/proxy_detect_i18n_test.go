@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDetectLang(t *testing.T) {
+	require.Equal(t, DetectLangZh, NormalizeDetectLang(""))
+	require.Equal(t, DetectLangZh, NormalizeDetectLang("zh-CN"))
+	require.Equal(t, DetectLangZh, NormalizeDetectLang("fr"))
+	require.Equal(t, DetectLangEn, NormalizeDetectLang("en"))
+	require.Equal(t, DetectLangEn, NormalizeDetectLang(" EN-us "))
+}
+
+func TestEnglishTranslationsComplete(t *testing.T) {
+	for code := range evidenceTemplates {
+		require.Contains(t, evidenceTemplatesEn, code)
+	}
+	for verdict := range verdictTextMap {
+		require.Contains(t, verdictTextMapEn, verdict)
+	}
+}
+
+func TestDetectResultLocalize(t *testing.T) {
+	result := analyze([]Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}, "claude-test", system_setting.DefaultScoringWeights)
+	zhEvidence := append([]string(nil), result.Evidence...)
+	zhText := result.VerdictText
+
+	result.localize("")
+	require.Equal(t, zhEvidence, result.Evidence)
+	require.Equal(t, zhText, result.VerdictText)
+
+	result.localize(DetectLangEn)
+	require.Equal(t, verdictTextMapEn[result.Verdict], result.VerdictText)
+	require.Len(t, result.Evidence, len(zhEvidence))
+	require.Equal(t, "[R1] tool_use id: "+truncStr(result.Fingerprints[0].ToolID, 28)+" -> toolu_ (Anthropic)", result.Evidence[0])
+	require.Contains(t, result.Evidence, "[!!] Duplicate msg id ("+result.Fingerprints[0].MsgID+"); real Anthropic generates a new id for every request")
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// A rejected key fails every model the same way, so a scan stops at the first rejection
+// instead of reporting each remaining model as unavailable.
+
+// Max error body bytes read to recognize an authentication error
+const maxAuthErrorBodyBytes = 4 << 10
+
+// errKeyRejected is the cancel cause of a scan aborted by a rejected key
+var errKeyRejected = errors.New("api key rejected")
+
+// isAuthFailure reports whether an error response rejects the key itself: HTTP 401/403, or
+// Anthropic's authentication_error envelope under any status
+func isAuthFailure(statusCode int, body []byte) bool {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return true
+	}
+	var parsed struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := common.Unmarshal(body, &parsed); err != nil {
+		return false
+	}
+	return parsed.Type == "error" && parsed.Error.Type == "authentication_error"
+}
+
+// keyRejected reports whether ctx was cancelled because the scan saw the key rejected
+func keyRejected(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errKeyRejected)
+}
+
+func invalidKeyDetectResult(model, traceID string) DetectResult {
+	return DetectResult{
+		Model:       model,
+		Verdict:     "invalid_key",
+		VerdictText: verdictTextMap["invalid_key"],
+		Scores:      newDetectScores(),
+		TraceID:     traceID,
+	}
+}
+
+// interruptedDetectResult is the result of a model whose context ended before a verdict
+func interruptedDetectResult(ctx context.Context, model, traceID string) DetectResult {
+	if keyRejected(ctx) {
+		return invalidKeyDetectResult(model, traceID)
+	}
+	return timeoutDetectResult(model, traceID)
+}
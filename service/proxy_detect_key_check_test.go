@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	authErrorBody          = `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`
+	modelNotFoundErrorBody = `{"type":"error","error":{"type":"not_found_error","message":"model: claude-x"}}`
+)
+
+func TestIsAuthFailure(t *testing.T) {
+	require.True(t, isAuthFailure(http.StatusUnauthorized, nil))
+	require.True(t, isAuthFailure(http.StatusForbidden, []byte("forbidden")))
+	require.True(t, isAuthFailure(http.StatusBadRequest, []byte(authErrorBody)))
+	require.False(t, isAuthFailure(http.StatusNotFound, []byte(modelNotFoundErrorBody)))
+	require.False(t, isAuthFailure(http.StatusNotFound, []byte(`{"error":{"code":"model_not_found"}}`)))
+	require.False(t, isAuthFailure(http.StatusBadGateway, []byte("<html>bad gateway</html>")))
+}
+
+func TestScanMultipleModelsKeyRejected(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(authErrorBody))
+	}))
+	defer srv.Close()
+
+	// The first batch sees the key rejected, so the fourth model never starts
+	models := []string{"claude-a", "claude-b", "claude-c", "claude-d"}
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-bad", models, DetectOptions{Rounds: 1, SkipSSRFCheck: true}, 5*time.Second)
+	require.Equal(t, "invalid_key", scan.Verdict)
+	require.Equal(t, verdictTextMap["invalid_key"], scan.VerdictText)
+	require.Len(t, scan.ModelResults, multiScanConcurrency)
+	for _, result := range scan.ModelResults {
+		require.Equal(t, "invalid_key", result.Verdict)
+	}
+	require.Equal(t, []string{"claude-d"}, scan.UnscannedModels)
+	require.False(t, scan.IsMixed)
+	require.LessOrEqual(t, int(requests.Load()), multiScanConcurrency)
+
+	scan.localize(DetectLangEn)
+	require.Equal(t, "Invalid API key", scan.VerdictText)
+}
+
+func TestScanMultipleModelsModelNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(modelNotFoundErrorBody))
+	}))
+	defer srv.Close()
+
+	models := []string{"claude-a", "claude-b", "claude-c", "claude-d"}
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-test", models, DetectOptions{Rounds: 1, SkipSSRFCheck: true}, 5*time.Second)
+	require.Empty(t, scan.Verdict)
+	require.Len(t, scan.ModelResults, len(models))
+	for _, result := range scan.ModelResults {
+		require.Equal(t, "unavailable", result.Verdict)
+		require.Equal(t, UnavailableReasonModelNotFound, result.UnavailableReason)
+		require.Equal(t, UnavailableReasonModelNotFound, scan.SummaryReasons[result.Model])
+	}
+}
+
+func TestClassifyUnavailableResponse(t *testing.T) {
+	require.Equal(t, UnavailableReasonAuth, classifyUnavailableResponse(http.StatusUnauthorized, nil))
+	require.Equal(t, UnavailableReasonModelNotFound, classifyUnavailableResponse(http.StatusNotFound, nil))
+	require.Equal(t, UnavailableReasonModelNotFound, classifyUnavailableResponse(http.StatusBadRequest, []byte(modelNotFoundErrorBody)))
+	require.Equal(t, UnavailableReasonModelNotFound, classifyUnavailableResponse(http.StatusServiceUnavailable, []byte(`{"error":{"code":"model_not_found"}}`)))
+	require.Equal(t, UnavailableReasonUpstream, classifyUnavailableResponse(http.StatusTooManyRequests, []byte(`{"type":"error","error":{"type":"rate_limit_error"}}`)))
+}
+
+func TestCheckModelAvailableReason(t *testing.T) {
+	target := ProbeTarget{BaseURL: "http://127.0.0.1:1", APIKey: "sk-test"}
+	err := CheckModelAvailable(context.Background(), newUnsafeHTTPClient(time.Second), target, "claude-a")
+	require.Equal(t, UnavailableReasonNetwork, unavailableReason(err))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	target.BaseURL = srv.URL
+	err = CheckModelAvailable(context.Background(), newUnsafeHTTPClient(50*time.Millisecond), target, "claude-a")
+	require.Equal(t, UnavailableReasonTimeout, unavailableReason(err))
+	require.Empty(t, unavailableReason(nil))
+}
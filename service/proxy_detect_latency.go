@@ -0,0 +1,62 @@
+package service
+
+import "slices"
+
+// A proxy that caches or replays responses answers in near-constant time, while genuine
+// generation varies with prompt and output length across the probe types.
+
+// Fewest latency samples needed to call them uniform
+const minUniformLatencySamples = 3
+
+// Largest max-min spread still counted as uniform: this many ms, or uniformLatencyRatio of
+// the median when that is larger
+const (
+	uniformLatencySpreadMs = 20
+	uniformLatencyRatio    = 0.05
+)
+
+// LatencyStats summarizes probe latencies
+type LatencyStats struct {
+	Count int   `json:"count"`
+	AvgMs int64 `json:"avg_ms"`
+	MinMs int64 `json:"min_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	MaxMs int64 `json:"max_ms"`
+	// Set when enough samples fall within a spread too narrow for real generation
+	Uniform bool `json:"uniform,omitempty"`
+}
+
+// computeLatencyStats summarizes the latency of successful probes, nil if none
+func computeLatencyStats(fingerprints []Fingerprint) *LatencyStats {
+	var samples []int64
+	var total int64
+	for _, fp := range fingerprints {
+		if fp.Error != "" || fp.LatencyMs <= 0 {
+			continue
+		}
+		samples = append(samples, fp.LatencyMs)
+		total += fp.LatencyMs
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	slices.Sort(samples)
+	stats := &LatencyStats{
+		Count: len(samples),
+		AvgMs: total / int64(len(samples)),
+		MinMs: samples[0],
+		P50Ms: latencyPercentile(samples, 50),
+		P90Ms: latencyPercentile(samples, 90),
+		MaxMs: samples[len(samples)-1],
+	}
+	allowed := max(int64(uniformLatencySpreadMs), int64(float64(stats.P50Ms)*uniformLatencyRatio))
+	stats.Uniform = stats.Count >= minUniformLatencySamples && stats.MaxMs-stats.MinMs <= allowed
+	return stats
+}
+
+// latencyPercentile returns the nearest-rank percentile p of sorted samples
+func latencyPercentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
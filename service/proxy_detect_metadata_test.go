@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataEndpointsBlocked(t *testing.T) {
+	cases := []struct {
+		cloud string
+		addr  string
+	}{
+		{"aws", "169.254.169.254"},
+		{"aws ipv6", "fd00:ec2::254"},
+		{"aws ecs", "169.254.170.2"},
+		{"gcp", "metadata.google.internal"},
+		{"gcp short", "metadata.goog"},
+		{"gcp fqdn", "Metadata.Google.Internal."},
+		{"azure", "metadata.azure.com"},
+		{"alibaba", "100.100.100.200"},
+		{"tencent", "169.254.0.23"},
+		{"tencent host", "metadata.tencentyun.com"},
+		{"oracle legacy", "192.0.0.192"},
+	}
+	dial := safeDialer()
+	for _, tc := range cases {
+		t.Run(tc.cloud, func(t *testing.T) {
+			require.True(t, isMetadataHost(tc.addr))
+			if ip := net.ParseIP(tc.addr); ip != nil {
+				require.EqualError(t, checkProbeIP(ip), "connection to metadata endpoint blocked")
+			}
+			// Hostnames are rejected before any DNS lookup
+			_, err := dial(context.Background(), "tcp", net.JoinHostPort(tc.addr, "80"))
+			require.EqualError(t, err, "connection to metadata endpoint blocked")
+		})
+	}
+
+	require.False(t, isMetadataHost("api.anthropic.com"))
+	require.NoError(t, checkProbeIP(net.ParseIP("100.100.100.201")))
+}
+
+func TestMetadataDenylistConfigurable(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	orig := setting.MetadataDenylist
+	t.Cleanup(func() { setting.MetadataDenylist = orig })
+
+	setting.MetadataDenylist = []string{"10.99.0.0/16", "metadata.internal.example"}
+	require.True(t, isMetadataHost("10.99.1.2"))
+	require.True(t, isMetadataHost("metadata.internal.example"))
+	require.False(t, isMetadataHost("metadata.google.internal"))
+
+	// Empty list falls back to the defaults
+	setting.MetadataDenylist = nil
+	require.True(t, isMetadataHost("metadata.google.internal"))
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DetectMetrics receives detection telemetry so a monitoring backend can export counters
+// and histograms (detections by verdict and proxy platform, probe error rate, latencies).
+// Implementations must be safe for concurrent use and must not block.
+type DetectMetrics interface {
+	// ObserveDetection is called once per finished detection run; results served from the
+	// result cache are not runs and are not reported
+	ObserveDetection(verdict, proxyPlatform string, duration time.Duration)
+	// ObserveProbe is called once per probe; errorClass is one of the ProbeError* values,
+	// empty when the probe succeeded
+	ObserveProbe(probeType, errorClass string, latency time.Duration)
+}
+
+// noopDetectMetrics is the default DetectMetrics and discards everything
+type noopDetectMetrics struct{}
+
+func (noopDetectMetrics) ObserveDetection(string, string, time.Duration) {}
+func (noopDetectMetrics) ObserveProbe(string, string, time.Duration)     {}
+
+// detectMetricsBox wraps the interface so atomic.Value always stores one concrete type
+type detectMetricsBox struct{ m DetectMetrics }
+
+var currentDetectMetrics atomic.Value
+
+// SetDetectMetrics installs the metrics sink for detection runs; nil restores the no-op default
+func SetDetectMetrics(m DetectMetrics) {
+	if m == nil {
+		m = noopDetectMetrics{}
+	}
+	currentDetectMetrics.Store(detectMetricsBox{m})
+}
+
+// detectMetrics returns the installed metrics sink
+func detectMetrics() DetectMetrics {
+	if box, ok := currentDetectMetrics.Load().(detectMetricsBox); ok {
+		return box.m
+	}
+	return noopDetectMetrics{}
+}
+
+// observeProbe reports a finished probe to the metrics sink
+func observeProbe(fp *Fingerprint) {
+	detectMetrics().ObserveProbe(fp.ProbeType, fp.ErrorClass, time.Duration(fp.LatencyMs)*time.Millisecond)
+}
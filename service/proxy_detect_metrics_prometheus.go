@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// prometheusDetectMetrics exports detection telemetry as Prometheus counters and histograms
+type prometheusDetectMetrics struct {
+	detections        *prometheus.CounterVec
+	detectionDuration *prometheus.HistogramVec
+	probes            *prometheus.CounterVec
+	probeLatency      *prometheus.HistogramVec
+}
+
+// newPrometheusDetectMetrics registers the detection metrics on reg
+func newPrometheusDetectMetrics(reg prometheus.Registerer) *prometheusDetectMetrics {
+	m := &prometheusDetectMetrics{
+		detections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_detect_detections_total",
+			Help: "Finished proxy detection runs by verdict and detected proxy platform.",
+		}, []string{"verdict", "proxy_platform"}),
+		detectionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_detect_detection_duration_seconds",
+			Help:    "Duration of finished proxy detection runs by verdict.",
+			Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+		}, []string{"verdict"}),
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_detect_probes_total",
+			Help: "Proxy detection probes by probe type and error class (none when the probe succeeded).",
+		}, []string{"probe_type", "error_class"}),
+		probeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_detect_probe_latency_seconds",
+			Help:    "Latency of proxy detection probes by probe type.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 20, 60},
+		}, []string{"probe_type"}),
+	}
+	reg.MustRegister(m.detections, m.detectionDuration, m.probes, m.probeLatency)
+	return m
+}
+
+func (m *prometheusDetectMetrics) ObserveDetection(verdict, proxyPlatform string, duration time.Duration) {
+	if proxyPlatform == "" {
+		proxyPlatform = "none"
+	}
+	m.detections.WithLabelValues(verdict, proxyPlatform).Inc()
+	m.detectionDuration.WithLabelValues(verdict).Observe(duration.Seconds())
+}
+
+func (m *prometheusDetectMetrics) ObserveProbe(probeType, errorClass string, latency time.Duration) {
+	if errorClass == "" {
+		errorClass = "none"
+	}
+	m.probes.WithLabelValues(probeType, errorClass).Inc()
+	m.probeLatency.WithLabelValues(probeType).Observe(latency.Seconds())
+}
+
+var (
+	detectMetricsRegistry = prometheus.NewRegistry()
+	detectMetricsInitOnce sync.Once
+)
+
+// InitProxyDetectMetrics installs the Prometheus sink for detection telemetry
+func InitProxyDetectMetrics() {
+	detectMetricsInitOnce.Do(func() {
+		SetDetectMetrics(newPrometheusDetectMetrics(detectMetricsRegistry))
+	})
+}
+
+// ProxyDetectMetricsHandler serves the detection metrics in the Prometheus exposition format
+func ProxyDetectMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(detectMetricsRegistry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingDetectMetrics struct {
+	mu          sync.Mutex
+	verdicts    []string
+	probeErrors []string
+}
+
+func (m *recordingDetectMetrics) ObserveDetection(verdict, _ string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verdicts = append(m.verdicts, verdict)
+}
+
+func (m *recordingDetectMetrics) ObserveProbe(_, errorClass string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probeErrors = append(m.probeErrors, errorClass)
+}
+
+func TestDetectMetrics(t *testing.T) {
+	require.Equal(t, noopDetectMetrics{}, detectMetrics())
+
+	rec := &recordingDetectMetrics{}
+	SetDetectMetrics(rec)
+	t.Cleanup(func() { SetDetectMetrics(nil) })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	opts := DetectOptions{Rounds: 2, SkipSSRFCheck: true, Force: true}
+	result := detectSingleModel(context.Background(), srv.URL, "sk-metrics", "claude-sonnet-4-5-20250929", opts)
+	require.Equal(t, "invalid_key", result.Verdict)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	require.Equal(t, []string{"invalid_key"}, rec.verdicts)
+	require.NotEmpty(t, rec.probeErrors)
+	for _, class := range rec.probeErrors {
+		require.Equal(t, ProbeErrorAuth, class)
+	}
+}
+
+func TestPrometheusDetectMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newPrometheusDetectMetrics(reg)
+	m.ObserveDetection("proxy", "OneAPI/NewAPI", 3*time.Second)
+	m.ObserveDetection("anthropic", "", time.Second)
+	m.ObserveProbe("tool", "", 200*time.Millisecond)
+	m.ObserveProbe("tool", ProbeErrorAuth, 50*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, `proxy_detect_detections_total{proxy_platform="OneAPI/NewAPI",verdict="proxy"} 1`)
+	require.Contains(t, body, `proxy_detect_detections_total{proxy_platform="none",verdict="anthropic"} 1`)
+	require.Contains(t, body, `proxy_detect_probes_total{error_class="none",probe_type="tool"} 1`)
+	require.Contains(t, body, `proxy_detect_probes_total{error_class="`+ProbeErrorAuth+`",probe_type="tool"} 1`)
+	require.Contains(t, body, `proxy_detect_detection_duration_seconds_count{verdict="proxy"} 1`)
+}
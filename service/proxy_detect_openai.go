@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Some channels only speak the OpenAI format and translate to Anthropic behind it, so
+// /v1/messages does not exist there. When every tool probe got 404/405 the detection sends a
+// single /v1/chat/completions request instead; no other status triggers it, so quota is not
+// spent twice. OpenAI's own replies carry a chatcmpl- id and an fp_ system_fingerprint; a
+// translation layer in front of Claude rarely reproduces both.
+
+// Origins recorded in Fingerprint.ChatCompletionSource
+const (
+	ChatCompletionOpenAI     = "openai"
+	ChatCompletionTranslated = "translated"
+)
+
+const defaultChatCompletionsPath = "/v1/chat/completions"
+
+// messagesEndpointMissing reports whether every probe failed because the messages path
+// does not exist (404) or does not accept POST (405)
+func messagesEndpointMissing(fingerprints []Fingerprint) bool {
+	if len(fingerprints) == 0 {
+		return false
+	}
+	for _, fp := range fingerprints {
+		if fp.HTTPStatus != http.StatusNotFound && fp.HTTPStatus != http.StatusMethodNotAllowed {
+			return false
+		}
+	}
+	return true
+}
+
+// chatCompletionsPath puts chat/completions next to a custom messages path
+// (/api/v1/messages -> /api/v1/chat/completions)
+func chatCompletionsPath(messagesPath string) string {
+	if prefix, ok := strings.CutSuffix(messagesPath, "/messages"); ok && prefix != "" {
+		return prefix + "/chat/completions"
+	}
+	return defaultChatCompletionsPath
+}
+
+// buildChatCompletionsPayload builds the OpenAI-format fallback request body
+func buildChatCompletionsPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 5,
+		"messages": []map[string]any{
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("simple")},
+		},
+	}
+}
+
+// probeChatCompletions sends the OpenAI-format fallback probe and records the reply's origin
+func probeChatCompletions(ctx context.Context, client *http.Client, target ProbeTarget, model string) Fingerprint {
+	fp := Fingerprint{
+		ProbeType:      "chat_completions",
+		ModelRequested: model,
+	}
+	defer observeProbe(&fp)
+
+	budget := probeBudgetFrom(ctx)
+	if budget.exhausted() {
+		fp.Error = "probe token budget exhausted"
+		fp.ErrorClass = ProbeErrorBudget
+		return fp
+	}
+
+	chatTarget := target
+	chatTarget.MessagesPath = chatCompletionsPath(target.MessagesPath)
+	req, err := chatTarget.newMessagesRequest(ctx, buildChatCompletionsPayload(model))
+	if err != nil {
+		fp.Error = "failed to create request"
+		fp.ErrorClass = ProbeErrorRequest
+		return fp
+	}
+
+	resp, _, err := doProbeRequest(ctx, client, req, &fp)
+	if err != nil {
+		fp.Error, fp.ErrorClass = classifyRequestFailure(ctx, err)
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect probe %s/chat_completions failed: %v", model, err))
+		return fp
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, errorKind := readErrorBody(resp)
+		fp.HTTPStatus = resp.StatusCode
+		fp.ErrorKind = errorKind
+		fp.Error = fmt.Sprintf("%s: %s", describeErrorKind(fmt.Sprintf("HTTP %d", resp.StatusCode), errorKind), string(truncateErrorSnippet(errBody)))
+		fp.ErrorClass = ProbeErrorHTTP
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			fp.ErrorClass = ProbeErrorAuth
+		}
+		return fp
+	}
+
+	fp.ProxyPlatform, fp.PlatformClues = detectProxyPlatform(resp.Header)
+	fp.ProxyHops, fp.ForwardedChain = parseForwardedChain(resp.Header)
+
+	var body map[string]any
+	bodyBytes, err := readLimitedBody(resp.Body)
+	var tooLarge errBodyTooLarge
+	if errors.As(err, &tooLarge) {
+		fp.BodyTruncated = true
+		fp.Error = err.Error()
+		fp.ErrorClass = ProbeErrorParse
+		return fp
+	}
+	if err == nil {
+		err = common.Unmarshal(bodyBytes, &body)
+	}
+	if err != nil {
+		fp.Error = "response body not JSON"
+		if fp.ErrorKind = classifyHTMLError(resp.Header, bodyBytes); fp.ErrorKind != "" {
+			fp.Error = fmt.Sprintf("%s: %s", describeErrorKind(fp.Error, fp.ErrorKind), truncateErrorSnippet(bodyBytes))
+		}
+		fp.ErrorClass = ProbeErrorParse
+		return fp
+	}
+
+	fp.MsgID, _ = body["id"].(string)
+	fp.Model, _ = body["model"].(string)
+	recordBackendLLM(&fp, BackendLLMSourceModel, fp.Model)
+	fp.SystemFingerprint, _ = body["system_fingerprint"].(string)
+	if usage, ok := body["usage"].(map[string]any); ok {
+		if n, ok := usage["completion_tokens"].(float64); ok {
+			fp.OutputTokens = int(n)
+		}
+	}
+	budget.charge(fp.OutputTokens)
+	fp.ChatCompletionSource = classifyChatCompletion(fp.MsgID, fp.SystemFingerprint, fp.Model)
+	return fp
+}
+
+// classifyChatCompletion tells OpenAI's own replies from translated ones
+func classifyChatCompletion(id, systemFingerprint, model string) string {
+	if strings.HasPrefix(id, "chatcmpl-") && strings.HasPrefix(systemFingerprint, "fp_") &&
+		!strings.Contains(strings.ToLower(model), "claude") {
+		return ChatCompletionOpenAI
+	}
+	return ChatCompletionTranslated
+}
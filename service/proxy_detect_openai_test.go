@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// openAIOnlyUpstream serves chat completions only; messagesStatus is returned for /v1/messages
+func openAIOnlyUpstream(t *testing.T, messagesStatus int, chatBody string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			_, _ = w.Write([]byte(chatBody))
+			return
+		}
+		w.WriteHeader(messagesStatus)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+const translatedChatBody = `{"id":"chatcmpl-4f1e2d","object":"chat.completion","model":"claude-sonnet-4-5-20250929","choices":[{"index":0,"message":{"role":"assistant","content":"OK"},"finish_reason":"stop"}],"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}`
+
+func TestOpenAIChatCompletionsFallback(t *testing.T) {
+	srv, paths := openAIOnlyUpstream(t, http.StatusNotFound, translatedChatBody)
+
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929",
+		DetectOptions{Rounds: 2, SkipSSRFCheck: true, VerifyRatelimit: true, CheckVersions: true})
+	require.Equal(t, "openai_translation", result.Verdict)
+	require.Equal(t, verdictTextMap["openai_translation"], result.VerdictText)
+	require.Equal(t, 1.0, result.Confidence)
+	require.True(t, result.Badges.IsProxied)
+	require.Nil(t, result.RatelimitVerify)
+	require.Nil(t, result.VersionSupport)
+	// Two tool rounds, then a single fallback request and nothing else
+	require.Equal(t, []string{"/v1/messages", "/v1/messages", "/v1/chat/completions"}, paths())
+
+	chat := result.Fingerprints[len(result.Fingerprints)-1]
+	require.Equal(t, "chat_completions", chat.ProbeType)
+	require.Equal(t, ChatCompletionTranslated, chat.ChatCompletionSource)
+	require.Equal(t, 1, chat.OutputTokens)
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "chat/completions 响应由转译层生成")
+}
+
+func TestOpenAIFallbackOnlyOnMissingEndpoint(t *testing.T) {
+	srv, paths := openAIOnlyUpstream(t, http.StatusInternalServerError, translatedChatBody)
+
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", DetectOptions{Rounds: 1, SkipSSRFCheck: true})
+	require.NotEqual(t, "openai_translation", result.Verdict)
+	require.NotContains(t, paths(), "/v1/chat/completions")
+
+	// 405 triggers it too, next to a custom messages path
+	srv, paths = openAIOnlyUpstream(t, http.StatusMethodNotAllowed, translatedChatBody)
+	result = detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929",
+		DetectOptions{Rounds: 1, SkipSSRFCheck: true, MessagesPath: "/api/v1/messages"})
+	require.Equal(t, "openai_translation", result.Verdict)
+	require.Equal(t, []string{"/api/v1/messages", "/api/v1/chat/completions"}, paths())
+}
+
+func TestClassifyChatCompletion(t *testing.T) {
+	require.Equal(t, ChatCompletionOpenAI, classifyChatCompletion("chatcmpl-9a8b7c", "fp_3b956da36b", "gpt-4o-2024-08-06"))
+	require.Equal(t, ChatCompletionTranslated, classifyChatCompletion("chatcmpl-9a8b7c", "fp_3b956da36b", "claude-sonnet-4-5-20250929"))
+	require.Equal(t, ChatCompletionTranslated, classifyChatCompletion("chatcmpl-9a8b7c", "", "gpt-4o"))
+	require.Equal(t, ChatCompletionTranslated, classifyChatCompletion("msg_01ABC", "fp_3b956da36b", "gpt-4o"))
+
+	require.Equal(t, "/v1/chat/completions", chatCompletionsPath(""))
+	require.Equal(t, "/v1/chat/completions", chatCompletionsPath("/v1/messages"))
+	require.Equal(t, "/api/v1/chat/completions", chatCompletionsPath("/api/v1/messages"))
+	require.Equal(t, "/v1/chat/completions", chatCompletionsPath("/claude"))
+}
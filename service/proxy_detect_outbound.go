@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// An outbound proxy sends the probes from another egress IP, e.g. to reach a geo-fenced
+// channel. The proxy resolves and connects to the target itself, so the SSRF-safe dialer
+// cannot vet the target address: an outbound proxy is only allowed together with
+// SkipSSRFCheck, i.e. for admin detections.
+
+var errOutboundProxyNeedsAdmin = errors.New("outbound proxy requires an admin detection")
+
+// ParseOutboundProxy parses an outbound proxy URL with an http, https, socks5 or socks5h scheme
+func ParseOutboundProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be http, https, socks5 or socks5h", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL has no host")
+	}
+	return u, nil
+}
+
+// newOutboundProxyClient creates a probe client whose connections go through proxyURL.
+// It fails closed: when the proxy is invalid or checkIP is set, every request fails instead
+// of silently going out directly from the wrong egress.
+func newOutboundProxyClient(timeout time.Duration, proxyURL string, checkIP bool) *http.Client {
+	transport := &http.Transport{ForceAttemptHTTP2: true}
+	if err := configureOutboundProxy(transport, proxyURL, checkIP); err != nil {
+		transport.DialContext = func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: probeRedirectPolicy(false),
+	}
+}
+
+func configureOutboundProxy(transport *http.Transport, proxyURL string, checkIP bool) error {
+	if checkIP {
+		return errOutboundProxyNeedsAdmin
+	}
+	u, err := ParseOutboundProxy(proxyURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		transport.Proxy = http.ProxyURL(u)
+		return nil
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		auth = &proxy.Auth{User: u.User.Username()}
+		auth.Password, _ = u.User.Password()
+	}
+	dialer, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{Timeout: 10 * time.Second})
+	if err != nil {
+		return err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return fmt.Errorf("socks5 dialer does not support contexts")
+	}
+	transport.DialContext = contextDialer.DialContext
+	return nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Under load Anthropic answers with the non-standard status 529 and exactly
+// {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}} (a request_id may
+// follow). Proxies either map it to 503/500 or keep the status with a body of their own, so
+// the exact pair is a strong sign of the genuine API. A 529 met on an attempt that was
+// retried still counts.
+
+// HTTP status of Anthropic's overloaded_error
+const statusOverloaded = 529
+
+// isAnthropicOverloadedBody reports whether body is Anthropic's overloaded_error envelope
+// with no fields beyond the official ones
+func isAnthropicOverloadedBody(body []byte) bool {
+	var parsed map[string]any
+	if err := common.Unmarshal(body, &parsed); err != nil {
+		return false
+	}
+	for key := range parsed {
+		if key != "type" && key != "error" && key != "request_id" {
+			return false
+		}
+	}
+	errObj, _ := parsed["error"].(map[string]any)
+	if len(errObj) != 2 {
+		return false
+	}
+	message, _ := errObj["message"].(string)
+	return parsed["type"] == "error" && errObj["type"] == "overloaded_error" && message != ""
+}
+
+// applyOverloaded scores Anthropic's exact 529 once across all fingerprints; a 529 with any
+// other body is only noted
+func applyOverloaded(result *DetectResult, fingerprints []Fingerprint, w system_setting.ScoringWeights) {
+	overloaded := 0
+	anthropic := false
+	for _, fp := range fingerprints {
+		if fp.Overloaded {
+			overloaded++
+		}
+		anthropic = anthropic || fp.OverloadedAnthropic
+	}
+	switch {
+	case anthropic:
+		result.Scores["anthropic"] += w.OverloadedAnthropic
+		result.addEvidence(EvidenceItem{Code: "overloaded_anthropic", Weight: w.OverloadedAnthropic, Params: map[string]any{"count": overloaded}})
+	case overloaded > 0:
+		result.addEvidence(EvidenceItem{Code: "overloaded_rewritten", Params: map[string]any{"count": overloaded}})
+	}
+}
+
+// recordOverloaded records a 529 response on fp; the Anthropic shape sticks once seen
+func recordOverloaded(fp *Fingerprint, statusCode int, body []byte) {
+	if statusCode != statusOverloaded {
+		return
+	}
+	fp.Overloaded = true
+	if isAnthropicOverloadedBody(body) {
+		fp.OverloadedAnthropic = true
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const anthropicOverloadedBody = `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"},"request_id":"req_011CUaBcDeFgHiJkLmNoPqRsTu"}`
+
+func TestIsAnthropicOverloadedBody(t *testing.T) {
+	require.True(t, isAnthropicOverloadedBody([]byte(anthropicOverloadedBody)))
+	require.True(t, isAnthropicOverloadedBody([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)))
+	// One-api style envelope around the same error
+	require.False(t, isAnthropicOverloadedBody([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded","code":"upstream_error"}}`)))
+	require.False(t, isAnthropicOverloadedBody([]byte(`{"error":{"type":"overloaded_error","message":"Overloaded"}}`)))
+	require.False(t, isAnthropicOverloadedBody([]byte(`{"type":"error","error":{"type":"api_error","message":"Overloaded"}}`)))
+	require.False(t, isAnthropicOverloadedBody([]byte(`Overloaded`)))
+}
+
+func TestProbeOnceOverloaded(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ProbeRetryBaseDelayMs = 1
+
+	var requests atomic.Int32
+	var overloadedRequests int32
+	overloadedBody := anthropicOverloadedBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= overloadedRequests {
+			w.WriteHeader(statusOverloaded)
+			_, _ = w.Write([]byte(overloadedBody))
+			return
+		}
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	model := "claude-sonnet-4-5-20250929"
+
+	// A retry that succeeds keeps the 529 it went through
+	setting.ProbeMaxAttempts = 3
+	overloadedRequests = 1
+	fp := probeOnce(context.Background(), client, target, model, "tool")
+	require.Empty(t, fp.Error)
+	require.True(t, fp.Overloaded)
+	require.True(t, fp.OverloadedAnthropic)
+	require.Equal(t, 1, fp.Retries)
+
+	// Without retries the 529 is the probe's outcome
+	setting.ProbeMaxAttempts = 1
+	requests.Store(0)
+	overloadedBody = `{"error":{"message":"upstream overloaded"}}`
+	fp = probeOnce(context.Background(), client, target, model, "tool")
+	require.Equal(t, ProbeErrorOverloaded, fp.ErrorClass)
+	require.Equal(t, statusOverloaded, fp.HTTPStatus)
+	require.True(t, fp.Overloaded)
+	require.False(t, fp.OverloadedAnthropic)
+}
+
+func TestAnalyzeOverloaded(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	base := analyze([]Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}, model, w)
+
+	// Counted once, from a retried probe and a failed one alike
+	retried := anthropicFingerprint("tool")
+	retried.Overloaded, retried.OverloadedAnthropic = true, true
+	failed := Fingerprint{ProbeType: "tool", Error: "HTTP 529: ...", ErrorClass: ProbeErrorOverloaded, Overloaded: true, OverloadedAnthropic: true}
+	result := analyze([]Fingerprint{retried, anthropicFingerprint("tool"), failed}, model, w)
+	require.Equal(t, base.Scores["anthropic"]+w.OverloadedAnthropic, result.Scores["anthropic"])
+	require.True(t, hasEvidence(result, "HTTP 529 overloaded_error 与官方格式完全一致 (2 次)"))
+
+	rewritten := anthropicFingerprint("tool")
+	rewritten.Overloaded = true
+	result = analyze([]Fingerprint{rewritten, anthropicFingerprint("tool")}, model, w)
+	require.Equal(t, base.Scores, result.Scores)
+	require.True(t, hasEvidence(result, "[!] 收到 HTTP 529 (1 次)"))
+
+	// Every probe overloaded: no verdict, but the shape is still reported
+	result = analyze([]Fingerprint{failed, failed}, model, w)
+	require.Equal(t, "unknown", result.Verdict)
+	require.True(t, hasEvidence(result, "HTTP 529 overloaded_error 与官方格式完全一致"))
+}
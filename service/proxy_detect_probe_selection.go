@@ -0,0 +1,41 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DetectOptions.Probes limits a run to the listed probe types, e.g. to skip the thinking probe
+// on a channel without thinking support. Empty keeps the preset's probes; the quick preset
+// always sends its single tool probe.
+
+// SelectableProbeTypes are the probe types DetectOptions.Probes may list
+var SelectableProbeTypes = []string{"tool", "thinking", "simple", "stream", "vision", "cache"}
+
+// ValidateProbeSelection checks that probes only lists SelectableProbeTypes, each once
+func ValidateProbeSelection(probes []string) error {
+	for i, probeType := range probes {
+		if !slices.Contains(SelectableProbeTypes, probeType) {
+			return fmt.Errorf("unknown probe type %q, expected one of %v", probeType, SelectableProbeTypes)
+		}
+		if slices.Contains(probes[:i], probeType) {
+			return fmt.Errorf("probe type %q listed twice", probeType)
+		}
+	}
+	return nil
+}
+
+// probeSelected reports whether probeType runs: whether it is listed when DetectOptions.Probes
+// is set, else inPreset (whether the preset sends it)
+func probeSelected(opts DetectOptions, probeType string, inPreset bool) bool {
+	if len(opts.Probes) == 0 {
+		return inPreset
+	}
+	return slices.Contains(opts.Probes, probeType)
+}
+
+// probeSelectionKey returns probes sorted, so the same selection in another order shares a
+// result cache entry
+func probeSelectionKey(probes []string) []string {
+	return slices.Sorted(slices.Values(probes))
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProbeSelection(t *testing.T) {
+	require.NoError(t, ValidateProbeSelection(nil))
+	require.NoError(t, ValidateProbeSelection([]string{"tool", "simple", "cache"}))
+	require.Error(t, ValidateProbeSelection([]string{"max_tokens"}))
+	require.Error(t, ValidateProbeSelection([]string{"tool", "tool"}))
+}
+
+func TestDetectSingleModelProbeSelection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	probeTypes := func(result DetectResult) []string {
+		var types []string
+		for _, fp := range result.Fingerprints {
+			types = append(types, fp.ProbeType)
+		}
+		return types
+	}
+
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929",
+		DetectOptions{Rounds: 2, SkipSSRFCheck: true, Force: true, Probes: []string{"simple", "tool"}})
+	require.Equal(t, []string{"tool", "tool", "simple"}, probeTypes(result))
+
+	// Selected probes run whatever the preset
+	result = detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929",
+		DetectOptions{Rounds: 1, SkipSSRFCheck: true, Force: true, Probes: []string{"vision"}})
+	require.Equal(t, []string{"vision"}, probeTypes(result))
+
+	// Empty keeps the preset's probes
+	result = detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929",
+		DetectOptions{Rounds: 1, SkipSSRFCheck: true, Force: true})
+	require.Equal(t, []string{"tool", "thinking"}, probeTypes(result))
+}
+
+func TestEstimateDetectionProbeSelection(t *testing.T) {
+	estimate := EstimateDetection([]string{"claude-sonnet-4-5-20250929"}, DetectOptions{Rounds: 3, Probes: []string{"tool", "cache"}})
+	var types []string
+	for _, p := range estimate.Models[0].Probes {
+		types = append(types, p.ProbeType)
+	}
+	require.Equal(t, []string{"tool", "cache"}, types)
+	require.Equal(t, 3+2, estimate.Requests)
+
+	require.NotEqual(t,
+		detectResultCacheKey("https://x", "sk", "m", DetectOptions{}),
+		detectResultCacheKey("https://x", "sk", "m", DetectOptions{Probes: []string{"tool"}}))
+	require.Equal(t,
+		detectResultCacheKey("https://x", "sk", "m", DetectOptions{Probes: []string{"tool", "stream"}}),
+		detectResultCacheKey("https://x", "sk", "m", DetectOptions{Probes: []string{"stream", "tool"}}))
+}
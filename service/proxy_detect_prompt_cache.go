@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Prompt caching is hard to fake: Anthropic bills the second identical request that marks a
+// long prefix with cache_control as cache_read_input_tokens, while a forged envelope reports
+// zero or leaves the field out. A miss proves nothing (the cache may be cold on another
+// node), so only an observed read is scored.
+
+// Lines of the cached prefix; ~20 tokens each keeps it above the largest minimum cacheable
+// prompt length (4096 tokens) of current models
+const promptCacheLines = 240
+
+var (
+	promptCachePrefixOnce sync.Once
+	promptCachePrefix     string
+)
+
+// promptCacheDocument returns the fixed text of the cached prefix. Both cache probe requests
+// must send it byte for byte, or the second cannot hit the cache.
+func promptCacheDocument() string {
+	promptCachePrefixOnce.Do(func() {
+		var sb strings.Builder
+		sb.WriteString("Reference table for the conversation below. Do not summarize it.\n")
+		for i := 1; i <= promptCacheLines; i++ {
+			fmt.Fprintf(&sb, "Entry %04d: alpha bravo charlie delta echo foxtrot golf hotel india juliet kilo lima.\n", i)
+		}
+		promptCachePrefix = sb.String()
+	})
+	return promptCachePrefix
+}
+
+// buildPromptCachePayload builds the cache probe request body: the long prefix as a system
+// block marked for caching, then a short question
+func buildPromptCachePayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 5,
+		"system": []map[string]any{
+			{"type": "text", "text": promptCacheDocument(), "cache_control": map[string]any{"type": "ephemeral"}},
+		},
+		"messages": []map[string]any{{"role": "user", "content": "Say OK"}},
+	}
+}
+
+// probePromptCache sends the cache probe twice with the same body. The first request writes
+// the cache; the fingerprint of the second is kept, with CacheReadObserved set when it was
+// billed cache reads.
+func probePromptCache(ctx context.Context, client *http.Client, target ProbeTarget, model string) Fingerprint {
+	fp := probeOnce(ctx, client, target, model, "cache")
+	if fp.Error != "" || ctx.Err() != nil {
+		return fp
+	}
+	fp = probeOnce(ctx, client, target, model, "cache")
+	fp.CacheReadObserved = fp.Error == "" && fp.CacheReadTokens > 0
+	return fp
+}
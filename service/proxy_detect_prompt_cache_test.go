@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptCachePayload(t *testing.T) {
+	model := "claude-sonnet-4-5-20250929"
+	first := buildPromptCachePayload(model)
+	require.Equal(t, first, buildPromptCachePayload(model), "both requests must share the exact prefix")
+
+	system := first["system"].([]map[string]any)
+	require.Equal(t, map[string]any{"type": "ephemeral"}, system[0]["cache_control"])
+	// Well above the 4096-token minimum at ~4 characters per token
+	require.Greater(t, len(system[0]["text"].(string)), 4*4096)
+}
+
+func TestProbePromptCache(t *testing.T) {
+	var bodies []string
+	cacheHonored := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		cacheRead := 0
+		if cacheHonored && len(bodies) > 1 && bodies[len(bodies)-1] == bodies[len(bodies)-2] {
+			cacheRead = 5000
+		}
+		_, _ = fmt.Fprintf(w, `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"end_turn","usage":{"input_tokens":8,"cache_creation_input_tokens":0,"cache_read_input_tokens":%d,"output_tokens":1}}`, cacheRead)
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+
+	fp := probePromptCache(context.Background(), client, target, "claude-sonnet-4-5-20250929")
+	require.Len(t, bodies, 2)
+	require.Empty(t, fp.Error)
+	require.Equal(t, 5000, fp.CacheReadTokens)
+	require.True(t, fp.CacheReadObserved)
+
+	// A forged envelope reports zero cache reads
+	cacheHonored = false
+	fp = probePromptCache(context.Background(), client, target, "claude-sonnet-4-5-20250929")
+	require.Len(t, bodies, 4)
+	require.False(t, fp.CacheReadObserved)
+}
+
+func TestAnalyzePromptCache(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	base := analyze([]Fingerprint{anthropicFingerprint("tool")}, model, w)
+
+	hit := anthropicFingerprint("cache")
+	hit.CacheReadTokens, hit.CacheReadObserved = 5000, true
+	miss := anthropicFingerprint("cache")
+	toolOnly := func(r DetectResult) int { return r.Scores["anthropic"] - base.Scores["anthropic"] }
+
+	observed := analyze([]Fingerprint{anthropicFingerprint("tool"), hit}, model, w)
+	missed := analyze([]Fingerprint{anthropicFingerprint("tool"), miss}, model, w)
+	// The cache probe's other fields score the same either way; only the read adds weight
+	require.Equal(t, w.CacheReadObserved, toolOnly(observed)-toolOnly(missed))
+	require.Contains(t, strings.Join(observed.Evidence, "\n"), "cache_read_input_tokens=5000")
+	require.Contains(t, strings.Join(missed.Evidence, "\n"), "不作判定")
+}
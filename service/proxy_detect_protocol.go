@@ -0,0 +1,28 @@
+package service
+
+import "net/http"
+
+// Anthropic's API negotiates HTTP/2 over TLS; many homemade proxies only speak HTTP/1.1.
+// CDNs and load balancers in front of legitimate relays vary as well, so an HTTP/1.1-only
+// upstream is a very weak hint. Plain http:// targets cannot negotiate HTTP/2 at all and
+// leave the protocol unrecorded.
+
+// Protocols recorded in Fingerprint.HTTPProtocol
+const (
+	HTTPProtocol2  = "HTTP/2.0"
+	HTTPProtocol11 = "HTTP/1.1"
+)
+
+// recordHTTPProtocol records the protocol negotiated for a TLS response
+func recordHTTPProtocol(fp *Fingerprint, resp *http.Response) {
+	if resp.TLS == nil {
+		return
+	}
+	fp.HTTPProtocol = resp.Proto
+}
+
+// isProtocolPinnedProbe reports whether the probe's client fixes the protocol itself, so its
+// HTTPProtocol says nothing about the upstream
+func isProtocolPinnedProbe(probeType string) bool {
+	return probeType == "header_case"
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeRecordsHTTPProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(usageConsistentBody))
+	})
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(handler)
+	defer h1.Close()
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+
+	model := "claude-sonnet-4-5-20250929"
+	fp := probeOnce(context.Background(), h2.Client(), ProbeTarget{BaseURL: h2.URL, APIKey: "sk-test"}, model, "simple")
+	require.Empty(t, fp.Error)
+	require.Equal(t, HTTPProtocol2, fp.HTTPProtocol)
+
+	fp = probeOnce(context.Background(), h1.Client(), ProbeTarget{BaseURL: h1.URL, APIKey: "sk-test"}, model, "simple")
+	require.Equal(t, HTTPProtocol11, fp.HTTPProtocol)
+
+	fp = probeOnce(context.Background(), plain.Client(), ProbeTarget{BaseURL: plain.URL, APIKey: "sk-test"}, model, "simple")
+	require.Empty(t, fp.HTTPProtocol)
+}
+
+func TestAnalyzeHTTPProtocol(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	withProtocols := func(protocols ...string) DetectResult {
+		var fps []Fingerprint
+		for _, p := range protocols {
+			fp := anthropicFingerprint("tool")
+			fp.HTTPProtocol = p
+			fps = append(fps, fp)
+		}
+		return analyze(fps, model, w)
+	}
+	base := withProtocols("", "")
+
+	http1 := withProtocols(HTTPProtocol11, HTTPProtocol11)
+	require.Equal(t, base.Scores["anthropic"]-w.HTTP1OnlyPenalty, http1.Scores["anthropic"])
+	require.True(t, hasEvidence(http1, "TLS 探测均只协商到 HTTP/1.1 (2 次)"))
+
+	http2 := withProtocols(HTTPProtocol2, HTTPProtocol2)
+	require.Equal(t, base.Scores, http2.Scores)
+	require.True(t, hasEvidence(http2, "TLS 探测均协商到 HTTP/2 (2 次)"))
+
+	// Mixed protocols (e.g. a CDN edge per region) say nothing
+	mixed := withProtocols(HTTPProtocol2, HTTPProtocol11)
+	require.Equal(t, base.Scores, mixed.Scores)
+	require.False(t, hasEvidence(mixed, "HTTP/"))
+
+	// The header_case probe pins HTTP/1.1 itself
+	pinned := anthropicFingerprint("header_case")
+	pinned.HTTPProtocol = HTTPProtocol11
+	h2fp := anthropicFingerprint("tool")
+	h2fp.HTTPProtocol = HTTPProtocol2
+	result := analyze([]Fingerprint{h2fp, pinned}, model, w)
+	require.True(t, hasEvidence(result, "TLS 探测均协商到 HTTP/2 (1 次)"))
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Anthropic sends anthropic-ratelimit-input-tokens-reset as an RFC 3339 time at which the
+// per-minute bucket is full again, so it is at most about a minute ahead of the response and
+// moves forward as tokens are spent. A forged header is often a constant or a far-future time,
+// which a randomized remaining value alone does not reveal.
+
+// Outcome of the reset timestamp check, see RatelimitVerification.ResetCheck
+const (
+	RatelimitResetOK          = "ok"
+	RatelimitResetUnparsable  = "unparsable"
+	RatelimitResetOutOfWindow = "out_of_window"
+	RatelimitResetBackwards   = "backwards"
+	RatelimitResetStatic      = "static"
+)
+
+const (
+	// Window of plausible reset times relative to the response; the lower bound absorbs the
+	// whole-second resolution of the Date header
+	ratelimitResetMinAhead = -2 * time.Second
+	ratelimitResetMaxAhead = 65 * time.Second
+	// How far a later sample's reset may fall behind an earlier one (second resolution)
+	ratelimitResetBackwardsTolerance = time.Second
+	// Observation span after which an unchanged reset is implausible
+	ratelimitResetStaticSpan = 2 * time.Second
+)
+
+// responseObservedAt returns when the upstream produced the response, by its Date header so
+// the reset is compared against the upstream clock, or the local time without one
+func responseObservedAt(header http.Header) time.Time {
+	if at, err := http.ParseTime(header.Get("Date")); err == nil {
+		return at
+	}
+	return time.Now()
+}
+
+// checkRatelimitResets checks the reset timestamps of samples, returning the outcome and a
+// detail line; both are empty when no sample carries a reset
+func checkRatelimitResets(samples []RatelimitSample) (string, string) {
+	var resets []time.Time
+	var observed []time.Time
+	for _, s := range samples {
+		if s.Reset == "" {
+			continue
+		}
+		reset, err := time.Parse(time.RFC3339, s.Reset)
+		if err != nil {
+			return RatelimitResetUnparsable, fmt.Sprintf("reset 非 RFC3339 时间 (%s)，疑似伪造", s.Reset)
+		}
+		if !s.ObservedAt.IsZero() {
+			if ahead := reset.Sub(s.ObservedAt); ahead < ratelimitResetMinAhead || ahead > ratelimitResetMaxAhead {
+				return RatelimitResetOutOfWindow, fmt.Sprintf("reset 距响应时间 %s，超出合理范围（1 分钟内），疑似伪造", ahead.Round(time.Second))
+			}
+			observed = append(observed, s.ObservedAt)
+		}
+		resets = append(resets, reset)
+	}
+	if len(resets) == 0 {
+		return "", ""
+	}
+
+	for i := 1; i < len(resets); i++ {
+		if resets[i].Before(resets[i-1].Add(-ratelimitResetBackwardsTolerance)) {
+			return RatelimitResetBackwards, fmt.Sprintf("reset 时间倒退 (%s → %s)，疑似伪造",
+				resets[i-1].Format(time.RFC3339), resets[i].Format(time.RFC3339))
+		}
+	}
+
+	allSame := len(resets) >= 2
+	for i := 1; i < len(resets) && allSame; i++ {
+		allSame = resets[i].Equal(resets[0])
+	}
+	if allSame && len(observed) >= 2 && observed[len(observed)-1].Sub(observed[0]) >= ratelimitResetStaticSpan {
+		return RatelimitResetStatic, fmt.Sprintf("reset 固定为 %s，疑似伪造", resets[0].Format(time.RFC3339))
+	}
+	return RatelimitResetOK, "reset 时间在 1 分钟内且随请求推进"
+}
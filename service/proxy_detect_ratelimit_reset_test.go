@@ -0,0 +1,53 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRatelimitResets(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sample := func(observedSec, resetSec int) RatelimitSample {
+		return RatelimitSample{
+			Remaining:  1000,
+			Reset:      t0.Add(time.Duration(resetSec) * time.Second).Format(time.RFC3339),
+			ObservedAt: t0.Add(time.Duration(observedSec) * time.Second),
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		samples []RatelimitSample
+		check   string
+	}{
+		{name: "no reset", samples: []RatelimitSample{{Remaining: 100}, {Remaining: 90}}, check: ""},
+		{name: "advancing", samples: []RatelimitSample{sample(0, 1), sample(2, 3), sample(4, 5)}, check: RatelimitResetOK},
+		{name: "unparsable", samples: []RatelimitSample{{Remaining: 100, Reset: "60"}}, check: RatelimitResetUnparsable},
+		{name: "far future", samples: []RatelimitSample{sample(0, 1), sample(2, 3600)}, check: RatelimitResetOutOfWindow},
+		{name: "past", samples: []RatelimitSample{sample(10, 0)}, check: RatelimitResetOutOfWindow},
+		{name: "backwards", samples: []RatelimitSample{sample(0, 30), sample(2, 10)}, check: RatelimitResetBackwards},
+		{name: "static", samples: []RatelimitSample{sample(0, 30), sample(2, 30), sample(4, 30)}, check: RatelimitResetStatic},
+		{name: "same second", samples: []RatelimitSample{sample(0, 1), sample(1, 1)}, check: RatelimitResetOK},
+		{name: "unknown observation", samples: []RatelimitSample{{Reset: "2026-03-01T12:00:30Z"}, {Reset: "2026-03-01T12:00:30Z"}}, check: RatelimitResetOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check, detail := checkRatelimitResets(tc.samples)
+			require.Equal(t, tc.check, check)
+			require.Equal(t, tc.check == "", detail == "")
+		})
+	}
+
+	result := classifyRatelimitSamples([]RatelimitSample{sample(0, 30), sample(2, 3600)})
+	require.Equal(t, RatelimitResetOutOfWindow, result.ResetCheck)
+	require.Contains(t, result.Detail, "超出合理范围")
+}
+
+func TestResponseObservedAt(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.True(t, at.Equal(responseObservedAt(http.Header{"Date": {at.Format(http.TimeFormat)}})))
+	require.WithinDuration(t, time.Now(), responseObservedAt(http.Header{}), time.Second)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DetectOptions.IncludeRaw (admin only, off by default) attaches what each probe received to
+// its Fingerprint so a wrong verdict can be debugged. The body is capped and the API key and
+// credential-looking headers are redacted. Raw responses are never persisted.
+
+// Max body bytes kept per probe
+const maxRawBodyBytes = 16 << 10
+
+const rawRedacted = "[redacted]"
+
+type rawCaptureKey struct{}
+
+// RawResponse is what a probe received, redacted
+type RawResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// The body was longer than maxRawBodyBytes (or not read to the end by the probe)
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+}
+
+// withRawCapture marks ctx so probes record their raw responses
+func withRawCapture(ctx context.Context, enabled bool) context.Context {
+	if !enabled {
+		return ctx
+	}
+	return context.WithValue(ctx, rawCaptureKey{}, true)
+}
+
+func rawCaptureEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(rawCaptureKey{}).(bool)
+	return enabled
+}
+
+// rawBodyRecorder keeps the first maxRawBodyBytes read through it
+type rawBodyRecorder struct {
+	io.ReadCloser
+	buf       []byte
+	truncated bool
+}
+
+func (r *rawBodyRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	room := maxRawBodyBytes - len(r.buf)
+	if n > room {
+		r.truncated = true
+		r.buf = append(r.buf, p[:room]...)
+	} else {
+		r.buf = append(r.buf, p[:n]...)
+	}
+	return n, err
+}
+
+// recordRawBody makes resp.Body keep a copy of what the probe reads from it
+func recordRawBody(resp *http.Response) *rawBodyRecorder {
+	rec := &rawBodyRecorder{ReadCloser: resp.Body}
+	resp.Body = rec
+	return rec
+}
+
+// rawResponse builds the redacted RawResponse of resp from the bytes the probe read
+func (r *rawBodyRecorder) rawResponse(resp *http.Response, apiKey string) *RawResponse {
+	raw := &RawResponse{
+		Status:        resp.StatusCode,
+		Headers:       make(map[string]string, len(resp.Header)),
+		Body:          redactAPIKey(string(r.buf), apiKey),
+		BodyTruncated: r.truncated,
+	}
+	for name, values := range resp.Header {
+		value := strings.Join(values, ", ")
+		if isCredentialHeader(name) {
+			value = rawRedacted
+		}
+		raw.Headers[name] = redactAPIKey(value, apiKey)
+	}
+	return raw
+}
+
+// isCredentialHeader reports whether a header may carry a credential or session
+func isCredentialHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "cookie" || name == "set-cookie" {
+		return true
+	}
+	for _, word := range []string{"auth", "key", "token", "secret", "session"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAPIKey(s, apiKey string) string {
+	if apiKey == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, apiKey, rawRedacted)
+}
+
+// withoutRawResponses returns fps with Raw cleared, for persisting a result
+func withoutRawResponses(fps []Fingerprint) []Fingerprint {
+	out := make([]Fingerprint, len(fps))
+	for i, fp := range fps {
+		fp.Raw = nil
+		out[i] = fp
+	}
+	return out
+}
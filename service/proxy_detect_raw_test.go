@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeOnceRawCapture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("X-Upstream-Token", "tok-1")
+		w.Header().Set("X-Echo", "key sk-raw-secret")
+		w.Header().Set("Request-Id", "req_01")
+		_, _ = io.WriteString(w, `{"id":"msg_01","type":"message","role":"assistant","content":[{"type":"text","text":"bad key sk-raw-secret"}],"usage":{"input_tokens":5,"output_tokens":3}}`)
+	}))
+	defer srv.Close()
+
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-raw-secret", AnthropicVersion: defaultAnthropicVersion}
+	client := newUnsafeHTTPClient(5 * time.Second)
+
+	// Off by default
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Nil(t, fp.Raw)
+
+	fp = probeOnce(withRawCapture(context.Background(), true), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.NotNil(t, fp.Raw)
+	require.Equal(t, http.StatusOK, fp.Raw.Status)
+	require.Contains(t, fp.Raw.Body, `"msg_01"`)
+	require.NotContains(t, fp.Raw.Body, "sk-raw-secret")
+	require.False(t, fp.Raw.BodyTruncated)
+	require.Equal(t, rawRedacted, fp.Raw.Headers["Set-Cookie"])
+	require.Equal(t, rawRedacted, fp.Raw.Headers["X-Upstream-Token"])
+	require.Equal(t, "key "+rawRedacted, fp.Raw.Headers["X-Echo"])
+	require.Equal(t, "req_01", fp.Raw.Headers["Request-Id"])
+
+	// Raw responses are not persisted
+	require.Nil(t, withoutRawResponses([]Fingerprint{fp})[0].Raw)
+	require.NotNil(t, fp.Raw)
+}
+
+func TestRawBodyRecorderLimit(t *testing.T) {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(strings.Repeat("a", maxRawBodyBytes+10)))}
+	rec := recordRawBody(resp)
+	_, _ = io.ReadAll(resp.Body)
+	raw := rec.rawResponse(resp, "")
+	require.Len(t, raw.Body, maxRawBodyBytes)
+	require.True(t, raw.BodyTruncated)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedirectRequest(t *testing.T, target string, via ...string) (*http.Request, []*http.Request) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, target, nil)
+	require.NoError(t, err)
+	var viaReqs []*http.Request
+	for _, u := range via {
+		r, err := http.NewRequest(http.MethodPost, u, nil)
+		require.NoError(t, err)
+		viaReqs = append(viaReqs, r)
+	}
+	return req, viaReqs
+}
+
+func TestProbeRedirectPolicy(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ProbeFollowRedirects = true
+	setting.ProbeMaxRedirects = 2
+	setting.ProbeRedirectAllowedHosts = []string{"10.0.0.5"}
+
+	safe := probeRedirectPolicy(true)
+	admin := probeRedirectPolicy(false)
+
+	// Redirect to a private IP is blocked for the safe client even when allowlisted
+	req, via := newRedirectRequest(t, "http://10.0.0.5/v1/messages", "http://8.8.8.8/v1/messages")
+	require.ErrorContains(t, safe(req, via), "private IP")
+
+	// Cross-host redirect to a non-allowlisted host is blocked
+	req, via = newRedirectRequest(t, "http://169.254.169.254/latest/meta-data", "http://8.8.8.8/v1/messages")
+	require.ErrorContains(t, admin(req, via), "another host")
+
+	// Admin client: same-host redirect on an internal address is fine
+	req, via = newRedirectRequest(t, "http://10.0.0.5/anthropic/v1/messages", "http://10.0.0.5/v1/messages")
+	require.NoError(t, admin(req, via))
+
+	// Admin client: allowlisted cross-host hop still gets the IP check
+	req, via = newRedirectRequest(t, "http://10.0.0.5/v1/messages", "http://10.0.0.9/v1/messages")
+	require.ErrorContains(t, admin(req, via), "private IP")
+
+	// Non-http scheme
+	req, via = newRedirectRequest(t, "file:///etc/passwd", "http://10.0.0.5/v1/messages")
+	require.ErrorContains(t, admin(req, via), "redirect blocked")
+
+	// Redirect cap
+	req, via = newRedirectRequest(t, "http://10.0.0.5/c", "http://10.0.0.5/a", "http://10.0.0.5/b", "http://10.0.0.5/c")
+	require.ErrorContains(t, admin(req, via), "stopped after 2 redirects")
+
+	// Redirects disabled
+	setting.ProbeFollowRedirects = false
+	req, via = newRedirectRequest(t, "http://10.0.0.5/b", "http://10.0.0.5/a")
+	require.ErrorIs(t, admin(req, via), http.ErrUseLastResponse)
+}
+
+func TestProbeRedirectToPrivateIPBlocked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	start := time.Now()
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.NotEmpty(t, fp.Error)
+	require.Equal(t, ProbeErrorNetwork, fp.ErrorClass)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
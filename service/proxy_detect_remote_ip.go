@@ -0,0 +1,52 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// The connected peer of each probe is recorded so channels resolving to the same backend can be
+// correlated. Through an outbound proxy the peer is the proxy itself.
+
+// IPv6 ranges blocked beside those net.IP classifies as private, loopback or link-local
+var blockedIPv6Nets = []*net.IPNet{
+	// Deprecated site-local unicast, still routed internally on some networks
+	mustParseCIDR("fec0::/10"),
+}
+
+// nat64Prefix is the well-known NAT64 prefix; the IPv4 address in its low 32 bits is checked too
+var nat64Prefix = mustParseCIDR("64:ff9b::/96")
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// embeddedIPv4 returns the IPv4 address a NAT64 address translates to, nil for any other IP
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil || !nat64Prefix.Contains(ip) {
+		return nil
+	}
+	return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+}
+
+// traceRemoteIP returns req recording the IP of the connection it is sent on into fp.RemoteIP
+func traceRemoteIP(req *http.Request, fp *Fingerprint) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				fp.RemoteIP = host
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// distinctRemoteIPs returns the remote IPs of fps in first-seen order
+func distinctRemoteIPs(fps []Fingerprint) []string {
+	return distinctValues(fps, func(fp Fingerprint) string { return fp.RemoteIP })
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckProbeIPv6(t *testing.T) {
+	blocked := []string{
+		"::1",
+		"::",
+		"fc00::1",
+		"fd12:3456:789a::1",
+		"fe80::1",
+		"ff02::1",
+		"ff01::1",
+		"fec0::1",
+		"::ffff:127.0.0.1",
+		"::ffff:10.0.0.1",
+		"64:ff9b::a00:1",  // NAT64 of 10.0.0.1
+		"64:ff9b::7f00:1", // NAT64 of 127.0.0.1
+	}
+	for _, s := range blocked {
+		require.Error(t, checkProbeIP(net.ParseIP(s)), s)
+	}
+	for _, s := range []string{"2606:4700::6810:84e5", "2001:4860:4860::8888", "64:ff9b::808:808", "::ffff:8.8.8.8"} {
+		require.NoError(t, checkProbeIP(net.ParseIP(s)), s)
+	}
+}
+
+func TestSafeDialerBlocksIPv6(t *testing.T) {
+	dial := safeDialer()
+	for _, addr := range []string{"[::1]:443", "[fd00::1]:443", "[fe80::1]:443"} {
+		_, err := dial(context.Background(), "tcp", addr)
+		require.EqualError(t, err, "connection to private IP blocked", addr)
+	}
+}
+
+func TestProbeRecordsRemoteIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test", AnthropicVersion: defaultAnthropicVersion}
+	fp := probeOnce(context.Background(), newUnsafeHTTPClient(5*time.Second), target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, "127.0.0.1", fp.RemoteIP)
+
+	result := analyze([]Fingerprint{fp, fp, {RemoteIP: "203.0.113.9"}}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, []string{"127.0.0.1", "203.0.113.9"}, result.RemoteIPs)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Replaying saved fingerprints re-runs the scoring without touching the upstream, e.g. to see
+// how a weight change would have judged past detections.
+
+// Max fingerprints accepted by one replay, well above what a thorough detection records
+const maxReplayFingerprints = 64
+
+// Probe types a detection records, the only ones a replayed fingerprint may carry
+var replayProbeTypes = map[string]bool{
+	"tool":             true,
+	"thinking":         true,
+	"stream":           true,
+	"max_tokens":       true,
+	"system":           true,
+	"stop_sequences":   true,
+	"identity":         true,
+	"vision":           true,
+	"cache":            true,
+	"header_case":      true,
+	"bad_version":      true,
+	"service_tier":     true,
+	"auth":             true,
+	"simple":           true,
+	"chat_completions": true,
+}
+
+// ValidateReplayFingerprints checks that saved fingerprints look like ones a detection records
+func ValidateReplayFingerprints(fingerprints []Fingerprint) error {
+	if len(fingerprints) == 0 {
+		return fmt.Errorf("no fingerprints")
+	}
+	if len(fingerprints) > maxReplayFingerprints {
+		return fmt.Errorf("too many fingerprints: %d, at most %d", len(fingerprints), maxReplayFingerprints)
+	}
+	for i, fp := range fingerprints {
+		if !replayProbeTypes[fp.ProbeType] {
+			return fmt.Errorf("fingerprint %d: unknown probe_type %q", i+1, fp.ProbeType)
+		}
+		if fp.LatencyMs < 0 || fp.OutputTokens < 0 || fp.RatelimitInputLimit < 0 || fp.Retries < 0 {
+			return fmt.Errorf("fingerprint %d: negative latency, token or retry count", i+1)
+		}
+		if fp.HTTPStatus != 0 && (fp.HTTPStatus < 100 || fp.HTTPStatus > 599) {
+			return fmt.Errorf("fingerprint %d: invalid http_status %d", i+1, fp.HTTPStatus)
+		}
+		if fp.ErrorClass != "" && fp.Error == "" {
+			return fmt.Errorf("fingerprint %d: error_class without error", i+1)
+		}
+	}
+	return nil
+}
+
+// ReplayFingerprints scores saved fingerprints for model with the given weights, exactly as a
+// live detection would have
+func ReplayFingerprints(fingerprints []Fingerprint, model string, w system_setting.ScoringWeights, lang string) (DetectResult, error) {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return DetectResult{}, fmt.Errorf("model is required")
+	}
+	if err := ValidateReplayFingerprints(fingerprints); err != nil {
+		return DetectResult{}, err
+	}
+	result := analyze(fingerprints, model, w)
+	result.localize(lang)
+	return result, nil
+}
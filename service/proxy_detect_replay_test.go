@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayFingerprints(t *testing.T) {
+	model := "claude-sonnet-4-5-20250929"
+	w := system_setting.DefaultScoringWeights
+	live := analyze([]Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("thinking")}, model, w)
+
+	// Fingerprints saved as JSON replay to the same verdict and scores
+	var saved []Fingerprint
+	require.NoError(t, common.Unmarshal([]byte(common.GetJsonString(live.Fingerprints)), &saved))
+	replayed, err := ReplayFingerprints(saved, model, w, DetectLangEn)
+	require.NoError(t, err)
+	require.Equal(t, live.Verdict, replayed.Verdict)
+	require.Equal(t, live.Scores, replayed.Scores)
+	require.Equal(t, "Anthropic official API", replayed.VerdictText)
+
+	// Tuned weights change the scores without re-probing (both fingerprints carry a toolu_ id)
+	tuned := w
+	tuned.ToolIDAnthropic = 0
+	retuned, err := ReplayFingerprints(saved, model, tuned, "")
+	require.NoError(t, err)
+	require.Equal(t, live.Scores["anthropic"]-2*w.ToolIDAnthropic, retuned.Scores["anthropic"])
+
+	_, err = ReplayFingerprints(saved, " ", w, "")
+	require.ErrorContains(t, err, "model is required")
+}
+
+func TestValidateReplayFingerprints(t *testing.T) {
+	require.NoError(t, ValidateReplayFingerprints([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "bad_version", VersionErrorShape: VersionErrorAnthropic}}))
+
+	require.ErrorContains(t, ValidateReplayFingerprints(nil), "no fingerprints")
+	require.ErrorContains(t, ValidateReplayFingerprints(make([]Fingerprint, maxReplayFingerprints+1)), "too many")
+	require.ErrorContains(t, ValidateReplayFingerprints([]Fingerprint{{ProbeType: "guess"}}), `unknown probe_type "guess"`)
+	require.ErrorContains(t, ValidateReplayFingerprints([]Fingerprint{{ProbeType: "tool", LatencyMs: -1}}), "negative")
+	require.ErrorContains(t, ValidateReplayFingerprints([]Fingerprint{{ProbeType: "tool", HTTPStatus: 42}}), "invalid http_status")
+	require.ErrorContains(t, ValidateReplayFingerprints([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "tool", ErrorClass: ProbeErrorHTTP}}), "fingerprint 2")
+}
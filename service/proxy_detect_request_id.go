@@ -0,0 +1,54 @@
+package service
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Anthropic answers every request with a request-id header of the form req_<base62>, next to
+// a msg_<base62> body id. Proxies that re-serve the reply drop the header or set their own,
+// usually an x-request-id UUID, while the body id still looks genuine.
+
+// Formats recorded in Fingerprint.RequestIDFormat
+const (
+	RequestIDFormatAnthropic = "anthropic"
+	RequestIDFormatUUID      = "uuid"
+	RequestIDFormatOther     = "other"
+	RequestIDFormatNone      = "none"
+)
+
+var requestIDPattern = regexp.MustCompile(`^req_[0-9A-Za-z]{20,}$`)
+
+// responseRequestID returns the request-id header, falling back to x-request-id; fromAnthropic
+// is false for the fallback, which Anthropic does not send
+func responseRequestID(header http.Header) (id string, fromAnthropic bool) {
+	if id := header.Get("Request-Id"); id != "" {
+		return id, true
+	}
+	return header.Get("X-Request-Id"), false
+}
+
+// classifyRequestID classifies the format of a request id header value
+func classifyRequestID(id string) string {
+	switch {
+	case id == "":
+		return RequestIDFormatNone
+	case requestIDPattern.MatchString(id):
+		return RequestIDFormatAnthropic
+	case uuidPattern.MatchString(id):
+		return RequestIDFormatUUID
+	}
+	return RequestIDFormatOther
+}
+
+// checkRequestID records the request id header of a reply whose body was already parsed.
+// The header is consistent when Anthropic's own request-id carries a req_ id alongside a
+// genuine msg_ id that it does not merely repeat.
+func checkRequestID(fp *Fingerprint, header http.Header) {
+	id, fromAnthropic := responseRequestID(header)
+	fp.RequestIDHeader = id
+	fp.RequestIDFormat = classifyRequestID(id)
+	fp.RequestIDConsistent = fromAnthropic && fp.RequestIDFormat == RequestIDFormatAnthropic &&
+		fp.MsgIDSource == "anthropic" && strings.TrimPrefix(id, "req_") != strings.TrimPrefix(fp.MsgID, anthropicMsgPrefix)
+}
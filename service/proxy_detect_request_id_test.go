@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyRequestID(t *testing.T) {
+	require.Equal(t, RequestIDFormatAnthropic, classifyRequestID("req_011CUaBcDeFgHiJkLmNoPqRsTu"))
+	require.Equal(t, RequestIDFormatUUID, classifyRequestID("3f1c2a9e-8b7d-4c6e-9f01-23456789abcd"))
+	require.Equal(t, RequestIDFormatOther, classifyRequestID("req_123"))
+	require.Equal(t, RequestIDFormatOther, classifyRequestID("20250101120000123456789"))
+	require.Equal(t, RequestIDFormatNone, classifyRequestID(""))
+}
+
+func TestCheckRequestID(t *testing.T) {
+	genuine := func() Fingerprint {
+		return Fingerprint{MsgID: "msg_011CUzYxWvUtSrQpOnMlKjIhGf", MsgIDSource: "anthropic"}
+	}
+	cases := []struct {
+		name       string
+		header     http.Header
+		format     string
+		consistent bool
+	}{
+		{"anthropic", http.Header{"Request-Id": {"req_011CUaBcDeFgHiJkLmNoPqRsTu"}}, RequestIDFormatAnthropic, true},
+		{"missing", http.Header{}, RequestIDFormatNone, false},
+		{"proxy uuid", http.Header{"X-Request-Id": {"3f1c2a9e-8b7d-4c6e-9f01-23456789abcd"}}, RequestIDFormatUUID, false},
+		// Only Anthropic's own header counts, even with the right format
+		{"x-request-id", http.Header{"X-Request-Id": {"req_011CUaBcDeFgHiJkLmNoPqRsTu"}}, RequestIDFormatAnthropic, false},
+		// Derived from the body id by the proxy
+		{"echoed msg id", http.Header{"Request-Id": {"req_011CUzYxWvUtSrQpOnMlKjIhGf"}}, RequestIDFormatAnthropic, false},
+	}
+	for _, tc := range cases {
+		fp := genuine()
+		checkRequestID(&fp, tc.header)
+		require.Equal(t, tc.format, fp.RequestIDFormat, tc.name)
+		require.Equal(t, tc.consistent, fp.RequestIDConsistent, tc.name)
+	}
+
+	rewritten := Fingerprint{MsgID: "chatcmpl-abc", MsgIDSource: "rewritten"}
+	checkRequestID(&rewritten, http.Header{"Request-Id": {"req_011CUaBcDeFgHiJkLmNoPqRsTu"}})
+	require.False(t, rewritten.RequestIDConsistent)
+}
+
+func TestProbeRequestIDHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "req_011CUaBcDeFgHiJkLmNoPqRsTu")
+		_, _ = w.Write([]byte(usageConsistentBody))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	fp := probeOnce(context.Background(), client, ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "simple")
+	require.Empty(t, fp.Error)
+	require.Equal(t, "req_011CUaBcDeFgHiJkLmNoPqRsTu", fp.RequestIDHeader)
+	require.Equal(t, fp.MsgIDSource == "anthropic", fp.RequestIDConsistent)
+}
+
+func TestAnalyzeRequestID(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	withRequestID := func(format, header string, consistent bool) DetectResult {
+		fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+		for i := range fps {
+			fps[i].RequestIDFormat = format
+			fps[i].RequestIDHeader = header
+			fps[i].RequestIDConsistent = consistent
+		}
+		return analyze(fps, model, w)
+	}
+	// Fingerprints saved without the header check are not scored
+	base := withRequestID("", "", false)
+	require.False(t, hasEvidence(base, "request-id"))
+
+	// Counted once across rounds
+	genuine := withRequestID(RequestIDFormatAnthropic, "req_011CUaBcDeFgHiJkLmNoPqRsTu", true)
+	require.Equal(t, base.Scores["anthropic"]+w.RequestIDAnthropic, genuine.Scores["anthropic"])
+
+	missing := withRequestID(RequestIDFormatNone, "", false)
+	require.Equal(t, base.Scores["anthropic"]-w.RequestIDRewrittenPenalty, missing.Scores["anthropic"])
+	require.True(t, hasEvidence(missing, "响应缺少 request-id 头"))
+
+	rewritten := withRequestID(RequestIDFormatUUID, "3f1c2a9e-8b7d-4c6e-9f01-23456789abcd", false)
+	require.Equal(t, base.Scores["anthropic"]-w.RequestIDRewrittenPenalty, rewritten.Scores["anthropic"])
+	require.Contains(t, strings.Join(rewritten.Evidence, "\n"), "[R1] [!] 消息 ID 为 Anthropic 格式，但 request-id 被改写: 3f1c2a9e-8b7d-4c6e-9f01-23456789abcd")
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Verdicts that describe a failed run rather than the target. They are never cached, so a
+// retry after fixing the key or network probes again, and never count as a verdict change.
+var runFailureVerdicts = map[string]bool{
+	"invalid_key":      true,
+	"unreachable":      true,
+	"timeout":          true,
+	"unavailable":      true,
+	"budget_exhausted": true,
+}
+
+// runFailureVerdictList returns runFailureVerdicts as a sorted list for queries
+func runFailureVerdictList() []string {
+	verdicts := make([]string, 0, len(runFailureVerdicts))
+	for verdict := range runFailureVerdicts {
+		verdicts = append(verdicts, verdict)
+	}
+	sort.Strings(verdicts)
+	return verdicts
+}
+
+type resultCacheEntry struct {
+	result    DetectResult
+	expiresAt time.Time
+}
+
+// detectResultCache keeps recent detection results so repeating a detection within the
+// TTL does not spend quota on the same answer
+type detectResultCache struct {
+	mu      sync.Mutex
+	entries map[string]resultCacheEntry
+}
+
+var proxyDetectResultCache = &detectResultCache{entries: make(map[string]resultCacheEntry)}
+
+func init() {
+	RegisterProxyDetectCache("result", proxyDetectResultCache)
+}
+
+// detectResultCacheKey hashes everything that changes what the probes send. The API key only
+// enters the HMAC, so it is never kept in memory in plaintext as part of a key.
+func detectResultCacheKey(baseURL, apiKey, model string, opts DetectOptions) string {
+	return common.GenerateHMAC(strings.Join([]string{
+		strings.TrimRight(strings.ToLower(strings.TrimSpace(baseURL)), "/"),
+		apiKey,
+		model,
+		strconv.Itoa(opts.Rounds),
+		opts.Preset,
+		opts.AnthropicVersion,
+		opts.MessagesPath,
+		strconv.FormatBool(opts.CheckVersions),
+		strconv.FormatBool(opts.VerifyRatelimit),
+		strconv.FormatBool(opts.CaptureTLS),
+		opts.OutboundProxy,
+		common.GetJsonString(opts.CustomPrompts),
+		strconv.FormatBool(opts.IncludeRaw),
+		strings.Join(probeSelectionKey(opts.Probes), ","),
+		common.GetJsonString(opts.ExtraHeaders),
+		strconv.FormatBool(opts.OverrideCoreHeaders),
+	}, "\x00"))
+}
+
+func (c *detectResultCache) get(key string, now time.Time) (DetectResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return DetectResult{}, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return DetectResult{}, false
+	}
+	return entry.result, true
+}
+
+func (c *detectResultCache) set(key string, result DetectResult, now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop expired entries on write so the map does not grow with one-off targets
+	for k, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = resultCacheEntry{result: result, expiresAt: now.Add(ttl)}
+}
+
+// Clear drops all cached results
+func (c *detectResultCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]resultCacheEntry)
+	return n
+}
+
+func detectResultCacheTTL() time.Duration {
+	return time.Duration(system_setting.GetProxyDetectSetting().ResultCacheTTLMinutes) * time.Minute
+}
+
+// cachedDetectResult returns a fresh cached result marked Cached. The probes of a cached
+// result spent no tokens in this run, so TokenUsage is dropped.
+func cachedDetectResult(key string) (DetectResult, bool) {
+	if detectResultCacheTTL() <= 0 {
+		return DetectResult{}, false
+	}
+	result, ok := proxyDetectResultCache.get(key, time.Now())
+	if !ok {
+		return DetectResult{}, false
+	}
+	result.Cached = true
+	result.TokenUsage = nil
+	return result, true
+}
+
+// storeDetectResult caches result unless caching is disabled or the run failed
+func storeDetectResult(key string, result DetectResult) {
+	ttl := detectResultCacheTTL()
+	if ttl <= 0 || runFailureVerdicts[result.Verdict] {
+		return
+	}
+	proxyDetectResultCache.set(key, result, time.Now(), ttl)
+}
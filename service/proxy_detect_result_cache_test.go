@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectResultCacheKey(t *testing.T) {
+	opts := DetectOptions{Rounds: 3}
+	key := detectResultCacheKey("https://api.example.com/", "sk-secret", "claude-sonnet-4-5-20250929", opts)
+	require.NotContains(t, key, "sk-secret")
+	require.Equal(t, key, detectResultCacheKey("https://API.example.com", "sk-secret", "claude-sonnet-4-5-20250929", opts))
+	require.NotEqual(t, key, detectResultCacheKey("https://api.example.com", "sk-other", "claude-sonnet-4-5-20250929", opts))
+	require.NotEqual(t, key, detectResultCacheKey("https://api.example.com", "sk-secret", "claude-sonnet-4-5-20250929", DetectOptions{Rounds: 5}))
+	require.NotEqual(t, key, detectResultCacheKey("https://api.example.com", "sk-secret", "claude-sonnet-4-5-20250929", DetectOptions{Rounds: 3, CustomPrompts: map[string]string{"simple": "hi"}}))
+}
+
+func TestDetectResultCacheExpiry(t *testing.T) {
+	cache := &detectResultCache{entries: make(map[string]resultCacheEntry)}
+	now := time.Now()
+	cache.set("a", DetectResult{Verdict: "anthropic"}, now, time.Minute)
+
+	result, ok := cache.get("a", now.Add(30*time.Second))
+	require.True(t, ok)
+	require.Equal(t, "anthropic", result.Verdict)
+
+	_, ok = cache.get("a", now.Add(time.Minute))
+	require.False(t, ok)
+	require.Zero(t, cache.Clear())
+}
+
+func TestDetectSingleModelCached(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 10
+	t.Cleanup(func() { proxyDetectResultCache.Clear() })
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	opts := DetectOptions{Rounds: 1, SkipSSRFCheck: true}
+	first := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts)
+	require.False(t, first.Cached)
+	probed := requests.Load()
+	require.Positive(t, probed)
+
+	second := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts)
+	require.True(t, second.Cached)
+	require.Equal(t, first.Verdict, second.Verdict)
+	require.Equal(t, probed, requests.Load())
+
+	opts.Force = true
+	forced := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts)
+	require.False(t, forced.Cached)
+	require.Greater(t, requests.Load(), probed)
+
+	setting.ResultCacheTTLMinutes = 0
+	opts.Force = false
+	require.False(t, detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts).Cached)
+}
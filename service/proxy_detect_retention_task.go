@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const proxyDetectRetentionTickInterval = 1 * time.Hour
+
+var (
+	proxyDetectRetentionOnce    sync.Once
+	proxyDetectRetentionRunning atomic.Bool
+)
+
+func StartProxyDetectRetentionTask() {
+	proxyDetectRetentionOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("proxy detect retention task started: tick=%s", proxyDetectRetentionTickInterval))
+			ticker := time.NewTicker(proxyDetectRetentionTickInterval)
+			defer ticker.Stop()
+
+			runProxyDetectRetentionOnce()
+			for range ticker.C {
+				runProxyDetectRetentionOnce()
+			}
+		})
+	})
+}
+
+func runProxyDetectRetentionOnce() {
+	if !proxyDetectRetentionRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer proxyDetectRetentionRunning.Store(false)
+
+	setting := system_setting.GetProxyDetectSetting()
+	maxAgeSeconds := int64(setting.RetentionDays) * 24 * 3600
+	if maxAgeSeconds <= 0 && setting.RetentionKeepLatest <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	n, err := model.PruneProxyDetectLogs(maxAgeSeconds, setting.RetentionKeepLatest, runFailureVerdictList())
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect retention task failed: %v", err))
+		return
+	}
+	if n > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("proxy detect retention: pruned %d records", n))
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const (
+	// Upper bound on ProbeMaxAttempts
+	maxProbeAttempts = 5
+	// Longest wait before a retry; a longer Retry-After ends the retries instead
+	maxProbeRetryDelay = 10 * time.Second
+	// Body bytes drained from a retried response so the connection can be reused
+	maxRetryDrainBytes = 4 << 10
+)
+
+// isRetryableProbeStatus reports whether status is transient: rate limited, a gateway
+// error or Anthropic's 529 overloaded_error. 400/401/403 and the rest fail at once.
+func isRetryableProbeStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, statusOverloaded:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header in delay-seconds or HTTP-date form
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// probeRetryDelay returns the wait before retry number attempt (1-based): Retry-After when
+// the response carries one, otherwise base doubled per attempt
+func probeRetryDelay(header http.Header, attempt int, base time.Duration) (time.Duration, bool) {
+	if delay, ok := parseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+		return delay, true
+	}
+	return base << (attempt - 1), false
+}
+
+// doProbeRequest sends req, retrying transient statuses up to ProbeMaxAttempts with
+// exponential backoff (or the advertised Retry-After). A retry is skipped when its wait
+// exceeds maxProbeRetryDelay or the ctx deadline, and the last response is returned as is.
+// fp records the retries; t0 is the start of the attempt that produced the response.
+func doProbeRequest(ctx context.Context, client *http.Client, req *http.Request, fp *Fingerprint) (resp *http.Response, t0 time.Time, err error) {
+	setting := system_setting.GetProxyDetectSetting()
+	attempts := min(max(setting.ProbeMaxAttempts, 1), maxProbeAttempts)
+	base := time.Duration(max(setting.ProbeRetryBaseDelayMs, 0)) * time.Millisecond
+
+	waitedRetryAfter := false
+	for attempt := 1; ; attempt++ {
+		t0 = time.Now()
+		resp, err = client.Do(traceRemoteIP(req, fp))
+		if err != nil {
+			return nil, t0, err
+		}
+		if attempt >= attempts || !isRetryableProbeStatus(resp.StatusCode) {
+			fp.RetryAfterHonored = waitedRetryAfter && resp.StatusCode == http.StatusOK
+			return resp, t0, nil
+		}
+
+		delay, fromHeader := probeRetryDelay(resp.Header, attempt, base)
+		if delay > maxProbeRetryDelay {
+			return resp, t0, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return resp, t0, nil
+		}
+		next, cloneErr := cloneProbeRequest(ctx, req)
+		if cloneErr != nil {
+			return resp, t0, nil
+		}
+		// The drained body still tells an Anthropic 529 apart from a proxy's
+		drained, _ := io.ReadAll(io.LimitReader(resp.Body, maxRetryDrainBytes))
+		resp.Body.Close()
+		recordOverloaded(fp, resp.StatusCode, drained)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, t0, ctx.Err()
+		case <-timer.C:
+		}
+		fp.Retries++
+		waitedRetryAfter = fromHeader
+		req = next
+	}
+}
+
+// cloneProbeRequest copies req with a fresh body for another attempt
+func cloneProbeRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	next := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	d, ok := parseRetryAfter("3", now)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(2*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Zero(t, d)
+
+	_, ok = parseRetryAfter("", now)
+	require.False(t, ok)
+	_, ok = parseRetryAfter("-1", now)
+	require.False(t, ok)
+	_, ok = parseRetryAfter("soon", now)
+	require.False(t, ok)
+}
+
+func TestProbeOnceRetry(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ProbeMaxAttempts = 3
+	setting.ProbeRetryBaseDelayMs = 1
+
+	var requests atomic.Int32
+	var failures int32
+	var failStatus int
+	var retryAfter string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(failStatus)
+			return
+		}
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	probe := func(status int, fail int32, after string) Fingerprint {
+		requests.Store(0)
+		failStatus, failures, retryAfter = status, fail, after
+		return probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "tool")
+	}
+
+	// 429 with Retry-After, then success
+	fp := probe(http.StatusTooManyRequests, 1, "0")
+	require.Empty(t, fp.Error)
+	require.Equal(t, 1, fp.Retries)
+	require.True(t, fp.RetryAfterHonored)
+
+	// Gateway errors back off without Retry-After
+	fp = probe(http.StatusBadGateway, 2, "")
+	require.Empty(t, fp.Error)
+	require.Equal(t, 2, fp.Retries)
+	require.False(t, fp.RetryAfterHonored)
+
+	// Attempts are capped; the last response is the error
+	fp = probe(http.StatusServiceUnavailable, 5, "")
+	require.Equal(t, http.StatusServiceUnavailable, fp.HTTPStatus)
+	require.Equal(t, 2, fp.Retries)
+	require.EqualValues(t, 3, requests.Load())
+
+	// Client errors fail fast
+	fp = probe(http.StatusUnauthorized, 5, "")
+	require.Equal(t, ProbeErrorAuth, fp.ErrorClass)
+	require.Zero(t, fp.Retries)
+	require.EqualValues(t, 1, requests.Load())
+
+	// A Retry-After beyond the longest wait is not retried
+	fp = probe(http.StatusTooManyRequests, 1, "60")
+	require.Equal(t, http.StatusTooManyRequests, fp.HTTPStatus)
+	require.EqualValues(t, 1, requests.Load())
+}
+
+func TestProbeRetryRespectsDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	fp := probeOnce(ctx, newUnsafeHTTPClient(5*time.Second), ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "tool")
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, http.StatusTooManyRequests, fp.HTTPStatus)
+	require.Zero(t, fp.Retries)
+}
+
+func TestAnalyzeRetryAfterHonored(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	plain := analyze([]Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}, "claude-test", w)
+
+	retried := anthropicFingerprint("tool")
+	retried.Retries = 1
+	retried.RetryAfterHonored = true
+	result := analyze([]Fingerprint{retried, retried}, "claude-test", w)
+	require.Equal(t, plain.Scores["anthropic"]+w.RetryAfterHonored, result.Scores["anthropic"], "counted once")
+	require.Contains(t, result.Evidence, "[R1] 按 Retry-After 等待后重试成功 (1 次重试)，限流响应与官方一致")
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// The task ticks every minute and reads the setting each time, so enabling, disabling or
+// changing the interval takes effect without a restart
+const scheduledDetectTickInterval = 1 * time.Minute
+
+var (
+	scheduledDetectOnce    sync.Once
+	scheduledDetectRunning atomic.Bool
+	scheduledDetectLastRun atomic.Int64
+)
+
+func StartProxyDetectScheduledTask() {
+	scheduledDetectOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("proxy detect scheduled task started: tick=%s", scheduledDetectTickInterval))
+			ticker := time.NewTicker(scheduledDetectTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				runScheduledDetectOnce()
+			}
+		})
+	})
+}
+
+// scheduledDetectDue reports whether a scheduled run should start at now (unix seconds)
+func scheduledDetectDue(setting *system_setting.ProxyDetectSetting, now, lastRun int64) bool {
+	if !setting.ScheduledDetectEnabled || setting.ScheduledDetectIntervalHours <= 0 {
+		return false
+	}
+	return now-lastRun >= int64(setting.ScheduledDetectIntervalHours)*3600
+}
+
+// scheduledDetectOptions selects every Anthropic channel with the default rounds and preset
+func scheduledDetectOptions(setting *system_setting.ProxyDetectSetting) ChannelDetectOptions {
+	return ChannelDetectOptions{Concurrency: setting.ScheduledDetectConcurrency}
+}
+
+// runScheduledDetectOnce detects every Anthropic channel through DetectChannels, which
+// persists each result and stores the verdict on the channel. A run still in progress when
+// the next tick comes is never overlapped.
+func runScheduledDetectOnce() {
+	setting := system_setting.GetProxyDetectSetting()
+	if !scheduledDetectDue(setting, common.GetTimestamp(), scheduledDetectLastRun.Load()) {
+		return
+	}
+	if !scheduledDetectRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer scheduledDetectRunning.Store(false)
+
+	ctx := context.Background()
+	summary, err := DetectChannels(ctx, scheduledDetectOptions(setting))
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("proxy detect scheduled run: failed to load channels: %v", err))
+		return
+	}
+	scheduledDetectLastRun.Store(common.GetTimestamp())
+	logger.LogInfo(ctx, fmt.Sprintf("proxy detect scheduled run: %d channels, detected=%d changed=%d failed=%d",
+		summary.Total, summary.Detected, summary.Changed, summary.Failed))
+}
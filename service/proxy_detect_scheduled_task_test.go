@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduledDetectDue(t *testing.T) {
+	setting := &system_setting.ProxyDetectSetting{ScheduledDetectIntervalHours: 6}
+	const now = int64(1_700_000_000)
+
+	require.False(t, scheduledDetectDue(setting, now, 0))
+
+	setting.ScheduledDetectEnabled = true
+	require.True(t, scheduledDetectDue(setting, now, 0))
+	require.False(t, scheduledDetectDue(setting, now, now-5*3600))
+	require.True(t, scheduledDetectDue(setting, now, now-6*3600))
+
+	setting.ScheduledDetectIntervalHours = 0
+	require.False(t, scheduledDetectDue(setting, now, 0))
+}
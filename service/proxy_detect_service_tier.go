@@ -0,0 +1,61 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// Anthropic reports the tier that served a request in usage.service_tier: standard, priority
+// or batch. Fakes often hardcode "standard" or inject values Anthropic never returns.
+//
+// The service_tier probe also requests service_tier "priority". The Messages API only accepts
+// "auto" or "standard_only" there, so Anthropic rejects the request with HTTP 400 and an
+// invalid_request_error naming service_tier. A proxy that strips the field or echoes the
+// requested tier answers normally instead.
+
+// service_tier values Anthropic returns in usage
+var anthropicServiceTiers = []string{"standard", "priority", "batch"}
+
+// service_tier sent by the service_tier probe
+const requestedServiceTier = "priority"
+
+// Classes recorded in Fingerprint.ServiceTierResponse
+const (
+	ServiceTierRejectedAnthropic = "rejected_anthropic"
+	ServiceTierRejectedRewritten = "rejected_rewritten"
+	ServiceTierAccepted          = "accepted"
+)
+
+// isKnownServiceTier reports whether tier is a service_tier value Anthropic returns
+func isKnownServiceTier(tier string) bool {
+	return slices.Contains(anthropicServiceTiers, tier)
+}
+
+// buildServiceTierPayload builds the service_tier probe request body
+func buildServiceTierPayload(model string) map[string]any {
+	payload := buildProbePayload(model, "simple")
+	payload["service_tier"] = requestedServiceTier
+	return payload
+}
+
+// classifyServiceTierResponse classifies the answer to the requested service_tier
+func classifyServiceTierResponse(statusCode int, body []byte) string {
+	if statusCode == http.StatusOK {
+		return ServiceTierAccepted
+	}
+	var parsed map[string]any
+	if err := common.Unmarshal(body, &parsed); err != nil {
+		return ServiceTierRejectedRewritten
+	}
+	errObj, _ := parsed["error"].(map[string]any)
+	errType, _ := errObj["type"].(string)
+	message, _ := errObj["message"].(string)
+	if statusCode == http.StatusBadRequest && parsed["type"] == "error" &&
+		errType == "invalid_request_error" && strings.Contains(message, "service_tier") {
+		return ServiceTierRejectedAnthropic
+	}
+	return ServiceTierRejectedRewritten
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const anthropicServiceTierErrorBody = `{"type":"error","error":{"type":"invalid_request_error","message":"service_tier: Input should be 'auto' or 'standard_only'"},"request_id":"req_011CT"}`
+
+func TestClassifyServiceTierResponse(t *testing.T) {
+	require.Equal(t, ServiceTierRejectedAnthropic, classifyServiceTierResponse(http.StatusBadRequest, []byte(anthropicServiceTierErrorBody)))
+	require.Equal(t, ServiceTierAccepted, classifyServiceTierResponse(http.StatusOK, nil))
+	require.Equal(t, ServiceTierRejectedRewritten, classifyServiceTierResponse(http.StatusBadRequest, []byte(`{"error":{"message":"invalid service_tier","type":"invalid_request_error"}}`)))
+	require.Equal(t, ServiceTierRejectedRewritten, classifyServiceTierResponse(http.StatusBadRequest, []byte(anthropicVersionErrorBody)))
+	require.Equal(t, ServiceTierRejectedRewritten, classifyServiceTierResponse(http.StatusBadGateway, []byte(`<html>502</html>`)))
+}
+
+func TestServiceTierProbe(t *testing.T) {
+	var strict bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = common.Unmarshal(raw, &body)
+		tier, _ := body["service_tier"].(string)
+		if r.Header.Get("x-api-key") == "sk-revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(authErrorBody))
+			return
+		}
+		if strict && tier != "" && tier != "auto" && tier != "standard_only" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(anthropicServiceTierErrorBody))
+			return
+		}
+		_, _ = w.Write([]byte(usageConsistentBody))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	model := "claude-sonnet-4-5-20250929"
+
+	strict = true
+	fp := probeOnce(context.Background(), client, target, model, "service_tier")
+	require.Empty(t, fp.Error, "the 400 is the expected answer")
+	require.Equal(t, requestedServiceTier, fp.ServiceTierRequested)
+	require.Equal(t, ServiceTierRejectedAnthropic, fp.ServiceTierResponse)
+
+	// A proxy stripping the field answers normally and reports its own tier
+	strict = false
+	fp = probeOnce(context.Background(), client, target, model, "service_tier")
+	require.Empty(t, fp.Error)
+	require.Equal(t, ServiceTierAccepted, fp.ServiceTierResponse)
+	require.Equal(t, "standard", fp.ServiceTier)
+
+	// Only a 400 is an answer, a rejected key fails the probe
+	fp = probeOnce(context.Background(), client, ProbeTarget{BaseURL: srv.URL, APIKey: "sk-revoked"}, model, "service_tier")
+	require.Contains(t, fp.Error, "HTTP 401")
+	require.Empty(t, fp.ServiceTierResponse)
+
+	// Other probes never send service_tier
+	strict = true
+	fp = probeOnce(context.Background(), client, target, model, "simple")
+	require.Empty(t, fp.Error)
+	require.Empty(t, fp.ServiceTierResponse)
+}
+
+func TestAnalyzeServiceTier(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	base := analyze([]Fingerprint{anthropicFingerprint("tool")}, model, w)
+
+	withTier := func(tier string) []Fingerprint {
+		var fps []Fingerprint
+		for range 2 {
+			fp := anthropicFingerprint("tool")
+			fp.ServiceTier = tier
+			fps = append(fps, fp)
+		}
+		return fps
+	}
+	known := analyze(withTier("priority"), model, w)
+	unknown := analyze(withTier("premium"), model, w)
+	// Two rounds of a known tier score twice; an unknown one is penalized once
+	require.Equal(t, known.Scores["anthropic"]-2*w.ServiceTier-w.ServiceTierUnknownPenalty, unknown.Scores["anthropic"])
+	require.True(t, hasEvidence(unknown, "service_tier: premium 不是官方取值"))
+
+	rejected := analyze([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "service_tier", ServiceTierRequested: "priority", ServiceTierResponse: ServiceTierRejectedAnthropic}}, model, w)
+	require.Equal(t, base.Scores["anthropic"]+w.ServiceTierRejectedAnthropic, rejected.Scores["anthropic"])
+	require.Contains(t, strings.Join(rejected.Evidence, "\n"), "[R2] 请求 service_tier=priority 返回官方 invalid_request_error")
+
+	echoed := analyze([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "service_tier", ServiceTierRequested: "priority", ServiceTierResponse: ServiceTierAccepted,
+		HasServiceTier: true, ServiceTier: "priority"}}, model, w)
+	require.Equal(t, base.Scores["anthropic"]+w.ServiceTier-w.ServiceTierAcceptedPenalty, echoed.Scores["anthropic"])
+	require.Contains(t, strings.Join(echoed.Evidence, "\n"), "[R2] [!!] 上游接受了官方不支持的 service_tier=priority（返回 priority）")
+}
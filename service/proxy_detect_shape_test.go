@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+// Response bodies as returned for a forced-tool probe
+const (
+	toolProbeGenuineBody     = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"tool_use","id":"toolu_01ABC","name":"probe","input":{"q":"test"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`
+	toolProbeMissingToolBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"I'll call probe with q=test."}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":9}}`
+	thinkingProbeReordered   = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"5"},{"type":"thinking","thinking":"2+3","signature":"sig"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":9}}`
+)
+
+func fingerprintFromBody(t *testing.T, probeType, body string) Fingerprint {
+	t.Helper()
+	var parsed map[string]any
+	require.NoError(t, common.UnmarshalJsonStr(body, &parsed))
+	fp := Fingerprint{ProbeType: probeType}
+	extractBodyFingerprint(&fp, parsed)
+	return fp
+}
+
+func TestContentBlockShape(t *testing.T) {
+	fp := fingerprintFromBody(t, "tool", toolProbeGenuineBody)
+	require.Equal(t, []string{"tool_use"}, fp.ContentBlockShape)
+	require.Empty(t, checkContentBlockShape(fp.ProbeType, fp.ContentBlockShape))
+
+	fp = fingerprintFromBody(t, "tool", toolProbeMissingToolBody)
+	require.Equal(t, []string{"text"}, fp.ContentBlockShape)
+	require.Equal(t, "tool_use_missing", checkContentBlockShape(fp.ProbeType, fp.ContentBlockShape))
+
+	fp = fingerprintFromBody(t, "thinking", thinkingProbeReordered)
+	require.Equal(t, []string{"text", "thinking"}, fp.ContentBlockShape)
+	require.Equal(t, "thinking_block_reordered", checkContentBlockShape(fp.ProbeType, fp.ContentBlockShape))
+
+	require.Equal(t, "thinking_block_missing", checkContentBlockShape("thinking", []string{"text"}))
+	require.Empty(t, checkContentBlockShape("thinking", []string{"redacted_thinking", "thinking", "text"}))
+	require.Empty(t, checkContentBlockShape("simple", []string{"text"}))
+}
+
+func TestAnalyzeMissingToolBlock(t *testing.T) {
+	missing := anthropicFingerprint("tool")
+	missing.ContentBlockShape = fingerprintFromBody(t, "tool", toolProbeMissingToolBody).ContentBlockShape
+
+	result := analyze([]Fingerprint{anthropicFingerprint("tool"), missing}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	var hits int
+	for _, e := range result.Evidence {
+		if strings.Contains(e, "未返回 tool_use") {
+			hits++
+			require.True(t, strings.HasPrefix(e, "[R2]"), e)
+		}
+	}
+	require.Equal(t, 1, hits)
+}
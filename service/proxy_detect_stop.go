@@ -0,0 +1,32 @@
+package service
+
+import (
+	"strings"
+)
+
+// Stop sequence the stop_sequences probe asks the model to emit mid-reply
+const stopSequenceMarker = "ZX-STOP-4K"
+
+// buildStopSequencesPayload builds the stop_sequences probe request body.
+// The prompt makes the model emit stopSequenceMarker before more text, so a faithful
+// upstream halts there with stop_reason "stop_sequence" while a proxy that drops the
+// parameter returns the marker and everything after it.
+func buildStopSequencesPayload(model string) map[string]any {
+	return map[string]any{
+		"model":          model,
+		"max_tokens":     64,
+		"stop_sequences": []string{stopSequenceMarker},
+		"messages": []map[string]any{
+			{"role": "user", "content": "Repeat this line exactly, with nothing before or after it: alpha beta " + stopSequenceMarker + " gamma delta"},
+		},
+	}
+}
+
+// checkStopSequences fills the stop_sequences probe fields of fp from the response body.
+// Honored means the upstream stopped on the marker; leaked means the marker reached the
+// output, i.e. the model produced it but nothing stopped generation.
+func checkStopSequences(fp *Fingerprint, body map[string]any) {
+	fp.StopSequence, _ = body["stop_sequence"].(string)
+	fp.StopSequencesHonored = fp.StopReason == "stop_sequence" && fp.StopSequence == stopSequenceMarker
+	fp.StopSequenceLeaked = strings.Contains(strings.ToUpper(extractReplyText(body)), stopSequenceMarker)
+}
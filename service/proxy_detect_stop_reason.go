@@ -0,0 +1,39 @@
+package service
+
+import "slices"
+
+// Translation layers copy the backend's own finish reason into stop_reason: OpenAI-compatible
+// backends answer "stop"/"length"/"tool_calls", Gemini upper-case "STOP"/"MAX_TOKENS". The
+// value set alone therefore names the backend behind a Messages-shaped reply.
+
+// Families recorded in Fingerprint.StopReasonFamily (empty when stop_reason is absent)
+const (
+	StopReasonFamilyAnthropic = "anthropic"
+	StopReasonFamilyOpenAI    = "openai"
+	StopReasonFamilyGemini    = "gemini"
+	StopReasonFamilyOther     = "other"
+)
+
+// OpenAI chat completion finish_reason values
+var openAIFinishReasons = []string{
+	"stop",
+	"length",
+	"tool_calls",
+	"function_call",
+	"content_filter",
+}
+
+// classifyStopReason returns the API family a stop_reason value belongs to
+func classifyStopReason(stopReason string) string {
+	switch {
+	case stopReason == "":
+		return ""
+	case slices.Contains(anthropicStopReasons, stopReason):
+		return StopReasonFamilyAnthropic
+	case slices.Contains(openAIFinishReasons, stopReason):
+		return StopReasonFamilyOpenAI
+	case slices.Contains(geminiFinishReasons, stopReason):
+		return StopReasonFamilyGemini
+	}
+	return StopReasonFamilyOther
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	stopHonoredBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"alpha beta "}],"stop_reason":"stop_sequence","stop_sequence":"ZX-STOP-4K","usage":{"input_tokens":30,"output_tokens":3}}`
+	stopIgnoredBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"alpha beta ZX-STOP-4K gamma delta"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":30,"output_tokens":9}}`
+	stopSkippedBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"alpha beta gamma delta"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":30,"output_tokens":5}}`
+)
+
+// stopProbeFingerprint parses a stop_sequences probe response the way probeOnce does
+func stopProbeFingerprint(t *testing.T, body string) Fingerprint {
+	t.Helper()
+	var parsed map[string]any
+	require.NoError(t, common.UnmarshalJsonStr(body, &parsed))
+	fp := Fingerprint{ProbeType: "stop_sequences"}
+	extractBodyFingerprint(&fp, parsed)
+	checkStopSequences(&fp, parsed)
+	return fp
+}
+
+func TestStopSequencesFingerprint(t *testing.T) {
+	fp := stopProbeFingerprint(t, stopHonoredBody)
+	require.True(t, fp.StopSequencesHonored)
+	require.Equal(t, stopSequenceMarker, fp.StopSequence)
+	require.False(t, fp.StopSequenceLeaked)
+
+	fp = stopProbeFingerprint(t, stopIgnoredBody)
+	require.False(t, fp.StopSequencesHonored)
+	require.Empty(t, fp.StopSequence)
+	require.True(t, fp.StopSequenceLeaked)
+
+	fp = stopProbeFingerprint(t, stopSkippedBody)
+	require.False(t, fp.StopSequencesHonored)
+	require.False(t, fp.StopSequenceLeaked)
+}
+
+func TestAnalyzeStopSequences(t *testing.T) {
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("thinking")}
+	probe := func(body string) Fingerprint {
+		fp := anthropicFingerprint("stop_sequences")
+		parsed := stopProbeFingerprint(t, body)
+		fp.StopReason = parsed.StopReason
+		fp.StopSequencesHonored = parsed.StopSequencesHonored
+		fp.StopSequence = parsed.StopSequence
+		fp.StopSequenceLeaked = parsed.StopSequenceLeaked
+		return fp
+	}
+
+	honored := analyze(append(fps, probe(stopHonoredBody)), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	ignored := analyze(append(fps, probe(stopIgnoredBody)), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	skipped := analyze(append(fps, probe(stopSkippedBody)), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, honored.Scores["anthropic"]-2, ignored.Scores["anthropic"])
+	require.Equal(t, honored.Scores["anthropic"], skipped.Scores["anthropic"])
+
+	evidence := strings.Join(ignored.Evidence, "\n")
+	require.Contains(t, evidence, "[!!] stop_sequences 未生效")
+	require.Contains(t, strings.Join(honored.Evidence, "\n"), "stop_sequences 生效")
+	require.Contains(t, strings.Join(skipped.Evidence, "\n"), "无法判断")
+}
+
+const (
+	stopReasonOpenAIStopBody   = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"stop","usage":{"input_tokens":10,"output_tokens":1}}`
+	stopReasonOpenAILengthBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"One, two"}],"stop_reason":"length","usage":{"input_tokens":10,"output_tokens":5}}`
+)
+
+func TestStopReasonStandard(t *testing.T) {
+	for _, body := range []string{usageConsistentBody, stopHonoredBody, `{"content":[]}`} {
+		require.True(t, fingerprintFromBody(t, "simple", body).StopReasonStandard, body)
+	}
+
+	fp := fingerprintFromBody(t, "simple", stopReasonOpenAIStopBody)
+	require.False(t, fp.StopReasonStandard)
+	require.Equal(t, "stop", fp.StopReason)
+
+	fp = fingerprintFromBody(t, "max_tokens", stopReasonOpenAILengthBody)
+	require.False(t, fp.StopReasonStandard)
+	require.Equal(t, "length", fp.StopReason)
+}
+
+func TestAnalyzeNonStandardStopReason(t *testing.T) {
+	standard := anthropicFingerprint("tool")
+	standard.StopReason = "tool_use"
+	standard.StopReasonStandard = true
+	translated := anthropicFingerprint("tool")
+	translated.StopReason = "stop"
+	length := anthropicFingerprint("tool")
+	length.StopReason = "length"
+
+	base := analyze([]Fingerprint{standard, standard}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	result := analyze([]Fingerprint{translated, length}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, base.Scores["anthropic"]-2, result.Scores["anthropic"])
+
+	require.Equal(t, system_setting.DefaultScoringWeights.StopReasonOpenAI, result.Scores["openai"])
+	require.Zero(t, base.Scores["openai"])
+
+	evidence := strings.Join(result.Evidence, "\n")
+	require.Contains(t, evidence, "[R1] [!!] stop_reason 为 OpenAI 取值: stop")
+	require.Contains(t, evidence, "[R2] [!!] stop_reason 为 OpenAI 取值: length")
+	require.Contains(t, evidence, "[R1] [!] 工具探测强制调用工具，stop_reason 却为 stop 而非 tool_use")
+	require.NotContains(t, strings.Join(base.Evidence, "\n"), "stop_reason 为")
+	require.NotContains(t, strings.Join(base.Evidence, "\n"), "工具探测强制调用工具")
+}
+
+func TestClassifyStopReason(t *testing.T) {
+	for _, s := range []string{"end_turn", "max_tokens", "stop_sequence", "tool_use", "pause_turn", "refusal"} {
+		require.Equal(t, StopReasonFamilyAnthropic, classifyStopReason(s), s)
+	}
+	for _, s := range []string{"stop", "length", "tool_calls", "function_call", "content_filter"} {
+		require.Equal(t, StopReasonFamilyOpenAI, classifyStopReason(s), s)
+	}
+	require.Equal(t, StopReasonFamilyGemini, classifyStopReason("STOP"))
+	require.Equal(t, StopReasonFamilyGemini, classifyStopReason("MAX_TOKENS"))
+	require.Equal(t, StopReasonFamilyOther, classifyStopReason("finished"))
+	require.Empty(t, classifyStopReason(""))
+
+	require.Equal(t, StopReasonFamilyOpenAI, fingerprintFromBody(t, "simple", stopReasonOpenAIStopBody).StopReasonFamily)
+}
+
+func TestAnalyzeStopReasonFamilies(t *testing.T) {
+	model := "claude-sonnet-4-5-20250929"
+	withStopReason := func(stopReason string) DetectResult {
+		fp := anthropicFingerprint("simple")
+		fp.StopReason = stopReason
+		return analyze([]Fingerprint{fp, fp}, model, system_setting.DefaultScoringWeights)
+	}
+
+	gemini := withStopReason("STOP")
+	require.Zero(t, gemini.Scores["openai"])
+	require.True(t, hasEvidence(gemini, "stop_reason 为 Gemini finishReason 取值: STOP"))
+
+	other := withStopReason("finished")
+	require.Zero(t, other.Scores["openai"])
+	require.True(t, hasEvidence(other, "stop_reason 非 Anthropic 取值: finished"))
+
+	// OpenAI translation outweighing the remaining Anthropic signals names the backend
+	fp := Fingerprint{ProbeType: "simple", StopReason: "stop", LatencyMs: 500}
+	openai := analyze([]Fingerprint{fp, fp}, model, system_setting.DefaultScoringWeights)
+	require.Equal(t, "openai_translation", openai.Verdict)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const (
+	// TTFT/total above this ratio means the stream arrived in one burst
+	streamBufferedRatio = 0.9
+	// Fewer events than this is too short to tell buffering from a fast reply
+	streamMinEventsForBuffering = 5
+	// Max bytes read from a probe stream
+	streamMaxBytes = 8 << 20
+	// All events within this spread means the stream was re-emitted as one blob
+	streamBlobMaxSpreadMs = 5
+	// Max entries kept in Fingerprint.StreamEventOrder
+	streamMaxEventOrder = 64
+)
+
+// buildStreamPayload builds the streaming probe request body.
+// The prompt yields enough text deltas to separate TTFT from total time.
+func buildStreamPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 128,
+		"stream":     true,
+		"messages": []map[string]any{
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("stream")},
+		},
+	}
+}
+
+// readStreamBody reads an Anthropic SSE stream, records its timing on fp and
+// reassembles the events into a non-streaming Messages body for extractBodyFingerprint.
+func readStreamBody(r io.Reader, t0 time.Time, fp *Fingerprint) (map[string]any, error) {
+	reader := bufio.NewReaderSize(io.LimitReader(r, streamMaxBytes), 64*1024)
+	if isJSONBody(reader) {
+		return readNonStreamBody(reader, t0, fp)
+	}
+	var body map[string]any
+	var content []any
+	var stopReason string
+	var deltaUsage map[string]any
+	var lastEventMs int64
+
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "data:") {
+			lastEventMs = time.Since(t0).Milliseconds()
+			if fp.StreamEvents == 0 {
+				fp.TTFTMs = lastEventMs
+			}
+			fp.StreamEvents++
+
+			var event map[string]any
+			if common.UnmarshalJsonStr(strings.TrimSpace(strings.TrimPrefix(line, "data:")), &event) == nil {
+				eventType, _ := event["type"].(string)
+				recordStreamEvent(fp, eventType)
+				switch eventType {
+				case "message_start":
+					body, _ = event["message"].(map[string]any)
+				case "content_block_start":
+					if block, ok := event["content_block"].(map[string]any); ok {
+						content = append(content, block)
+					}
+				case "content_block_delta":
+					appendStreamDelta(content, event)
+				case "message_delta":
+					if delta, ok := event["delta"].(map[string]any); ok {
+						stopReason, _ = delta["stop_reason"].(string)
+					}
+					deltaUsage, _ = event["usage"].(map[string]any)
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read stream")
+		}
+	}
+	fp.StreamTotalMs = time.Since(t0).Milliseconds()
+	fp.StreamBuffered = isStreamBuffered(fp.TTFTMs, fp.StreamTotalMs, fp.StreamEvents)
+	fp.StreamBlob = fp.StreamEvents >= streamMinEventsForBuffering && lastEventMs-fp.TTFTMs <= streamBlobMaxSpreadMs
+	fp.StreamCanonical = isCanonicalStreamOrder(fp.StreamEventOrder)
+
+	if body == nil {
+		return nil, fmt.Errorf("stream has no message_start event")
+	}
+	body["content"] = content
+	if stopReason != "" {
+		body["stop_reason"] = stopReason
+	}
+	if usage, ok := body["usage"].(map[string]any); ok {
+		for k, v := range deltaUsage {
+			usage[k] = v
+		}
+	}
+	return body, nil
+}
+
+// appendStreamDelta applies a content_block_delta event to the reassembled content blocks
+func appendStreamDelta(content []any, event map[string]any) {
+	idx, ok := event["index"].(float64)
+	if !ok || int(idx) < 0 || int(idx) >= len(content) {
+		return
+	}
+	block, ok := content[int(idx)].(map[string]any)
+	if !ok {
+		return
+	}
+	delta, ok := event["delta"].(map[string]any)
+	if !ok {
+		return
+	}
+	switch delta["type"] {
+	case "text_delta":
+		text, _ := delta["text"].(string)
+		prev, _ := block["text"].(string)
+		block["text"] = prev + text
+	case "signature_delta":
+		sig, _ := delta["signature"].(string)
+		prev, _ := block["signature"].(string)
+		block["signature"] = prev + sig
+	}
+}
+
+// isStreamBuffered reports whether the first event arrived so late that the
+// upstream likely buffered the whole response before forwarding it
+func isStreamBuffered(ttftMs, totalMs int64, events int) bool {
+	if totalMs <= 0 || events < streamMinEventsForBuffering {
+		return false
+	}
+	return float64(ttftMs)/float64(totalMs) > streamBufferedRatio
+}
+
+// isJSONBody reports whether the body is a plain JSON document rather than SSE,
+// i.e. the upstream ignored stream:true. Leading whitespace is consumed.
+func isJSONBody(reader *bufio.Reader) bool {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = reader.ReadByte()
+		case '{':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// readNonStreamBody parses a non-streaming Messages body returned to a streaming request
+func readNonStreamBody(reader io.Reader, t0 time.Time, fp *Fingerprint) (map[string]any, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response")
+	}
+	fp.StreamNotSSE = true
+	fp.StreamTotalMs = time.Since(t0).Milliseconds()
+	var body map[string]any
+	if err := common.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("response body not JSON")
+	}
+	return body, nil
+}
+
+// recordStreamEvent appends an SSE event type to fp, collapsing consecutive repeats
+func recordStreamEvent(fp *Fingerprint, eventType string) {
+	if eventType == "" {
+		return
+	}
+	if eventType == "ping" {
+		fp.HasPingEvent = true
+	}
+	order := fp.StreamEventOrder
+	if len(order) > 0 && order[len(order)-1] == eventType || len(order) >= streamMaxEventOrder {
+		return
+	}
+	fp.StreamEventOrder = append(order, eventType)
+}
+
+// isCanonicalStreamOrder checks the collapsed event order against the Messages streaming
+// framing: message_start, balanced content_block_start/delta/stop groups, message_delta,
+// message_stop, with ping allowed in between
+func isCanonicalStreamOrder(order []string) bool {
+	n := len(order)
+	if n < 3 || order[0] != "message_start" || order[n-2] != "message_delta" || order[n-1] != "message_stop" {
+		return false
+	}
+	open := false
+	for _, event := range order[1 : n-2] {
+		switch event {
+		case "ping":
+		case "content_block_start":
+			if open {
+				return false
+			}
+			open = true
+		case "content_block_delta":
+			if !open {
+				return false
+			}
+		case "content_block_stop":
+			if !open {
+				return false
+			}
+			open = false
+		default:
+			return false
+		}
+	}
+	return !open
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSSE(w http.ResponseWriter, event string) {
+	_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", event)
+}
+
+func newMockSSEServer(buffered bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		if buffered {
+			time.Sleep(300 * time.Millisecond)
+		}
+		writeSSE(w, `{"type":"message_start","message":{"id":"msg_01ABCDEFGHIJKLMNOPQRSTUV","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":12,"output_tokens":1,"service_tier":"standard"}}}`)
+		writeSSE(w, `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+		flusher.Flush()
+		for i := 1; i <= 6; i++ {
+			if !buffered {
+				time.Sleep(50 * time.Millisecond)
+			}
+			writeSSE(w, fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"%d "}}`, i))
+			flusher.Flush()
+		}
+		writeSSE(w, `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":12}}`)
+		writeSSE(w, `{"type":"message_stop"}`)
+		flusher.Flush()
+	}))
+}
+
+func TestStreamProbeBuffering(t *testing.T) {
+	for _, buffered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("buffered=%t", buffered), func(t *testing.T) {
+			srv := newMockSSEServer(buffered)
+			defer srv.Close()
+
+			fp := probeOnce(context.Background(), newUnsafeHTTPClient(5*time.Second), ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "stream")
+			require.Empty(t, fp.Error)
+			require.Equal(t, buffered, fp.StreamBuffered)
+			require.Equal(t, buffered, fp.StreamBlob)
+			require.Equal(t, 10, fp.StreamEvents)
+			require.Equal(t, "anthropic", fp.MsgIDSource)
+			require.Equal(t, "end_turn", fp.StopReason)
+			require.Equal(t, 12, fp.OutputTokens)
+			require.Equal(t, len("1 2 3 4 5 6 "), fp.OutputChars)
+		})
+	}
+}
+
+func TestIsStreamBuffered(t *testing.T) {
+	require.False(t, isStreamBuffered(950, 1000, 3))
+	require.False(t, isStreamBuffered(100, 1000, 20))
+	require.True(t, isStreamBuffered(950, 1000, 20))
+	require.False(t, isStreamBuffered(0, 0, 20))
+}
+
+func TestStreamProbeEventOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		writeSSE(w, `{"type":"message_start","message":{"id":"msg_01ABCDEFGHIJKLMNOPQRSTUV","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":12,"output_tokens":1}}}`)
+		writeSSE(w, `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+		writeSSE(w, `{"type":"ping"}`)
+		flusher.Flush()
+		for i := 1; i <= 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			writeSSE(w, fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"%d "}}`, i))
+			flusher.Flush()
+		}
+		writeSSE(w, `{"type":"content_block_stop","index":0}`)
+		writeSSE(w, `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":6}}`)
+		writeSSE(w, `{"type":"message_stop"}`)
+	}))
+	defer srv.Close()
+
+	fp := probeOnce(context.Background(), newUnsafeHTTPClient(5*time.Second), ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "stream")
+	require.Empty(t, fp.Error)
+	require.Equal(t, []string{"message_start", "content_block_start", "ping", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}, fp.StreamEventOrder)
+	require.True(t, fp.HasPingEvent)
+	require.True(t, fp.StreamCanonical)
+	require.False(t, fp.StreamBlob)
+}
+
+func TestStreamProbeJSONDespiteStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`  {"id":"msg_01ABCDEFGHIJKLMNOPQRSTUV","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"1 2 3"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":6}}`))
+	}))
+	defer srv.Close()
+
+	fp := probeOnce(context.Background(), newUnsafeHTTPClient(5*time.Second), ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}, "claude-sonnet-4-5-20250929", "stream")
+	require.Empty(t, fp.Error)
+	require.True(t, fp.StreamNotSSE)
+	require.Zero(t, fp.StreamEvents)
+	require.Equal(t, "anthropic", fp.MsgIDSource)
+	require.Equal(t, 6, fp.OutputTokens)
+}
+
+func TestIsCanonicalStreamOrder(t *testing.T) {
+	require.True(t, isCanonicalStreamOrder([]string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}))
+	require.True(t, isCanonicalStreamOrder([]string{"message_start", "ping", "content_block_start", "content_block_delta", "content_block_stop", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}))
+	// Unclosed block, delta outside a block, missing message_stop, unknown event
+	require.False(t, isCanonicalStreamOrder([]string{"message_start", "content_block_start", "content_block_delta", "message_delta", "message_stop"}))
+	require.False(t, isCanonicalStreamOrder([]string{"message_start", "content_block_delta", "message_delta", "message_stop"}))
+	require.False(t, isCanonicalStreamOrder([]string{"message_start", "content_block_start", "content_block_stop", "message_delta"}))
+	require.False(t, isCanonicalStreamOrder([]string{"message_start", "chunk", "message_delta", "message_stop"}))
+	require.False(t, isCanonicalStreamOrder(nil))
+}
+
+func TestAnalyzeStreamFraming(t *testing.T) {
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("thinking")}
+	plain := anthropicFingerprint("stream")
+	canonical := anthropicFingerprint("stream")
+	canonical.StreamCanonical = true
+	canonical.HasPingEvent = true
+	notSSE := anthropicFingerprint("stream")
+	notSSE.StreamNotSSE = true
+
+	base := analyze(append(fps, plain), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "anthropic", base.Verdict)
+	require.Equal(t, base.Scores["anthropic"]+1, analyze(append(fps, canonical), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights).Scores["anthropic"])
+	require.Equal(t, base.Scores["anthropic"]-2, analyze(append(fps, notSSE), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights).Scores["anthropic"])
+
+	blob := canonical
+	blob.StreamBlob = true
+	blob.StreamEvents = 12
+	result := analyze(append(fps, blob), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "suspicious", result.Verdict)
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "疑似中转伪造流式响应")
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Token the system probe asks the model to start its reply with
+const systemProbeMarker = "ZX-PROBE-7Q"
+
+// buildSystemPayload builds the system-parameter probe request body.
+// The instruction lives only in the top-level system field, so a proxy that drops it
+// yields a reply without the marker.
+func buildSystemPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 32,
+		"system":     "Always begin every reply with the exact token " + systemProbeMarker + " followed by a space, then answer briefly.",
+		"messages": []map[string]any{
+			{"role": "user", "content": system_setting.GetProxyDetectSetting().ProbePrompt("system")},
+		},
+	}
+}
+
+// extractReplyText concatenates the text blocks of a Messages response body
+func extractReplyText(body map[string]any) string {
+	content, ok := body["content"].([]any)
+	if !ok {
+		return ""
+	}
+	var sb strings.Builder
+	for _, block := range content {
+		bm, ok := block.(map[string]any)
+		if !ok || bm["type"] != "text" {
+			continue
+		}
+		text, _ := bm["text"].(string)
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// isSystemHonored reports whether the reply starts with systemProbeMarker,
+// tolerating leading whitespace, quotes and markdown emphasis
+func isSystemHonored(reply string) bool {
+	reply = strings.TrimLeft(reply, " \t\r\n\"'`*_>[(")
+	return strings.HasPrefix(strings.ToUpper(reply), systemProbeMarker)
+}
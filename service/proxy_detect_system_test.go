@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemProbeReplyMatching(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		honored bool
+	}{
+		{"plain", `{"content":[{"type":"text","text":"ZX-PROBE-7Q Paris."}]}`, true},
+		{"markdown", `{"content":[{"type":"text","text":"**ZX-PROBE-7Q** The capital is Paris."}]}`, true},
+		{"quoted lowercase", `{"content":[{"type":"text","text":"\n\"zx-probe-7q Paris\""}]}`, true},
+		{"split blocks", `{"content":[{"type":"text","text":"ZX-PRO"},{"type":"text","text":"BE-7Q Paris"}]}`, true},
+		{"ignored", `{"content":[{"type":"text","text":"The capital of France is Paris."}]}`, false},
+		{"marker not leading", `{"content":[{"type":"text","text":"Paris. ZX-PROBE-7Q"}]}`, false},
+		{"no text", `{"content":[{"type":"tool_use","id":"toolu_01"}]}`, false},
+		{"empty", `{}`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]any
+			require.NoError(t, common.UnmarshalJsonStr(tc.body, &body))
+			require.Equal(t, tc.honored, isSystemHonored(extractReplyText(body)))
+		})
+	}
+}
+
+func TestAnalyzeSystemNotHonored(t *testing.T) {
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("thinking")}
+
+	honored := anthropicFingerprint("system")
+	honored.SystemHonored = true
+	base := analyze(append(fps, honored), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+
+	ignored := analyze(append(fps, anthropicFingerprint("system")), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, base.Scores["anthropic"]-1, ignored.Scores["anthropic"])
+
+	found := false
+	for _, e := range ignored.Evidence {
+		if strings.Contains(e, "system 参数未生效") {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
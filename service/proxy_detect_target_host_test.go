@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetHostLists(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	allow, deny := setting.TargetHostAllowlist, setting.TargetHostDenylist
+	t.Cleanup(func() { setting.TargetHostAllowlist, setting.TargetHostDenylist = allow, deny })
+
+	setting.TargetHostAllowlist = []string{"*.relay.example", "api.anthropic.com"}
+	setting.TargetHostDenylist = []string{"blocked.relay.example"}
+
+	require.NoError(t, ValidateProxyDetectURL("https://eu.relay.example/v1", false))
+	require.NoError(t, ValidateProxyDetectURL("https://API.anthropic.com", false))
+	require.EqualError(t, ValidateProxyDetectURL("https://blocked.relay.example", false), "target host blocked.relay.example is denied")
+	require.EqualError(t, ValidateProxyDetectURL("https://third-party.example", false), "target host third-party.example is not in the allowlist")
+	// Admins skipping the SSRF check may target any host
+	require.NoError(t, ValidateProxyDetectURL("https://third-party.example", true))
+
+	// Enforced at dial time, before any DNS lookup
+	dial := safeDialer()
+	_, err := dial(context.Background(), "tcp", net.JoinHostPort("blocked.relay.example", "443"))
+	require.EqualError(t, err, "target host blocked.relay.example is denied")
+	_, err = dial(context.Background(), "tcp", net.JoinHostPort("third-party.example", "443"))
+	require.EqualError(t, err, "target host third-party.example is not in the allowlist")
+
+	// Without an allowlist only the denylist applies
+	setting.TargetHostAllowlist = nil
+	require.NoError(t, ValidateProxyDetectURL("https://third-party.example", false))
+	require.Error(t, ValidateProxyDetectURL("https://blocked.relay.example", false))
+}
@@ -0,0 +1,625 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func anthropicFingerprint(probeType string) Fingerprint {
+	shape := []string{"text"}
+	switch probeType {
+	case "tool":
+		shape = []string{"tool_use"}
+	case "thinking":
+		shape = []string{"thinking", "text"}
+	}
+	return Fingerprint{
+		ProbeType:         probeType,
+		ToolID:            "toolu_01ABCDEFGHIJKLMNOPQRSTUV",
+		ToolIDSource:      "anthropic",
+		MsgID:             "msg_01ABCDEFGHIJKLMNOPQRSTUV",
+		MsgIDSource:       "anthropic",
+		MsgIDFormat:       "base62",
+		Model:             "claude-sonnet-4-5-20250929",
+		ModelSource:       "anthropic",
+		UsageStyle:        "snake_case",
+		HasServiceTier:    true,
+		ServiceTier:       "standard",
+		HasInferenceGeo:   true,
+		InferenceGeo:      "us",
+		HasCacheCreation:  true,
+		HasAnthropicHdrs:  true,
+		LatencyMs:         800,
+		StopReason:        "tool_use",
+		ContentBlockShape: shape,
+	}
+}
+
+func TestAnalyzeDisqualifyingPlatform(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := setting.DisqualifyingPlatforms
+	t.Cleanup(func() { setting.DisqualifyingPlatforms = original })
+
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+	for i := range fps {
+		fps[i].ProxyPlatform = "OpenRouter"
+		fps[i].PlatformClues = []string{"OpenRouter header detected"}
+	}
+
+	setting.DisqualifyingPlatforms = []string{}
+	result := analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "anthropic", result.Verdict)
+
+	setting.DisqualifyingPlatforms = []string{"openrouter"}
+	result = analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "proxy", result.Verdict)
+	require.Equal(t, 1.0, result.Confidence)
+	require.Greater(t, result.Scores["anthropic"], 0)
+	require.Contains(t, result.Evidence[len(result.Evidence)-1], "OpenRouter")
+}
+
+func TestAnalyzeScoringWeights(t *testing.T) {
+	fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+	base := analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+
+	weights := system_setting.DefaultScoringWeights
+	weights.ToolIDAnthropic = 0
+	weights.ServiceTier = 10
+	result := analyze(fps, "claude-sonnet-4-5-20250929", weights)
+	delta := 2 * (weights.ServiceTier - system_setting.DefaultScoringWeights.ServiceTier - system_setting.DefaultScoringWeights.ToolIDAnthropic)
+	require.Equal(t, base.Scores["anthropic"]+delta, result.Scores["anthropic"])
+
+	// Zero weights silence a signal without touching the evidence
+	kiro := anthropicFingerprint("tool")
+	kiro.Model, kiro.ModelSource = "kiro-claude-sonnet-4-5", "kiro"
+	weights = system_setting.DefaultScoringWeights
+	weights.ModelKiro = 0
+	result = analyze([]Fingerprint{kiro}, "claude-sonnet-4-5-20250929", weights)
+	require.Zero(t, result.Scores["bedrock"])
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "kiro-* (Kiro 逆向铁证)")
+}
+
+func TestAnalyzeMinConfidence(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := setting.MinConfidence
+	t.Cleanup(func() { setting.MinConfidence = original })
+
+	// Kiro model id on an otherwise official envelope: anthropic and bedrock both score
+	kiro := anthropicFingerprint("tool")
+	kiro.Model, kiro.ModelSource = "kiro-claude-sonnet-4-5", "kiro"
+	fps := []Fingerprint{kiro}
+
+	setting.MinConfidence = 0
+	winner := analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.NotEqual(t, "unknown", winner.Verdict)
+	require.Less(t, winner.Confidence, 1.0)
+
+	setting.MinConfidence = 1
+	result := analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "unknown", result.Verdict)
+	require.Equal(t, winner.Confidence, result.Confidence)
+	require.Equal(t, winner.Scores, result.Scores)
+	require.Contains(t, result.Evidence[len(result.Evidence)-1], "低于阈值")
+
+	// The missing-fields override still wins over the threshold
+	stripped := anthropicFingerprint("tool")
+	stripped.HasInferenceGeo, stripped.InferenceGeo, stripped.HasCacheCreation = false, "", false
+	result = analyze([]Fingerprint{stripped, stripped}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, "suspicious", result.Verdict)
+}
+
+func TestNormalizeTraceID(t *testing.T) {
+	require.Equal(t, "my-trace-1", normalizeTraceID(" my-trace-1 "))
+
+	generated := normalizeTraceID("")
+	require.True(t, strings.HasPrefix(generated, "pd-"))
+	require.NotEqual(t, generated, normalizeTraceID(""))
+
+	require.True(t, strings.HasPrefix(normalizeTraceID("bad\ntrace"), "pd-"))
+	require.True(t, strings.HasPrefix(normalizeTraceID(strings.Repeat("a", maxTraceIDLen+1)), "pd-"))
+}
+
+func TestInferEffectiveMaxTokens(t *testing.T) {
+	require.Equal(t, 0, inferEffectiveMaxTokens(Fingerprint{StopReason: "max_tokens", OutputTokens: maxTokensProbeLimit}))
+	require.Equal(t, 0, inferEffectiveMaxTokens(Fingerprint{StopReason: "end_turn", OutputTokens: 200}))
+	require.Equal(t, 0, inferEffectiveMaxTokens(Fingerprint{StopReason: "max_tokens"}))
+	require.Equal(t, 256, inferEffectiveMaxTokens(Fingerprint{StopReason: "max_tokens", OutputTokens: 256}))
+
+	fp := anthropicFingerprint("max_tokens")
+	fp.StopReason = "max_tokens"
+	fp.OutputTokens = 256
+	fp.EffectiveMaxTokens = inferEffectiveMaxTokens(fp)
+	result := analyze([]Fingerprint{anthropicFingerprint("tool"), fp}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, 256, result.EffectiveMaxTokens)
+}
+
+func TestClassifyRatelimitSamples(t *testing.T) {
+	testCases := []struct {
+		name      string
+		samples   []RatelimitSample
+		verdict   string
+		totalDrop int
+		monotone  bool
+	}{
+		{name: "too few samples", samples: []RatelimitSample{{Remaining: 100}}, verdict: "unavailable"},
+		{name: "static", samples: []RatelimitSample{{Remaining: 100}, {Remaining: 100}, {Remaining: 100}}, verdict: "static"},
+		{name: "monotone decrease", samples: []RatelimitSample{{Remaining: 100}, {Remaining: 90}, {Remaining: 80}}, verdict: "dynamic", totalDrop: 20, monotone: true},
+		{name: "non-monotone", samples: []RatelimitSample{{Remaining: 100}, {Remaining: 90}, {Remaining: 95}}, verdict: "dynamic", totalDrop: 5},
+		{name: "increase", samples: []RatelimitSample{{Remaining: 80}, {Remaining: 100}}, verdict: "dynamic", totalDrop: -20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := classifyRatelimitSamples(tc.samples)
+			require.Equal(t, tc.verdict, result.Verdict)
+			require.NotEmpty(t, result.Detail)
+			require.Equal(t, tc.samples, result.Samples)
+			require.Equal(t, tc.totalDrop, result.TotalDrop)
+			require.Equal(t, tc.monotone, result.Monotone)
+			require.False(t, result.ResetSane)
+		})
+	}
+
+	// Sane reset timestamps, exposed with the sample times
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	samples := []RatelimitSample{
+		{Remaining: 100, Reset: t0.Add(time.Second).Format(time.RFC3339), ObservedAt: t0},
+		{Remaining: 90, Reset: t0.Add(3 * time.Second).Format(time.RFC3339), ObservedAt: t0.Add(2 * time.Second)},
+	}
+	result := classifyRatelimitSamples(samples)
+	require.True(t, result.ResetSane)
+	require.Equal(t, RatelimitResetOK, result.ResetCheck)
+	require.Contains(t, common.GetJsonString(result), `"observed_at":"2026-03-01T12:00:00Z"`)
+	require.NotContains(t, common.GetJsonString(RatelimitSample{Remaining: 1}), "observed_at")
+}
+
+func TestAnalyzeInferenceGeoConsistency(t *testing.T) {
+	stable := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+	result := analyze(stable, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, []string{"us"}, result.InferenceGeos)
+	for _, e := range result.Evidence {
+		require.NotContains(t, e, "跨轮不一致")
+	}
+
+	flipping := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+	flipping[1].InferenceGeo = "eu"
+	result = analyze(flipping, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, []string{"us", "eu"}, result.InferenceGeos)
+	require.Equal(t, "anthropic", result.Verdict)
+	found := false
+	for _, e := range result.Evidence {
+		if strings.Contains(e, "跨轮不一致") {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestProbeAnthropicVersionHeader(t *testing.T) {
+	var seen []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("anthropic-version"))
+		mu.Unlock()
+		if r.Header.Get("anthropic-version") != "2023-06-01" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Empty(t, fp.Error)
+
+	target.AnthropicVersion = "2023-01-01"
+	fp = probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Contains(t, fp.Error, "HTTP 400")
+
+	support := checkVersionSupport(context.Background(), client, target, "claude-sonnet-4-5-20250929")
+	require.Equal(t, map[string]bool{"2023-06-01": true, "2023-01-01": false}, support)
+	require.Equal(t, []string{"2023-06-01", "2023-01-01", "2023-06-01", "2023-01-01"}, seen)
+}
+
+func TestComputeLatencyStats(t *testing.T) {
+	require.Nil(t, computeLatencyStats(nil))
+	require.Nil(t, computeLatencyStats([]Fingerprint{{Error: "timeout", LatencyMs: 30000}}))
+
+	stats := computeLatencyStats([]Fingerprint{
+		{LatencyMs: 300},
+		{LatencyMs: 900},
+		{Error: "HTTP 500", LatencyMs: 50},
+		{LatencyMs: 600},
+	})
+	require.Equal(t, &LatencyStats{Count: 3, AvgMs: 600, MinMs: 300, P50Ms: 600, P90Ms: 900, MaxMs: 900}, stats)
+
+	var fps []Fingerprint
+	for ms := int64(100); ms <= 1000; ms += 100 {
+		fps = append(fps, Fingerprint{LatencyMs: ms})
+	}
+	stats = computeLatencyStats(fps)
+	require.Equal(t, int64(500), stats.P50Ms)
+	require.Equal(t, int64(900), stats.P90Ms)
+	require.False(t, stats.Uniform)
+
+	// Cached or replayed replies answer in near-constant time
+	stats = computeLatencyStats([]Fingerprint{{LatencyMs: 1200}, {LatencyMs: 1210}, {LatencyMs: 1195}, {LatencyMs: 1230}})
+	require.True(t, stats.Uniform)
+	require.False(t, computeLatencyStats([]Fingerprint{{LatencyMs: 1200}, {LatencyMs: 1200}}).Uniform)
+}
+
+func TestAnalyzeLatencyUniform(t *testing.T) {
+	var fps []Fingerprint
+	for i, ms := range []int64{800, 805, 810} {
+		fp := anthropicFingerprint("simple")
+		fp.LatencyMs = ms
+		fp.MsgID = "msg_01XFDUDYJgAACzvnptvVoYE" + strconv.Itoa(i)
+		fps = append(fps, fp)
+	}
+	result := analyze(fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.NotNil(t, result.LatencyStats)
+	require.Equal(t, 3, result.LatencyStats.Count)
+	require.True(t, hasEvidence(result, "延迟"))
+}
+
+func TestAnalyzeAllFailed(t *testing.T) {
+	authFailed := Fingerprint{ProbeType: "tool", Error: "HTTP 401: invalid x-api-key", ErrorClass: ProbeErrorAuth}
+	forbidden := Fingerprint{ProbeType: "thinking", Error: "HTTP 403: forbidden", ErrorClass: ProbeErrorAuth}
+	network := Fingerprint{ProbeType: "tool", Error: "request failed", ErrorClass: ProbeErrorNetwork}
+	timeout := Fingerprint{ProbeType: "stream", Error: "detection timed out", ErrorClass: ProbeErrorTimeout}
+	serverErr := Fingerprint{ProbeType: "tool", Error: "HTTP 500: oops", ErrorClass: ProbeErrorHTTP}
+
+	cases := []struct {
+		name    string
+		fps     []Fingerprint
+		verdict string
+	}{
+		{"all auth", []Fingerprint{authFailed, forbidden}, "invalid_key"},
+		{"all network or timeout", []Fingerprint{network, timeout}, "unreachable"},
+		{"mixed auth and network", []Fingerprint{authFailed, network}, "unknown"},
+		{"server errors", []Fingerprint{serverErr, serverErr}, "unknown"},
+		{"no probes", nil, "unknown"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := analyze(tc.fps, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+			require.Equal(t, tc.verdict, result.Verdict)
+			require.Equal(t, verdictTextMap[tc.verdict], result.VerdictText)
+			require.Len(t, result.Evidence, 1)
+		})
+	}
+}
+
+func TestProbeErrorClass(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error"}}`))
+	}))
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-bad"}
+
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, ProbeErrorAuth, fp.ErrorClass)
+
+	srv.Close()
+	fp = probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, ProbeErrorNetwork, fp.ErrorClass)
+}
+
+func TestModelFilter(t *testing.T) {
+	ids := []string{"claude-sonnet-4-5-20250929", "Claude-Opus-Alias", "grok-4", "gpt-4o", "gpt-4o-mini"}
+	match := func(expr string) []string {
+		filter, err := ParseModelFilter(expr)
+		require.NoError(t, err)
+		var out []string
+		for _, id := range ids {
+			if filter.Match(id) {
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+
+	require.Equal(t, []string{"claude-sonnet-4-5-20250929", "Claude-Opus-Alias"}, match(""))
+	require.Equal(t, ids, match("all"))
+	require.Equal(t, []string{"grok-4"}, match("GROK"))
+	require.Equal(t, []string{"gpt-4o"}, match(`re:^gpt-4o$`))
+
+	_, err := ParseModelFilter("re:(")
+	require.Error(t, err)
+}
+
+func TestMessagesPathOverride(t *testing.T) {
+	for _, ok := range []string{"", "/v1/messages", "/anthropic/v1/messages", "/api/v2/claude/messages"} {
+		require.NoError(t, ValidateMessagesPath(ok), ok)
+	}
+	for _, bad := range []string{
+		"v1/messages",
+		"//evil.example.com/v1/messages",
+		"http://evil.example.com/v1/messages",
+		"/v1/../../admin",
+		"/v1/messages?x=1",
+		"/v1/messages#frag",
+		"/@evil.example.com/v1",
+		"/%2e%2e/admin",
+		"\\\\evil.example.com\\v1",
+		"/" + strings.Repeat("a", maxMessagesPathLen),
+	} {
+		require.Error(t, ValidateMessagesPath(bad), bad)
+	}
+
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL + "/", APIKey: "sk-test", MessagesPath: "/anthropic/v1/messages"}
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Empty(t, fp.Error)
+	require.Equal(t, "/anthropic/v1/messages", gotPath)
+
+	target.MessagesPath = ""
+	probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Equal(t, "/v1/messages", gotPath)
+
+	target.MessagesPath = "//evil.example.com/v1/messages"
+	_, err := target.messagesURL()
+	require.Error(t, err)
+}
+
+func TestVerifyRatelimitReusesProbeSamples(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("anthropic-ratelimit-input-tokens-remaining", strconv.Itoa(int(1000-10*n)))
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	probes := []Fingerprint{
+		{ProbeType: "tool", RatelimitInputRemaining: 1200},
+		{ProbeType: "tool", Error: "HTTP 529"},
+		{ProbeType: "thinking", RatelimitInputRemaining: 1100},
+	}
+
+	reused := ratelimitSamplesFromFingerprints(probes, 1)
+	require.Equal(t, []RatelimitSample{{Remaining: 1200}, {Remaining: 1100}}, reused)
+	require.Empty(t, ratelimitSamplesFromFingerprints(probes, 3))
+
+	// Two reused samples, so only two extra requests are needed for four shots
+	result := verifyRatelimitDynamic(context.Background(), client, target, "claude-sonnet-4-5-20250929", 4, reused)
+	require.Equal(t, int32(2), requests.Load())
+	require.Equal(t, 2, result.ReusedSamples)
+	require.Len(t, result.Samples, 4)
+	require.Equal(t, "dynamic", result.Verdict)
+
+	// Enough reused samples: no extra requests at all
+	requests.Store(0)
+	enough := []RatelimitSample{{Remaining: 500}, {Remaining: 500}, {Remaining: 500}, {Remaining: 500}}
+	result = verifyRatelimitDynamic(context.Background(), client, target, "claude-sonnet-4-5-20250929", 4, enough)
+	require.Zero(t, requests.Load())
+	require.Equal(t, "static", result.Verdict)
+}
+
+func TestScanMultipleModelsPerModelBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		raw, _ := io.ReadAll(r.Body)
+		_ = common.Unmarshal(raw, &body)
+		if body.Model == "claude-slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		if body.Model == "claude-missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"` + body.Model + `","content":[{"type":"text","text":"OK"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	models := []string{"claude-slow", "claude-fast", "claude-missing"}
+	start := time.Now()
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-test", models, DetectOptions{Rounds: 1, SkipSSRFCheck: true}, 300*time.Millisecond)
+	require.Less(t, time.Since(start), 3*time.Second)
+
+	require.Len(t, scan.ModelResults, 3)
+	for i, model := range models {
+		require.Equal(t, model, scan.ModelResults[i].Model)
+	}
+	require.Equal(t, "timeout", scan.Summary["claude-slow"])
+	require.Equal(t, verdictTextMap["timeout"], scan.ModelResults[0].VerdictText)
+	require.NotContains(t, []string{"timeout", "unavailable"}, scan.Summary["claude-fast"])
+	require.Equal(t, "unavailable", scan.Summary["claude-missing"])
+	require.False(t, scan.IsMixed)
+	require.Zero(t, scan.TruncatedAt)
+	require.Empty(t, scan.UnscannedModels)
+}
+
+func TestScanMultipleModelsTruncated(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := setting.Timeouts
+	t.Cleanup(func() { setting.Timeouts = original })
+	setting.Timeouts.MultiScanSeconds = 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Drain the body so the server notices the client hanging up
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	// The first batch outlives the scan timeout, so the fourth model never starts
+	models := []string{"claude-a", "claude-b", "claude-c", "claude-d"}
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-test", models, DetectOptions{Rounds: 1, SkipSSRFCheck: true}, 5*time.Second)
+	require.Len(t, scan.ModelResults, multiScanConcurrency)
+	for i, result := range scan.ModelResults {
+		require.Equal(t, models[i], result.Model)
+		require.Equal(t, "timeout", result.Verdict)
+	}
+	require.Equal(t, multiScanConcurrency, scan.TruncatedAt)
+	require.Equal(t, []string{"claude-d"}, scan.UnscannedModels)
+	require.NotContains(t, scan.Summary, "claude-d")
+}
+
+func TestScanMultipleModelsAliases(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Model string `json:"model"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		_ = common.Unmarshal(body, &payload)
+		mu.Lock()
+		sent = append(sent, payload.Model)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	scan := scanMultipleModels(context.Background(), srv.URL, "sk-test", []string{"claude-3.5-sonnet", "claude-3-haiku-20240307"},
+		DetectOptions{Rounds: 1, SkipSSRFCheck: true}, 5*time.Second)
+	require.ElementsMatch(t, []string{"claude-3-5-sonnet-20241022", "claude-3-haiku-20240307"}, sent)
+	require.Equal(t, "claude-3-5-sonnet-20241022", scan.ModelResults[0].Model)
+	require.Equal(t, "claude-3.5-sonnet", scan.ModelResults[0].ModelRequested)
+	require.Empty(t, scan.ModelResults[1].ModelRequested)
+	require.Contains(t, scan.Summary, "claude-3-5-sonnet-20241022")
+}
+
+func TestDetectSingleModelQuick(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 0
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	// The extras are ignored: exactly one tool probe is sent
+	opts := DetectOptions{Rounds: 3, SkipSSRFCheck: true, Preset: DetectPresetQuick, VerifyRatelimit: true, CheckVersions: true}
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts)
+	require.Equal(t, int32(1), requests.Load())
+	require.True(t, result.Quick)
+	require.Nil(t, result.RatelimitVerify)
+	require.Nil(t, result.VersionSupport)
+	require.Len(t, result.Fingerprints, 1)
+	require.Contains(t, result.Evidence[len(result.Evidence)-1], "建议进行完整检测")
+
+	opts.Preset = DetectPresetStandard
+	require.False(t, detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts).Quick)
+}
+
+func TestVerifyRatelimitConcurrentProbes(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 0
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("anthropic-ratelimit-input-tokens-remaining", strconv.Itoa(int(1000-10*n)))
+		// Earlier requests answer later, so probe order differs from the decrements
+		time.Sleep(time.Duration(max(0, 4-n)) * 30 * time.Millisecond)
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	opts := DetectOptions{Rounds: 3, Concurrency: 3, Probes: []string{"tool"}, SkipSSRFCheck: true, VerifyRatelimit: true}
+	result := detectSingleModel(context.Background(), srv.URL, "sk-test", "claude-sonnet-4-5-20250929", opts)
+	require.NotNil(t, result.RatelimitVerify)
+	require.Zero(t, result.RatelimitVerify.ReusedSamples)
+	require.Equal(t, "dynamic", result.RatelimitVerify.Verdict)
+	require.True(t, result.RatelimitVerify.Monotone)
+}
+
+func TestRunToolProbesConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"tool_use","id":"toolu_01ABC"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+
+	start := time.Now()
+	fps := runToolProbes(context.Background(), client, target, "claude-sonnet-4-5-20250929", 3, 3)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.Len(t, fps, 3)
+	for _, fp := range fps {
+		require.Equal(t, "tool", fp.ProbeType)
+		require.Empty(t, fp.Error)
+	}
+	require.EqualValues(t, 3, peak.Load())
+
+	// Capped at maxProbeConcurrency
+	peak.Store(0)
+	fps = runToolProbes(context.Background(), client, target, "claude-sonnet-4-5-20250929", 4, 10)
+	require.Len(t, fps, 4)
+	require.EqualValues(t, maxProbeConcurrency, peak.Load())
+
+	// Default stays sequential
+	peak.Store(0)
+	fps = runToolProbes(context.Background(), client, target, "claude-sonnet-4-5-20250929", 2, 0)
+	require.Len(t, fps, 2)
+	require.EqualValues(t, 1, peak.Load())
+
+	// The shared deadline still bounds the whole batch
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	fps = runToolProbes(ctx, client, target, "claude-sonnet-4-5-20250929", 3, 2)
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+	require.Len(t, fps, 2)
+	for _, fp := range fps {
+		require.Equal(t, ProbeErrorTimeout, fp.ErrorClass)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Genuine thinking signatures vary in length with the thinking they sign. Across several
+// thinking probes, identical lengths suggest a constant signature, and lengths all just under
+// the same round number suggest signatures cut to a fixed size.
+
+// Steps of the round numbers a truncated signature length sits just under
+var roundSigLengthSteps = []int{100, 128}
+
+// How far under a round number a length still counts as truncated (one base64 group)
+const sigTruncationMargin = 3
+
+// thinkingSigLengths returns the signature lengths of the thinking probes that returned one
+func thinkingSigLengths(fps []Fingerprint) []int {
+	var lengths []int
+	for _, fp := range fps {
+		if fp.ProbeType == "thinking" && fp.ThinkingSigLen > 0 {
+			lengths = append(lengths, fp.ThinkingSigLen)
+		}
+	}
+	return lengths
+}
+
+// constantSigLength reports whether two or more lengths are all the same
+func constantSigLength(lengths []int) bool {
+	if len(lengths) < 2 {
+		return false
+	}
+	for _, l := range lengths[1:] {
+		if l != lengths[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// truncatedSigBound returns the round number two or more lengths all sit just under
+// (within sigTruncationMargin, inclusive), 0 if there is none
+func truncatedSigBound(lengths []int) int {
+	if len(lengths) < 2 {
+		return 0
+	}
+	for _, step := range roundSigLengthSteps {
+		bound := (lengths[0] + sigTruncationMargin) / step * step
+		if bound == 0 {
+			continue
+		}
+		all := true
+		for _, l := range lengths {
+			if l > bound || bound-l > sigTruncationMargin {
+				all = false
+				break
+			}
+		}
+		if all {
+			return bound
+		}
+	}
+	return 0
+}
+
+// sigLengthOutOfRange returns the first length outside the expected range that is not
+// already classified short, 0 if all are in range
+func sigLengthOutOfRange(lengths []int, check system_setting.ThinkingSigCheck) int {
+	lo, hi := check.ExpectedRange()
+	for _, l := range lengths {
+		if l >= check.Short() && (l < lo || l > hi) {
+			return l
+		}
+	}
+	return 0
+}
+
+// thinkingProbeRounds is how many thinking probes a run sends
+func thinkingProbeRounds(opts DetectOptions) int {
+	if opts.Preset == DetectPresetThorough {
+		return system_setting.GetProxyDetectSetting().ThinkingSigCheck.Rounds()
+	}
+	return 1
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func thinkingRounds(sigLens ...int) []Fingerprint {
+	fps := []Fingerprint{anthropicFingerprint("tool")}
+	for _, l := range sigLens {
+		fp := anthropicFingerprint("thinking")
+		fp.ThinkingSigLen = l
+		fp.ThinkingSigClass = "normal"
+		fps = append(fps, fp)
+	}
+	return fps
+}
+
+func evidenceCodes(result DetectResult) []string {
+	var codes []string
+	for _, e := range result.EvidenceItems {
+		codes = append(codes, e.Code)
+	}
+	return codes
+}
+
+func TestTruncatedSigBound(t *testing.T) {
+	require.Equal(t, 512, truncatedSigBound([]int{512, 510}))
+	require.Equal(t, 1000, truncatedSigBound([]int{998, 1000, 997}))
+	require.Zero(t, truncatedSigBound([]int{512}))
+	require.Zero(t, truncatedSigBound([]int{512, 508}))
+	require.Zero(t, truncatedSigBound([]int{612, 840}))
+	// Same length off any round number is constant, not truncated
+	require.Zero(t, truncatedSigBound([]int{450, 450}))
+	require.True(t, constantSigLength([]int{450, 450}))
+	require.False(t, constantSigLength([]int{450, 452}))
+}
+
+func TestAnalyzeThinkingSigDistribution(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+
+	genuine := analyze(thinkingRounds(612, 840, 733), "claude-sonnet-4-5-20250929", w)
+	require.Equal(t, []int{612, 840, 733}, genuine.ThinkingSigLengths)
+	for _, code := range []string{"thinking_sig_truncated", "thinking_sig_constant_len", "thinking_sig_out_of_range"} {
+		require.False(t, slices.Contains(evidenceCodes(genuine), code), code)
+	}
+
+	constant := analyze(thinkingRounds(450, 450, 450), "claude-sonnet-4-5-20250929", w)
+	require.Contains(t, evidenceCodes(constant), "thinking_sig_constant_len")
+	require.True(t, hasEvidence(constant, "3"))
+	require.Equal(t, genuine.Scores["anthropic"]-w.ThinkingSigConstantPenalty, constant.Scores["anthropic"])
+
+	truncated := analyze(thinkingRounds(512, 510, 512), "claude-sonnet-4-5-20250929", w)
+	require.Contains(t, evidenceCodes(truncated), "thinking_sig_truncated")
+	require.NotContains(t, evidenceCodes(truncated), "thinking_sig_constant_len")
+	require.True(t, hasEvidence(truncated, "512, 510, 512"))
+	require.Equal(t, genuine.Scores["anthropic"]-w.ThinkingSigTruncatedPenalty, truncated.Scores["anthropic"])
+
+	// A single thinking probe only gets the range check
+	single := analyze(thinkingRounds(9000), "claude-sonnet-4-5-20250929", w)
+	require.Equal(t, []string{"thinking_sig_out_of_range"}, slices.DeleteFunc(evidenceCodes(single), func(c string) bool {
+		return !slices.Contains([]string{"thinking_sig_truncated", "thinking_sig_constant_len", "thinking_sig_out_of_range"}, c)
+	}))
+}
+
+func TestThinkingSigCheckConfigurable(t *testing.T) {
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+
+	setting.ThinkingSigCheck = system_setting.ThinkingSigCheck{ShortThreshold: 300, ExpectedMin: 300, ExpectedMax: 600, ThoroughRounds: 4}
+	require.Equal(t, "short", classifyThinkingSig(string(make([]byte, 250))))
+	require.Equal(t, 4, thinkingProbeRounds(DetectOptions{Preset: DetectPresetThorough}))
+	require.Equal(t, 1, thinkingProbeRounds(DetectOptions{}))
+
+	result := analyze(thinkingRounds(612, 540), "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Contains(t, evidenceCodes(result), "thinking_sig_out_of_range")
+	require.True(t, hasEvidence(result, "300-600"))
+}
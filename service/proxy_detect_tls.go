@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A proxy answering on its own domain presents its own certificate, usually a Cloudflare
+// edge or Let's Encrypt one, never the api.anthropic.com certificate. With CaptureTLS the
+// probes go through a client that does the TLS handshake itself so the leaf certificate of
+// the target can be recorded.
+
+// Certificate providers recorded in DetectResult.TLSCertProvider
+const (
+	TLSProviderCloudflare  = "cloudflare"
+	TLSProviderLetsEncrypt = "letsencrypt"
+)
+
+// Domain a genuine Anthropic endpoint certificate covers
+const anthropicCertDomain = "anthropic.com"
+
+// tlsCertificate is the leaf certificate presented by the target
+type tlsCertificate struct {
+	Issuer   string
+	SANs     []string
+	Provider string
+}
+
+// tlsCertRecorder keeps the leaf certificate of the first TLS handshake
+type tlsCertRecorder struct {
+	mu   sync.Mutex
+	cert *tlsCertificate
+}
+
+func (r *tlsCertRecorder) record(state tls.ConnectionState) {
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert == nil {
+		r.cert = newTLSCertificate(state.PeerCertificates[0])
+	}
+}
+
+// certificate returns the recorded certificate, nil if no handshake completed
+func (r *tlsCertRecorder) certificate() *tlsCertificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+func newTLSCertificate(leaf *x509.Certificate) *tlsCertificate {
+	return &tlsCertificate{
+		Issuer:   leaf.Issuer.CommonName,
+		SANs:     slices.Clone(leaf.DNSNames),
+		Provider: classifyTLSProvider(leaf.Issuer.CommonName, leaf.Issuer.Organization),
+	}
+}
+
+// classifyTLSProvider recognizes Cloudflare edge and Let's Encrypt certificates by issuer
+func classifyTLSProvider(issuerCN string, issuerOrg []string) string {
+	names := strings.ToLower(issuerCN + " " + strings.Join(issuerOrg, " "))
+	switch {
+	case strings.Contains(names, "cloudflare"):
+		return TLSProviderCloudflare
+	case strings.Contains(names, "let's encrypt"):
+		return TLSProviderLetsEncrypt
+	}
+	return ""
+}
+
+// coversAnthropic reports whether any SAN is anthropic.com or one of its subdomains
+func (c *tlsCertificate) coversAnthropic() bool {
+	for _, san := range c.SANs {
+		san = strings.ToLower(san)
+		if san == anthropicCertDomain || strings.HasSuffix(san, "."+anthropicCertDomain) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTLSCaptureClient creates a client that performs the TLS handshake in DialTLSContext and
+// records the target certificate. checkIP applies the SSRF-safe dialer.
+func newTLSCaptureClient(timeout time.Duration, checkIP bool) (*http.Client, *tlsCertRecorder) {
+	rec := &tlsCertRecorder{}
+	dial := (&net.Dialer{Timeout: 10 * time.Second}).DialContext
+	if checkIP {
+		dial = safeDialer()
+	}
+	transport := &http.Transport{
+		DialContext: dial,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: host, NextProtos: []string{"h2", "http/1.1"}})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			rec.record(tlsConn.ConnectionState())
+			return tlsConn, nil
+		},
+		// A custom DialTLSContext disables HTTP/2 unless forced; keep the protocol the
+		// standard client would negotiate
+		ForceAttemptHTTP2: true,
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: probeRedirectPolicy(checkIP),
+	}, rec
+}
+
+// applyTLSCertificate records the target certificate on result and notes an "anthropic"
+// verdict served with a certificate that does not cover anthropic.com
+func applyTLSCertificate(result *DetectResult, cert *tlsCertificate) {
+	if cert == nil {
+		return
+	}
+	result.TLSIssuer = cert.Issuer
+	result.TLSSANs = cert.SANs
+	result.TLSCertProvider = cert.Provider
+	result.addEvidence(EvidenceItem{Code: "tls_certificate", Params: map[string]any{"issuer": cert.Issuer, "sans": cert.SANs}})
+	if cert.Provider != "" {
+		result.addEvidence(EvidenceItem{Code: "tls_cert_provider", Params: map[string]any{"provider": cert.Provider}})
+	}
+	if result.Verdict == "anthropic" && !cert.coversAnthropic() {
+		result.addEvidence(EvidenceItem{Code: "tls_san_mismatch", Params: map[string]any{"sans": cert.SANs}})
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyTLSProvider(t *testing.T) {
+	require.Equal(t, TLSProviderCloudflare, classifyTLSProvider("Cloudflare Inc ECC CA-3", []string{"Cloudflare, Inc."}))
+	require.Equal(t, TLSProviderLetsEncrypt, classifyTLSProvider("R11", []string{"Let's Encrypt"}))
+	require.Empty(t, classifyTLSProvider("WE1", []string{"Google Trust Services"}))
+}
+
+func TestTLSCertRecorder(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	rec := &tlsCertRecorder{}
+	require.Nil(t, rec.certificate())
+	rec.record(tls.ConnectionState{})
+	require.Nil(t, rec.certificate())
+
+	rec.record(tls.ConnectionState{PeerCertificates: []*x509.Certificate{srv.Certificate()}})
+	cert := rec.certificate()
+	require.NotNil(t, cert)
+	require.Equal(t, srv.Certificate().DNSNames, cert.SANs)
+	require.False(t, cert.coversAnthropic())
+
+	// only the first handshake is kept
+	rec.record(tls.ConnectionState{PeerCertificates: []*x509.Certificate{{DNSNames: []string{"api.anthropic.com"}}}})
+	require.Same(t, cert, rec.certificate())
+}
+
+func TestApplyTLSCertificate(t *testing.T) {
+	result := DetectResult{Verdict: "anthropic"}
+	applyTLSCertificate(&result, nil)
+	require.Empty(t, result.EvidenceItems)
+
+	applyTLSCertificate(&result, &tlsCertificate{Issuer: "R11", SANs: []string{"relay.example.com"}, Provider: TLSProviderLetsEncrypt})
+	require.Equal(t, "R11", result.TLSIssuer)
+	require.Equal(t, []string{"relay.example.com"}, result.TLSSANs)
+	require.Equal(t, TLSProviderLetsEncrypt, result.TLSCertProvider)
+	require.Equal(t, "tls_san_mismatch", result.EvidenceItems[len(result.EvidenceItems)-1].Code)
+
+	genuine := DetectResult{Verdict: "anthropic"}
+	applyTLSCertificate(&genuine, &tlsCertificate{Issuer: "WE1", SANs: []string{"api.anthropic.com"}})
+	for _, item := range genuine.EvidenceItems {
+		require.NotEqual(t, "tls_san_mismatch", item.Code)
+	}
+
+	proxied := DetectResult{Verdict: "bedrock"}
+	applyTLSCertificate(&proxied, &tlsCertificate{Issuer: "R11", SANs: []string{"relay.example.com"}})
+	require.Len(t, proxied.EvidenceItems, 1)
+}
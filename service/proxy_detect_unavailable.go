@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// Reasons a model fails CheckModelAvailable, reported per model in ScanResult.SummaryReasons
+const (
+	// 401/403 or an authentication_error: the key is rejected
+	UnavailableReasonAuth = "auth_error"
+	// 404, not_found_error or a model_not_found code: the upstream does not serve the model
+	UnavailableReasonModelNotFound = "model_not_found"
+	UnavailableReasonTimeout       = "timeout"
+	// No response: connection refused, DNS, TLS or a blocked target
+	UnavailableReasonNetwork = "network_error"
+	// Any other error response (429, 5xx, ...)
+	UnavailableReasonUpstream = "upstream_error"
+)
+
+// ModelUnavailableError is returned by CheckModelAvailable for a model that cannot be used
+type ModelUnavailableError struct {
+	// One of UnavailableReason*
+	Reason string
+	// Status of the error response, 0 when none was received
+	StatusCode int
+}
+
+func (e *ModelUnavailableError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("model unavailable: %s (HTTP %d)", e.Reason, e.StatusCode)
+	}
+	return "model unavailable: " + e.Reason
+}
+
+// unavailableReason returns the reason of a CheckModelAvailable error, "" for nil
+func unavailableReason(err error) string {
+	var unavailable *ModelUnavailableError
+	if errors.As(err, &unavailable) {
+		return unavailable.Reason
+	}
+	if err != nil {
+		return UnavailableReasonNetwork
+	}
+	return ""
+}
+
+// requestFailureReason maps a failed request to timeout or network_error, like classifyRequestFailure
+func requestFailureReason(ctx context.Context, err error) string {
+	if _, class := classifyRequestFailure(ctx, err); class == ProbeErrorTimeout {
+		return UnavailableReasonTimeout
+	}
+	return UnavailableReasonNetwork
+}
+
+// classifyUnavailableResponse tells why a non-200 availability response rejected the model
+func classifyUnavailableResponse(statusCode int, body []byte) string {
+	if isAuthFailure(statusCode, body) {
+		return UnavailableReasonAuth
+	}
+	if statusCode == http.StatusNotFound || strings.Contains(string(body), "model_not_found") {
+		return UnavailableReasonModelNotFound
+	}
+	var parsed struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if common.Unmarshal(body, &parsed) == nil && parsed.Error.Type == "not_found_error" {
+		return UnavailableReasonModelNotFound
+	}
+	return UnavailableReasonUpstream
+}
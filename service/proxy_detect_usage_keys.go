@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+)
+
+// The usage object is serialized by each platform's own code, so the order of its keys is a
+// fingerprint of whoever produced it. Orderings observed on non-streaming Messages replies:
+//
+//	Anthropic          input_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+//	                   cache_creation, output_tokens, service_tier
+//	                   (server_tool_use and inference_geo follow when present)
+//	Vertex AI          input_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+//	                   cache_creation, output_tokens (no service_tier)
+//	Bedrock InvokeModel input_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+//	                   output_tokens (no cache_creation breakdown)
+//	Bedrock Converse   inputTokens, outputTokens, totalTokens
+//	                   (cacheReadInputTokens / cacheWriteInputTokens follow when caching)
+//
+// A proxy that rebuilds usage from its own struct or a map typically emits the keys in
+// alphabetical order, or only input_tokens and output_tokens.
+
+// Profiles recorded in Fingerprint.UsageKeyProfile
+const (
+	UsageKeyProfileAnthropic       = "anthropic"
+	UsageKeyProfileVertex          = "vertex"
+	UsageKeyProfileBedrock         = "bedrock"
+	UsageKeyProfileBedrockConverse = "bedrock_converse"
+	UsageKeyProfileReconstructed   = "reconstructed"
+	UsageKeyProfileUnknown         = "unknown"
+)
+
+// usageKeyProfile is one platform's usage key order; optional keys may appear anywhere and
+// are ignored when comparing
+type usageKeyProfile struct {
+	name     string
+	keys     []string
+	optional []string
+}
+
+// Checked in order, the first exact match wins
+var usageKeyProfiles = []usageKeyProfile{
+	{
+		name:     UsageKeyProfileAnthropic,
+		keys:     []string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens", "service_tier"},
+		optional: []string{"server_tool_use", "inference_geo"},
+	},
+	{
+		name: UsageKeyProfileVertex,
+		keys: []string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens"},
+	},
+	{
+		name: UsageKeyProfileBedrock,
+		keys: []string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "output_tokens"},
+	},
+	{
+		name:     UsageKeyProfileBedrockConverse,
+		keys:     []string{"inputTokens", "outputTokens", "totalTokens"},
+		optional: []string{"cacheReadInputTokens", "cacheWriteInputTokens"},
+	},
+}
+
+// usageKeyOrder returns the keys of the top-level usage object in wire order, nil when the
+// body is not JSON or has no usage object. Decoding into a map would lose the order.
+func usageKeyOrder(body []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if key, _ := tok.(string); key == "usage" {
+			return objectKeyOrder(dec)
+		}
+		// Skip the value of any other key
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// objectKeyOrder reads the object the decoder is positioned at and returns its keys in order
+func objectKeyOrder(dec *json.Decoder) []string {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	keys := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := tok.(string)
+		keys = append(keys, key)
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil
+		}
+	}
+	return keys
+}
+
+// classifyUsageKeys matches an ordered usage key list against the known profiles
+func classifyUsageKeys(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	for _, profile := range usageKeyProfiles {
+		filtered := slices.DeleteFunc(slices.Clone(keys), func(key string) bool {
+			return slices.Contains(profile.optional, key)
+		})
+		if slices.Equal(filtered, profile.keys) {
+			return profile.name
+		}
+	}
+	// Alphabetized keys, or snake_case usage stripped of the cache counters every official
+	// platform reports
+	if len(keys) >= 3 && slices.IsSorted(keys) {
+		return UsageKeyProfileReconstructed
+	}
+	if slices.Contains(keys, "input_tokens") && !slices.Contains(keys, "cache_creation_input_tokens") {
+		return UsageKeyProfileReconstructed
+	}
+	return UsageKeyProfileUnknown
+}
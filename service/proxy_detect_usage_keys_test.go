@@ -0,0 +1,72 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageKeyOrder(t *testing.T) {
+	require.Equal(t, []string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens", "service_tier"},
+		usageKeyOrder([]byte(usageConsistentBody)))
+
+	// Nested objects and arrays before usage are skipped; keys inside usage values are not listed
+	body := `{"content":[{"type":"text","usage":{"x":1}}],"usage":{"output_tokens":1,"input_tokens":2,"cache_creation":{"ephemeral_5m_input_tokens":0}},"id":"msg_01"}`
+	require.Equal(t, []string{"output_tokens", "input_tokens", "cache_creation"}, usageKeyOrder([]byte(body)))
+
+	require.Nil(t, usageKeyOrder([]byte(`{"id":"msg_01"}`)))
+	require.Nil(t, usageKeyOrder([]byte(`{"usage":"none"}`)))
+	require.Nil(t, usageKeyOrder([]byte(`not json`)))
+}
+
+func TestClassifyUsageKeys(t *testing.T) {
+	cases := []struct {
+		keys    []string
+		profile string
+	}{
+		{[]string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens", "service_tier"}, UsageKeyProfileAnthropic},
+		{[]string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens", "service_tier", "server_tool_use", "inference_geo"}, UsageKeyProfileAnthropic},
+		{[]string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "cache_creation", "output_tokens"}, UsageKeyProfileVertex},
+		{[]string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens", "output_tokens"}, UsageKeyProfileBedrock},
+		{[]string{"inputTokens", "outputTokens", "totalTokens", "cacheReadInputTokens"}, UsageKeyProfileBedrockConverse},
+		// Alphabetized by a proxy
+		{[]string{"cache_creation", "cache_creation_input_tokens", "cache_read_input_tokens", "input_tokens", "output_tokens", "service_tier"}, UsageKeyProfileReconstructed},
+		// Cache counters dropped
+		{[]string{"input_tokens", "output_tokens"}, UsageKeyProfileReconstructed},
+		{[]string{"output_tokens", "input_tokens", "cache_creation_input_tokens"}, UsageKeyProfileUnknown},
+		{nil, ""},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.profile, classifyUsageKeys(tc.keys), strings.Join(tc.keys, ","))
+	}
+}
+
+func TestAnalyzeUsageKeys(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	withProfile := func(profile string) []Fingerprint {
+		fps := []Fingerprint{anthropicFingerprint("tool"), anthropicFingerprint("tool")}
+		for i := range fps {
+			fps[i].UsageKeys = []string{"input_tokens", "output_tokens"}
+			fps[i].UsageKeyProfile = profile
+		}
+		return fps
+	}
+	base := analyze(withProfile(""), model, w)
+
+	// Counted once across rounds
+	official := analyze(withProfile(UsageKeyProfileAnthropic), model, w)
+	require.Equal(t, base.Scores["anthropic"]+w.UsageKeysAnthropic, official.Scores["anthropic"])
+
+	bedrock := analyze(withProfile(UsageKeyProfileBedrock), model, w)
+	require.Equal(t, base.Scores["bedrock"]+w.UsageKeysBedrock, bedrock.Scores["bedrock"])
+
+	rebuilt := analyze(withProfile(UsageKeyProfileReconstructed), model, w)
+	require.Equal(t, base.Scores["anthropic"]-w.UsageKeysReconstructedPenalty, rebuilt.Scores["anthropic"])
+	require.Contains(t, strings.Join(rebuilt.Evidence, "\n"), "[!] usage 键按字母排序或缺少缓存计数 (input_tokens, output_tokens)")
+
+	unknown := analyze(withProfile(UsageKeyProfileUnknown), model, w)
+	require.Equal(t, base.Scores, unknown.Scores)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	usageConsistentBody   = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"cache_creation_input_tokens":30,"cache_read_input_tokens":0,"cache_creation":{"ephemeral_5m_input_tokens":30,"ephemeral_1h_input_tokens":0},"output_tokens":4,"service_tier":"standard"}}`
+	usageInconsistentBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK, here you go"}],"stop_reason":"end_turn","usage":{"input_tokens":0,"cache_creation_input_tokens":50,"cache_read_input_tokens":-3,"cache_creation":{"ephemeral_5m_input_tokens":20,"ephemeral_1h_input_tokens":0},"output_tokens":0,"total_tokens":999}}`
+)
+
+func TestUsageConsistency(t *testing.T) {
+	fp := fingerprintFromBody(t, "simple", usageConsistentBody)
+	require.True(t, fp.UsageConsistent)
+	require.Empty(t, fp.UsageIssues)
+
+	fp = fingerprintFromBody(t, "simple", usageInconsistentBody)
+	require.False(t, fp.UsageConsistent)
+	joined := renderUsageIssues(fp.UsageIssues, DetectLangZh)
+	require.Contains(t, joined, "cache_read_input_tokens 不是非负整数")
+	require.Contains(t, joined, "cache_creation 明细之和 20 ≠ cache_creation_input_tokens 50")
+	require.Contains(t, joined, "output_tokens 为 0")
+	require.Contains(t, joined, "total_tokens 999")
+
+	issues := checkUsageConsistency(map[string]any{"input_tokens": float64(0), "output_tokens": float64(1)}, 0)
+	require.Equal(t, []UsageIssue{{Code: "input_zero"}}, issues)
+}
+
+func TestUsageInconsistentRendersEnglish(t *testing.T) {
+	fp := fingerprintFromBody(t, "simple", usageInconsistentBody)
+	joined := renderUsageIssues(fp.UsageIssues, DetectLangEn)
+	require.Contains(t, joined, "cache_read_input_tokens is not a non-negative integer (-3)")
+	require.Contains(t, joined, "cache_creation breakdown sums to 20 ≠ cache_creation_input_tokens 50")
+	require.Contains(t, joined, "15 chars of text returned but output_tokens is 0")
+	require.Contains(t, joined, "total_tokens 999 does not match the sum of the parts 50")
+
+	item := EvidenceItem{Code: "usage_inconsistent", Round: 1, Params: map[string]any{"issues": fp.UsageIssues}}
+	line := item.Render(DetectLangEn)
+	require.True(t, strings.HasPrefix(line, "[R1] [!!] usage numbers are inconsistent: "))
+	require.Contains(t, line, "(-3); cache_creation breakdown")
+	require.NotRegexp(t, `\p{Han}`, line)
+}
+
+func renderUsageIssues(issues []UsageIssue, lang string) string {
+	lines := make([]string, len(issues))
+	for i, issue := range issues {
+		lines[i] = issue.Render(lang)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestAnalyzeUsageInconsistent(t *testing.T) {
+	consistent := anthropicFingerprint("tool")
+	consistent.UsageConsistent = true
+	bad := fingerprintFromBody(t, "simple", usageInconsistentBody)
+	inconsistent := anthropicFingerprint("tool")
+	inconsistent.UsageIssues = bad.UsageIssues
+
+	base := analyze([]Fingerprint{consistent, consistent}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	result := analyze([]Fingerprint{inconsistent, inconsistent}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, base.Scores["anthropic"]-2, result.Scores["anthropic"])
+
+	var lines []string
+	for _, e := range result.Evidence {
+		if strings.Contains(e, "usage 数值自相矛盾") {
+			lines = append(lines, e)
+		}
+	}
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], "[R1] [!!]"))
+}
+
+const usageInjectedBody = `{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"OK"}],"stop_reason":"end_turn","usage":{"input_tokens":12,"cache_creation_input_tokens":0,"cache_read_input_tokens":0,"output_tokens":4,"service_tier":"standard","billing_id":"bill_7f3a"}}`
+
+func TestExtraUsageFields(t *testing.T) {
+	fp := fingerprintFromBody(t, "simple", usageConsistentBody)
+	require.Empty(t, fp.ExtraUsageFields)
+
+	fp = fingerprintFromBody(t, "simple", usageInjectedBody)
+	require.Equal(t, []string{"billing_id"}, fp.ExtraUsageFields)
+	require.True(t, fp.UsageConsistent)
+
+	// A new genuine field added to the allowlist is no longer flagged
+	setting := system_setting.GetProxyDetectSetting()
+	orig := setting.KnownUsageFields
+	t.Cleanup(func() { setting.KnownUsageFields = orig })
+	setting.KnownUsageFields = append(slices.Clone(system_setting.DefaultKnownUsageFields), "billing_id")
+	fp = fingerprintFromBody(t, "simple", usageInjectedBody)
+	require.Empty(t, fp.ExtraUsageFields)
+}
+
+func TestAnalyzeExtraUsageFields(t *testing.T) {
+	clean := anthropicFingerprint("tool")
+	injected := anthropicFingerprint("tool")
+	injected.ExtraUsageFields = []string{"billing_id"}
+
+	base := analyze([]Fingerprint{clean, clean}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	result := analyze([]Fingerprint{injected, injected}, "claude-sonnet-4-5-20250929", system_setting.DefaultScoringWeights)
+	require.Equal(t, base.Scores["anthropic"]-1, result.Scores["anthropic"])
+
+	var lines []string
+	for _, e := range result.Evidence {
+		if strings.Contains(e, "usage 含非官方字段: billing_id") {
+			lines = append(lines, e)
+		}
+	}
+	require.Len(t, lines, 2)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// The bad_version probe sends an anthropic-version that will never exist. Anthropic rejects
+// it with HTTP 400 and its own error envelope ({"type":"error","error":{"type":
+// "invalid_request_error","message":"... anthropic-version ..."}}); proxies either rewrite
+// the error into another shape or overwrite the header and answer normally.
+
+// anthropic-version sent by the bad_version probe
+const invalidAnthropicVersion = "9999-01-01"
+
+// Max error body bytes read by the bad_version probe
+const maxVersionErrorBodyBytes = 4 << 10
+
+// Classes recorded in Fingerprint.VersionErrorShape
+const (
+	VersionErrorAnthropic = "anthropic"
+	VersionErrorRewritten = "rewritten"
+	VersionErrorAccepted  = "accepted"
+)
+
+// classifyVersionError classifies the error response to an invalid anthropic-version
+func classifyVersionError(statusCode int, body []byte) string {
+	if statusCode == http.StatusOK {
+		return VersionErrorAccepted
+	}
+	var parsed map[string]any
+	if err := common.Unmarshal(body, &parsed); err != nil {
+		return VersionErrorRewritten
+	}
+	errObj, _ := parsed["error"].(map[string]any)
+	errType, _ := errObj["type"].(string)
+	message, _ := errObj["message"].(string)
+	if statusCode == http.StatusBadRequest && parsed["type"] == "error" &&
+		errType == "invalid_request_error" && strings.Contains(message, "anthropic-version") {
+		return VersionErrorAnthropic
+	}
+	return VersionErrorRewritten
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+const anthropicVersionErrorBody = `{"type":"error","error":{"type":"invalid_request_error","message":"Unexpected value(s) ` + "`9999-01-01`" + ` for the ` + "`anthropic-version`" + ` header. Please consult our documentation at docs.anthropic.com or try updating to the latest version."},"request_id":"req_011CT"}`
+
+func TestClassifyVersionError(t *testing.T) {
+	require.Equal(t, VersionErrorAnthropic, classifyVersionError(http.StatusBadRequest, []byte(anthropicVersionErrorBody)))
+	require.Equal(t, VersionErrorAccepted, classifyVersionError(http.StatusOK, nil))
+	// OpenAI-style envelope, wrong status, unrelated message, non-JSON
+	require.Equal(t, VersionErrorRewritten, classifyVersionError(http.StatusBadRequest, []byte(`{"error":{"message":"invalid anthropic-version","type":"invalid_request_error","code":null}}`)))
+	require.Equal(t, VersionErrorRewritten, classifyVersionError(http.StatusInternalServerError, []byte(anthropicVersionErrorBody)))
+	require.Equal(t, VersionErrorRewritten, classifyVersionError(http.StatusBadRequest, []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad request"}}`)))
+	require.Equal(t, VersionErrorRewritten, classifyVersionError(http.StatusBadGateway, []byte(`<html>502</html>`)))
+}
+
+func TestBadVersionProbe(t *testing.T) {
+	var strict bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strict && r.Header.Get("anthropic-version") != "2023-06-01" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(anthropicVersionErrorBody))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_01ABC","model":"claude-sonnet-4-5-20250929","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test", AnthropicVersion: invalidAnthropicVersion}
+
+	strict = true
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "bad_version")
+	require.Empty(t, fp.Error, "the 400 is the expected answer")
+	require.Equal(t, VersionErrorAnthropic, fp.VersionErrorShape)
+
+	strict = false
+	fp = probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "bad_version")
+	require.Empty(t, fp.Error)
+	require.Equal(t, VersionErrorAccepted, fp.VersionErrorShape)
+
+	// Other probes still treat a 400 as a failure
+	strict = true
+	fp = probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "simple")
+	require.Contains(t, fp.Error, "HTTP 400")
+	require.Empty(t, fp.VersionErrorShape)
+}
+
+func TestAnalyzeVersionErrorShape(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	model := "claude-sonnet-4-5-20250929"
+	base := analyze([]Fingerprint{anthropicFingerprint("tool")}, model, w)
+
+	genuine := analyze([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "bad_version", VersionErrorShape: VersionErrorAnthropic}}, model, w)
+	require.Equal(t, base.Scores["anthropic"]+w.VersionErrorAnthropic, genuine.Scores["anthropic"])
+	require.Contains(t, strings.Join(genuine.Evidence, "\n"), "[R2] 无效 anthropic-version (9999-01-01) 返回官方 invalid_request_error")
+
+	rewritten := analyze([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "bad_version", VersionErrorShape: VersionErrorRewritten}}, model, w)
+	require.Equal(t, base.Scores["anthropic"], rewritten.Scores["anthropic"])
+	require.Contains(t, strings.Join(rewritten.Evidence, "\n"), "[R2] [!] 无效 anthropic-version")
+
+	accepted := analyze([]Fingerprint{anthropicFingerprint("tool"), {ProbeType: "bad_version", VersionErrorShape: VersionErrorAccepted}}, model, w)
+	require.Equal(t, base.Scores["anthropic"]-w.VersionAcceptedPenalty, accepted.Scores["anthropic"])
+	require.Contains(t, strings.Join(accepted.Evidence, "\n"), "[R2] [!!] 上游接受了无效 anthropic-version")
+}
+
+func TestBadVersionProbeAuthFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(authErrorBody))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-revoked", AnthropicVersion: invalidAnthropicVersion}
+	fp := probeOnce(context.Background(), client, target, "claude-sonnet-4-5-20250929", "bad_version")
+	require.Contains(t, fp.Error, "HTTP 401")
+	require.Empty(t, fp.VersionErrorShape)
+
+	// A revoked key stays invalid_key with the thorough probes
+	opts := DetectOptions{Rounds: 1, Preset: DetectPresetThorough, SkipSSRFCheck: true, Force: true}
+	result := detectSingleModel(context.Background(), srv.URL, "sk-revoked", "claude-sonnet-4-5-20250929", opts)
+	require.Equal(t, "invalid_key", result.Verdict)
+}
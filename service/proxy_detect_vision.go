@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// Every current Claude model reads images, but a channel that quietly serves "claude" from a
+// text-only model cannot. The vision probe sends a small solid red PNG and asks for its color:
+// a real model names it, a text-only backend either rejects the image block with its own
+// error or answers without having seen it.
+
+// 8x8 solid red PNG sent by the vision probe
+const visionProbeImage = "iVBORw0KGgoAAAANSUhEUgAAAAgAAAAICAIAAABLbSncAAAAEUlEQVR42mP4z8CAFTEMLQkAKP8/wc53yE8AAAAASUVORK5CYII="
+
+// Max error body bytes read by the vision probe
+const maxVisionErrorBodyBytes = 4 << 10
+
+// Results recorded in Fingerprint.VisionSupported; empty when a reply cut off by max_tokens
+// did not get to the answer
+const (
+	VisionSupportedYes   = "yes"
+	VisionSupportedNo    = "no"
+	VisionSupportedError = "error"
+)
+
+// Claude models documented with image input; claude-3-5-haiku shipped text-only
+var visionModelPattern = regexp.MustCompile(`^claude-(?:opus|sonnet|haiku-[4-9]|3-opus|3-sonnet|3-haiku|3-[57]-sonnet)`)
+
+// modelExpectsVision reports whether the requested Claude model should accept images
+func modelExpectsVision(model string) bool {
+	return visionModelPattern.MatchString(strings.ToLower(model))
+}
+
+// buildVisionPayload builds the vision probe request body. A one-word answer needs a few
+// tokens, the headroom covers models that add a short sentence around it.
+func buildVisionPayload(model string) map[string]any {
+	return map[string]any{
+		"model":      model,
+		"max_tokens": 32,
+		"messages": []map[string]any{
+			{"role": "user", "content": []map[string]any{
+				{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png", "data": visionProbeImage}},
+				{"type": "text", "text": "What is the color of this image? Answer with one word."},
+			}},
+		},
+	}
+}
+
+// isVisionRejection reports whether a failed vision probe rejected the request itself
+// (bad content, too large, unsupported type) rather than the key, quota or upstream health
+func isVisionRejection(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// isAnthropicErrorEnvelope reports whether body is Anthropic's error envelope
+// ({"type":"error","error":{"type":...,"message":...}})
+func isAnthropicErrorEnvelope(body []byte) bool {
+	var parsed map[string]any
+	if err := common.Unmarshal(body, &parsed); err != nil {
+		return false
+	}
+	errObj, _ := parsed["error"].(map[string]any)
+	errType, _ := errObj["type"].(string)
+	_, hasMessage := errObj["message"].(string)
+	return parsed["type"] == "error" && errType != "" && hasMessage
+}
+
+// checkVisionReply fills VisionSupported from an accepted vision probe. A reply truncated by
+// max_tokens without naming the color is left undecided rather than counted as ignored.
+func checkVisionReply(fp *Fingerprint, body map[string]any) {
+	if strings.Contains(strings.ToLower(extractReplyText(body)), "red") {
+		fp.VisionSupported = VisionSupportedYes
+		return
+	}
+	if fp.StopReason == "max_tokens" {
+		return
+	}
+	fp.VisionSupported = VisionSupportedNo
+}
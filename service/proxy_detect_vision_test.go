@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelExpectsVision(t *testing.T) {
+	for _, model := range []string{"claude-sonnet-4-5-20250929", "claude-opus-4-6-thinking", "claude-haiku-4-5-20251001", "claude-3-5-sonnet-20241022", "claude-3-haiku-20240307"} {
+		require.True(t, modelExpectsVision(model), model)
+	}
+	for _, model := range []string{"claude-3-5-haiku-20241022", "claude-2.1", "gpt-4o"} {
+		require.False(t, modelExpectsVision(model), model)
+	}
+}
+
+func TestVisionProbe(t *testing.T) {
+	var status int
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+	model := "claude-sonnet-4-5-20250929"
+	reply := func(text, stopReason string) string {
+		return `{"id":"msg_01ABC","model":"` + model + `","content":[{"type":"text","text":"` + text + `"}],"stop_reason":"` + stopReason + `","usage":{"input_tokens":20,"output_tokens":2}}`
+	}
+
+	status, body = http.StatusOK, reply("Red.", "end_turn")
+	fp := probeOnce(context.Background(), client, target, model, "vision")
+	require.Empty(t, fp.Error)
+	require.Equal(t, VisionSupportedYes, fp.VisionSupported)
+
+	status, body = http.StatusOK, reply("I don't see any image attached.", "end_turn")
+	fp = probeOnce(context.Background(), client, target, model, "vision")
+	require.Equal(t, VisionSupportedNo, fp.VisionSupported)
+
+	// Cut off before answering: undecided rather than ignored
+	status, body = http.StatusOK, reply("The image shows", "max_tokens")
+	fp = probeOnce(context.Background(), client, target, model, "vision")
+	require.Empty(t, fp.VisionSupported)
+
+	status, body = http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"Could not process image"}}`
+	fp = probeOnce(context.Background(), client, target, model, "vision")
+	require.Empty(t, fp.Error, "the rejection is the expected answer")
+	require.Equal(t, VisionSupportedError, fp.VisionSupported)
+	require.True(t, fp.VisionErrorAnthropic)
+
+	status, body = http.StatusBadRequest, `{"error":{"message":"image_url is only supported by certain models","type":"invalid_request_error","code":null}}`
+	fp = probeOnce(context.Background(), client, target, model, "vision")
+	require.Equal(t, VisionSupportedError, fp.VisionSupported)
+	require.False(t, fp.VisionErrorAnthropic)
+	require.Equal(t, http.StatusBadRequest, fp.HTTPStatus)
+
+	// Auth failures stay ordinary probe failures
+	status, body = http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`
+	fp = probeOnce(context.Background(), client, target, model, "vision")
+	require.Equal(t, ProbeErrorAuth, fp.ErrorClass)
+	require.Empty(t, fp.VisionSupported)
+}
+
+func TestAnalyzeVisionMismatch(t *testing.T) {
+	w := system_setting.DefaultScoringWeights
+	tool := anthropicFingerprint("tool")
+	rejected := Fingerprint{ProbeType: "vision", VisionSupported: VisionSupportedError, HTTPStatus: http.StatusBadRequest}
+
+	result := analyze([]Fingerprint{tool, rejected}, "claude-sonnet-4-5-20250929", w)
+	require.Equal(t, "suspicious", result.Verdict)
+	require.Contains(t, strings.Join(result.Evidence, "\n"), "疑似纯文本模型冒充")
+
+	// An Anthropic-shaped rejection, or a model without image input, is not a mismatch
+	official := rejected
+	official.VisionErrorAnthropic = true
+	require.Equal(t, "anthropic", analyze([]Fingerprint{tool, official}, "claude-sonnet-4-5-20250929", w).Verdict)
+	require.Equal(t, "anthropic", analyze([]Fingerprint{tool, rejected}, "claude-3-5-haiku-20241022", w).Verdict)
+
+	supported := analyze([]Fingerprint{tool, {ProbeType: "vision", VisionSupported: VisionSupportedYes}}, "claude-sonnet-4-5-20250929", w)
+	require.Equal(t, "anthropic", supported.Verdict)
+	require.Contains(t, strings.Join(supported.Evidence, "\n"), "[R2] 图片输入被正确识别")
+}
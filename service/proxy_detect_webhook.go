@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	ProxyDetectWebhookEventVerdictChanged = "proxy_detect.verdict_changed"
+	// Per-attempt timeout for delivering a verdict change
+	verdictWebhookTimeout = 10 * time.Second
+)
+
+// Wait before the single retry of a failed delivery
+var verdictWebhookRetryDelay = 2 * time.Second
+
+// VerdictChangePayload is the body posted to VerdictWebhookURL when the verdict of a
+// (base URL, model) pair differs from its previous persisted run
+type VerdictChangePayload struct {
+	Event         string   `json:"event"`
+	BaseURL       string   `json:"base_url"`
+	BaseURLHash   string   `json:"base_url_hash"`
+	Model         string   `json:"model"`
+	OldVerdict    string   `json:"old_verdict"`
+	NewVerdict    string   `json:"new_verdict"`
+	OldConfidence float64  `json:"old_confidence"`
+	Confidence    float64  `json:"confidence"`
+	EvidenceCodes []string `json:"evidence_codes"`
+	TraceID       string   `json:"trace_id"`
+	Timestamp     int64    `json:"timestamp"`
+}
+
+// verdictWebhookBaseline loads the run the next result is compared against, the latest one
+// that did not fail; nil when the webhook is off or the pair has no such run. Must be called
+// before the new result is persisted.
+func verdictWebhookBaseline(ctx context.Context, baseURL, modelName string) *model.ProxyDetectLog {
+	if system_setting.GetProxyDetectSetting().VerdictWebhookURL == "" {
+		return nil
+	}
+	previous, err := model.GetLatestProxyDetectLog(model.HashProxyDetectTarget(baseURL), modelName, runFailureVerdictList())
+	if err != nil {
+		logger.LogWarn(ctx, "failed to load previous proxy detect log: "+err.Error())
+		return nil
+	}
+	return previous
+}
+
+// buildVerdictChangePayload compares result against previous. Failed runs (timeout, invalid
+// key, ...) on either side are not a change of the target and do not notify.
+func buildVerdictChangePayload(baseURL string, previous *model.ProxyDetectLog, result DetectResult) (VerdictChangePayload, bool) {
+	if previous == nil || previous.Verdict == result.Verdict ||
+		runFailureVerdicts[previous.Verdict] || runFailureVerdicts[result.Verdict] {
+		return VerdictChangePayload{}, false
+	}
+	codes := make([]string, 0, len(result.EvidenceItems))
+	for _, item := range result.EvidenceItems {
+		codes = append(codes, item.Code)
+	}
+	return VerdictChangePayload{
+		Event:         ProxyDetectWebhookEventVerdictChanged,
+		BaseURL:       baseURL,
+		BaseURLHash:   model.HashProxyDetectTarget(baseURL),
+		Model:         result.Model,
+		OldVerdict:    previous.Verdict,
+		NewVerdict:    result.Verdict,
+		OldConfidence: previous.Confidence,
+		Confidence:    result.Confidence,
+		EvidenceCodes: codes,
+		TraceID:       result.TraceID,
+		Timestamp:     time.Now().Unix(),
+	}, true
+}
+
+// notifyVerdictChange posts the verdict change asynchronously when it differs from previous
+func notifyVerdictChange(baseURL string, previous *model.ProxyDetectLog, result DetectResult) {
+	payload, changed := buildVerdictChangePayload(baseURL, previous, result)
+	if !changed {
+		return
+	}
+	setting := system_setting.GetProxyDetectSetting()
+	webhookURL, secret := setting.VerdictWebhookURL, setting.VerdictWebhookSecret
+	if webhookURL == "" {
+		return
+	}
+	gopool.Go(func() {
+		if err := deliverVerdictWebhook(context.Background(), webhookURL, secret, payload); err != nil {
+			common.SysError(fmt.Sprintf("proxy detect verdict webhook for %s failed: %s", payload.Model, err.Error()))
+		}
+	})
+}
+
+// deliverVerdictWebhook posts the payload and retries once on failure. SSRF rejections are
+// not retried.
+func deliverVerdictWebhook(ctx context.Context, webhookURL, secret string, payload VerdictChangePayload) error {
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("request reject: %v", err)
+	}
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal verdict webhook payload: %v", err)
+	}
+	if err = postSignedWebhook(ctx, webhookURL, secret, body, verdictWebhookTimeout); err == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(verdictWebhookRetryDelay):
+	}
+	return postSignedWebhook(ctx, webhookURL, secret, body, verdictWebhookTimeout)
+}
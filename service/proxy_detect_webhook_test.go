@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildVerdictChangePayload(t *testing.T) {
+	result := DetectResult{Model: "claude-sonnet-4-5-20250929", Verdict: "suspicious", Confidence: 0.7, TraceID: "trace-1"}
+	result.addEvidence(EvidenceItem{Code: "missing_inference_geo"})
+	result.addEvidence(EvidenceItem{Code: "cached_response"})
+
+	_, changed := buildVerdictChangePayload("https://relay.example.com", nil, result)
+	require.False(t, changed, "first run")
+	_, changed = buildVerdictChangePayload("https://relay.example.com", &model.ProxyDetectLog{Verdict: "suspicious"}, result)
+	require.False(t, changed, "same verdict")
+	_, changed = buildVerdictChangePayload("https://relay.example.com", &model.ProxyDetectLog{Verdict: "timeout"}, result)
+	require.False(t, changed, "previous run failed")
+
+	payload, changed := buildVerdictChangePayload("https://relay.example.com", &model.ProxyDetectLog{Verdict: "anthropic", Confidence: 0.95}, result)
+	require.True(t, changed)
+	require.Equal(t, ProxyDetectWebhookEventVerdictChanged, payload.Event)
+	require.Equal(t, model.HashProxyDetectTarget("https://relay.example.com"), payload.BaseURLHash)
+	require.Equal(t, "anthropic", payload.OldVerdict)
+	require.Equal(t, "suspicious", payload.NewVerdict)
+	require.Equal(t, 0.95, payload.OldConfidence)
+	require.Equal(t, []string{"missing_inference_geo", "cached_response"}, payload.EvidenceCodes)
+}
+
+func TestDeliverVerdictWebhook(t *testing.T) {
+	fetchSetting := system_setting.GetFetchSetting()
+	origSSRF, origDelay := fetchSetting.EnableSSRFProtection, verdictWebhookRetryDelay
+	t.Cleanup(func() {
+		fetchSetting.EnableSSRFProtection = origSSRF
+		verdictWebhookRetryDelay = origDelay
+	})
+	fetchSetting.EnableSSRFProtection = false
+	verdictWebhookRetryDelay = time.Millisecond
+
+	payload := VerdictChangePayload{Event: ProxyDetectWebhookEventVerdictChanged, Model: "claude-sonnet-4-5-20250929", OldVerdict: "anthropic", NewVerdict: "bedrock"}
+
+	var calls atomic.Int32
+	var failures int32
+	var got VerdictChangePayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, generateSignature("s3cret", body), r.Header.Get("X-Webhook-Signature"))
+		require.NoError(t, common.Unmarshal(body, &got))
+	}))
+	defer server.Close()
+
+	// One failure is retried
+	failures = 1
+	require.NoError(t, deliverVerdictWebhook(context.Background(), server.URL, "s3cret", payload))
+	require.Equal(t, int32(2), calls.Load())
+	require.Equal(t, payload, got)
+
+	// Only once
+	calls.Store(0)
+	failures = 2
+	require.Error(t, deliverVerdictWebhook(context.Background(), server.URL, "s3cret", payload))
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestVerdictWebhookBaselineSkipsFailedRuns(t *testing.T) {
+	setupChannelDetectTestDB(t)
+	setting := system_setting.GetProxyDetectSetting()
+	orig := setting.VerdictWebhookURL
+	t.Cleanup(func() { setting.VerdictWebhookURL = orig })
+	setting.VerdictWebhookURL = "https://hooks.example.com/verdict"
+
+	const baseURL = "https://relay.example.com"
+	modelName := "claude-sonnet-4-5-20250929"
+	// anthropic -> timeout -> suspicious: the timeout is not a change, the flip after it is
+	var changes []bool
+	for _, verdict := range []string{"anthropic", "timeout", "suspicious"} {
+		result := DetectResult{Model: modelName, Verdict: verdict}
+		previous := verdictWebhookBaseline(context.Background(), baseURL, modelName)
+		_, changed := buildVerdictChangePayload(baseURL, previous, result)
+		changes = append(changes, changed)
+		persistDetectResult(context.Background(), baseURL, "sk-test", result)
+	}
+	require.Equal(t, []bool{false, false, true}, changes)
+}
+
+func TestDetectPersistsTimeoutWhenCutShort(t *testing.T) {
+	setupChannelDetectTestDB(t)
+	setting := system_setting.GetProxyDetectSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.ResultCacheTTLMinutes = 0
+
+	// The tool probes answer, the thinking probe hangs until the run is cut short
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"thinking"`) {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(toolProbeGenuineBody))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	modelName := "claude-sonnet-4-5-20250929"
+	result := detectSingleModel(ctx, srv.URL, "sk-test", modelName, DetectOptions{Rounds: 1, SkipSSRFCheck: true, PersistResult: true})
+	require.Equal(t, "timeout", result.Verdict)
+	require.Zero(t, result.Confidence)
+	require.NotEmpty(t, result.Fingerprints)
+
+	logs, _, err := model.GetProxyDetectLogs(model.HashProxyDetectTarget(srv.URL), modelName, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, "timeout", logs[0].Verdict)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultWorkingModelCandidates are tried by FindWorkingModel, cheapest current models first
+var DefaultWorkingModelCandidates = []string{
+	"claude-sonnet-4-5-20250929",
+	"claude-haiku-4-5-20251001",
+	"claude-3-5-sonnet-20241022",
+	"claude-3-haiku-20240307",
+}
+
+// Timeout of one availability check while looking for a working model
+const workingModelCheckTimeout = 15 * time.Second
+
+// FailedModel is a candidate that did not pass CheckModelAvailable
+type FailedModel struct {
+	Model string `json:"model"`
+	// One of UnavailableReason*
+	Reason     string `json:"reason"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+// WorkingModels is the outcome of FindWorkingModels; Working is empty when no candidate works
+type WorkingModels struct {
+	Working []string      `json:"working"`
+	Failed  []FailedModel `json:"failed"`
+	// Opus candidates dropped to save quota
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// FindWorkingModels checks every candidate and reports which ones answered 200 and why the
+// others failed. Opus models are skipped to save quota; nil candidates uses
+// DefaultWorkingModelCandidates.
+func FindWorkingModels(ctx context.Context, client *http.Client, target ProbeTarget, candidates []string) WorkingModels {
+	return findWorkingModels(ctx, client, target, candidates, false)
+}
+
+// FindWorkingModel returns the first working default candidate, or the first candidate when
+// none works
+func FindWorkingModel(ctx context.Context, client *http.Client, target ProbeTarget) string {
+	found := findWorkingModels(ctx, client, target, nil, true)
+	if len(found.Working) == 0 {
+		return DefaultWorkingModelCandidates[0]
+	}
+	return found.Working[0]
+}
+
+func findWorkingModels(ctx context.Context, client *http.Client, target ProbeTarget, candidates []string, stopAtFirst bool) WorkingModels {
+	if candidates == nil {
+		candidates = DefaultWorkingModelCandidates
+	}
+	result := WorkingModels{Working: []string{}, Failed: []FailedModel{}}
+	for _, model := range candidates {
+		if strings.Contains(strings.ToLower(model), "opus") {
+			result.Skipped = append(result.Skipped, model)
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, workingModelCheckTimeout)
+		err := CheckModelAvailable(checkCtx, client, target, model)
+		cancel()
+		if err == nil {
+			result.Working = append(result.Working, model)
+			if stopAtFirst {
+				break
+			}
+			continue
+		}
+		failed := FailedModel{Model: model, Reason: unavailableReason(err)}
+		var unavailable *ModelUnavailableError
+		if errors.As(err, &unavailable) {
+			failed.StatusCode = unavailable.StatusCode
+		}
+		result.Failed = append(result.Failed, failed)
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindWorkingModels(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "claude-haiku"):
+			requested = append(requested, "claude-haiku")
+			w.WriteHeader(http.StatusOK)
+		case strings.Contains(string(body), "claude-sonnet"):
+			requested = append(requested, "claude-sonnet")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(modelNotFoundErrorBody))
+		default:
+			requested = append(requested, "other")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+	client := newUnsafeHTTPClient(5 * time.Second)
+	target := ProbeTarget{BaseURL: srv.URL, APIKey: "sk-test"}
+
+	found := FindWorkingModels(context.Background(), client, target, []string{"claude-sonnet", "claude-opus", "claude-haiku", "claude-x"})
+	require.Equal(t, []string{"claude-haiku"}, found.Working)
+	require.Equal(t, []FailedModel{
+		{Model: "claude-sonnet", Reason: UnavailableReasonModelNotFound, StatusCode: http.StatusNotFound},
+		{Model: "claude-x", Reason: UnavailableReasonUpstream, StatusCode: http.StatusTooManyRequests},
+	}, found.Failed)
+	require.Equal(t, []string{"claude-opus"}, found.Skipped)
+	require.Equal(t, []string{"claude-sonnet", "claude-haiku", "other"}, requested)
+
+	// Nothing works: an explicit empty list instead of a default model
+	found = FindWorkingModels(context.Background(), client, target, []string{"claude-x"})
+	require.NotNil(t, found.Working)
+	require.Empty(t, found.Working)
+}
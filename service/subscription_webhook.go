@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	SubscriptionWebhookEventCreated = "subscription.created"
+	// Per-attempt timeout for delivering a subscription webhook
+	subscriptionWebhookTimeout = 10 * time.Second
+)
+
+// Base delay between delivery attempts, doubled on each retry up to subscriptionWebhookMaxBackoff
+var subscriptionWebhookBackoff = 2 * time.Second
+
+// Longest delay between two delivery attempts
+const subscriptionWebhookMaxBackoff = 5 * time.Minute
+
+// SubscriptionWebhookPayload is the signed body posted to the fulfillment endpoint
+type SubscriptionWebhookPayload struct {
+	Event          string  `json:"event"`
+	OrderId        string  `json:"order_id"`
+	SubscriptionId int     `json:"subscription_id"`
+	UserId         int     `json:"user_id"`
+	Username       string  `json:"username"`
+	PlanId         int     `json:"plan_id"`
+	PlanTitle      string  `json:"plan_title"`
+	Amount         float64 `json:"amount"`
+	PaymentMethod  string  `json:"payment_method"`
+	Source         string  `json:"source"`
+	Timestamp      int64   `json:"timestamp"`
+}
+
+func init() {
+	model.SubscriptionPurchaseHook = NotifySubscriptionPurchase
+}
+
+// NotifySubscriptionPurchase delivers the subscription webhook asynchronously when configured
+func NotifySubscriptionPurchase(event model.SubscriptionPurchaseEvent) {
+	setting := operation_setting.GetSubscriptionWebhookSetting()
+	if !setting.Enabled || setting.URL == "" {
+		return
+	}
+	webhookURL, secret, maxRetries := setting.URL, setting.Secret, setting.MaxRetries
+	gopool.Go(func() {
+		username, _ := model.GetUsernameById(event.UserId, false)
+		payload := SubscriptionWebhookPayload{
+			Event:          SubscriptionWebhookEventCreated,
+			OrderId:        event.TradeNo,
+			SubscriptionId: event.SubscriptionId,
+			UserId:         event.UserId,
+			Username:       username,
+			PlanId:         event.PlanId,
+			PlanTitle:      event.PlanTitle,
+			Amount:         event.Money,
+			PaymentMethod:  event.PaymentMethod,
+			Source:         event.Source,
+			Timestamp:      time.Now().Unix(),
+		}
+		if err := deliverSubscriptionWebhook(context.Background(), webhookURL, secret, payload, maxRetries); err != nil {
+			common.SysError(fmt.Sprintf("subscription webhook for user %d plan %d failed: %s", event.UserId, event.PlanId, err.Error()))
+		}
+	})
+}
+
+// deliverSubscriptionWebhook posts the payload, retrying with exponential backoff.
+// SSRF rejections are not retried.
+func deliverSubscriptionWebhook(ctx context.Context, webhookURL, secret string, payload SubscriptionWebhookPayload, maxRetries int) error {
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("request reject: %v", err)
+	}
+	body, err := common.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription webhook payload: %v", err)
+	}
+	// Values saved before the limit existed may be larger
+	maxRetries = min(max(maxRetries, 0), operation_setting.MaxSubscriptionWebhookRetries)
+	delay := subscriptionWebhookBackoff
+	for attempt := 1; ; attempt++ {
+		err = postSignedWebhook(ctx, webhookURL, secret, body, subscriptionWebhookTimeout)
+		if err == nil {
+			common.SysLog(fmt.Sprintf("subscription webhook delivered: event=%s subscription=%d attempt=%d", payload.Event, payload.SubscriptionId, attempt))
+			return nil
+		}
+		common.SysLog(fmt.Sprintf("subscription webhook attempt %d/%d failed: subscription=%d err=%s", attempt, maxRetries+1, payload.SubscriptionId, err.Error()))
+		if attempt > maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, subscriptionWebhookMaxBackoff)
+	}
+}
+
+// postSignedWebhook posts body once within timeout, signing it with secret when set
+func postSignedWebhook(ctx context.Context, webhookURL, secret string, body []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Webhook-Signature", generateSignature(secret, body))
+	}
+	client := GetHttpClient()
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook request: %v", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliverSubscriptionWebhook(t *testing.T) {
+	fetchSetting := system_setting.GetFetchSetting()
+	origSSRF, origBackoff := fetchSetting.EnableSSRFProtection, subscriptionWebhookBackoff
+	t.Cleanup(func() {
+		fetchSetting.EnableSSRFProtection = origSSRF
+		subscriptionWebhookBackoff = origBackoff
+	})
+	subscriptionWebhookBackoff = time.Millisecond
+
+	payload := SubscriptionWebhookPayload{
+		Event:          SubscriptionWebhookEventCreated,
+		OrderId:        "SUB-1",
+		SubscriptionId: 7,
+		UserId:         3,
+		PlanId:         2,
+		Amount:         9.9,
+		Source:         "order",
+		Timestamp:      1700000000,
+	}
+
+	t.Run("signed delivery after retry", func(t *testing.T) {
+		fetchSetting.EnableSSRFProtection = false
+		var calls atomic.Int32
+		var got SubscriptionWebhookPayload
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			require.Equal(t, generateSignature("s3cret", body), r.Header.Get("X-Webhook-Signature"))
+			require.NoError(t, common.Unmarshal(body, &got))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		require.NoError(t, deliverSubscriptionWebhook(context.Background(), server.URL, "s3cret", payload, 2))
+		require.Equal(t, int32(2), calls.Load())
+		require.Equal(t, payload, got)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		fetchSetting.EnableSSRFProtection = false
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		require.Error(t, deliverSubscriptionWebhook(context.Background(), server.URL, "", payload, 2))
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("ssrf protection rejects loopback", func(t *testing.T) {
+		fetchSetting.EnableSSRFProtection = true
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		}))
+		defer server.Close()
+
+		require.Error(t, deliverSubscriptionWebhook(context.Background(), server.URL, "", payload, 2))
+		require.Zero(t, calls.Load())
+	})
+}
@@ -0,0 +1,66 @@
+package operation_setting
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// SubscriptionWebhookSetting 订阅购买 Webhook，用于对接外部履约系统
+type SubscriptionWebhookSetting struct {
+	Enabled    bool   `json:"enabled"`
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`      // HMAC-SHA256 签名密钥，签名放在 X-Webhook-Signature 头
+	MaxRetries int    `json:"max_retries"` // 首次投递失败后的最大重试次数
+}
+
+// 最大重试次数上限，避免投递协程长时间存活
+const MaxSubscriptionWebhookRetries = 10
+
+// 默认配置
+var subscriptionWebhookSetting = SubscriptionWebhookSetting{
+	Enabled:    false,
+	URL:        "",
+	Secret:     "",
+	MaxRetries: 3,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("subscription_webhook_setting", &subscriptionWebhookSetting)
+}
+
+func GetSubscriptionWebhookSetting() *SubscriptionWebhookSetting {
+	return &subscriptionWebhookSetting
+}
+
+// ValidateSubscriptionWebhookURL 校验 Webhook 地址，留空表示不投递
+func ValidateSubscriptionWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("Webhook 地址格式无效")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("Webhook 地址仅支持 http/https")
+	}
+	return nil
+}
+
+// ValidateSubscriptionWebhookMaxRetries 校验最大重试次数
+func ValidateSubscriptionWebhookMaxRetries(value string) error {
+	retries, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("最大重试次数格式错误：%s", err.Error())
+	}
+	if retries < 0 || retries > MaxSubscriptionWebhookRetries {
+		return fmt.Errorf("最大重试次数须在 0 到 %d 之间", MaxSubscriptionWebhookRetries)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package operation_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSubscriptionWebhookMaxRetries(t *testing.T) {
+	require.NoError(t, ValidateSubscriptionWebhookMaxRetries("0"))
+	require.NoError(t, ValidateSubscriptionWebhookMaxRetries("10"))
+	require.Error(t, ValidateSubscriptionWebhookMaxRetries("11"))
+	require.Error(t, ValidateSubscriptionWebhookMaxRetries("-1"))
+	require.Error(t, ValidateSubscriptionWebhookMaxRetries("three"))
+}
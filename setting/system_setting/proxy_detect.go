@@ -0,0 +1,556 @@
+package system_setting
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ProxyDetectSetting 中转检测配置
+type ProxyDetectSetting struct {
+	// 是否允许非管理员使用中转检测，关闭后仅管理员可用
+	UserEnabled bool `json:"user_enabled"`
+	// 命中即判定为中转的平台（与 detectProxyPlatform 返回的平台名比较，不区分大小写），默认为空
+	DisqualifyingPlatforms []string `json:"disqualifying_platforms"`
+	// 检测记录保留天数，0 表示不按时间清理；每个 base URL 与模型的最新记录是变更 webhook 的基线，始终保留
+	RetentionDays int `json:"retention_days"`
+	// 每个 base URL 保留的最新记录数，0 表示不限制
+	RetentionKeepLatest int `json:"retention_keep_latest"`
+	// 各探测类型使用的提示词（tool/thinking/max_tokens/stream/system/identity/simple），便于轮换或本地化，缺省时使用内置提示词
+	ProbePrompts map[string]string `json:"probe_prompts"`
+	// 是否在后台定期预热 Anthropic 渠道的模型可用性缓存
+	AvailabilityWarmEnabled bool `json:"availability_warm_enabled"`
+	// 预热间隔（分钟）
+	AvailabilityWarmIntervalMinutes int `json:"availability_warm_interval_minutes"`
+	// 可用性缓存有效期（分钟），超过后视为过期
+	AvailabilityCacheTTLMinutes int `json:"availability_cache_ttl_minutes"`
+	// 是否在后台按间隔自动检测全部 Anthropic 渠道并保存结果，可随时开关
+	ScheduledDetectEnabled bool `json:"scheduled_detect_enabled"`
+	// 自动检测间隔（小时），上一轮未结束时不会开始新的一轮
+	ScheduledDetectIntervalHours int `json:"scheduled_detect_interval_hours"`
+	// 自动检测时同时检测的渠道数
+	ScheduledDetectConcurrency int `json:"scheduled_detect_concurrency"`
+	// 是否为每次检测记录审计日志（发起人、目标地址哈希、模型、结论）
+	AuditEnabled bool `json:"audit_enabled"`
+	// 探测请求是否跟随重定向，关闭后直接返回 3xx 响应
+	ProbeFollowRedirects bool `json:"probe_follow_redirects"`
+	// 最多跟随的重定向次数
+	ProbeMaxRedirects int `json:"probe_max_redirects"`
+	// 探测遇到 429/502/503/504 时的最大请求次数（含首次，最多 5 次），1 表示不重试
+	ProbeMaxAttempts int `json:"probe_max_attempts"`
+	// 重试的初始等待（毫秒），每次翻倍；响应带 Retry-After 时以其为准
+	ProbeRetryBaseDelayMs int `json:"probe_retry_base_delay_ms"`
+	// 允许重定向前往的其它主机（默认仅允许同主机重定向）
+	ProbeRedirectAllowedHosts []string `json:"probe_redirect_allowed_hosts"`
+	// 官方 usage 对象中的已知字段，其余字段视为中转注入；官方新增字段时在此补充，为空时使用内置列表
+	KnownUsageFields []string `json:"known_usage_fields"`
+	// 探测请求禁止访问的云元数据地址，支持 IP、CIDR 和主机名，为空时使用内置列表
+	MetadataDenylist []string `json:"metadata_denylist"`
+	// 未跳过 SSRF 检查时（非管理员检测）允许探测的目标主机，支持 *.example.com 通配子域名，为空时不限制
+	TargetHostAllowlist []string `json:"target_host_allowlist"`
+	// 未跳过 SSRF 检查时禁止探测的目标主机，格式同上，优先于允许列表
+	TargetHostDenylist []string `json:"target_host_denylist"`
+	// 单次检测（含多模型扫描）所有探测累计输出 tokens 上限，达到后停止后续探测，0 表示不限制
+	ScanOutputTokenBudget int `json:"scan_output_token_budget"`
+	// 探测读取的非流式响应体上限（KB），超出时停止读取并记为探测失败，防止超大或压缩炸弹响应耗尽内存
+	MaxResponseBodyKB int `json:"max_response_body_kb"`
+	// 批量检测渠道时，显式开启自动禁用后会被禁用的判定结果
+	ChannelAutoDisableVerdicts []string `json:"channel_auto_disable_verdicts"`
+	// 判定时各信号的计分权重，出现新的伪装手段或误判增多时可在线调整
+	ScoringWeights ScoringWeights `json:"scoring_weights"`
+	// 按得分判定时胜出类别的最低置信度（0-1），低于该值时结论改为无法确定，避免信号冲突时误判
+	MinConfidence float64 `json:"min_confidence"`
+	// 未指定模型时多模型扫描使用的模型列表，Anthropic 发布新模型时在此补充，为空时使用内置列表
+	ScanModels []string `json:"scan_models"`
+	// 模型别名（不区分大小写）到规范模型 ID 的映射，检测前替换，追加或覆盖内置别名表
+	ModelAliases map[string]string `json:"model_aliases"`
+	// 单次检测最多可选的模型数，超出时拒绝请求；模型分批扫描，扫描总超时到达后剩余模型不再检测
+	MaxModels int `json:"max_models"`
+	// 相同目标（base URL、API Key、模型、轮数等）的检测结果缓存时长（分钟），0 表示不缓存
+	ResultCacheTTLMinutes int `json:"result_cache_ttl_minutes"`
+	// 检测各阶段的超时
+	Timeouts DetectTimeouts `json:"timeouts"`
+	// thinking 签名长度检查的阈值、预期范围与 thorough 预设的探测次数
+	ThinkingSigCheck ThinkingSigCheck `json:"thinking_sig_check"`
+	// 检测结果保存后，若与同一 base URL、模型的上一次结论不同则向该地址 POST 通知，为空时不通知
+	VerdictWebhookURL string `json:"verdict_webhook_url"`
+	// 通知签名密钥，设置后请求带 X-Webhook-Signature（HMAC-SHA256）
+	VerdictWebhookSecret string `json:"verdict_webhook_secret"`
+}
+
+// DefaultKnownUsageFields 官方 Messages 响应 usage 对象中出现的字段
+var DefaultKnownUsageFields = []string{
+	"input_tokens",
+	"output_tokens",
+	"cache_creation_input_tokens",
+	"cache_read_input_tokens",
+	"cache_creation",
+	"server_tool_use",
+	"service_tier",
+	"inference_geo",
+}
+
+// DefaultMetadataDenylist 主流云厂商的实例元数据地址
+var DefaultMetadataDenylist = []string{
+	"169.254.169.254",          // AWS / GCP / Azure / OCI / DigitalOcean
+	"fd00:ec2::254",            // AWS IPv6
+	"169.254.170.2",            // AWS ECS 任务元数据
+	"100.100.100.200",          // 阿里云
+	"169.254.0.23",             // 腾讯云
+	"192.0.0.192",              // Oracle Cloud 旧版
+	"metadata.google.internal", // GCP
+	"metadata.goog",            // GCP
+	"metadata.azure.com",       // Azure
+	"metadata.tencentyun.com",  // 腾讯云
+}
+
+// DefaultScanModels 内置的多模型扫描默认模型
+var DefaultScanModels = []string{
+	"claude-opus-4-6-thinking",
+	"claude-opus-4-6-20250918",
+	"claude-sonnet-4-5-20250929",
+	"claude-haiku-4-5-20251001",
+	"claude-3-5-sonnet-20241022",
+	"claude-3-haiku-20240307",
+}
+
+// DefaultModelAliases 内置的模型别名表，将营销名称和 -latest 别名映射为带日期的模型 ID
+var DefaultModelAliases = map[string]string{
+	"claude-3.5-sonnet":        "claude-3-5-sonnet-20241022",
+	"claude-3-5-sonnet":        "claude-3-5-sonnet-20241022",
+	"claude-3-5-sonnet-latest": "claude-3-5-sonnet-20241022",
+	"claude-3.5-haiku":         "claude-3-5-haiku-20241022",
+	"claude-3-5-haiku":         "claude-3-5-haiku-20241022",
+	"claude-3-5-haiku-latest":  "claude-3-5-haiku-20241022",
+	"claude-3.7-sonnet":        "claude-3-7-sonnet-20250219",
+	"claude-3-7-sonnet":        "claude-3-7-sonnet-20250219",
+	"claude-3-7-sonnet-latest": "claude-3-7-sonnet-20250219",
+	"claude-3-haiku":           "claude-3-haiku-20240307",
+	"claude-3-opus":            "claude-3-opus-20240229",
+	"claude-3-opus-latest":     "claude-3-opus-20240229",
+	"claude-sonnet-4":          "claude-sonnet-4-20250514",
+	"claude-sonnet-4-0":        "claude-sonnet-4-20250514",
+	"claude-opus-4":            "claude-opus-4-20250514",
+	"claude-opus-4-0":          "claude-opus-4-20250514",
+	"claude-opus-4-1":          "claude-opus-4-1-20250805",
+	"claude-opus-4.1":          "claude-opus-4-1-20250805",
+	"claude-sonnet-4-5":        "claude-sonnet-4-5-20250929",
+	"claude-sonnet-4.5":        "claude-sonnet-4-5-20250929",
+	"claude-haiku-4-5":         "claude-haiku-4-5-20251001",
+	"claude-haiku-4.5":         "claude-haiku-4-5-20251001",
+	"claude-opus-4-6":          "claude-opus-4-6-20250918",
+	"claude-opus-4.6":          "claude-opus-4-6-20250918",
+	"sonnet":                   "claude-sonnet-4-5-20250929",
+	"sonnet-latest":            "claude-sonnet-4-5-20250929",
+	"haiku":                    "claude-haiku-4-5-20251001",
+	"haiku-latest":             "claude-haiku-4-5-20251001",
+	"opus":                     "claude-opus-4-6-20250918",
+	"opus-latest":              "claude-opus-4-6-20250918",
+}
+
+// 扫描模型列表的最大长度
+const maxScanModels = 20
+
+// 单次检测模型数上限的默认值与可配置的最大值
+const (
+	defaultMaxModels = 6
+	maxMaxModels     = 50
+)
+
+// 响应体上限（KB）的默认值与可配置范围
+const (
+	defaultMaxResponseBodyKB = 2048
+	minMaxResponseBodyKB     = 64
+	maxMaxResponseBodyKB     = 64 << 10
+)
+
+// 自动检测间隔（小时）与并发数的上限
+const (
+	maxScheduledDetectIntervalHours = 720
+	maxScheduledDetectConcurrency   = 10
+)
+
+// Claude 模型 ID：claude- 开头，由小写字母、数字和 . - 组成
+var claudeModelIDPattern = regexp.MustCompile(`^claude-[a-z0-9]+(?:[.-][a-z0-9]+)*$`)
+
+// ProxyDetectToolName 工具探测中强制调用的工具名，自定义的 tool 提示词必须提及该名称
+const ProxyDetectToolName = "probe"
+
+// DefaultProbePrompts 内置的各探测类型提示词
+var DefaultProbePrompts = map[string]string{
+	"tool":       "call probe with q=test",
+	"thinking":   "What is 2+3?",
+	"max_tokens": "Count from 1 to 2000 in English words, one number per line. Do not stop early or summarize.",
+	"stream":     "Write the numbers 1 to 40 separated by spaces.",
+	"system":     "What is the capital of France?",
+	"identity":   "What model are you? Reply with your exact model name and the company that trained you.",
+	"simple":     "Say OK",
+}
+
+var defaultProxyDetectSetting = ProxyDetectSetting{
+	UserEnabled:            true,
+	DisqualifyingPlatforms: []string{},
+	RetentionDays:          30,
+	RetentionKeepLatest:    0,
+	ProbePrompts:           map[string]string{},
+
+	AvailabilityWarmEnabled:         false,
+	AvailabilityWarmIntervalMinutes: 30,
+	AvailabilityCacheTTLMinutes:     60,
+
+	ScheduledDetectEnabled:       false,
+	ScheduledDetectIntervalHours: 24,
+	ScheduledDetectConcurrency:   2,
+
+	AuditEnabled: true,
+
+	ProbeFollowRedirects:      true,
+	ProbeMaxRedirects:         3,
+	ProbeRedirectAllowedHosts: []string{},
+
+	ProbeMaxAttempts:      3,
+	ProbeRetryBaseDelayMs: 500,
+
+	KnownUsageFields: append([]string(nil), DefaultKnownUsageFields...),
+	MetadataDenylist: append([]string(nil), DefaultMetadataDenylist...),
+
+	TargetHostAllowlist: []string{},
+	TargetHostDenylist:  []string{},
+
+	ScanOutputTokenBudget: 0,
+	MaxResponseBodyKB:     defaultMaxResponseBodyKB,
+
+	ChannelAutoDisableVerdicts: []string{"suspicious", "bedrock"},
+
+	ScoringWeights: DefaultScoringWeights,
+	MinConfidence:  0.5,
+
+	ScanModels:   append([]string(nil), DefaultScanModels...),
+	ModelAliases: map[string]string{},
+	MaxModels:    defaultMaxModels,
+
+	ResultCacheTTLMinutes: 10,
+
+	Timeouts: DefaultDetectTimeouts,
+
+	ThinkingSigCheck: DefaultThinkingSigCheck,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("proxy_detect_setting", &defaultProxyDetectSetting)
+}
+
+func GetProxyDetectSetting() *ProxyDetectSetting {
+	return &defaultProxyDetectSetting
+}
+
+// IsDisqualifyingPlatform 判断平台是否被配置为直接判定中转
+func (s *ProxyDetectSetting) IsDisqualifyingPlatform(platform string) bool {
+	if platform == "" {
+		return false
+	}
+	for _, p := range s.DisqualifyingPlatforms {
+		if strings.EqualFold(strings.TrimSpace(p), platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbePrompt 返回探测类型对应的提示词，未配置或为空时回退到内置提示词
+func (s *ProxyDetectSetting) ProbePrompt(probeType string) string {
+	if prompt := strings.TrimSpace(s.ProbePrompts[probeType]); prompt != "" {
+		return prompt
+	}
+	return DefaultProbePrompts[probeType]
+}
+
+// ValidateProbePrompts 校验探测提示词配置：仅允许已知探测类型，提示词不能为空，tool 提示词必须要求调用探测工具
+func ValidateProbePrompts(jsonStr string) error {
+	var prompts map[string]string
+	if err := common.UnmarshalJsonStr(jsonStr, &prompts); err != nil {
+		return fmt.Errorf("探测提示词格式错误：%s", err.Error())
+	}
+	for probeType, prompt := range prompts {
+		if _, ok := DefaultProbePrompts[probeType]; !ok {
+			return fmt.Errorf("未知的探测类型 %s", probeType)
+		}
+		if strings.TrimSpace(prompt) == "" {
+			return fmt.Errorf("探测类型 %s 的提示词不能为空", probeType)
+		}
+		if probeType == "tool" && !strings.Contains(strings.ToLower(prompt), ProxyDetectToolName) {
+			return fmt.Errorf("tool 提示词必须要求模型调用 %s 工具", ProxyDetectToolName)
+		}
+	}
+	return nil
+}
+
+// IsRedirectHostAllowed 判断探测请求是否可以重定向到该主机（不区分大小写）
+func (s *ProxyDetectSetting) IsRedirectHostAllowed(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, h := range s.ProbeRedirectAllowedHosts {
+		if strings.EqualFold(strings.TrimSpace(h), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKnownUsageField 判断 usage 字段是否属于官方字段，未配置时回退到内置列表
+func (s *ProxyDetectSetting) IsKnownUsageField(field string) bool {
+	known := s.KnownUsageFields
+	if len(known) == 0 {
+		known = DefaultKnownUsageFields
+	}
+	for _, k := range known {
+		if strings.TrimSpace(k) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsChannelAutoDisableVerdict 判断批量检测中该判定结果是否应自动禁用渠道
+func (s *ProxyDetectSetting) IsChannelAutoDisableVerdict(verdict string) bool {
+	if verdict == "" {
+		return false
+	}
+	for _, v := range s.ChannelAutoDisableVerdicts {
+		if strings.TrimSpace(v) == verdict {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataDenylistEntries 返回生效的元数据禁止列表，未配置时回退到内置列表
+func (s *ProxyDetectSetting) MetadataDenylistEntries() []string {
+	if len(s.MetadataDenylist) == 0 {
+		return DefaultMetadataDenylist
+	}
+	return s.MetadataDenylist
+}
+
+// ScanModelEntries 返回生效的扫描模型列表，未配置时回退到内置列表
+func (s *ProxyDetectSetting) ScanModelEntries() []string {
+	if len(s.ScanModels) == 0 {
+		return DefaultScanModels
+	}
+	return s.ScanModels
+}
+
+// ValidateScanModels 校验扫描模型列表：每项必须是形如 claude-sonnet-4-5-20250929 的 Claude 模型 ID，且不能重复
+func ValidateScanModels(jsonStr string) error {
+	var models []string
+	if err := common.UnmarshalJsonStr(jsonStr, &models); err != nil {
+		return fmt.Errorf("扫描模型列表格式错误：%s", err.Error())
+	}
+	if len(models) > maxScanModels {
+		return fmt.Errorf("扫描模型最多 %d 个", maxScanModels)
+	}
+	seen := make(map[string]bool, len(models))
+	for _, m := range models {
+		if !claudeModelIDPattern.MatchString(m) {
+			return fmt.Errorf("无效的 Claude 模型 ID %q", m)
+		}
+		if seen[m] {
+			return fmt.Errorf("扫描模型 %s 重复", m)
+		}
+		seen[m] = true
+	}
+	return nil
+}
+
+// ResolveModelAlias 返回别名对应的规范模型 ID，配置的别名优先于内置别名，不是别名时原样返回
+func (s *ProxyDetectSetting) ResolveModelAlias(model string) string {
+	key := strings.ToLower(strings.TrimSpace(model))
+	for alias, canonical := range s.ModelAliases {
+		if strings.ToLower(strings.TrimSpace(alias)) == key {
+			return canonical
+		}
+	}
+	if canonical, ok := DefaultModelAliases[key]; ok {
+		return canonical
+	}
+	return model
+}
+
+// ValidateModelAliases 校验模型别名表：别名不能为空，目标必须是 Claude 模型 ID，且不能指向另一个别名
+func ValidateModelAliases(jsonStr string) error {
+	var aliases map[string]string
+	if err := common.UnmarshalJsonStr(jsonStr, &aliases); err != nil {
+		return fmt.Errorf("模型别名格式错误：%s", err.Error())
+	}
+	lowered := make(map[string]bool, len(aliases))
+	for alias := range aliases {
+		key := strings.ToLower(strings.TrimSpace(alias))
+		if lowered[key] {
+			return fmt.Errorf("模型别名 %s 重复", alias)
+		}
+		lowered[key] = true
+	}
+	for alias, canonical := range aliases {
+		if strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("模型别名不能为空")
+		}
+		if !claudeModelIDPattern.MatchString(canonical) {
+			return fmt.Errorf("别名 %s 的目标不是有效的 Claude 模型 ID：%q", alias, canonical)
+		}
+		if lowered[canonical] {
+			return fmt.Errorf("别名 %s 的目标 %s 本身也是别名", alias, canonical)
+		}
+	}
+	return nil
+}
+
+// ModelLimit 返回单次检测最多可选的模型数，未配置时使用默认值
+func (s *ProxyDetectSetting) ModelLimit() int {
+	if s.MaxModels <= 0 {
+		return defaultMaxModels
+	}
+	return s.MaxModels
+}
+
+// ValidateMaxModels 校验单次检测模型数上限
+func ValidateMaxModels(value string) error {
+	maxModels, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("模型数上限格式错误：%s", err.Error())
+	}
+	if maxModels < 1 || maxModels > maxMaxModels {
+		return fmt.Errorf("模型数上限须在 1 到 %d 之间", maxMaxModels)
+	}
+	return nil
+}
+
+// ResponseBodyLimit 返回探测读取响应体的字节上限，未配置时使用默认值
+func (s *ProxyDetectSetting) ResponseBodyLimit() int64 {
+	if s.MaxResponseBodyKB <= 0 {
+		return defaultMaxResponseBodyKB << 10
+	}
+	return int64(s.MaxResponseBodyKB) << 10
+}
+
+// ValidateMaxResponseBodyKB 校验响应体上限
+func ValidateMaxResponseBodyKB(value string) error {
+	kb, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("响应体上限格式错误：%s", err.Error())
+	}
+	if kb < minMaxResponseBodyKB || kb > maxMaxResponseBodyKB {
+		return fmt.Errorf("响应体上限须在 %d 到 %d KB 之间", minMaxResponseBodyKB, maxMaxResponseBodyKB)
+	}
+	return nil
+}
+
+// ValidateScheduledDetectIntervalHours 校验自动检测间隔
+func ValidateScheduledDetectIntervalHours(value string) error {
+	hours, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("自动检测间隔格式错误：%s", err.Error())
+	}
+	if hours < 1 || hours > maxScheduledDetectIntervalHours {
+		return fmt.Errorf("自动检测间隔须在 1 到 %d 小时之间", maxScheduledDetectIntervalHours)
+	}
+	return nil
+}
+
+// ValidateScheduledDetectConcurrency 校验自动检测并发数
+func ValidateScheduledDetectConcurrency(value string) error {
+	concurrency, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("自动检测并发数格式错误：%s", err.Error())
+	}
+	if concurrency < 1 || concurrency > maxScheduledDetectConcurrency {
+		return fmt.Errorf("自动检测并发数须在 1 到 %d 之间", maxScheduledDetectConcurrency)
+	}
+	return nil
+}
+
+// ValidateMinConfidence 校验最低置信度在 0 到 1 之间
+func ValidateMinConfidence(value string) error {
+	minConfidence, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("最低置信度格式错误：%s", err.Error())
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		return fmt.Errorf("最低置信度须在 0 到 1 之间")
+	}
+	return nil
+}
+
+// MatchTargetHost 判断主机名是否命中列表中的某项（不区分大小写）；*.example.com 匹配其任意层级的子域名，不匹配 example.com 本身
+func MatchTargetHost(patterns []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if pattern != "" && pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTargetHostList 校验目标主机允许/禁止列表：每项必须是主机名、IP 或 *. 开头的通配域名
+func ValidateTargetHostList(jsonStr string) error {
+	var entries []string
+	if err := common.UnmarshalJsonStr(jsonStr, &entries); err != nil {
+		return fmt.Errorf("目标主机列表格式错误：%s", err.Error())
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return fmt.Errorf("目标主机列表不能包含空项")
+		}
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		name := strings.TrimPrefix(entry, "*.")
+		if name == "" || strings.ContainsAny(name, "* :/?#@[]") {
+			return fmt.Errorf("无效的目标主机 %s", entry)
+		}
+	}
+	return nil
+}
+
+// ValidateMetadataDenylist 校验元数据禁止列表：每项必须是 IP、CIDR 或主机名
+func ValidateMetadataDenylist(jsonStr string) error {
+	var entries []string
+	if err := common.UnmarshalJsonStr(jsonStr, &entries); err != nil {
+		return fmt.Errorf("元数据禁止列表格式错误：%s", err.Error())
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return fmt.Errorf("元数据禁止列表不能包含空项")
+		}
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("无效的 CIDR %s", entry)
+			}
+			continue
+		}
+		if strings.ContainsAny(entry, " :/?#@") {
+			return fmt.Errorf("无效的主机名 %s", entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package system_setting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProbePrompts(t *testing.T) {
+	require.NoError(t, ValidateProbePrompts(`{}`))
+	require.NoError(t, ValidateProbePrompts(`{"simple":"回复 OK","tool":"请调用 probe 工具，参数 q=hello"}`))
+	require.Error(t, ValidateProbePrompts(`not json`))
+	require.Error(t, ValidateProbePrompts(`{"simple":"  "}`))
+	require.Error(t, ValidateProbePrompts(`{"unknown":"hi"}`))
+	require.Error(t, ValidateProbePrompts(`{"tool":"say hello"}`))
+}
+
+func TestProbePromptFallback(t *testing.T) {
+	s := ProxyDetectSetting{ProbePrompts: map[string]string{"simple": "回复 OK", "thinking": " "}}
+	require.Equal(t, "回复 OK", s.ProbePrompt("simple"))
+	require.Equal(t, DefaultProbePrompts["thinking"], s.ProbePrompt("thinking"))
+	require.Equal(t, DefaultProbePrompts["tool"], s.ProbePrompt("tool"))
+}
+
+func TestValidateMetadataDenylist(t *testing.T) {
+	require.NoError(t, ValidateMetadataDenylist(`["169.254.169.254", "fd00:ec2::254", "10.0.0.0/8", "metadata.google.internal"]`))
+	require.Error(t, ValidateMetadataDenylist(`["10.0.0.0/33"]`))
+	require.Error(t, ValidateMetadataDenylist(`[""]`))
+	require.Error(t, ValidateMetadataDenylist(`["http://metadata"]`))
+	require.Error(t, ValidateMetadataDenylist(`{"a":1}`))
+}
+
+func TestParseScoringWeights(t *testing.T) {
+	require.NoError(t, DefaultScoringWeights.Validate())
+
+	w, err := ParseScoringWeights(`{"model_kiro": 10, "duplicate_msg_id_penalty": 0}`, DefaultScoringWeights)
+	require.NoError(t, err)
+	require.Equal(t, 10, w.ModelKiro)
+	require.Equal(t, 0, w.DuplicateMsgIDPenalty)
+	require.Equal(t, DefaultScoringWeights.ToolIDAnthropic, w.ToolIDAnthropic)
+
+	_, err = ParseScoringWeights(`{"tool_id_bedrock": -1}`, DefaultScoringWeights)
+	require.ErrorContains(t, err, "tool_id_bedrock")
+	_, err = ParseScoringWeights(`{"tool_id_bedrock": 1.5}`, DefaultScoringWeights)
+	require.Error(t, err)
+	_, err = ParseScoringWeights(`not json`, DefaultScoringWeights)
+	require.Error(t, err)
+}
+
+func TestValidateScanModels(t *testing.T) {
+	require.NoError(t, ValidateScanModels(`[]`))
+	require.NoError(t, ValidateScanModels(`["claude-opus-4-6-thinking", "claude-3-5-sonnet-20241022", "claude-sonnet-4.5"]`))
+	require.Error(t, ValidateScanModels(`["gpt-4o"]`))
+	require.Error(t, ValidateScanModels(`["Claude-3-haiku"]`))
+	require.Error(t, ValidateScanModels(`["claude-3-haiku-"]`))
+	require.Error(t, ValidateScanModels(`["claude-3-haiku", "claude-3-haiku"]`))
+	require.Error(t, ValidateScanModels(`"claude-3-haiku"`))
+}
+
+func TestScanModelFallback(t *testing.T) {
+	s := ProxyDetectSetting{}
+	require.Equal(t, DefaultScanModels, s.ScanModelEntries())
+	s.ScanModels = []string{"claude-opus-4-7"}
+	require.Equal(t, []string{"claude-opus-4-7"}, s.ScanModelEntries())
+}
+
+func TestResolveModelAlias(t *testing.T) {
+	s := ProxyDetectSetting{}
+	require.Equal(t, "claude-3-5-sonnet-20241022", s.ResolveModelAlias("claude-3.5-sonnet"))
+	require.Equal(t, "claude-sonnet-4-5-20250929", s.ResolveModelAlias(" Sonnet-Latest "))
+	require.Equal(t, "claude-3-haiku-20240307", s.ResolveModelAlias("claude-3-haiku-20240307"))
+	require.Equal(t, "my-custom-model", s.ResolveModelAlias("my-custom-model"))
+
+	// Configured aliases extend and override the built-in table
+	s.ModelAliases = map[string]string{"Sonnet-Latest": "claude-sonnet-4-20250514", "house-claude": "claude-opus-4-1-20250805"}
+	require.Equal(t, "claude-sonnet-4-20250514", s.ResolveModelAlias("sonnet-latest"))
+	require.Equal(t, "claude-opus-4-1-20250805", s.ResolveModelAlias("house-claude"))
+
+	for alias, canonical := range DefaultModelAliases {
+		require.Regexp(t, claudeModelIDPattern, canonical, alias)
+		_, chained := DefaultModelAliases[canonical]
+		require.False(t, chained, alias)
+	}
+}
+
+func TestValidateModelAliases(t *testing.T) {
+	require.NoError(t, ValidateModelAliases(`{}`))
+	require.NoError(t, ValidateModelAliases(`{"house-claude": "claude-opus-4-1-20250805"}`))
+	require.Error(t, ValidateModelAliases(`{"house-claude": "gpt-4o"}`))
+	require.Error(t, ValidateModelAliases(`{" ": "claude-opus-4-1-20250805"}`))
+	require.Error(t, ValidateModelAliases(`{"a": "claude-b", "claude-b": "claude-opus-4-1-20250805"}`))
+	require.Error(t, ValidateModelAliases(`{"sonnet": "claude-sonnet-4-20250514", "Sonnet": "claude-sonnet-4-20250514"}`))
+	require.Error(t, ValidateModelAliases(`["sonnet"]`))
+}
+
+func TestParseDetectTimeouts(t *testing.T) {
+	require.NoError(t, DefaultDetectTimeouts.Validate())
+
+	timeouts, err := ParseDetectTimeouts(`{"probe_seconds": 10, "single_detect_seconds": 30}`, DefaultDetectTimeouts)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, timeouts.Probe())
+	require.Equal(t, 30*time.Second, timeouts.SingleDetect())
+	require.Equal(t, DefaultDetectTimeouts.MultiScan(), timeouts.MultiScan())
+
+	_, err = ParseDetectTimeouts(`{"probe_seconds": 1}`, DefaultDetectTimeouts)
+	require.ErrorContains(t, err, "probe_seconds")
+	_, err = ParseDetectTimeouts(`{"probe_seconds": 200}`, DefaultDetectTimeouts)
+	require.Error(t, err)
+	_, err = ParseDetectTimeouts(`{"multi_scan_model_seconds": 600}`, DefaultDetectTimeouts)
+	require.Error(t, err)
+	_, err = ParseDetectTimeouts(`not json`, DefaultDetectTimeouts)
+	require.Error(t, err)
+
+	require.Equal(t, 60*time.Second, DetectTimeouts{}.Probe())
+}
+
+func TestValidateMinConfidence(t *testing.T) {
+	require.NoError(t, ValidateMinConfidence("0.5"))
+	require.NoError(t, ValidateMinConfidence("0"))
+	require.NoError(t, ValidateMinConfidence("1"))
+	require.Error(t, ValidateMinConfidence("1.2"))
+	require.Error(t, ValidateMinConfidence("-0.1"))
+	require.Error(t, ValidateMinConfidence("high"))
+}
+
+func TestMaxModels(t *testing.T) {
+	s := &ProxyDetectSetting{}
+	require.Equal(t, defaultMaxModels, s.ModelLimit())
+	s.MaxModels = 20
+	require.Equal(t, 20, s.ModelLimit())
+
+	require.NoError(t, ValidateMaxModels("20"))
+	require.Error(t, ValidateMaxModels("0"))
+	require.Error(t, ValidateMaxModels("51"))
+	require.Error(t, ValidateMaxModels("all"))
+}
+
+func TestValidateScheduledDetect(t *testing.T) {
+	require.NoError(t, ValidateScheduledDetectIntervalHours("24"))
+	require.Error(t, ValidateScheduledDetectIntervalHours("0"))
+	require.Error(t, ValidateScheduledDetectIntervalHours("721"))
+	require.Error(t, ValidateScheduledDetectIntervalHours("daily"))
+
+	require.NoError(t, ValidateScheduledDetectConcurrency("2"))
+	require.Error(t, ValidateScheduledDetectConcurrency("0"))
+	require.Error(t, ValidateScheduledDetectConcurrency("11"))
+}
+
+func TestMatchTargetHost(t *testing.T) {
+	patterns := []string{"*.example.com", "API.anthropic.com", "203.0.113.7"}
+	require.True(t, MatchTargetHost(patterns, "relay.example.com"))
+	require.True(t, MatchTargetHost(patterns, "a.b.example.com."))
+	require.False(t, MatchTargetHost(patterns, "example.com"))
+	require.False(t, MatchTargetHost(patterns, "badexample.com"))
+	require.True(t, MatchTargetHost(patterns, "api.anthropic.com"))
+	require.True(t, MatchTargetHost(patterns, "203.0.113.7"))
+	require.False(t, MatchTargetHost(nil, "api.anthropic.com"))
+}
+
+func TestValidateTargetHostList(t *testing.T) {
+	require.NoError(t, ValidateTargetHostList(`[]`))
+	require.NoError(t, ValidateTargetHostList(`["*.example.com", "api.anthropic.com", "203.0.113.7", "2001:db8::1"]`))
+	require.Error(t, ValidateTargetHostList(`[""]`))
+	require.Error(t, ValidateTargetHostList(`["*"]`))
+	require.Error(t, ValidateTargetHostList(`["a.*.example.com"]`))
+	require.Error(t, ValidateTargetHostList(`["https://example.com"]`))
+	require.Error(t, ValidateTargetHostList(`"example.com"`))
+}
+
+func TestResponseBodyLimit(t *testing.T) {
+	s := &ProxyDetectSetting{}
+	require.Equal(t, int64(defaultMaxResponseBodyKB<<10), s.ResponseBodyLimit())
+	s.MaxResponseBodyKB = 512
+	require.Equal(t, int64(512<<10), s.ResponseBodyLimit())
+
+	require.NoError(t, ValidateMaxResponseBodyKB("2048"))
+	require.Error(t, ValidateMaxResponseBodyKB("16"))
+	require.Error(t, ValidateMaxResponseBodyKB("100000"))
+	require.Error(t, ValidateMaxResponseBodyKB("2MB"))
+}
+
+func TestParseThinkingSigCheck(t *testing.T) {
+	require.NoError(t, DefaultThinkingSigCheck.Validate())
+
+	check, err := ParseThinkingSigCheck(`{"expected_min": 300, "thorough_rounds": 2}`, DefaultThinkingSigCheck)
+	require.NoError(t, err)
+	lo, hi := check.ExpectedRange()
+	require.Equal(t, 300, lo)
+	require.Equal(t, DefaultThinkingSigCheck.ExpectedMax, hi)
+	require.Equal(t, 2, check.Rounds())
+
+	_, err = ParseThinkingSigCheck(`{"short_threshold": 500}`, DefaultThinkingSigCheck)
+	require.Error(t, err)
+	_, err = ParseThinkingSigCheck(`{"expected_max": 150}`, DefaultThinkingSigCheck)
+	require.Error(t, err)
+	_, err = ParseThinkingSigCheck(`{"thorough_rounds": 9}`, DefaultThinkingSigCheck)
+	require.Error(t, err)
+	_, err = ParseThinkingSigCheck(`not json`, DefaultThinkingSigCheck)
+	require.Error(t, err)
+
+	require.Equal(t, 100, ThinkingSigCheck{}.Short())
+	require.Equal(t, 3, ThinkingSigCheck{}.Rounds())
+}
@@ -0,0 +1,80 @@
+package system_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ThinkingSigCheck thinking 签名长度检查的参数。官方签名为数百字符以上的 base64，
+// 长度随思考内容变化；截断或伪造的签名会过短、超出范围或多次探测长度相同
+type ThinkingSigCheck struct {
+	// 短于该长度的签名记为 short（截断）
+	ShortThreshold int `json:"short_threshold"`
+	// 官方签名的预期长度范围（字符），超出时记为异常
+	ExpectedMin int `json:"expected_min"`
+	ExpectedMax int `json:"expected_max"`
+	// thorough 预设的 thinking 探测次数，至少 2 次才能比较签名长度分布
+	ThoroughRounds int `json:"thorough_rounds"`
+}
+
+// DefaultThinkingSigCheck 内置的签名长度检查参数
+var DefaultThinkingSigCheck = ThinkingSigCheck{
+	ShortThreshold: 100,
+	ExpectedMin:    200,
+	ExpectedMax:    8192,
+	ThoroughRounds: 3,
+}
+
+// thorough 预设 thinking 探测次数的上限
+const maxThinkingSigRounds = 5
+
+// Short 短签名阈值，未配置时使用内置值
+func (c ThinkingSigCheck) Short() int {
+	if c.ShortThreshold <= 0 {
+		return DefaultThinkingSigCheck.ShortThreshold
+	}
+	return c.ShortThreshold
+}
+
+// ExpectedRange 预期长度范围，未配置时使用内置值
+func (c ThinkingSigCheck) ExpectedRange() (int, int) {
+	if c.ExpectedMin <= 0 || c.ExpectedMax <= 0 {
+		return DefaultThinkingSigCheck.ExpectedMin, DefaultThinkingSigCheck.ExpectedMax
+	}
+	return c.ExpectedMin, c.ExpectedMax
+}
+
+// Rounds thorough 预设的 thinking 探测次数，未配置时使用内置值
+func (c ThinkingSigCheck) Rounds() int {
+	if c.ThoroughRounds <= 0 {
+		return DefaultThinkingSigCheck.ThoroughRounds
+	}
+	return min(c.ThoroughRounds, maxThinkingSigRounds)
+}
+
+// Validate 校验阈值为正、短签名阈值不超过预期下限、预期范围有效且探测次数在 1 到上限之间
+func (c ThinkingSigCheck) Validate() error {
+	if c.ShortThreshold < 1 {
+		return fmt.Errorf("短签名阈值须大于 0")
+	}
+	if c.ExpectedMin < c.ShortThreshold || c.ExpectedMax <= c.ExpectedMin {
+		return fmt.Errorf("签名预期长度范围无效，须满足 短签名阈值 <= 下限 < 上限")
+	}
+	if c.ThoroughRounds < 1 || c.ThoroughRounds > maxThinkingSigRounds {
+		return fmt.Errorf("thinking 探测次数须在 1 到 %d 之间", maxThinkingSigRounds)
+	}
+	return nil
+}
+
+// ParseThinkingSigCheck 以 base 为基础解析签名长度检查 JSON（未出现的字段保持 base 的值）并校验
+func ParseThinkingSigCheck(jsonStr string, base ThinkingSigCheck) (ThinkingSigCheck, error) {
+	check := base
+	if err := common.UnmarshalJsonStr(jsonStr, &check); err != nil {
+		return base, fmt.Errorf("签名长度检查配置格式错误：%s", err.Error())
+	}
+	if err := check.Validate(); err != nil {
+		return base, err
+	}
+	return check, nil
+}
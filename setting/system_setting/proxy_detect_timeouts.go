@@ -0,0 +1,105 @@
+package system_setting
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// DetectTimeouts 中转检测各阶段的超时（秒），内网可调短，慢速链路可调长
+type DetectTimeouts struct {
+	// 单模型检测（该模型全部探测）的总超时
+	SingleDetectSeconds int `json:"single_detect_seconds"`
+	// 多模型扫描的总超时
+	MultiScanSeconds int `json:"multi_scan_seconds"`
+	// 多模型扫描中每个模型（可用性检查 + 检测）的时间预算
+	MultiScanModelSeconds int `json:"multi_scan_model_seconds"`
+	// 单个探测请求的超时
+	ProbeSeconds int `json:"probe_seconds"`
+	// 模型可用性检查的超时
+	AvailCheckSeconds int `json:"avail_check_seconds"`
+}
+
+// DefaultDetectTimeouts 内置的检测超时
+var DefaultDetectTimeouts = DetectTimeouts{
+	SingleDetectSeconds:   120,
+	MultiScanSeconds:      300,
+	MultiScanModelSeconds: 150,
+	ProbeSeconds:          60,
+	AvailCheckSeconds:     20,
+}
+
+// 各超时允许的取值范围（秒）
+var detectTimeoutRanges = map[string][2]int{
+	"single_detect_seconds":    {10, 900},
+	"multi_scan_seconds":       {30, 1800},
+	"multi_scan_model_seconds": {10, 900},
+	"probe_seconds":            {5, 300},
+	"avail_check_seconds":      {5, 120},
+}
+
+// SingleDetect 单模型检测总超时，未配置时使用内置值
+func (t DetectTimeouts) SingleDetect() time.Duration {
+	return timeoutOrDefault(t.SingleDetectSeconds, DefaultDetectTimeouts.SingleDetectSeconds)
+}
+
+// MultiScan 多模型扫描总超时，未配置时使用内置值
+func (t DetectTimeouts) MultiScan() time.Duration {
+	return timeoutOrDefault(t.MultiScanSeconds, DefaultDetectTimeouts.MultiScanSeconds)
+}
+
+// MultiScanModel 多模型扫描中每个模型的时间预算，未配置时使用内置值
+func (t DetectTimeouts) MultiScanModel() time.Duration {
+	return timeoutOrDefault(t.MultiScanModelSeconds, DefaultDetectTimeouts.MultiScanModelSeconds)
+}
+
+// Probe 单个探测请求超时，未配置时使用内置值
+func (t DetectTimeouts) Probe() time.Duration {
+	return timeoutOrDefault(t.ProbeSeconds, DefaultDetectTimeouts.ProbeSeconds)
+}
+
+// AvailCheck 模型可用性检查超时，未配置时使用内置值
+func (t DetectTimeouts) AvailCheck() time.Duration {
+	return timeoutOrDefault(t.AvailCheckSeconds, DefaultDetectTimeouts.AvailCheckSeconds)
+}
+
+func timeoutOrDefault(seconds, fallback int) time.Duration {
+	if seconds <= 0 {
+		seconds = fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Validate 校验各超时在允许范围内，且单个探测不超过单模型检测、单模型预算不超过扫描总超时
+func (t DetectTimeouts) Validate() error {
+	v := reflect.ValueOf(t)
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		bounds := detectTimeoutRanges[name]
+		if seconds := int(v.Field(i).Int()); seconds < bounds[0] || seconds > bounds[1] {
+			return fmt.Errorf("超时 %s 须在 %d-%d 秒之间", name, bounds[0], bounds[1])
+		}
+	}
+	if t.ProbeSeconds > t.SingleDetectSeconds {
+		return fmt.Errorf("单个探测超时不能大于单模型检测超时")
+	}
+	if t.MultiScanModelSeconds > t.MultiScanSeconds {
+		return fmt.Errorf("每个模型的时间预算不能大于多模型扫描总超时")
+	}
+	return nil
+}
+
+// ParseDetectTimeouts 以 base 为基础解析超时 JSON（未出现的字段保持 base 的值）并校验，超时必须为整数秒
+func ParseDetectTimeouts(jsonStr string, base DetectTimeouts) (DetectTimeouts, error) {
+	timeouts := base
+	if err := common.UnmarshalJsonStr(jsonStr, &timeouts); err != nil {
+		return base, fmt.Errorf("超时配置格式错误：%s", err.Error())
+	}
+	if err := timeouts.Validate(); err != nil {
+		return base, err
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,194 @@
+package system_setting
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ScoringWeights 中转检测各信号的计分权重，均为非负整数；扣分项填写扣除的分值
+type ScoringWeights struct {
+	// tool_use id 前缀：toolu_ / tooluse_ / tool_N
+	ToolIDAnthropic int `json:"tool_id_anthropic"`
+	ToolIDBedrock   int `json:"tool_id_bedrock"`
+	ToolIDVertex    int `json:"tool_id_vertex"`
+	// thinking 签名带 claude# 前缀（Vertex AI）
+	ThinkingSigVertex int `json:"thinking_sig_vertex"`
+	// message id：msg_<base62> / req_vrtx_
+	MsgIDAnthropic int `json:"msg_id_anthropic"`
+	MsgIDVertex    int `json:"msg_id_vertex"`
+	// model 字段：kiro-* / anthropic.*
+	ModelKiro    int `json:"model_kiro"`
+	ModelBedrock int `json:"model_bedrock"`
+	// Anthropic 独有的 usage 字段
+	ServiceTier   int `json:"service_tier"`
+	InferenceGeo  int `json:"inference_geo"`
+	CacheCreation int `json:"cache_creation"`
+	// camelCase usage（Bedrock）
+	UsageCamelCase int `json:"usage_camel_case"`
+	// AWS 响应头 / Anthropic 限流响应头
+	AWSHeaders       int `json:"aws_headers"`
+	AnthropicHeaders int `json:"anthropic_headers"`
+	// SSE 事件序列符合官方格式且含 ping
+	StreamCanonical int `json:"stream_canonical"`
+	// Gemini 原生字段：usageMetadata 对象、promptTokenCount 等计数键、finishReason 取值、缺失 stop_reason
+	GeminiUsageMetadata  int `json:"gemini_usage_metadata"`
+	GeminiTokenCountKeys int `json:"gemini_token_count_keys"`
+	GeminiFinishReason   int `json:"gemini_finish_reason"`
+	GeminiNoStopReason   int `json:"gemini_no_stop_reason"`
+	// 无效 anthropic-version 返回官方 invalid_request_error
+	VersionErrorAnthropic int `json:"version_error_anthropic"`
+	// 请求 service_tier=priority 返回官方 invalid_request_error
+	ServiceTierRejectedAnthropic int `json:"service_tier_rejected_anthropic"`
+	// 返回 HTTP 529 且错误体与官方 overloaded_error 完全一致（含重试中遇到的，计一次）
+	OverloadedAnthropic int `json:"overloaded_anthropic"`
+	// 429 后按 Retry-After 等待重试成功（计一次）
+	RetryAfterHonored int `json:"retry_after_honored"`
+	// 仅接受 x-api-key 认证、拒绝 Bearer
+	XAPIKeyOnly int `json:"x_api_key_only"`
+	// stop_reason 为 OpenAI 取值（stop / length / tool_calls 等，计入 openai 桶，计一次）
+	StopReasonOpenAI int `json:"stop_reason_openai"`
+	// 重复发送带 cache_control 的长前缀后计费了 cache_read_input_tokens
+	CacheReadObserved int `json:"cache_read_observed"`
+	// usage 键顺序符合 Anthropic / Vertex / Bedrock 的序列化顺序（计一次）
+	UsageKeysAnthropic int `json:"usage_keys_anthropic"`
+	UsageKeysVertex    int `json:"usage_keys_vertex"`
+	UsageKeysBedrock   int `json:"usage_keys_bedrock"`
+	// 响应头 request-id 为 Anthropic 的 req_ 格式，且与 msg_ 消息 ID 相符（计一次）
+	RequestIDAnthropic int `json:"request_id_anthropic"`
+
+	// 以下为 Anthropic 得分的扣分项
+	// 请求流式却返回非流式 JSON
+	StreamNotSSEPenalty int `json:"stream_not_sse_penalty"`
+	// system 参数未生效
+	SystemIgnoredPenalty int `json:"system_ignored_penalty"`
+	// usage 数值自相矛盾 / 含非官方字段（各扣一次）
+	UsageInconsistentPenalty int `json:"usage_inconsistent_penalty"`
+	UsageInjectedPenalty     int `json:"usage_injected_penalty"`
+	// stop_reason 非官方取值（扣一次）
+	StopReasonPenalty int `json:"stop_reason_penalty"`
+	// 停止序列泄漏到输出中
+	StopSequenceLeakedPenalty int `json:"stop_sequence_leaked_penalty"`
+	// 响应头名称大小写被改写（扣一次）
+	HeaderRecasedPenalty int `json:"header_recased_penalty"`
+	// 官方必有字段缺失
+	MissingInferenceGeoPenalty  int `json:"missing_inference_geo_penalty"`
+	MissingCacheCreationPenalty int `json:"missing_cache_creation_penalty"`
+	MissingThinkingSigPenalty   int `json:"missing_thinking_sig_penalty"`
+	// msg id 跨轮重复
+	DuplicateMsgIDPenalty int `json:"duplicate_msg_id_penalty"`
+	// tool_use id 跨轮重复（扣一次）
+	DuplicateToolIDPenalty int `json:"duplicate_tool_id_penalty"`
+	// 各轮回显的 model 或其来源分类不一致，疑似轮询多个后端（扣一次）
+	InconsistentBackendPenalty int `json:"inconsistent_backend_penalty"`
+	// 非流式响应均未压缩且带固定 Content-Length（扣一次）
+	ReserializedBodyPenalty int `json:"reserialized_body_penalty"`
+	// TLS 探测均只协商到 HTTP/1.1（官方为 HTTP/2，CDN 各异，极弱信号，扣一次）
+	HTTP1OnlyPenalty int `json:"http1_only_penalty"`
+	// 响应头 Date 与本地时间偏差超过 30 秒（弱信号，扣一次）
+	ClockSkewPenalty int `json:"clock_skew_penalty"`
+	// 多次 thinking 探测的签名长度完全相同，疑似固定签名（扣一次）
+	ThinkingSigConstantPenalty int `json:"thinking_sig_constant_penalty"`
+	// 多次 thinking 探测的签名长度都恰好略低于同一个整数（100 或 128 的倍数），疑似截断（扣一次）
+	ThinkingSigTruncatedPenalty int `json:"thinking_sig_truncated_penalty"`
+	// 签名长度超出预期范围（扣一次）
+	ThinkingSigOutOfRangePenalty int `json:"thinking_sig_out_of_range_penalty"`
+	// 上游接受了无效 anthropic-version
+	VersionAcceptedPenalty int `json:"version_accepted_penalty"`
+	// 上游接受了官方不支持的 service_tier=priority（忽略或回显）
+	ServiceTierAcceptedPenalty int `json:"service_tier_accepted_penalty"`
+	// usage.service_tier 不是 standard / priority / batch（扣一次）
+	ServiceTierUnknownPenalty int `json:"service_tier_unknown_penalty"`
+	// 上游接受 Authorization: Bearer 认证（官方仅支持 x-api-key）
+	BearerAcceptedPenalty int `json:"bearer_accepted_penalty"`
+	// usage 键按字母排序或缺少缓存计数，疑似中转重建（扣一次）
+	UsageKeysReconstructedPenalty int `json:"usage_keys_reconstructed_penalty"`
+	// 消息 ID 为 Anthropic 格式，但响应头 request-id 缺失或被改写（计一次）
+	RequestIDRewrittenPenalty int `json:"request_id_rewritten_penalty"`
+}
+
+// DefaultScoringWeights 内置的计分权重
+var DefaultScoringWeights = ScoringWeights{
+	ToolIDAnthropic:              5,
+	ToolIDBedrock:                5,
+	ToolIDVertex:                 5,
+	ThinkingSigVertex:            5,
+	MsgIDAnthropic:               2,
+	MsgIDVertex:                  6,
+	ModelKiro:                    8,
+	ModelBedrock:                 3,
+	ServiceTier:                  3,
+	InferenceGeo:                 2,
+	CacheCreation:                1,
+	UsageCamelCase:               2,
+	AWSHeaders:                   3,
+	AnthropicHeaders:             2,
+	StreamCanonical:              1,
+	GeminiUsageMetadata:          5,
+	GeminiTokenCountKeys:         3,
+	GeminiFinishReason:           2,
+	GeminiNoStopReason:           1,
+	VersionErrorAnthropic:        2,
+	ServiceTierRejectedAnthropic: 2,
+	OverloadedAnthropic:          5,
+	RetryAfterHonored:            1,
+	XAPIKeyOnly:                  2,
+	StopReasonOpenAI:             4,
+	CacheReadObserved:            4,
+	UsageKeysAnthropic:           2,
+	UsageKeysVertex:              2,
+	UsageKeysBedrock:             2,
+	RequestIDAnthropic:           2,
+
+	StreamNotSSEPenalty:           2,
+	SystemIgnoredPenalty:          1,
+	UsageInconsistentPenalty:      2,
+	UsageInjectedPenalty:          1,
+	StopReasonPenalty:             2,
+	StopSequenceLeakedPenalty:     2,
+	HeaderRecasedPenalty:          1,
+	MissingInferenceGeoPenalty:    3,
+	MissingCacheCreationPenalty:   2,
+	MissingThinkingSigPenalty:     3,
+	DuplicateMsgIDPenalty:         3,
+	DuplicateToolIDPenalty:        4,
+	InconsistentBackendPenalty:    3,
+	ReserializedBodyPenalty:       1,
+	HTTP1OnlyPenalty:              1,
+	ClockSkewPenalty:              1,
+	ThinkingSigConstantPenalty:    2,
+	ThinkingSigTruncatedPenalty:   3,
+	ThinkingSigOutOfRangePenalty:  1,
+	VersionAcceptedPenalty:        1,
+	ServiceTierAcceptedPenalty:    2,
+	ServiceTierUnknownPenalty:     2,
+	BearerAcceptedPenalty:         3,
+	UsageKeysReconstructedPenalty: 1,
+	RequestIDRewrittenPenalty:     1,
+}
+
+// Validate 校验所有权重均为非负数
+func (w ScoringWeights) Validate() error {
+	v := reflect.ValueOf(w)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Int() < 0 {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			return fmt.Errorf("计分权重 %s 不能为负数", name)
+		}
+	}
+	return nil
+}
+
+// ParseScoringWeights 以 base 为基础解析计分权重 JSON（未出现的字段保持 base 的值）并校验，权重必须为整数
+func ParseScoringWeights(jsonStr string, base ScoringWeights) (ScoringWeights, error) {
+	weights := base
+	if err := common.UnmarshalJsonStr(jsonStr, &weights); err != nil {
+		return base, fmt.Errorf("计分权重格式错误：%s", err.Error())
+	}
+	if err := weights.Validate(); err != nil {
+		return base, err
+	}
+	return weights, nil
+}
@@ -147,6 +147,18 @@ const renderDuration = (text, record, t) => {
 };
 
 const renderEnabled = (text, record, t) => {
+  if (record?.plan?.deleted_at) {
+    return (
+      <Tag
+        color='white'
+        shape='circle'
+        type='light'
+        prefixIcon={<Badge dot type='tertiary' />}
+      >
+        {t('已删除')}
+      </Tag>
+    );
+  }
   return text ? (
     <Tag
       color='white'
@@ -228,9 +240,46 @@ const renderPaymentConfig = (text, record, t, enableEpay) => {
   );
 };
 
-const renderOperations = (text, record, { openEdit, setPlanEnabled, t }) => {
+const renderOperations = (
+  text,
+  record,
+  { openEdit, setPlanEnabled, deletePlan, restorePlan, t },
+) => {
   const isEnabled = record?.plan?.enabled;
 
+  if (record?.plan?.deleted_at) {
+    return (
+      <Button
+        theme='light'
+        type='primary'
+        size='small'
+        onClick={() =>
+          Modal.confirm({
+            title: t('确认恢复'),
+            content: t(
+              '恢复后套餐将重新出现在列表中，启用状态保持不变。是否继续？',
+            ),
+            centered: true,
+            onOk: () => restorePlan(record),
+          })
+        }
+      >
+        {t('恢复')}
+      </Button>
+    );
+  }
+
+  const handleDelete = () => {
+    Modal.confirm({
+      title: t('确认删除'),
+      content: t(
+        '删除后套餐不再展示且无法购买，已有订阅不受影响，可随时恢复。是否继续？',
+      ),
+      centered: true,
+      onOk: () => deletePlan(record),
+    });
+  };
+
   const handleToggle = () => {
     if (isEnabled) {
       Modal.confirm({
@@ -273,6 +322,9 @@ const renderOperations = (text, record, { openEdit, setPlanEnabled, t }) => {
           {t('启用')}
         </Button>
       )}
+      <Button theme='light' type='danger' size='small' onClick={handleDelete}>
+        {t('删除')}
+      </Button>
     </Space>
   );
 };
@@ -281,6 +333,8 @@ export const getSubscriptionsColumns = ({
   t,
   openEdit,
   setPlanEnabled,
+  deletePlan,
+  restorePlan,
   enableEpay,
 }) => {
   return [
@@ -349,9 +403,15 @@ export const getSubscriptionsColumns = ({
       title: t('操作'),
       dataIndex: 'operate',
       fixed: 'right',
-      width: 160,
+      width: 220,
       render: (text, record) =>
-        renderOperations(text, record, { openEdit, setPlanEnabled, t }),
+        renderOperations(text, record, {
+          openEdit,
+          setPlanEnabled,
+          deletePlan,
+          restorePlan,
+          t,
+        }),
     },
   ];
 };
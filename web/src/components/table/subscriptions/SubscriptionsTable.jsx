@@ -33,6 +33,8 @@ const SubscriptionsTable = (subscriptionsData) => {
     compactMode,
     openEdit,
     setPlanEnabled,
+    deletePlan,
+    restorePlan,
     t,
     enableEpay,
   } = subscriptionsData;
@@ -42,9 +44,11 @@ const SubscriptionsTable = (subscriptionsData) => {
       t,
       openEdit,
       setPlanEnabled,
+      deletePlan,
+      restorePlan,
       enableEpay,
     });
-  }, [t, openEdit, setPlanEnabled, enableEpay]);
+  }, [t, openEdit, setPlanEnabled, deletePlan, restorePlan, enableEpay]);
 
   const tableColumns = useMemo(() => {
     return compactMode
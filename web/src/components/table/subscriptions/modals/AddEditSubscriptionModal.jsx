@@ -94,6 +94,8 @@ const AddEditSubscriptionModal = ({
     purchasable: true,
     sort_order: 0,
     max_purchase_per_user: 0,
+    refundable: false,
+    refundable_days: 0,
     total_amount: 0,
     upgrade_group: '',
     stripe_price_id: '',
@@ -119,6 +121,8 @@ const AddEditSubscriptionModal = ({
       purchasable: p.purchasable !== false,
       sort_order: Number(p.sort_order || 0),
       max_purchase_per_user: Number(p.max_purchase_per_user || 0),
+      refundable: p.refundable === true,
+      refundable_days: Number(p.refundable_days || 0),
       total_amount: Number(
         quotaToDisplayAmount(p.total_amount || 0).toFixed(2),
       ),
@@ -164,6 +168,8 @@ const AddEditSubscriptionModal = ({
               : 0,
           sort_order: Number(values.sort_order || 0),
           max_purchase_per_user: Number(values.max_purchase_per_user || 0),
+          refundable: values.refundable === true,
+          refundable_days: Number(values.refundable_days || 0),
           total_amount: displayAmountToQuota(values.total_amount),
           upgrade_group: values.upgrade_group || '',
         },
@@ -373,6 +379,24 @@ const AddEditSubscriptionModal = ({
                       />
                     </Col>
 
+                    <Col span={12}>
+                      <Form.Switch
+                        field='refundable'
+                        label={t('允许退款')}
+                        size='large'
+                      />
+                    </Col>
+                    <Col span={12}>
+                      <Form.InputNumber
+                        field='refundable_days'
+                        label={t('可退款天数')}
+                        min={0}
+                        precision={0}
+                        extraText={t('0 表示不限')}
+                        style={{ width: '100%' }}
+                      />
+                    </Col>
+
                     <Col span={12}>
                       <Form.Switch
                         field='enabled'
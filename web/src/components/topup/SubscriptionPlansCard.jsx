@@ -498,6 +498,11 @@ const SubscriptionPlansCard = ({
                 const upgradeLabel = plan?.upgrade_group
                   ? `${t('升级分组')}: ${plan.upgrade_group}`
                   : null;
+                const effectiveRatio = p?.effective_group_ratio;
+                const ratioLabel =
+                  effectiveRatio !== undefined && effectiveRatio !== null
+                    ? `${t('分组倍率')}: ${effectiveRatio}x`
+                    : null;
                 const resetLabel =
                   formatSubscriptionResetPeriod(plan, t) === t('不重置')
                     ? null
@@ -515,6 +520,12 @@ const SubscriptionPlansCard = ({
                     : { label: totalLabel },
                   limitLabel ? { label: limitLabel } : null,
                   upgradeLabel ? { label: upgradeLabel } : null,
+                  ratioLabel
+                    ? {
+                        label: ratioLabel,
+                        tooltip: `${t('分组')}：${p?.effective_group}`,
+                      }
+                    : null,
                 ].filter(Boolean);
 
                 return (
@@ -100,6 +100,48 @@ export const useSubscriptionsData = () => {
     }
   };
 
+  // Soft-delete a plan (existing subscriptions keep working)
+  const deletePlan = async (planRecord) => {
+    const planId = planRecord?.plan?.id;
+    if (!planId) return;
+    setLoading(true);
+    try {
+      const res = await API.delete(`/api/subscription/admin/plans/${planId}`);
+      if (res.data?.success) {
+        showSuccess(t('已删除'));
+        await loadPlans();
+      } else {
+        showError(res.data?.message || t('操作失败'));
+      }
+    } catch (e) {
+      showError(t('请求失败'));
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  // Restore a soft-deleted plan
+  const restorePlan = async (planRecord) => {
+    const planId = planRecord?.plan?.id;
+    if (!planId) return;
+    setLoading(true);
+    try {
+      const res = await API.post(
+        `/api/subscription/admin/plans/${planId}/restore`,
+      );
+      if (res.data?.success) {
+        showSuccess(t('已恢复'));
+        await loadPlans();
+      } else {
+        showError(res.data?.message || t('操作失败'));
+      }
+    } catch (e) {
+      showError(t('请求失败'));
+    } finally {
+      setLoading(false);
+    }
+  };
+
   // Modal control functions
   const closeEdit = () => {
     setShowEdit(false);
@@ -155,6 +197,8 @@ export const useSubscriptionsData = () => {
     // Actions
     loadPlans,
     setPlanEnabled,
+    deletePlan,
+    restorePlan,
     refresh,
     closeEdit,
     openCreate,
@@ -26,21 +26,40 @@ const VERDICT_CONFIG = {
   anthropic: { color: 'green', label: 'Anthropic 官方 API' },
   bedrock: { color: 'blue', label: 'AWS Bedrock (Kiro)' },
   antigravity: { color: 'purple', label: 'Google Vertex AI (Antigravity)' },
+  gemini: { color: 'cyan', label: 'Google Gemini (原生 API 转译)' },
+  openai_translation: { color: 'amber', label: 'OpenAI 格式转译' },
+  backend_llm: { color: 'red', label: '非 Claude 模型冒充' },
   suspicious: { color: 'orange', label: '疑似伪装 Anthropic' },
+  proxy: { color: 'red', label: '确认中转平台' },
   unknown: { color: 'grey', label: '无法确定' },
+  invalid_key: { color: 'red', label: 'API Key 无效' },
+  unreachable: { color: 'grey', label: '无法连接上游' },
   unavailable: { color: 'white', label: '不可用' },
+  timeout: { color: 'grey', label: '检测超时' },
+  budget_exhausted: { color: 'grey', label: '探测预算耗尽' },
+};
+
+const unavailableReasonLabels = {
+  auth_error: '鉴权失败',
+  model_not_found: '模型不存在',
+  timeout: '请求超时',
+  network_error: '网络错误',
+  upstream_error: '上游错误',
 };
 
 const ProxyDetector = () => {
-  const { t } = useTranslation();
+  const { t, i18n } = useTranslation();
+  const detectLang = i18n.language?.startsWith('zh') ? 'zh' : 'en';
   const [statusState] = useContext(StatusContext);
   const admin = isAdmin();
 
   const serverAddress = useMemo(() => {
     return statusState?.status?.server_address || window.location.origin;
   }, [statusState]);
+  const maxModels = statusState?.status?.proxy_detect_max_models || 6;
 
   const [baseURL, setBaseURL] = useState('');
+  const [messagesPath, setMessagesPath] = useState('');
   const [apiKey, setApiKey] = useState('');
   const [selectedModels, setSelectedModels] = useState([]);
   const [rounds, setRounds] = useState(2);
@@ -59,7 +78,7 @@ const ProxyDetector = () => {
     }
     setModelsLoading(true);
     try {
-      const res = await API.post('/api/proxy-detect/models', {
+      const res = await API.post(`/api/proxy-detect/models?lang=${detectLang}`, {
         base_url: effectiveBaseURL,
         api_key: apiKey,
       });
@@ -95,12 +114,13 @@ const ProxyDetector = () => {
     setResult(null);
 
     try {
-      const res = await API.post('/api/proxy-detect/detect', {
+      const res = await API.post(`/api/proxy-detect/detect?lang=${detectLang}`, {
         base_url: effectiveBaseURL,
         api_key: apiKey,
-        models: selectedModels.slice(0, 6),
+        models: selectedModels,
         rounds: rounds,
         verify_ratelimit: selectedModels.length === 1 ? verifyRatelimit : false,
+        messages_path: admin ? messagesPath.trim() : '',
       });
       if (res.data.success) {
         setResult(res.data.data);
@@ -123,6 +143,29 @@ const ProxyDetector = () => {
     );
   };
 
+  const renderChannelVerdict = (cv) => {
+    if (!cv) return null;
+    const mixed = cv.verdict.startsWith('mixed-');
+    const verdict = mixed ? cv.verdict.slice('mixed-'.length) : cv.verdict;
+    const distribution = Object.entries(cv.distribution || {})
+      .sort((a, b) => b[1] - a[1])
+      .map(
+        ([v, n]) =>
+          `${t((VERDICT_CONFIG[v] || VERDICT_CONFIG.unknown).label)} ×${n}`,
+      )
+      .join(', ');
+    return (
+      <Space spacing={4}>
+        <Text type='tertiary'>{t('渠道结论')}</Text>
+        {mixed && <Tag color='orange'>{t('混合')}</Tag>}
+        {renderVerdictTag(verdict)}
+        <Text type='tertiary' size='small'>
+          {Math.round(cv.share * 100)}% · {distribution}
+        </Text>
+      </Space>
+    );
+  };
+
   const renderConfidence = (confidence) => {
     const pct = Math.round(confidence * 100);
     let color = 'var(--semi-color-success)';
@@ -146,6 +189,12 @@ const ProxyDetector = () => {
         <Tag color='purple' size='small'>
           Antigravity: {scores.antigravity || 0}
         </Tag>
+        <Tag color='cyan' size='small'>
+          Gemini: {scores.gemini || 0}
+        </Tag>
+        <Tag color='amber' size='small'>
+          OpenAI: {scores.openai || 0}
+        </Tag>
       </Space>
     );
   };
@@ -219,6 +268,16 @@ const ProxyDetector = () => {
     },
   ];
 
+  const renderTokenUsage = (usage) => {
+    if (!usage) return null;
+    return (
+      <Text type={usage.exhausted ? 'warning' : 'secondary'}>
+        {t('探测输出 tokens')}: {usage.output_tokens}
+        {usage.budget > 0 && ` / ${usage.budget}`}
+      </Text>
+    );
+  };
+
   const renderSingleResult = (res) => {
     if (!res) return null;
     return (
@@ -227,7 +286,9 @@ const ProxyDetector = () => {
         <Card
           style={{
             borderLeft: `4px solid var(--semi-color-${
-              res.verdict === 'suspicious'
+              res.verdict === 'proxy'
+                ? 'danger'
+                : res.verdict === 'suspicious'
                 ? 'warning'
                 : res.verdict === 'unknown'
                   ? 'text-3'
@@ -255,11 +316,15 @@ const ProxyDetector = () => {
               {res.model && (
                 <Text type='secondary'>
                   {t('模型')}: {res.model}
+                  {res.model_requested &&
+                    ` (${t('别名')}: ${res.model_requested})`}
                 </Text>
               )}
               {res.avg_latency_ms > 0 && (
                 <Text type='secondary'>
                   {t('平均延迟')}: {res.avg_latency_ms}ms
+                  {res.latency_stats?.count > 1 &&
+                    ` (p50 ${res.latency_stats.p50_ms}ms / p90 ${res.latency_stats.p90_ms}ms)`}
                 </Text>
               )}
               {res.proxy_platform && (
@@ -267,6 +332,7 @@ const ProxyDetector = () => {
                   {t('中转平台')}: {res.proxy_platform}
                 </Text>
               )}
+              {renderTokenUsage(res.token_usage)}
             </div>
             {res.platform_clues && res.platform_clues.length > 0 && (
               <div className='flex items-center gap-2 flex-wrap'>
@@ -375,14 +441,28 @@ const ProxyDetector = () => {
         title: t('判定'),
         dataIndex: 'verdict',
         width: 220,
-        render: (text) => renderVerdictTag(text),
+        render: (text, record) => (
+          <Space spacing={4}>
+            {renderVerdictTag(text)}
+            {record.unavailable_reason && (
+              <Text type='tertiary' size='small'>
+                {t(
+                  unavailableReasonLabels[record.unavailable_reason] ||
+                    record.unavailable_reason,
+                )}
+              </Text>
+            )}
+          </Space>
+        ),
       },
       {
         title: t('置信度'),
         dataIndex: 'confidence',
         width: 100,
         render: (val, record) =>
-          record.verdict === 'unavailable' ? (
+          ['unavailable', 'timeout', 'budget_exhausted'].includes(
+            record.verdict,
+          ) ? (
             <Text type='tertiary'>-</Text>
           ) : (
             renderConfidence(val)
@@ -409,9 +489,27 @@ const ProxyDetector = () => {
             description={t('检测到混合渠道：不同模型路由到不同后端')}
           />
         )}
+        {scan.verdict === 'invalid_key' && (
+          <Banner
+            type='danger'
+            description={t('API Key 被上游拒绝，扫描已提前终止')}
+          />
+        )}
+        {scan.unscanned_models?.length > 0 &&
+          scan.verdict !== 'invalid_key' && (
+            <Banner
+              type='warning'
+              description={t('扫描超时，以下模型未检测：{{models}}', {
+                models: scan.unscanned_models.join(', '),
+              })}
+            />
+          )}
 
         {/* Summary Table */}
-        <Card title={t('扫描总览')}>
+        <Card
+          title={t('扫描总览')}
+          headerExtraContent={renderChannelVerdict(scan.channel_verdict)}
+        >
             <Table
               columns={summaryColumns}
               dataSource={scan.model_results}
@@ -419,6 +517,9 @@ const ProxyDetector = () => {
               size='small'
               rowKey={(record) => record.model}
             />
+            {scan.token_usage && (
+              <div className='mt-2'>{renderTokenUsage(scan.token_usage)}</div>
+            )}
           </Card>
 
         {/* Per-model Details */}
@@ -557,6 +658,18 @@ const ProxyDetector = () => {
               )}
             </Form.Slot>
 
+            {/* Messages path (admin only) */}
+            {admin && (
+              <Form.Slot label={t('Messages 路径')}>
+                <Input
+                  value={messagesPath}
+                  onChange={setMessagesPath}
+                  placeholder='/v1/messages'
+                  style={{ width: '100%' }}
+                />
+              </Form.Slot>
+            )}
+
             {/* API Key */}
             <Form.Slot label='API Key'>
               <Input
@@ -575,7 +688,9 @@ const ProxyDetector = () => {
                   key={claudeModels.join(',')}
                   multiple
                   value={selectedModels}
-                  onChange={(val) => setSelectedModels((val || []).slice(0, 6))}
+                  onChange={(val) =>
+                    setSelectedModels((val || []).slice(0, maxModels))
+                  }
                   style={{ flex: 1 }}
                   optionList={claudeModels.map((m) => ({
                     value: m,
@@ -0,0 +1,160 @@
+/*
+Copyright (C) 2025 QuantumNous
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as
+published by the Free Software Foundation, either version 3 of the
+License, or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+For commercial licensing, please contact support@quantumnous.com
+*/
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Form, Row, Col, Spin } from '@douyinfe/semi-ui';
+import { API, showError, showSuccess, toBoolean } from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsSubscriptionWebhook(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'subscription_webhook_setting.enabled': false,
+    'subscription_webhook_setting.url': '',
+    'subscription_webhook_setting.secret': '',
+    'subscription_webhook_setting.max_retries': 3,
+  });
+  const formApiRef = useRef(null);
+
+  useEffect(() => {
+    if (props.options && formApiRef.current) {
+      const currentInputs = {
+        'subscription_webhook_setting.enabled': toBoolean(
+          props.options['subscription_webhook_setting.enabled'],
+        ),
+        'subscription_webhook_setting.url':
+          props.options['subscription_webhook_setting.url'] || '',
+        'subscription_webhook_setting.secret': '',
+        'subscription_webhook_setting.max_retries':
+          props.options['subscription_webhook_setting.max_retries'] !==
+          undefined
+            ? parseInt(
+                props.options['subscription_webhook_setting.max_retries'],
+              )
+            : 3,
+      };
+      setInputs(currentInputs);
+      formApiRef.current.setValues(currentInputs);
+    }
+  }, [props.options]);
+
+  const handleFormChange = (values) => {
+    setInputs(values);
+  };
+
+  const submitWebhookSetting = async () => {
+    setLoading(true);
+    try {
+      const options = [
+        {
+          key: 'subscription_webhook_setting.enabled',
+          value: inputs['subscription_webhook_setting.enabled']
+            ? 'true'
+            : 'false',
+        },
+        {
+          key: 'subscription_webhook_setting.url',
+          value: inputs['subscription_webhook_setting.url'] || '',
+        },
+        {
+          key: 'subscription_webhook_setting.max_retries',
+          value: String(
+            inputs['subscription_webhook_setting.max_retries'] ?? 3,
+          ),
+        },
+      ];
+      // 密钥不回显，仅在填写时更新
+      if (inputs['subscription_webhook_setting.secret']) {
+        options.push({
+          key: 'subscription_webhook_setting.secret',
+          value: inputs['subscription_webhook_setting.secret'],
+        });
+      }
+
+      const results = await Promise.all(
+        options.map((opt) => API.put('/api/option/', opt)),
+      );
+      const errorResults = results.filter((res) => !res.data.success);
+      if (errorResults.length > 0) {
+        errorResults.forEach((res) => {
+          showError(res.data.message);
+        });
+      } else {
+        showSuccess(t('更新成功'));
+        props.refresh?.();
+      }
+    } catch (error) {
+      showError(t('更新失败'));
+    }
+    setLoading(false);
+  };
+
+  return (
+    <Spin spinning={loading}>
+      <Form
+        initValues={inputs}
+        onValueChange={handleFormChange}
+        getFormApi={(api) => (formApiRef.current = api)}
+      >
+        <Form.Section text={t('订阅购买 Webhook')}>
+          <Row gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}>
+            <Col xs={24} sm={24} md={4} lg={4} xl={4}>
+              <Form.Switch
+                field='subscription_webhook_setting.enabled'
+                size='default'
+                checkedText='｜'
+                uncheckedText='〇'
+                label={t('启用')}
+              />
+            </Col>
+            <Col xs={24} sm={24} md={10} lg={10} xl={10}>
+              <Form.Input
+                field='subscription_webhook_setting.url'
+                label={t('Webhook 地址')}
+                placeholder={'https://example.com/fulfillment'}
+                extraText={t(
+                  '用户购买或管理员绑定订阅后推送 subscription.created 事件，受 SSRF 防护设置约束',
+                )}
+              />
+            </Col>
+            <Col xs={24} sm={24} md={6} lg={6} xl={6}>
+              <Form.Input
+                field='subscription_webhook_setting.secret'
+                label={t('Webhook 签名密钥')}
+                placeholder={t('用于 X-Webhook-Signature 签名，敏感信息不显示')}
+                type='password'
+              />
+            </Col>
+            <Col xs={24} sm={24} md={4} lg={4} xl={4}>
+              <Form.InputNumber
+                field='subscription_webhook_setting.max_retries'
+                label={t('失败重试次数')}
+                min={0}
+                max={10}
+              />
+            </Col>
+          </Row>
+          <Button onClick={submitWebhookSetting}>
+            {t('更新订阅 Webhook 设置')}
+          </Button>
+        </Form.Section>
+      </Form>
+    </Spin>
+  );
+}